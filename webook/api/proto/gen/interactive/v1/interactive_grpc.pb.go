@@ -19,12 +19,14 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	InteractiveService_IncrReadCnt_FullMethodName = "/interactive.v1.InteractiveService/IncrReadCnt"
-	InteractiveService_Like_FullMethodName        = "/interactive.v1.InteractiveService/Like"
-	InteractiveService_CancelLike_FullMethodName  = "/interactive.v1.InteractiveService/CancelLike"
-	InteractiveService_Collect_FullMethodName     = "/interactive.v1.InteractiveService/Collect"
-	InteractiveService_Get_FullMethodName         = "/interactive.v1.InteractiveService/Get"
-	InteractiveService_GetByIds_FullMethodName    = "/interactive.v1.InteractiveService/GetByIds"
+	InteractiveService_IncrReadCnt_FullMethodName  = "/interactive.v1.InteractiveService/IncrReadCnt"
+	InteractiveService_Like_FullMethodName         = "/interactive.v1.InteractiveService/Like"
+	InteractiveService_CancelLike_FullMethodName   = "/interactive.v1.InteractiveService/CancelLike"
+	InteractiveService_Collect_FullMethodName      = "/interactive.v1.InteractiveService/Collect"
+	InteractiveService_Get_FullMethodName          = "/interactive.v1.InteractiveService/Get"
+	InteractiveService_GetByIds_FullMethodName     = "/interactive.v1.InteractiveService/GetByIds"
+	InteractiveService_LikeTop_FullMethodName      = "/interactive.v1.InteractiveService/LikeTop"
+	InteractiveService_GetSnapshots_FullMethodName = "/interactive.v1.InteractiveService/GetSnapshots"
 )
 
 // InteractiveServiceClient is the client API for InteractiveService service.
@@ -37,6 +39,8 @@ type InteractiveServiceClient interface {
 	Collect(ctx context.Context, in *CollectRequest, opts ...grpc.CallOption) (*CollectResponse, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	GetByIds(ctx context.Context, in *GetByIdsRequest, opts ...grpc.CallOption) (*GetByIdsResponse, error)
+	LikeTop(ctx context.Context, in *LikeTopRequest, opts ...grpc.CallOption) (*LikeTopResponse, error)
+	GetSnapshots(ctx context.Context, in *GetSnapshotsRequest, opts ...grpc.CallOption) (*GetSnapshotsResponse, error)
 }
 
 type interactiveServiceClient struct {
@@ -101,6 +105,24 @@ func (c *interactiveServiceClient) GetByIds(ctx context.Context, in *GetByIdsReq
 	return out, nil
 }
 
+func (c *interactiveServiceClient) LikeTop(ctx context.Context, in *LikeTopRequest, opts ...grpc.CallOption) (*LikeTopResponse, error) {
+	out := new(LikeTopResponse)
+	err := c.cc.Invoke(ctx, InteractiveService_LikeTop_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *interactiveServiceClient) GetSnapshots(ctx context.Context, in *GetSnapshotsRequest, opts ...grpc.CallOption) (*GetSnapshotsResponse, error) {
+	out := new(GetSnapshotsResponse)
+	err := c.cc.Invoke(ctx, InteractiveService_GetSnapshots_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // InteractiveServiceServer is the server API for InteractiveService service.
 // All implementations must embed UnimplementedInteractiveServiceServer
 // for forward compatibility
@@ -111,6 +133,8 @@ type InteractiveServiceServer interface {
 	Collect(context.Context, *CollectRequest) (*CollectResponse, error)
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	GetByIds(context.Context, *GetByIdsRequest) (*GetByIdsResponse, error)
+	LikeTop(context.Context, *LikeTopRequest) (*LikeTopResponse, error)
+	GetSnapshots(context.Context, *GetSnapshotsRequest) (*GetSnapshotsResponse, error)
 	mustEmbedUnimplementedInteractiveServiceServer()
 }
 
@@ -136,6 +160,12 @@ func (UnimplementedInteractiveServiceServer) Get(context.Context, *GetRequest) (
 func (UnimplementedInteractiveServiceServer) GetByIds(context.Context, *GetByIdsRequest) (*GetByIdsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetByIds not implemented")
 }
+func (UnimplementedInteractiveServiceServer) LikeTop(context.Context, *LikeTopRequest) (*LikeTopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LikeTop not implemented")
+}
+func (UnimplementedInteractiveServiceServer) GetSnapshots(context.Context, *GetSnapshotsRequest) (*GetSnapshotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshots not implemented")
+}
 func (UnimplementedInteractiveServiceServer) mustEmbedUnimplementedInteractiveServiceServer() {}
 
 // UnsafeInteractiveServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -257,6 +287,42 @@ func _InteractiveService_GetByIds_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _InteractiveService_LikeTop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LikeTopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InteractiveServiceServer).LikeTop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InteractiveService_LikeTop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InteractiveServiceServer).LikeTop(ctx, req.(*LikeTopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InteractiveService_GetSnapshots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSnapshotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InteractiveServiceServer).GetSnapshots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InteractiveService_GetSnapshots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InteractiveServiceServer).GetSnapshots(ctx, req.(*GetSnapshotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // InteractiveService_ServiceDesc is the grpc.ServiceDesc for InteractiveService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -288,6 +354,14 @@ var InteractiveService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetByIds",
 			Handler:    _InteractiveService_GetByIds_Handler,
 		},
+		{
+			MethodName: "LikeTop",
+			Handler:    _InteractiveService_LikeTop_Handler,
+		},
+		{
+			MethodName: "GetSnapshots",
+			Handler:    _InteractiveService_GetSnapshots_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "interactive/v1/interactive.pb",
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ranking_snapshots;
+DROP TABLE IF EXISTS ranking_snapshot_items;
\ No newline at end of file
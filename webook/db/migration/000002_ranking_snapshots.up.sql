@@ -0,0 +1,20 @@
+CREATE TABLE `ranking_snapshots`
+(
+    `id`    bigint AUTO_INCREMENT,
+    `name`  varchar(64),
+    `ctime` bigint,
+    PRIMARY KEY (`id`),
+    INDEX   `idx_name_ctime` (`name`, `ctime`)
+);
+
+CREATE TABLE `ranking_snapshot_items`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `snapshot_id` bigint,
+    `article_id`  bigint,
+    `position`    bigint,
+    `score`       double,
+    PRIMARY KEY (`id`),
+    INDEX         `idx_snapshot_article` (`snapshot_id`, `article_id`),
+    INDEX         `idx_article_id` (`article_id`)
+);
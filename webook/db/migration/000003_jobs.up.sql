@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `jobs`
+(
+    `id`              bigint AUTO_INCREMENT,
+    `name`            varchar(128),
+    `executor`        longtext,
+    `expression`      longtext,
+    `config`          longtext,
+    `status`          bigint,
+    `version`         bigint,
+    `next_time`       bigint,
+    `trigger_time`    bigint DEFAULT 0,
+    `last_start_time` bigint DEFAULT 0,
+    `last_end_time`   bigint DEFAULT 0,
+    `last_status`     tinyint unsigned DEFAULT 0,
+    `last_error`      varchar(1024),
+    `update_time`     bigint,
+    `create_time`     bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uni_jobs_name` (`name`),
+    INDEX `idx_jobs_next_time` (`next_time`),
+    INDEX `idx_jobs_trigger_time` (`trigger_time`)
+);
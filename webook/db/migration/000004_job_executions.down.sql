@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_executions;
+ALTER TABLE `jobs`
+    DROP COLUMN `attempt`;
@@ -0,0 +1,18 @@
+ALTER TABLE `jobs`
+    ADD COLUMN `attempt` bigint DEFAULT 0;
+
+CREATE TABLE `job_executions`
+(
+    `id`         bigint AUTO_INCREMENT,
+    `job_id`     bigint,
+    `job_name`   varchar(128),
+    `node`       varchar(128),
+    `attempt`    bigint,
+    `start_time` bigint,
+    `end_time`   bigint DEFAULT 0,
+    `status`     tinyint unsigned,
+    `error`      varchar(1024),
+    PRIMARY KEY (`id`),
+    INDEX `idx_job_start` (`job_id`, `start_time`),
+    INDEX `idx_status_start` (`status`, `start_time`)
+);
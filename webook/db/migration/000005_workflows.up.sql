@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS `workflows`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `name`        varchar(128),
+    `expression`  longtext,
+    `steps`       text,
+    `status`      bigint,
+    `version`     bigint,
+    `next_time`   bigint,
+    `update_time` bigint,
+    `create_time` bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uni_workflows_name` (`name`),
+    INDEX `idx_workflows_next_time` (`next_time`)
+);
+
+CREATE TABLE IF NOT EXISTS `workflow_runs`
+(
+    `id`            bigint AUTO_INCREMENT,
+    `workflow_id`   bigint,
+    `workflow_name` longtext,
+    `version`       bigint,
+    `node`          varchar(128),
+    `status`        tinyint unsigned,
+    `start_time`    bigint,
+    `end_time`      bigint,
+    `update_time`   bigint,
+    PRIMARY KEY (`id`),
+    INDEX `idx_workflow_runs_workflow_id` (`workflow_id`),
+    INDEX `idx_status_utime` (`status`, `update_time`)
+);
+
+CREATE TABLE IF NOT EXISTS `workflow_step_runs`
+(
+    `id`         bigint AUTO_INCREMENT,
+    `run_id`     bigint,
+    `job`        varchar(128),
+    `status`     tinyint unsigned,
+    `attempt`    bigint,
+    `start_time` bigint,
+    `end_time`   bigint,
+    `error`      varchar(1024),
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uk_run_job` (`run_id`, `job`)
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS job_nodes;
+DROP TABLE IF EXISTS job_tasks;
+ALTER TABLE `job_executions`
+    DROP COLUMN `task_id`,
+    DROP COLUMN `shard`;
+ALTER TABLE `jobs`
+    DROP COLUMN `mode`,
+    DROP COLUMN `shards`;
@@ -0,0 +1,37 @@
+ALTER TABLE `jobs`
+    ADD COLUMN `mode`   tinyint unsigned DEFAULT 0,
+    ADD COLUMN `shards` bigint DEFAULT 0;
+
+ALTER TABLE `job_executions`
+    ADD COLUMN `task_id` bigint DEFAULT 0,
+    ADD COLUMN `shard`   bigint DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `job_tasks`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `job_id`      bigint,
+    `tick`        bigint,
+    `shard`       bigint,
+    `shards`      bigint,
+    `node`        varchar(128),
+    `status`      tinyint unsigned,
+    `next_time`   bigint,
+    `version`     bigint,
+    `attempt`     bigint,
+    `update_time` bigint,
+    `create_time` bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uk_job_tick_shard` (`job_id`, `tick`, `shard`),
+    INDEX `idx_node_status_next` (`node`, `status`, `next_time`)
+);
+
+CREATE TABLE IF NOT EXISTS `job_nodes`
+(
+    `id`             bigint AUTO_INCREMENT,
+    `name`           varchar(128),
+    `start_time`     bigint,
+    `heartbeat_time` bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uni_job_nodes_name` (`name`),
+    INDEX `idx_job_nodes_heartbeat_time` (`heartbeat_time`)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE `jobs`
+    DROP COLUMN `timezone`,
+    DROP COLUMN `misfire`,
+    DROP COLUMN `max_duration`;
@@ -0,0 +1,4 @@
+ALTER TABLE `jobs`
+    ADD COLUMN `timezone`     varchar(64) DEFAULT '',
+    ADD COLUMN `misfire`      tinyint unsigned DEFAULT 0,
+    ADD COLUMN `max_duration` bigint DEFAULT 0;
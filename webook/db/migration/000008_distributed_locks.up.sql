@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `distributed_locks`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `name`        varchar(255),
+    `owner`       varchar(64),
+    `token`       bigint,
+    `expire_time` bigint,
+    `utime`       bigint,
+    `ctime`       bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uni_distributed_locks_name` (`name`)
+);
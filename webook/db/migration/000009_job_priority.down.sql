@@ -0,0 +1,3 @@
+ALTER TABLE `jobs`
+    DROP INDEX `idx_jobs_priority`,
+    DROP COLUMN `priority`;
@@ -0,0 +1,3 @@
+ALTER TABLE `jobs`
+    ADD COLUMN `priority` bigint DEFAULT 0,
+    ADD INDEX `idx_jobs_priority` (`priority`);
@@ -0,0 +1,3 @@
+ALTER TABLE `ranking_snapshots`
+    DROP INDEX `uk_name_bucket`,
+    DROP COLUMN `bucket`;
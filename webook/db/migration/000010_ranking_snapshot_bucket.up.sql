@@ -0,0 +1,8 @@
+ALTER TABLE `ranking_snapshots`
+    ADD COLUMN `bucket` bigint DEFAULT 0;
+
+UPDATE `ranking_snapshots`
+SET `bucket` = `ctime`;
+
+ALTER TABLE `ranking_snapshots`
+    ADD UNIQUE INDEX `uk_name_bucket` (`name`, `bucket`);
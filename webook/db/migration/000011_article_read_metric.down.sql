@@ -0,0 +1,5 @@
+ALTER TABLE `articles`
+    DROP COLUMN `read_metric`;
+
+ALTER TABLE `published_articles`
+    DROP COLUMN `read_metric`;
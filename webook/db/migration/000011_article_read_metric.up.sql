@@ -0,0 +1,5 @@
+ALTER TABLE `articles`
+    ADD COLUMN `read_metric` varchar(16) DEFAULT '';
+
+ALTER TABLE `published_articles`
+    ADD COLUMN `read_metric` varchar(16) DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE `articles`
+    DROP INDEX `idx_articles_category`,
+    DROP COLUMN `category`,
+    DROP COLUMN `tags`;
+
+ALTER TABLE `published_articles`
+    DROP INDEX `idx_published_articles_category`,
+    DROP COLUMN `category`,
+    DROP COLUMN `tags`;
@@ -0,0 +1,9 @@
+ALTER TABLE `articles`
+    ADD COLUMN `category` varchar(64) DEFAULT '',
+    ADD COLUMN `tags` varchar(512) DEFAULT '',
+    ADD INDEX `idx_articles_category` (`category`);
+
+ALTER TABLE `published_articles`
+    ADD COLUMN `category` varchar(64) DEFAULT '',
+    ADD COLUMN `tags` varchar(512) DEFAULT '',
+    ADD INDEX `idx_published_articles_category` (`category`);
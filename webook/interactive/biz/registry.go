@@ -0,0 +1,110 @@
+package biz
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrUnknownBiz = errors.New("未知的业务类型")
+	// ErrDisabled 业务存在 但是没有开启对应的功能
+	ErrDisabled = errors.New("业务未开启该功能")
+)
+
+// Config 单个业务的互动配置
+type Config struct {
+	Name           string
+	LikeEnabled    bool
+	CollectEnabled bool
+	ReadEnabled    bool
+	// DedupWindow 阅读去重窗口 0 表示不去重
+	DedupWindow time.Duration
+	// Ranking 是否参与点赞排行榜
+	Ranking bool
+}
+
+// Registry 允许使用互动服务的业务
+type Registry interface {
+	// Get 未注册的业务返回 ErrUnknownBiz
+	Get(biz string) (Config, error)
+	// List 所有注册的业务 按名字排序
+	List() []Config
+	// Reload 整体替换注册的业务
+	Reload(cfgs []Config)
+}
+
+// ConfigRegistry
+// 读多写少 每次重新加载都替换整个 map 读的时候不需要加锁
+type ConfigRegistry struct {
+	bizs atomic.Pointer[map[string]Config]
+}
+
+func NewConfigRegistry(cfgs []Config) *ConfigRegistry {
+	r := &ConfigRegistry{}
+	r.Reload(cfgs)
+	return r
+}
+
+func (r *ConfigRegistry) Get(biz string) (Config, error) {
+	cfg, ok := (*r.bizs.Load())[biz]
+	if !ok {
+		return Config{}, ErrUnknownBiz
+	}
+	return cfg, nil
+}
+
+func (r *ConfigRegistry) List() []Config {
+	bizs := *r.bizs.Load()
+	res := make([]Config, 0, len(bizs))
+	for _, cfg := range bizs {
+		res = append(res, cfg)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func (r *ConfigRegistry) Reload(cfgs []Config) {
+	bizs := make(map[string]Config, len(cfgs))
+	for _, cfg := range cfgs {
+		bizs[cfg.Name] = cfg
+	}
+	r.bizs.Store(&bizs)
+}
+
+// Like 业务不存在或者没有开启点赞时返回错误
+func Like(r Registry, biz string) error {
+	return check(r, biz, func(cfg Config) bool { return cfg.LikeEnabled })
+}
+
+func Collect(r Registry, biz string) error {
+	return check(r, biz, func(cfg Config) bool { return cfg.CollectEnabled })
+}
+
+func Read(r Registry, biz string) error {
+	return check(r, biz, func(cfg Config) bool { return cfg.ReadEnabled })
+}
+
+func Ranking(r Registry, biz string) error {
+	return check(r, biz, func(cfg Config) bool { return cfg.Ranking })
+}
+
+// Known 只要求业务已注册
+func Known(r Registry, biz string) error {
+	_, err := r.Get(biz)
+	return err
+}
+
+func check(r Registry, biz string, enabled func(cfg Config) bool) error {
+	cfg, err := r.Get(biz)
+	if err != nil {
+		return err
+	}
+	if !enabled(cfg) {
+		return ErrDisabled
+	}
+	return nil
+}
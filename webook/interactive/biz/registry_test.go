@@ -0,0 +1,36 @@
+package biz
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestConfigRegistry(t *testing.T) {
+	r := NewConfigRegistry([]Config{
+		{
+			Name:        "article",
+			LikeEnabled: true,
+			ReadEnabled: true,
+			DedupWindow: time.Minute,
+			Ranking:     true,
+		},
+	})
+
+	cfg, err := r.Get("article")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.DedupWindow)
+
+	assert.NoError(t, Like(r, "article"))
+	assert.Equal(t, ErrDisabled, Collect(r, "article"))
+	assert.Equal(t, ErrUnknownBiz, Like(r, "video"))
+
+	r.Reload([]Config{{Name: "video"}, {Name: "article"}})
+	assert.Equal(t, []Config{{Name: "article"}, {Name: "video"}}, r.List())
+
+	// 重新加载后旧的配置失效
+	r.Reload([]Config{{Name: "video", CollectEnabled: true}})
+	assert.Equal(t, ErrUnknownBiz, Known(r, "article"))
+	assert.NoError(t, Collect(r, "video"))
+	assert.Equal(t, ErrDisabled, Ranking(r, "video"))
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"reflect"
 	"runtime"
+	"time"
 )
 
 type config struct {
@@ -38,6 +39,32 @@ type config struct {
 		Port     int    `yaml:"port"`
 		Name     string `yaml:"name"`
 	} `yaml:"grpc"`
+
+	// Bizs 允许使用互动服务的业务 修改后会自动重新加载
+	Bizs []BizConfig `yaml:"bizs"`
+
+	// 定时任务在多个实例中只执行一次用的锁
+	DLock struct {
+		TTL time.Duration `yaml:"ttl"`
+	} `yaml:"dlock"`
+
+	Reconcile struct {
+		// 只输出差异报告 不修正缓存
+		DryRun  bool          `yaml:"dryRun"`
+		Spec    string        `yaml:"spec"`
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"reconcile"`
+}
+
+type BizConfig struct {
+	Name    string `yaml:"name"`
+	Like    bool   `yaml:"like"`
+	Collect bool   `yaml:"collect"`
+	Read    bool   `yaml:"read"`
+	// 同一用户重复阅读的去重窗口 0 表示不去重
+	DedupWindow time.Duration `yaml:"dedupWindow"`
+	// 是否参与点赞排行榜
+	Ranking bool `yaml:"ranking"`
 }
 
 func stringToByteSliceHookFunc() mapstructure.DecodeHookFunc {
@@ -74,6 +101,8 @@ func loadConfig(path string) (config *config, err error) {
 		),
 	)
 
+	// 监听变更
+	viper.WatchConfig()
 	err = viper.ReadInConfig()
 	if err != nil {
 		return
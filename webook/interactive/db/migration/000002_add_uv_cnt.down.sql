@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS interactive_daily_uvs;
+ALTER TABLE `interactives` DROP COLUMN `uv_cnt`;
\ No newline at end of file
@@ -0,0 +1,15 @@
+ALTER TABLE `interactives`
+    ADD COLUMN `uv_cnt` bigint NOT NULL DEFAULT 0 AFTER `collect_cnt`;
+
+CREATE TABLE `interactive_daily_uvs`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `biz_id`      bigint,
+    `biz`         varchar(128),
+    `day`         char(8),
+    `uv_cnt`      bigint,
+    `update_time` bigint,
+    `create_time` bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `biz_type_id_day` (`biz_id`, `biz`, `day`)
+);
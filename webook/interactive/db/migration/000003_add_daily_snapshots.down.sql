@@ -0,0 +1 @@
+DROP TABLE IF EXISTS interactive_daily_snapshots;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE `interactive_daily_snapshots`
+(
+    `id`          bigint AUTO_INCREMENT,
+    `biz_id`      bigint,
+    `biz`         varchar(128),
+    `day`         char(8),
+    `read_cnt`    bigint,
+    `like_cnt`    bigint,
+    `collect_cnt` bigint,
+    `update_time` bigint,
+    `create_time` bigint,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `biz_type_id_day` (`biz_id`, `biz`, `day`)
+);
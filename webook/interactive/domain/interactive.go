@@ -8,13 +8,39 @@ type Interactive struct {
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
+	UvCnt      int64
 	Liked      bool
 	Collected  bool
 }
 
+// InteractiveSnapshot 某一天结束时的累计互动数据
+type InteractiveSnapshot struct {
+	Biz        string
+	BizId      int64
+	Day        time.Time
+	ReadCnt    int64
+	LikeCnt    int64
+	CollectCnt int64
+}
+
 type ReadHistory struct {
 	BizId    int64
 	Biz      string
 	Uid      int64
 	ReadTime time.Time
 }
+
+// InteractiveDrift 缓存与数据库中同一个计数的差异
+type InteractiveDrift struct {
+	Biz   string
+	BizId int64
+	// Field 出现差异的计数 read_cnt like_cnt collect_cnt ranking
+	Field  string
+	Cached int64
+	Stored int64
+}
+
+// Delta 缓存需要修正的量
+func (d InteractiveDrift) Delta() int64 {
+	return d.Stored - d.Cached
+}
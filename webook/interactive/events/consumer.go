@@ -2,11 +2,13 @@ package events
 
 import (
 	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
 	"github.com/Anwenya/GeekTime/webook/interactive/domain"
 	"github.com/Anwenya/GeekTime/webook/interactive/repository"
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
 	"github.com/Anwenya/GeekTime/webook/pkg/saramax"
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
 	"time"
 )
 
@@ -14,17 +16,35 @@ type InteractiveReadEventConsumer struct {
 	repo   repository.InteractiveRepository
 	client sarama.Client
 	l      logger.LoggerV1
+
+	// 业务是否开启阅读计数 以及阅读去重的窗口
+	registry biz.Registry
+	// 统计被去重和被计数的阅读 两者的比例就是去重率
+	dedupVector *prometheus.CounterVec
 }
 
 func NewInteractiveReadEventConsumer(
 	repo repository.InteractiveRepository,
 	client sarama.Client,
 	l logger.LoggerV1,
+	registry biz.Registry,
 ) *InteractiveReadEventConsumer {
+	vector := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "GeekTime",
+			Subsystem: "webook_interactive",
+			Name:      "read_dedup",
+			Help:      "统计阅读去重 counted 计数 suppressed 被去重",
+		},
+		[]string{"result"},
+	)
+	prometheus.MustRegister(vector)
 	return &InteractiveReadEventConsumer{
-		repo:   repo,
-		client: client,
-		l:      l,
+		repo:        repo,
+		client:      client,
+		l:           l,
+		registry:    registry,
+		dedupVector: vector,
 	}
 }
 
@@ -38,7 +58,7 @@ func (i *InteractiveReadEventConsumer) Start() error {
 		err := cg.Consume(
 			context.Background(),
 			[]string{TopicReadEvent},
-			saramax.NewHandler[ReadEvent](i.l, i.Consume),
+			saramax.NewHandler[ReadEvent]("interactive_read_event", i.l, i.Consume),
 		)
 		if err != nil {
 			i.l.Error("退出消费", logger.Error(err))
@@ -57,7 +77,7 @@ func (i *InteractiveReadEventConsumer) StartBatch() error {
 		er := cg.Consume(
 			context.Background(),
 			[]string{TopicReadEvent},
-			saramax.NewBatchHandler[ReadEvent](i.l, i.BatchConsume),
+			saramax.NewBatchHandler[ReadEvent]("interactive_read_event_batch", i.l, i.BatchConsume),
 		)
 		if er != nil {
 			i.l.Error("退出消费", logger.Error(er))
@@ -70,26 +90,186 @@ func (i *InteractiveReadEventConsumer) Consume(
 	msg *sarama.ConsumerMessage,
 	event ReadEvent,
 ) error {
+	cfg, ok := i.readConfig(event.BizOrDefault())
+	if !ok {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	return i.repo.IncrReadCnt(ctx, Biz, event.Aid)
+	// 独立访客本身就是去重的 每次阅读都记录
+	i.addReader(ctx, event)
+	if !i.markRead(ctx, event, cfg.DedupWindow) {
+		return nil
+	}
+	err := i.repo.IncrReadCnt(ctx, event.BizOrDefault(), event.Aid)
+	if err != nil {
+		i.unmarkRead(cfg.DedupWindow, []ReadEvent{event})
+	}
+	return err
 }
 
+// BatchConsume 同一批消息可能来自不同的业务 按业务分组处理 每个业务的去重窗口不同
+// 有一个业务失败就返回错误 整批重试时已经计数的阅读会被去重标记挡住
 func (i *InteractiveReadEventConsumer) BatchConsume(
 	msgs []*sarama.ConsumerMessage,
 	events []ReadEvent,
 ) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var bizs []string
+	groups := make(map[string][]ReadEvent)
+	for _, event := range events {
+		b := event.BizOrDefault()
+		if _, ok := groups[b]; !ok {
+			bizs = append(bizs, b)
+		}
+		groups[b] = append(groups[b], event)
+	}
+
+	var err error
+	for _, b := range bizs {
+		er := i.batchConsume(ctx, b, groups[b])
+		if er != nil {
+			err = er
+		}
+	}
+	return err
+}
+
+func (i *InteractiveReadEventConsumer) batchConsume(ctx context.Context, b string, events []ReadEvent) error {
+	cfg, ok := i.readConfig(b)
+	if !ok {
+		return nil
+	}
+	for _, event := range events {
+		i.addReader(ctx, event)
+	}
+
+	events = i.batchMarkRead(ctx, events, cfg.DedupWindow)
+	if len(events) == 0 {
+		return nil
+	}
+
 	bizs := make([]string, 0, len(events))
 	bizIds := make([]int64, 0, len(events))
+	for _, event := range events {
+		bizs = append(bizs, b)
+		bizIds = append(bizIds, event.Aid)
+	}
+	err := i.repo.BatchIncrReadCnt(ctx, bizs, bizIds)
+	if err != nil {
+		i.unmarkRead(cfg.DedupWindow, events)
+	}
+	return err
+}
+
+// readConfig 业务没有注册或者关闭了阅读计数时 直接丢弃消息
+func (i *InteractiveReadEventConsumer) readConfig(b string) (biz.Config, bool) {
+	err := biz.Read(i.registry, b)
+	if err != nil {
+		i.l.Warn("忽略阅读事件", logger.String("biz", b), logger.Error(err))
+		return biz.Config{}, false
+	}
+	cfg, _ := i.registry.Get(b)
+	return cfg, true
+}
+
+// markRead 判断这次阅读是否需要计数 window 为0时不去重
+// redis 异常时宁可多计也不丢数据
+func (i *InteractiveReadEventConsumer) markRead(ctx context.Context, event ReadEvent, window time.Duration) bool {
+	if window <= 0 {
+		i.dedupVector.WithLabelValues("counted").Inc()
+		return true
+	}
+	ok, err := i.repo.MarkRead(ctx, event.BizOrDefault(), event.Aid, event.Uid, window)
+	if err != nil {
+		i.l.Error(
+			"阅读去重失败",
+			logger.Int64("aid", event.Aid),
+			logger.Int64("uid", event.Uid),
+			logger.Error(err),
+		)
+		ok = true
+	}
+	i.observeDedup(ok, 1)
+	return ok
+}
 
+// batchMarkRead 返回需要计数的阅读
+func (i *InteractiveReadEventConsumer) batchMarkRead(ctx context.Context, events []ReadEvent, window time.Duration) []ReadEvent {
+	if window <= 0 {
+		i.dedupVector.WithLabelValues("counted").Add(float64(len(events)))
+		return events
+	}
+
+	bizs := make([]string, 0, len(events))
+	bizIds := make([]int64, 0, len(events))
+	uids := make([]int64, 0, len(events))
 	for _, event := range events {
-		bizs = append(bizs, Biz)
+		bizs = append(bizs, event.BizOrDefault())
 		bizIds = append(bizIds, event.Aid)
+		uids = append(uids, event.Uid)
+	}
+	oks, err := i.repo.BatchMarkRead(ctx, bizs, bizIds, uids, window)
+	if err != nil {
+		i.l.Error("批量阅读去重失败", logger.Error(err))
+		i.dedupVector.WithLabelValues("counted").Add(float64(len(events)))
+		return events
 	}
 
+	res := make([]ReadEvent, 0, len(events))
+	for idx, ok := range oks {
+		if ok {
+			res = append(res, events[idx])
+		}
+	}
+	i.observeDedup(true, len(res))
+	i.observeDedup(false, len(events)-len(res))
+	return res
+}
+
+// unmarkRead 计数失败了 撤销去重标记 否则重试的消息会被当成重复阅读
+// 用新的 ctx 计数失败可能就是因为超时
+func (i *InteractiveReadEventConsumer) unmarkRead(window time.Duration, events []ReadEvent) {
+	if window <= 0 {
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	return i.repo.BatchIncrReadCnt(ctx, bizs, bizIds)
+	bizs := make([]string, 0, len(events))
+	bizIds := make([]int64, 0, len(events))
+	uids := make([]int64, 0, len(events))
+	for _, event := range events {
+		bizs = append(bizs, event.BizOrDefault())
+		bizIds = append(bizIds, event.Aid)
+		uids = append(uids, event.Uid)
+	}
+	err := i.repo.UnmarkRead(ctx, bizs, bizIds, uids)
+	if err != nil {
+		i.l.Error("撤销阅读去重失败 这些阅读不会再计数", logger.Int("cnt", len(events)), logger.Error(err))
+	}
+}
+
+func (i *InteractiveReadEventConsumer) observeDedup(counted bool, cnt int) {
+	result := "suppressed"
+	if counted {
+		result = "counted"
+	}
+	i.dedupVector.WithLabelValues(result).Add(float64(cnt))
+}
+
+// addReader 独立访客只是统计数据 失败了不影响阅读数
+func (i *InteractiveReadEventConsumer) addReader(ctx context.Context, event ReadEvent) {
+	err := i.repo.AddReader(ctx, event.BizOrDefault(), event.Aid, event.Uid)
+	if err != nil {
+		i.l.Error(
+			"记录独立访客失败",
+			logger.Int64("aid", event.Aid),
+			logger.Int64("uid", event.Uid),
+			logger.Error(err),
+		)
+	}
 }
 
 type HistoryRecordConsumer struct {
@@ -115,7 +295,7 @@ func (i *HistoryRecordConsumer) Start() error {
 		er := cg.Consume(
 			context.Background(),
 			[]string{TopicReadEvent},
-			saramax.NewHandler[ReadEvent](i.l, i.Consume),
+			saramax.NewHandler[ReadEvent]("history_record", i.l, i.Consume),
 		)
 		if er != nil {
 			i.l.Error("退出消费", logger.Error(er))
@@ -134,7 +314,7 @@ func (i *HistoryRecordConsumer) Consume(
 		ctx,
 		domain.ReadHistory{
 			BizId:    event.Aid,
-			Biz:      "article",
+			Biz:      event.BizOrDefault(),
 			Uid:      event.Uid,
 			ReadTime: time.UnixMilli(event.ReadTime),
 		},
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// readRepo 在内存里去重和计数 可以让计数失败
+type readRepo struct {
+	repository.InteractiveRepository
+	marked  map[string]struct{}
+	cnt     map[int64]int
+	incrErr error
+}
+
+func (r *readRepo) key(biz string, bizId int64, uid int64) string {
+	return fmt.Sprintf("%s:%d:%d", biz, bizId, uid)
+}
+
+func (r *readRepo) AddReader(ctx context.Context, biz string, bizId int64, uid int64) error {
+	return nil
+}
+
+func (r *readRepo) MarkRead(ctx context.Context, biz string, bizId int64, uid int64, window time.Duration) (bool, error) {
+	key := r.key(biz, bizId, uid)
+	if _, ok := r.marked[key]; ok {
+		return false, nil
+	}
+	r.marked[key] = struct{}{}
+	return true, nil
+}
+
+func (r *readRepo) BatchMarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64, window time.Duration) ([]bool, error) {
+	res := make([]bool, 0, len(biz))
+	for idx := range biz {
+		ok, _ := r.MarkRead(ctx, biz[idx], bizIds[idx], uids[idx], window)
+		res = append(res, ok)
+	}
+	return res, nil
+}
+
+func (r *readRepo) UnmarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64) error {
+	for idx := range biz {
+		delete(r.marked, r.key(biz[idx], bizIds[idx], uids[idx]))
+	}
+	return nil
+}
+
+func (r *readRepo) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
+	if r.incrErr != nil {
+		return r.incrErr
+	}
+	r.cnt[bizId]++
+	return nil
+}
+
+func (r *readRepo) BatchIncrReadCnt(ctx context.Context, biz []string, bizIds []int64) error {
+	if r.incrErr != nil {
+		return r.incrErr
+	}
+	for _, id := range bizIds {
+		r.cnt[id]++
+	}
+	return nil
+}
+
+func TestInteractiveReadEventConsumer_RetryAfterIncrFailed(t *testing.T) {
+	repo := &readRepo{marked: map[string]struct{}{}, cnt: map[int64]int{}}
+	c := &InteractiveReadEventConsumer{
+		repo: repo,
+		l:    logger.NewNopLogger(),
+		registry: biz.NewConfigRegistry([]biz.Config{
+			{Name: Biz, ReadEnabled: true, DedupWindow: time.Minute},
+		}),
+		dedupVector: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "read_dedup"}, []string{"result"}),
+	}
+	event := ReadEvent{Aid: 1, Uid: 2}
+	other := ReadEvent{Aid: 3, Uid: 2}
+
+	// 计数失败 消息会重试 重试时还要计数
+	repo.incrErr = errors.New("模拟的数据库错误")
+	assert.Error(t, c.Consume(nil, event))
+	assert.Error(t, c.BatchConsume(nil, []ReadEvent{other}))
+	repo.incrErr = nil
+	assert.NoError(t, c.Consume(nil, event))
+	assert.NoError(t, c.BatchConsume(nil, []ReadEvent{other}))
+	// 窗口内重复的阅读不计数
+	assert.NoError(t, c.Consume(nil, event))
+	assert.NoError(t, c.BatchConsume(nil, []ReadEvent{other}))
+	assert.Equal(t, map[int64]int{1: 1, 3: 1}, repo.cnt)
+}
+
+func TestInteractiveReadEventConsumer_BatchConsumeBizs(t *testing.T) {
+	repo := &readRepo{marked: map[string]struct{}{}, cnt: map[int64]int{}}
+	c := &InteractiveReadEventConsumer{
+		repo: repo,
+		l:    logger.NewNopLogger(),
+		registry: biz.NewConfigRegistry([]biz.Config{
+			{Name: Biz, ReadEnabled: true, DedupWindow: time.Minute},
+			{Name: "comment", ReadEnabled: true},
+			{Name: "video"},
+		}),
+		dedupVector: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "read_dedup"}, []string{"result"}),
+	}
+	assert.NoError(t, c.BatchConsume(nil, []ReadEvent{
+		// 旧的消息没有业务类型 按文章处理
+		{Aid: 1, Uid: 2},
+		{Biz: Biz, Aid: 1, Uid: 2},
+		// 没有去重窗口的每次都计数
+		{Biz: "comment", Aid: 3, Uid: 2},
+		{Biz: "comment", Aid: 3, Uid: 2},
+		// 关闭了阅读计数的和没有注册的丢弃
+		{Biz: "video", Aid: 4, Uid: 2},
+		{Biz: "unknown", Aid: 5, Uid: 2},
+	}))
+	assert.Equal(t, map[int64]int{1: 1, 3: 2}, repo.cnt)
+}
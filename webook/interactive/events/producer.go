@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IBM/sarama"
+	"strconv"
+)
+
+// headerIdempotencyKey 幂等键同时放在消息头里 消费方不需要解析消息体就能去重
+const headerIdempotencyKey = "idempotency_key"
+
+type Producer interface {
+	ProduceLikeEvent(ctx context.Context, evt LikeEvent) error
+	ProduceCancelLikeEvent(ctx context.Context, evt CancelLikeEvent) error
+	ProduceCollectEvent(ctx context.Context, evt CollectEvent) error
+}
+
+type SaramaSyncProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewSaramaSyncProducer(producer sarama.SyncProducer) Producer {
+	return &SaramaSyncProducer{producer: producer}
+}
+
+func (s *SaramaSyncProducer) ProduceLikeEvent(ctx context.Context, evt LikeEvent) error {
+	if evt.IdempotencyKey == "" {
+		evt.IdempotencyKey = IdempotencyKey(TopicLikeEvent, evt.Biz, evt.BizId, evt.Uid, evt.LikeTime)
+	}
+	return s.produce(TopicLikeEvent, evt.BizId, evt.IdempotencyKey, evt)
+}
+
+func (s *SaramaSyncProducer) ProduceCancelLikeEvent(ctx context.Context, evt CancelLikeEvent) error {
+	if evt.IdempotencyKey == "" {
+		evt.IdempotencyKey = IdempotencyKey(TopicCancelLikeEvent, evt.Biz, evt.BizId, evt.Uid, evt.CancelTime)
+	}
+	return s.produce(TopicCancelLikeEvent, evt.BizId, evt.IdempotencyKey, evt)
+}
+
+func (s *SaramaSyncProducer) ProduceCollectEvent(ctx context.Context, evt CollectEvent) error {
+	if evt.IdempotencyKey == "" {
+		evt.IdempotencyKey = IdempotencyKey(TopicCollectEvent, evt.Biz, evt.BizId, evt.Uid, evt.CollectTime)
+	}
+	return s.produce(TopicCollectEvent, evt.BizId, evt.IdempotencyKey, evt)
+}
+
+// produce 以业务id作为消息的key 默认的分区器按key哈希 同一个业务的事件有序
+func (s *SaramaSyncProducer) produce(topic string, bizId int64, idempotencyKey string, evt any) error {
+	val, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.producer.SendMessage(
+		&sarama.ProducerMessage{
+			Topic: topic,
+			Key:   sarama.StringEncoder(strconv.FormatInt(bizId, 10)),
+			Value: sarama.ByteEncoder(val),
+			Headers: []sarama.RecordHeader{
+				{
+					Key:   []byte(headerIdempotencyKey),
+					Value: []byte(idempotencyKey),
+				},
+			},
+		},
+	)
+	return err
+}
+
+// IdempotencyKey 由操作类型 业务 用户和状态的版本组成 同一次状态变化生成的键相同
+// 版本是数据库里这条点赞或者收藏记录的更新时间 同一条记录严格递增
+func IdempotencyKey(topic string, biz string, bizId int64, uid int64, version int64) string {
+	return fmt.Sprintf("%s:%s:%d:%d:%d", topic, biz, bizId, uid, version)
+}
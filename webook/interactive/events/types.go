@@ -4,14 +4,63 @@ const TopicReadEvent = "article_read"
 
 const TopicGroupID = "interactive"
 
+// 互动服务对外发布的事件 消息的 key 是业务id 同一个业务的事件落在同一个分区 保证有序
+// 每条消息都带有幂等键 消费方可以据此去重
+const (
+	// TopicLikeEvent 点赞成功 消息体为 LikeEvent
+	TopicLikeEvent = "interactive_like"
+	// TopicCancelLikeEvent 取消点赞成功 消息体为 CancelLikeEvent
+	TopicCancelLikeEvent = "interactive_cancel_like"
+	// TopicCollectEvent 收藏成功 消息体为 CollectEvent
+	TopicCollectEvent = "interactive_collect"
+)
+
+// Biz 文章 旧的阅读事件没有业务类型 都按文章处理
 const Biz = "article"
 
 type ReadEvent struct {
+	Biz      string
 	Aid      int64
 	Uid      int64
 	ReadTime int64
 }
 
+// BizOrDefault 阅读事件的业务类型
+func (e ReadEvent) BizOrDefault() string {
+	if e.Biz == "" {
+		return Biz
+	}
+	return e.Biz
+}
+
+type LikeEvent struct {
+	// IdempotencyKey 幂等键 同一次操作重复投递时不变
+	IdempotencyKey string
+	Biz            string
+	BizId          int64
+	Uid            int64
+	// LikeTime 毫秒时间戳
+	LikeTime int64
+}
+
+type CancelLikeEvent struct {
+	IdempotencyKey string
+	Biz            string
+	BizId          int64
+	Uid            int64
+	CancelTime     int64
+}
+
+type CollectEvent struct {
+	IdempotencyKey string
+	Biz            string
+	BizId          int64
+	Uid            int64
+	// Cid 收藏夹id
+	Cid         int64
+	CollectTime int64
+}
+
 type Consumer interface {
 	Start() error
 }
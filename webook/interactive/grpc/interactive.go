@@ -2,12 +2,19 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
 	"github.com/Anwenya/GeekTime/webook/interactive/domain"
 	"github.com/Anwenya/GeekTime/webook/interactive/service"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
 )
 
+const DefaultLikeTopLimit = 100
+
 type InteractiveServiceServer struct {
 	interactivev1.UnimplementedInteractiveServiceServer
 	svc service.InteractiveService
@@ -27,7 +34,7 @@ func (i *InteractiveServiceServer) IncrReadCnt(ctx context.Context, request *int
 		request.GetBiz(),
 		request.GetBizId(),
 	)
-	return &interactivev1.IncrReadCntResponse{}, err
+	return &interactivev1.IncrReadCntResponse{}, toStatusErr(err)
 }
 
 func (i *InteractiveServiceServer) Like(ctx context.Context, request *interactivev1.LikeRequest) (*interactivev1.LikeResponse, error) {
@@ -37,7 +44,7 @@ func (i *InteractiveServiceServer) Like(ctx context.Context, request *interactiv
 		request.GetBizId(),
 		request.GetUid(),
 	)
-	return &interactivev1.LikeResponse{}, err
+	return &interactivev1.LikeResponse{}, toStatusErr(err)
 }
 
 func (i *InteractiveServiceServer) CancelLike(ctx context.Context, request *interactivev1.CancelLikeRequest) (*interactivev1.CancelLikeResponse, error) {
@@ -47,7 +54,7 @@ func (i *InteractiveServiceServer) CancelLike(ctx context.Context, request *inte
 		request.GetBizId(),
 		request.GetUid(),
 	)
-	return &interactivev1.CancelLikeResponse{}, err
+	return &interactivev1.CancelLikeResponse{}, toStatusErr(err)
 }
 
 func (i *InteractiveServiceServer) Collect(ctx context.Context, request *interactivev1.CollectRequest) (*interactivev1.CollectResponse, error) {
@@ -58,7 +65,7 @@ func (i *InteractiveServiceServer) Collect(ctx context.Context, request *interac
 		request.GetCid(),
 		request.GetUid(),
 	)
-	return &interactivev1.CollectResponse{}, err
+	return &interactivev1.CollectResponse{}, toStatusErr(err)
 }
 
 func (i *InteractiveServiceServer) Get(ctx context.Context, request *interactivev1.GetRequest) (*interactivev1.GetResponse, error) {
@@ -69,7 +76,7 @@ func (i *InteractiveServiceServer) Get(ctx context.Context, request *interactive
 		request.GetUid(),
 	)
 	if err != nil {
-		return nil, err
+		return nil, toStatusErr(err)
 	}
 	return &interactivev1.GetResponse{
 		Interactive: i.toDTO(interactive),
@@ -83,7 +90,7 @@ func (i *InteractiveServiceServer) GetByIds(ctx context.Context, request *intera
 		request.GetIds(),
 	)
 	if err != nil {
-		return nil, err
+		return nil, toStatusErr(err)
 	}
 	interactives := make(map[int64]*interactivev1.Interactive, len(res))
 	for k, v := range res {
@@ -94,6 +101,76 @@ func (i *InteractiveServiceServer) GetByIds(ctx context.Context, request *intera
 	}, nil
 }
 
+func (i *InteractiveServiceServer) LikeTop(ctx context.Context, request *interactivev1.LikeTopRequest) (*interactivev1.LikeTopResponse, error) {
+	res, err := LikeTop(ctx, i.svc, request)
+	if err != nil {
+		return nil, toStatusErr(err)
+	}
+
+	interactives := make([]*interactivev1.Interactive, 0, len(res))
+	for _, intr := range res {
+		interactives = append(interactives, i.toDTO(intr))
+	}
+	return &interactivev1.LikeTopResponse{
+		Interactives: interactives,
+	}, nil
+}
+
+func (i *InteractiveServiceServer) GetSnapshots(ctx context.Context, request *interactivev1.GetSnapshotsRequest) (*interactivev1.GetSnapshotsResponse, error) {
+	res, err := i.svc.GetSnapshots(
+		ctx,
+		request.GetBiz(),
+		request.GetBizIds(),
+		time.UnixMilli(request.GetStart()),
+		time.UnixMilli(request.GetEnd()),
+	)
+	if err != nil {
+		return nil, toStatusErr(err)
+	}
+	snapshots := make([]*interactivev1.InteractiveSnapshot, 0, len(res))
+	for _, s := range res {
+		snapshots = append(snapshots, &interactivev1.InteractiveSnapshot{
+			Biz:        s.Biz,
+			BizId:      s.BizId,
+			Day:        s.Day.UnixMilli(),
+			ReadCnt:    s.ReadCnt,
+			LikeCnt:    s.LikeCnt,
+			CollectCnt: s.CollectCnt,
+		})
+	}
+	return &interactivev1.GetSnapshotsResponse{
+		Snapshots: snapshots,
+	}, nil
+}
+
+// LikeTop 按照请求的窗口查询点赞排行 本地调用和 gRPC 调用共用
+// 没有指定数量时返回 DefaultLikeTopLimit 个
+func LikeTop(ctx context.Context, svc service.InteractiveService, request *interactivev1.LikeTopRequest) ([]domain.Interactive, error) {
+	limit := request.GetLimit()
+	if limit <= 0 {
+		limit = DefaultLikeTopLimit
+	}
+	if request.GetWindow() == interactivev1.Window_WINDOW_ALL {
+		return svc.LikeTop(ctx, request.GetBiz(), limit)
+	}
+	start, end := ToTimeRange(request, time.Now())
+	return svc.WindowLikeTop(ctx, request.GetBiz(), start, end, limit)
+}
+
+// ToTimeRange 把排行榜窗口转换成具体的时间范围 除了自定义窗口都是截止到 now 的滑动窗口
+func ToTimeRange(request *interactivev1.LikeTopRequest, now time.Time) (time.Time, time.Time) {
+	switch request.GetWindow() {
+	case interactivev1.Window_WINDOW_HOUR:
+		return now.Add(-time.Hour), now
+	case interactivev1.Window_WINDOW_DAY:
+		return now.Add(-24 * time.Hour), now
+	case interactivev1.Window_WINDOW_WEEK:
+		return now.Add(-7 * 24 * time.Hour), now
+	default:
+		return time.UnixMilli(request.GetStart()), time.UnixMilli(request.GetEnd())
+	}
+}
+
 func (i *InteractiveServiceServer) toDTO(interactive domain.Interactive) *interactivev1.Interactive {
 	return &interactivev1.Interactive{
 		Biz:        interactive.Biz,
@@ -103,5 +180,22 @@ func (i *InteractiveServiceServer) toDTO(interactive domain.Interactive) *intera
 		Collected:  interactive.Collected,
 		Liked:      interactive.Liked,
 		LikeCnt:    interactive.LikeCnt,
+		UvCnt:      interactive.UvCnt,
+	}
+}
+
+// toStatusErr 把业务注册相关的错误转换成对应的 gRPC 状态码
+func toStatusErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, biz.ErrUnknownBiz):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, biz.ErrDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrInvalidWindow):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
 	}
 }
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// recordedLikeTop 记录排行榜的查询参数
+type recordedLikeTop struct {
+	service.InteractiveService
+	start, end time.Time
+	n          int64
+}
+
+func (r *recordedLikeTop) LikeTop(ctx context.Context, biz string, n int64) ([]domain.Interactive, error) {
+	r.n = n
+	return nil, nil
+}
+
+func (r *recordedLikeTop) WindowLikeTop(ctx context.Context, biz string, start, end time.Time, n int64) ([]domain.Interactive, error) {
+	r.start, r.end, r.n = start, end, n
+	if !start.Before(end) {
+		return nil, service.ErrInvalidWindow
+	}
+	return nil, nil
+}
+
+func TestInteractiveServiceServer_LikeTop(t *testing.T) {
+	svc := &recordedLikeTop{}
+	server := NewInteractiveServiceServer(svc)
+	ctx := context.Background()
+
+	// 没有指定数量的使用默认值
+	_, err := server.LikeTop(ctx, &interactivev1.LikeTopRequest{Biz: "article"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(DefaultLikeTopLimit), svc.n)
+
+	_, err = server.LikeTop(ctx, &interactivev1.LikeTopRequest{Biz: "article", Window: interactivev1.Window_WINDOW_DAY, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), svc.n)
+	assert.Equal(t, 24*time.Hour, svc.end.Sub(svc.start))
+
+	_, err = server.LikeTop(ctx, &interactivev1.LikeTopRequest{
+		Biz:    "article",
+		Window: interactivev1.Window_WINDOW_CUSTOM,
+		Start:  2000,
+		End:    1000,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, time.UnixMilli(2000), svc.start)
+}
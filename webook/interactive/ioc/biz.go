@@ -0,0 +1,40 @@
+package ioc
+
+import (
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/config"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// InitBizRegistry 配置文件变更时重新加载业务配置
+func InitBizRegistry(l logger.LoggerV1) biz.Registry {
+	registry := biz.NewConfigRegistry(toBizConfigs(config.Config.Bizs))
+	viper.OnConfigChange(func(in fsnotify.Event) {
+		var cfgs []config.BizConfig
+		err := viper.UnmarshalKey("bizs", &cfgs)
+		if err != nil {
+			l.Error("重新加载业务配置失败", logger.Error(err))
+			return
+		}
+		registry.Reload(toBizConfigs(cfgs))
+		l.Info("重新加载业务配置", logger.Int("cnt", len(cfgs)))
+	})
+	return registry
+}
+
+func toBizConfigs(cfgs []config.BizConfig) []biz.Config {
+	res := make([]biz.Config, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		res = append(res, biz.Config{
+			Name:           cfg.Name,
+			LikeEnabled:    cfg.Like,
+			CollectEnabled: cfg.Collect,
+			ReadEnabled:    cfg.Read,
+			DedupWindow:    cfg.DedupWindow,
+			Ranking:        cfg.Ranking,
+		})
+	}
+	return res
+}
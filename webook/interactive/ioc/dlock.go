@@ -0,0 +1,17 @@
+package ioc
+
+import (
+	"github.com/Anwenya/GeekTime/webook/interactive/config"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// InitLocker 定时任务用的分布式锁 和缓存用同一个 redis
+func InitLocker(client redis.Cmdable) dlock.Locker {
+	ttl := config.Config.DLock.TTL
+	if ttl <= 0 {
+		ttl = time.Second * 30
+	}
+	return dlock.NewClient(dlock.NewRedisStore(client), ttl)
+}
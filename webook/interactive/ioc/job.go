@@ -0,0 +1,68 @@
+package ioc
+
+import (
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/config"
+	ijob "github.com/Anwenya/GeekTime/webook/interactive/job"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+func InitDailyUVJob(repo repository.InteractiveRepository, registry biz.Registry, l logger.LoggerV1) *ijob.DailyUVJob {
+	return ijob.NewDailyUVJob(repo, registry, time.Minute*30, l)
+}
+
+func InitDailySnapshotJob(repo repository.InteractiveRepository, registry biz.Registry, l logger.LoggerV1) *ijob.DailySnapshotJob {
+	return ijob.NewDailySnapshotJob(repo, registry, time.Minute*30, l)
+}
+
+func InitReconcileJob(repo repository.InteractiveRepository, registry biz.Registry, l logger.LoggerV1) *ijob.ReconcileJob {
+	cfg := config.Config.Reconcile
+	return ijob.NewReconcileJob(repo, registry, cfg.DryRun, cfg.Timeout, l)
+}
+
+func InitJobs(
+	l logger.LoggerV1,
+	locker dlock.Locker,
+	uvJob *ijob.DailyUVJob,
+	snapshotJob *ijob.DailySnapshotJob,
+	reconcileJob *ijob.ReconcileJob,
+) *cron.Cron {
+	builder := ijob.NewCronJobBuilder(
+		prometheus.SummaryOpts{
+			Namespace: "GeekTime",
+			Subsystem: "webook_interactive",
+			Name:      "cron_job",
+			Help:      "定时任务执行",
+			Objectives: map[float64]float64{
+				0.5:   0.01,
+				0.75:  0.01,
+				0.9:   0.01,
+				0.99:  0.001,
+				0.999: 0.0001,
+			},
+		},
+		l,
+	)
+	expr := cron.New(cron.WithSeconds())
+	// 每天凌晨 00:10 同步前一天的数据
+	// 每个实例都会触发 只有抢到锁的执行
+	_, err := expr.AddJob("0 10 0 * * *", builder.BuildSingleton(uvJob, locker))
+	if err != nil {
+		panic(any(err))
+	}
+	// 每天凌晨 00:05 记录前一天的快照
+	_, err = expr.AddJob("0 5 0 * * *", builder.BuildSingleton(snapshotJob, locker))
+	if err != nil {
+		panic(any(err))
+	}
+	_, err = expr.AddJob(config.Config.Reconcile.Spec, builder.BuildSingleton(reconcileJob, locker))
+	if err != nil {
+		panic(any(err))
+	}
+	return expr
+}
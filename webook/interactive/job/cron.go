@@ -0,0 +1,93 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	"strconv"
+	"time"
+)
+
+// Job 互动服务自己的定时任务 只在本进程内按 cron 执行 不经过主站的任务调度
+type Job interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type CronJobBuilder struct {
+	vector *prometheus.SummaryVec
+	l      logger.LoggerV1
+}
+
+func NewCronJobBuilder(opts prometheus.SummaryOpts, l logger.LoggerV1) *CronJobBuilder {
+	vector := prometheus.NewSummaryVec(
+		opts,
+		[]string{"job", "success"},
+	)
+	prometheus.MustRegister(vector)
+	return &CronJobBuilder{vector: vector, l: l}
+}
+
+func (b *CronJobBuilder) Build(job Job) cron.Job {
+	name := job.Name()
+	return cron.FuncJob(func() {
+		start := time.Now()
+		b.l.Debug("开始运行", logger.String("name", name))
+		err := job.Run(context.Background())
+		if err != nil {
+			b.l.Error(
+				"执行失败",
+				logger.Error(err),
+				logger.String("name", name),
+			)
+		}
+		b.l.Debug("结束运行", logger.String("name", name))
+		b.vector.WithLabelValues(name, strconv.FormatBool(err == nil)).
+			Observe(float64(time.Since(start).Milliseconds()))
+	})
+}
+
+// BuildSingleton 每个实例都按 cron 触发 只有抢到锁的实例执行
+func (b *CronJobBuilder) BuildSingleton(job Job, locker dlock.Locker) cron.Job {
+	return b.Build(&singletonJob{Job: job, locker: locker, l: b.l})
+}
+
+type singletonJob struct {
+	Job
+	locker dlock.Locker
+	l      logger.LoggerV1
+}
+
+func (s *singletonJob) Run(ctx context.Context) error {
+	lock, err := s.locker.TryLock(ctx, "interactive:job:"+s.Name())
+	if errors.Is(err, dlock.ErrLocked) {
+		s.l.Debug("其他实例正在执行", logger.String("name", s.Name()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		er := lock.Unlock(ctx)
+		if er != nil {
+			s.l.Warn("释放任务锁失败", logger.String("name", s.Name()), logger.Error(er))
+		}
+	}()
+
+	// 续约失败就停止执行 锁过期后其他实例可能已经开始了
+	lockCtx := lock.Context()
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(lockCtx, func() {
+		cancel(context.Cause(lockCtx))
+	})
+	defer func() {
+		stop()
+		cancel(context.Canceled)
+	}()
+	return s.Job.Run(ctx)
+}
@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingJob 执行到 release 被关闭为止
+type blockingJob struct {
+	runs    atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingJob) Name() string {
+	return "blocking"
+}
+
+func (b *blockingJob) Run(ctx context.Context) error {
+	b.runs.Add(1)
+	close(b.started)
+	<-b.release
+	return nil
+}
+
+func TestSingletonJob_Run(t *testing.T) {
+	mr := miniredis.RunT(t)
+	locker := dlock.NewClient(dlock.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})), time.Second*3)
+	job := &blockingJob{started: make(chan struct{}), release: make(chan struct{})}
+	// 模拟两个实例同时被 cron 触发
+	first := &singletonJob{Job: job, locker: locker, l: logger.NewNopLogger()}
+	second := &singletonJob{Job: job, locker: locker, l: logger.NewNopLogger()}
+
+	done := make(chan error)
+	go func() {
+		done <- first.Run(context.Background())
+	}()
+	<-job.started
+	// 抢不到锁的实例直接跳过
+	require.NoError(t, second.Run(context.Background()))
+	assert.Equal(t, int32(1), job.runs.Load())
+
+	close(job.release)
+	require.NoError(t, <-done)
+	// 执行完之后释放了锁
+	assert.False(t, mr.Exists("interactive:job:blocking"))
+}
@@ -0,0 +1,128 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// ReconcileJob 定期以数据库为准核对每个注册业务的缓存计数
+// 参与排行榜的业务还会核对排行榜 dryRun 时只输出差异报告 不修正缓存
+// 需要用 BuildSingleton 注册 多个实例中只有一个执行
+type ReconcileJob struct {
+	repo     repository.InteractiveRepository
+	registry biz.Registry
+	dryRun   bool
+	timeout  time.Duration
+	l        logger.LoggerV1
+	// 记录每一处差异的大小 按计数类型区分
+	vector *prometheus.HistogramVec
+}
+
+func NewReconcileJob(
+	repo repository.InteractiveRepository,
+	registry biz.Registry,
+	dryRun bool,
+	timeout time.Duration,
+	l logger.LoggerV1,
+) *ReconcileJob {
+	vector := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "GeekTime",
+			Subsystem: "webook_interactive",
+			Name:      "cache_drift",
+			Help:      "缓存与数据库计数的差异",
+			Buckets:   []float64{1, 2, 5, 10, 50, 100, 1000, 10000},
+		},
+		[]string{"biz", "field", "dry_run"},
+	)
+	prometheus.MustRegister(vector)
+	return &ReconcileJob{
+		repo:     repo,
+		registry: registry,
+		dryRun:   dryRun,
+		timeout:  timeout,
+		l:        l,
+		vector:   vector,
+	}
+}
+
+func (r *ReconcileJob) Name() string {
+	return "interactive_reconcile"
+}
+
+func (r *ReconcileJob) Run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var errs []error
+	// 一个业务或者互动数据缓存出错 不影响核对其他的
+	for _, cfg := range r.registry.List() {
+		drifts, err := r.repo.ReconcileCache(ctx, cfg.Name, r.dryRun)
+		r.report(cfg.Name, drifts)
+		errs = append(errs, err)
+		if !cfg.Ranking {
+			continue
+		}
+		drifts, err = r.repo.ReconcileRanking(ctx, cfg.Name, r.dryRun)
+		r.report(cfg.Name, drifts)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// report 上报差异 dryRun 时逐条输出差异
+func (r *ReconcileJob) report(biz string, drifts []domain.InteractiveDrift) {
+	type summary struct {
+		cnt   int64
+		total int64
+		max   int64
+	}
+	summaries := make(map[string]*summary)
+	dryRun := strconv.FormatBool(r.dryRun)
+	for _, drift := range drifts {
+		delta := drift.Delta()
+		if delta < 0 {
+			delta = -delta
+		}
+		r.vector.WithLabelValues(biz, drift.Field, dryRun).Observe(float64(delta))
+
+		s, ok := summaries[drift.Field]
+		if !ok {
+			s = &summary{}
+			summaries[drift.Field] = s
+		}
+		s.cnt++
+		s.total += delta
+		s.max = max(s.max, delta)
+
+		if r.dryRun {
+			r.l.Info(
+				"缓存计数差异",
+				logger.String("biz", drift.Biz),
+				logger.Int64("bizId", drift.BizId),
+				logger.String("field", drift.Field),
+				logger.Int64("cached", drift.Cached),
+				logger.Int64("stored", drift.Stored),
+			)
+		}
+	}
+
+	for field, s := range summaries {
+		r.l.Info(
+			"缓存核对完成",
+			logger.String("biz", biz),
+			logger.String("field", field),
+			logger.Bool("dryRun", r.dryRun),
+			logger.Int64("cnt", s.cnt),
+			logger.Int64("total", s.total),
+			logger.Int64("max", s.max),
+		)
+	}
+}
@@ -0,0 +1,57 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// recordedReconciler 记录核对过的业务 video 的缓存核对失败
+type recordedReconciler struct {
+	repository.InteractiveRepository
+	caches   []string
+	rankings []string
+}
+
+func (r *recordedReconciler) ReconcileCache(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error) {
+	r.caches = append(r.caches, biz)
+	if biz == "video" {
+		return nil, errors.New("mock error")
+	}
+	return []domain.InteractiveDrift{{Biz: biz, Field: repository.DriftFieldLikeCnt, Cached: 1, Stored: 2}}, nil
+}
+
+func (r *recordedReconciler) ReconcileRanking(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error) {
+	r.rankings = append(r.rankings, biz)
+	return nil, nil
+}
+
+func TestReconcileJob_Run(t *testing.T) {
+	repo := &recordedReconciler{}
+	registry := biz.NewConfigRegistry([]biz.Config{
+		{Name: "article", Ranking: true},
+		{Name: "video"},
+		{Name: "comment"},
+	})
+	job := NewReconcileJob(repo, registry, true, time.Minute, logger.NewNopLogger())
+
+	err := job.Run(context.Background())
+	// 一个业务失败不影响核对其他业务
+	assert.Error(t, err)
+	assert.Equal(t, []string{"article", "comment", "video"}, repo.caches)
+	// 只有参与排行榜的业务核对排行榜
+	assert.Equal(t, []string{"article"}, repo.rankings)
+
+	// 重新加载的业务下一次核对生效
+	registry.Reload([]biz.Config{{Name: "comment", Ranking: true}})
+	repo.caches, repo.rankings = nil, nil
+	assert.NoError(t, job.Run(context.Background()))
+	assert.Equal(t, []string{"comment"}, repo.caches)
+	assert.Equal(t, []string{"comment"}, repo.rankings)
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"time"
+)
+
+// DailySnapshotJob 每天凌晨把互动数据的累计值记录为前一天的快照
+// 每个注册的业务一份 快照按天覆盖 用 BuildSingleton 注册避免重复执行
+type DailySnapshotJob struct {
+	repo     repository.InteractiveRepository
+	registry biz.Registry
+	timeout  time.Duration
+	l        logger.LoggerV1
+}
+
+func NewDailySnapshotJob(
+	repo repository.InteractiveRepository,
+	registry biz.Registry,
+	timeout time.Duration,
+	l logger.LoggerV1,
+) *DailySnapshotJob {
+	return &DailySnapshotJob{
+		repo:     repo,
+		registry: registry,
+		timeout:  timeout,
+		l:        l,
+	}
+}
+
+func (d *DailySnapshotJob) Name() string {
+	return "daily_snapshot"
+}
+
+func (d *DailySnapshotJob) Run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	day := time.Now().AddDate(0, 0, -1)
+	var errs []error
+	for _, cfg := range d.registry.List() {
+		d.l.Info(
+			"记录互动数据快照",
+			logger.String("biz", cfg.Name),
+			logger.String("day", day.Format(time.DateOnly)),
+		)
+		errs = append(errs, d.repo.SnapshotDaily(ctx, cfg.Name, day))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"time"
+)
+
+// DailyUVJob 每天把前一天的独立访客数从 HyperLogLog 同步到数据库
+// 只同步开启了阅读的业务 同步过程是幂等的 用 BuildSingleton 注册避免重复执行
+type DailyUVJob struct {
+	repo     repository.InteractiveRepository
+	registry biz.Registry
+	timeout  time.Duration
+	l        logger.LoggerV1
+}
+
+func NewDailyUVJob(
+	repo repository.InteractiveRepository,
+	registry biz.Registry,
+	timeout time.Duration,
+	l logger.LoggerV1,
+) *DailyUVJob {
+	return &DailyUVJob{
+		repo:     repo,
+		registry: registry,
+		timeout:  timeout,
+		l:        l,
+	}
+}
+
+func (d *DailyUVJob) Name() string {
+	return "daily_uv"
+}
+
+func (d *DailyUVJob) Run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	day := time.Now().AddDate(0, 0, -1)
+	var errs []error
+	// 一个业务失败不影响其他业务
+	for _, cfg := range d.registry.List() {
+		if !cfg.ReadEnabled {
+			continue
+		}
+		d.l.Info(
+			"同步独立访客数",
+			logger.String("biz", cfg.Name),
+			logger.String("day", day.Format(time.DateOnly)),
+		)
+		errs = append(errs, d.repo.PersistDailyUV(ctx, cfg.Name, day))
+	}
+	return errors.Join(errs...)
+}
@@ -22,6 +22,12 @@ func main() {
 		}
 	}
 
+	app.cron.Start()
+	defer func() {
+		// 等待定时任务退出
+		<-app.cron.Stop().Done()
+	}()
+
 	go func() {
 		err := app.adminServer.Start()
 		if err != nil {
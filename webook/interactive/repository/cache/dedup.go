@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// ReadDeduplicator 同一个用户在去重窗口内多次阅读同一篇文章只计一次
+type ReadDeduplicator interface {
+	// MarkRead 返回 true 表示这是窗口内的第一次阅读 应该计数
+	MarkRead(ctx context.Context, biz string, bizId int64, uid int64, window time.Duration) (bool, error)
+	// BatchMarkRead 批量版本 返回值与参数一一对应
+	BatchMarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64, window time.Duration) ([]bool, error)
+	// UnmarkRead 计数失败时撤销标记 重试的时候才能再计数
+	UnmarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64) error
+}
+
+// MarkRead 利用 SETNX 的原子性 key 过期后窗口自然结束
+func (i *InteractiveRedisCache) MarkRead(ctx context.Context, biz string, bizId int64, uid int64, window time.Duration) (bool, error) {
+	return i.client.SetNX(ctx, i.readDedupKey(biz, bizId, uid), 1, window).Result()
+}
+
+func (i *InteractiveRedisCache) BatchMarkRead(
+	ctx context.Context,
+	biz []string,
+	bizIds []int64,
+	uids []int64,
+	window time.Duration,
+) ([]bool, error) {
+	pipe := i.client.Pipeline()
+	cmds := make([]*redis.BoolCmd, 0, len(biz))
+	for idx := range biz {
+		cmds = append(cmds, pipe.SetNX(ctx, i.readDedupKey(biz[idx], bizIds[idx], uids[idx]), 1, window))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, 0, len(cmds))
+	for _, cmd := range cmds {
+		res = append(res, cmd.Val())
+	}
+	return res, nil
+}
+
+func (i *InteractiveRedisCache) UnmarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64) error {
+	keys := make([]string, 0, len(biz))
+	for idx := range biz {
+		keys = append(keys, i.readDedupKey(biz[idx], bizIds[idx], uids[idx]))
+	}
+	return i.client.Del(ctx, keys...).Err()
+}
+
+func (i *InteractiveRedisCache) readDedupKey(biz string, bizId int64, uid int64) string {
+	return fmt.Sprintf("read_dedup:%s:%d:%d", biz, bizId, uid)
+}
@@ -19,10 +19,14 @@ const (
 	fieldReadCnt    = "read_cnt"
 	fieldLikeCnt    = "like_cnt"
 	fieldCollectCnt = "collect_cnt"
+	fieldUvCnt      = "uv_cnt"
 )
 
 type InteractiveCache interface {
 	InteractiveRanking
+	InteractiveUV
+	ReadDeduplicator
+	InteractiveReconciler
 	IncrReadCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	IncrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	DecrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
@@ -80,6 +84,7 @@ func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, bizId int64
 	interactive.CollectCnt, _ = strconv.ParseInt(res[fieldCollectCnt], 10, 64)
 	interactive.LikeCnt, _ = strconv.ParseInt(res[fieldLikeCnt], 10, 64)
 	interactive.ReadCnt, _ = strconv.ParseInt(res[fieldReadCnt], 10, 64)
+	interactive.UvCnt, _ = strconv.ParseInt(res[fieldUvCnt], 10, 64)
 	return interactive, nil
 }
 
@@ -91,6 +96,7 @@ func (i *InteractiveRedisCache) Set(ctx context.Context, biz string, bizId int64
 		fieldCollectCnt, res.CollectCnt,
 		fieldReadCnt, res.ReadCnt,
 		fieldLikeCnt, res.LikeCnt,
+		fieldUvCnt, res.UvCnt,
 	).Err()
 	if err != nil {
 		return err
@@ -0,0 +1,19 @@
+-- 具体业务
+local key = KEYS[1]
+-- 字段 核对时读到的值 数据库中的值 三个一组
+
+-- 缓存已经过期的不处理
+if redis.call("EXISTS", key) == 0 then
+    return 0
+end
+-- 任何一个字段在核对期间有变化都不修正 留给下一次核对
+for i = 1, #ARGV, 3 do
+    local cur = tonumber(redis.call("HGET", key, ARGV[i]) or "0")
+    if cur ~= tonumber(ARGV[i + 1]) then
+        return 0
+    end
+end
+for i = 1, #ARGV, 3 do
+    redis.call("HSET", key, ARGV[i], ARGV[i + 2])
+end
+return 1
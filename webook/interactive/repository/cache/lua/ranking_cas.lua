@@ -0,0 +1,17 @@
+-- 有序集合的名称
+local zsetName = KEYS[1]
+-- 要修正分数的元素
+local member = ARGV[1]
+-- 核对时读到的分数
+local expected = tonumber(ARGV[2])
+-- 数据库中的点赞数
+local score = ARGV[3]
+
+-- 元素不存在时不处理 避免把已经淘汰的数据重新写回去
+-- 核对期间分数有变化的也不处理 留给下一次核对
+local cur = redis.call("ZSCORE", zsetName, member)
+if not cur or tonumber(cur) ~= expected then
+    return 0
+end
+redis.call("ZADD", zsetName, "XX", score, member)
+return 1
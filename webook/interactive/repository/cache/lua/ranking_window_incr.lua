@@ -0,0 +1,24 @@
+-- 小时桶
+local hourKey = KEYS[1]
+-- 天桶
+local dayKey = KEYS[2]
+-- 业务id
+local member = ARGV[1]
+-- 变化量 点赞+1 取消点赞-1
+local delta = tonumber(ARGV[2])
+-- 过期时间 秒
+local hourTTL = tonumber(ARGV[3])
+local dayTTL = tonumber(ARGV[4])
+
+redis.call("ZINCRBY", hourKey, delta, member)
+-- 只在第一次创建桶的时候设置过期时间
+if redis.call("TTL", hourKey) == -1 then
+    redis.call("EXPIRE", hourKey, hourTTL)
+end
+
+redis.call("ZINCRBY", dayKey, delta, member)
+if redis.call("TTL", dayKey) == -1 then
+    redis.call("EXPIRE", dayKey, dayTTL)
+end
+
+return 1
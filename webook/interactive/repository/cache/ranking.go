@@ -8,6 +8,7 @@ import (
 	"github.com/ecodeclub/ekit/queue"
 	"github.com/redis/go-redis/v9"
 	"strconv"
+	"time"
 )
 
 var (
@@ -25,6 +26,10 @@ type InteractiveRanking interface {
 	SetRankingScore(ctx context.Context, biz string, bizId int64, count int64) error
 	// LikeTop 获得排名数据 默认前100
 	LikeTop(ctx context.Context, biz string, topN int64) ([]domain.Interactive, error)
+	// IncrWindowRanking 记录点赞数在时间桶中的变化
+	IncrWindowRanking(ctx context.Context, biz string, bizId int64, delta int64, t time.Time) error
+	// WindowLikeTop 获得时间窗口内的排名数据
+	WindowLikeTop(ctx context.Context, biz string, start, end time.Time, topN int64) ([]domain.Interactive, error)
 }
 
 // IncrRankingIfPresent
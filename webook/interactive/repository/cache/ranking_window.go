@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/ranking_window_incr.lua
+	luaRankingWindowIncr string
+)
+
+const (
+	// 小时桶要能覆盖一周窗口两端不足一天的部分 所以多留一天
+	hourBucketExpiration = 8 * 24 * time.Hour
+	dayBucketExpiration  = 31 * 24 * time.Hour
+	// 合并结果的缓存时间 同一个窗口短时间内的重复查询直接复用
+	windowMergeExpiration = time.Minute
+)
+
+// IncrWindowRanking
+// 按时间分桶记录点赞数的变化 同时写小时桶和天桶
+// 桶带过期时间 过期后自然淘汰
+func (i *InteractiveRedisCache) IncrWindowRanking(ctx context.Context, biz string, bizId int64, delta int64, t time.Time) error {
+	return i.client.Eval(
+		ctx,
+		luaRankingWindowIncr,
+		[]string{i.hourBucketKey(biz, t), i.dayBucketKey(biz, t)},
+		bizId, delta,
+		int64(hourBucketExpiration.Seconds()),
+		int64(dayBucketExpiration.Seconds()),
+	).Err()
+}
+
+// WindowLikeTop
+// 获得 [start, end) 时间窗口内的点赞排行 精度为小时
+// 完整的天使用天桶 两端不足一天的部分使用小时桶 合并后取前 topN
+// 开始时间早于天桶的保留时间时 从最早一个完整保留的天开始算
+func (i *InteractiveRedisCache) WindowLikeTop(
+	ctx context.Context,
+	biz string,
+	start, end time.Time,
+	topN int64,
+) ([]domain.Interactive, error) {
+	start = i.clampWindowStart(start, time.Now())
+	keys := i.windowBucketKeys(biz, start, end)
+	if len(keys) == 0 {
+		return []domain.Interactive{}, nil
+	}
+
+	dst := fmt.Sprintf(
+		"top_%s:w:%s_%s",
+		biz,
+		start.Format("2006010215"),
+		end.Format("2006010215"),
+	)
+	exists, err := i.client.Exists(ctx, dst).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		pipe := i.client.TxPipeline()
+		pipe.ZUnionStore(ctx, dst, &redis.ZStore{Keys: keys, Aggregate: "SUM"})
+		pipe.Expire(ctx, dst, windowMergeExpiration)
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 取消点赞可能让分数小于等于0 这部分不参与排名
+	res, err := i.client.ZRevRangeByScoreWithScores(ctx, dst, &redis.ZRangeBy{
+		Min:   "(0",
+		Max:   "+inf",
+		Count: topN,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	interactives := make([]domain.Interactive, 0, len(res))
+	for _, z := range res {
+		id, _ := strconv.ParseInt(z.Member.(string), 10, 64)
+		interactives = append(interactives, domain.Interactive{
+			Biz:     biz,
+			BizId:   id,
+			LikeCnt: int64(z.Score),
+		})
+	}
+	return interactives, nil
+}
+
+// windowBucketKeys 计算覆盖时间窗口需要合并的桶
+func (i *InteractiveRedisCache) windowBucketKeys(biz string, start, end time.Time) []string {
+	var keys []string
+	cur := start.Truncate(time.Hour)
+	for cur.Before(end) {
+		dayStart := time.Date(cur.Year(), cur.Month(), cur.Day(), 0, 0, 0, 0, cur.Location())
+		nextDay := dayStart.AddDate(0, 0, 1)
+		// 整天都在窗口内 直接用天桶
+		if cur.Equal(dayStart) && !nextDay.After(end) {
+			keys = append(keys, i.dayBucketKey(biz, cur))
+			cur = nextDay
+			continue
+		}
+		keys = append(keys, i.hourBucketKey(biz, cur))
+		cur = cur.Add(time.Hour)
+	}
+	return keys
+}
+
+// clampWindowStart 更早的桶已经过期了 没必要合并
+// 那一天的小时桶也早就过期了 所以直接从下一个整天开始
+func (i *InteractiveRedisCache) clampWindowStart(start, now time.Time) time.Time {
+	earliest := now.Add(-dayBucketExpiration)
+	if !start.Before(earliest) {
+		return start
+	}
+	return time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, earliest.Location()).
+		AddDate(0, 0, 1)
+}
+
+func (i *InteractiveRedisCache) hourBucketKey(biz string, t time.Time) string {
+	return fmt.Sprintf("top_%s:h:%s", biz, t.Format("2006010215"))
+}
+
+func (i *InteractiveRedisCache) dayBucketKey(biz string, t time.Time) string {
+	return fmt.Sprintf("top_%s:d:%s", biz, t.Format("20060102"))
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWindowBucketKeys(t *testing.T) {
+	c := &InteractiveRedisCache{}
+	testCases := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		want  []string
+	}{
+		{
+			name:  "一个小时内",
+			start: time.Date(2024, 4, 10, 10, 20, 0, 0, time.Local),
+			end:   time.Date(2024, 4, 10, 10, 50, 0, 0, time.Local),
+			want:  []string{"top_article:h:2024041010"},
+		},
+		{
+			name:  "跨小时",
+			start: time.Date(2024, 4, 10, 10, 20, 0, 0, time.Local),
+			end:   time.Date(2024, 4, 10, 11, 20, 0, 0, time.Local),
+			want:  []string{"top_article:h:2024041010", "top_article:h:2024041011"},
+		},
+		{
+			name:  "整天使用天桶",
+			start: time.Date(2024, 4, 10, 0, 0, 0, 0, time.Local),
+			end:   time.Date(2024, 4, 11, 0, 0, 0, 0, time.Local),
+			want:  []string{"top_article:d:20240410"},
+		},
+		{
+			name:  "两端使用小时桶",
+			start: time.Date(2024, 4, 9, 22, 0, 0, 0, time.Local),
+			end:   time.Date(2024, 4, 11, 1, 30, 0, 0, time.Local),
+			want: []string{
+				"top_article:h:2024040922",
+				"top_article:h:2024040923",
+				"top_article:d:20240410",
+				"top_article:h:2024041100",
+				"top_article:h:2024041101",
+			},
+		},
+		{
+			name:  "非法窗口",
+			start: time.Date(2024, 4, 11, 0, 0, 0, 0, time.Local),
+			end:   time.Date(2024, 4, 10, 0, 0, 0, 0, time.Local),
+			want:  nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keys := c.windowBucketKeys("article", tc.start, tc.end)
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
+
+func TestWindowLikeTop(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewInteractiveRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})).(*InteractiveRedisCache)
+	ctx := context.Background()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	incr := func(aid int64, delta int64, at time.Time) {
+		require.NoError(t, c.IncrWindowRanking(ctx, "article", aid, delta, at))
+	}
+	incr(1, 1, today.AddDate(0, 0, -2).Add(10*time.Hour))
+	incr(2, 1, today.AddDate(0, 0, -2).Add(23*time.Hour))
+	incr(1, 1, today.AddDate(0, 0, -1).Add(5*time.Hour))
+	incr(1, 1, today.AddDate(0, 0, -1).Add(20*time.Hour))
+	incr(1, 1, today.AddDate(0, 0, -1).Add(21*time.Hour))
+	// 点赞之后又取消了
+	incr(3, 1, today.AddDate(0, 0, -1).Add(6*time.Hour))
+	incr(3, -1, today.AddDate(0, 0, -1).Add(7*time.Hour))
+	incr(2, 1, today.Add(time.Hour))
+	// 窗口之外的
+	incr(4, 5, today.AddDate(0, 0, -2).Add(9*time.Hour))
+	incr(4, 5, today.Add(2*time.Hour))
+
+	// 小时桶和天桶同时写入 第一次创建的时候设置过期时间
+	hourKey := c.hourBucketKey("article", today.Add(time.Hour))
+	dayKey := c.dayBucketKey("article", today.Add(time.Hour))
+	assert.Equal(t, hourBucketExpiration, mr.TTL(hourKey))
+	assert.Equal(t, dayBucketExpiration, mr.TTL(dayKey))
+	score, err := mr.ZScore(dayKey, "4")
+	require.NoError(t, err)
+	assert.Equal(t, float64(5), score)
+	mr.FastForward(time.Minute)
+	incr(2, 1, today.Add(time.Hour+time.Minute))
+	// 后面的写入不会延长过期时间
+	assert.Equal(t, hourBucketExpiration-time.Minute, mr.TTL(hourKey))
+	score, err = mr.ZScore(hourKey, "2")
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), score)
+
+	start := today.AddDate(0, 0, -2).Add(10 * time.Hour)
+	end := today.Add(2 * time.Hour)
+	res, err := c.WindowLikeTop(ctx, "article", start, end, 10)
+	require.NoError(t, err)
+	// 分数为0的不参与排名
+	assert.Equal(t, []domain.Interactive{
+		{Biz: "article", BizId: 1, LikeCnt: 4},
+		{Biz: "article", BizId: 2, LikeCnt: 3},
+	}, res)
+
+	res, err = c.WindowLikeTop(ctx, "article", start, end, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	// 合并的结果会缓存一段时间
+	incr(2, 2, today.Add(time.Hour))
+	res, err = c.WindowLikeTop(ctx, "article", start, end, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res[0].BizId)
+	mr.FastForward(windowMergeExpiration)
+	res, err = c.WindowLikeTop(ctx, "article", start, end, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Interactive{{Biz: "article", BizId: 2, LikeCnt: 5}}, res)
+}
+
+func TestClampWindowStart(t *testing.T) {
+	c := &InteractiveRedisCache{}
+	now := time.Date(2024, 4, 10, 10, 20, 0, 0, time.Local)
+	start := now.Add(-time.Hour)
+	assert.Equal(t, start, c.clampWindowStart(start, now))
+	// 天桶保留了31天 那一天的小时桶已经过期了 从下一个整天开始
+	assert.Equal(t,
+		time.Date(2024, 3, 11, 0, 0, 0, 0, time.Local),
+		c.clampWindowStart(now.AddDate(0, -6, 0), now))
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+)
+
+var (
+	//go:embed lua/cnt_cas.lua
+	luaCntCAS string
+
+	//go:embed lua/ranking_cas.lua
+	luaRankingCAS string
+)
+
+// rankingShards 排行榜按业务id拆分的key数量
+const rankingShards = 100
+
+// InteractiveReconciler 用于核对缓存与数据库中的计数
+// 修正时比较并设置 核对期间有正常更新的不修正 不会覆盖掉这些更新
+// 多个实例重复修正也只会生效一次
+type InteractiveReconciler interface {
+	// ScanCached 分批获得缓存中的互动数据
+	ScanCached(ctx context.Context, biz string, cursor uint64, count int64) ([]domain.Interactive, uint64, error)
+	// SetCntsIfUnchanged 缓存中的计数还是 expected 时改成 val 返回是否修正了 key 不存在时不处理
+	SetCntsIfUnchanged(ctx context.Context, biz string, bizId int64, expected domain.Interactive, val domain.Interactive) (bool, error)
+	// RankingShards 排行榜的分片数量
+	RankingShards() int
+	// ScanRanking 分批获得某个排行榜分片中的点赞数
+	ScanRanking(ctx context.Context, biz string, shard int, cursor uint64, count int64) ([]domain.Interactive, uint64, error)
+	// SetRankingScoreIfUnchanged 排行榜中的点赞数还是 expected 时改成 val 元素不存在时不处理
+	SetRankingScoreIfUnchanged(ctx context.Context, biz string, bizId int64, expected int64, val int64) (bool, error)
+}
+
+// ScanCached
+// SCAN 只保证完整遍历 同一个key可能返回多次 重复核对不影响结果
+func (i *InteractiveRedisCache) ScanCached(
+	ctx context.Context,
+	biz string,
+	cursor uint64,
+	count int64,
+) ([]domain.Interactive, uint64, error) {
+	prefix := fmt.Sprintf("interactive:%s:", biz)
+	keys, next, err := i.client.Scan(ctx, cursor, prefix+"*", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(keys) == 0 {
+		return []domain.Interactive{}, next, nil
+	}
+
+	pipe := i.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, pipe.HGetAll(ctx, key))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]domain.Interactive, 0, len(keys))
+	for idx, cmd := range cmds {
+		bizId, er := strconv.ParseInt(strings.TrimPrefix(keys[idx], prefix), 10, 64)
+		// 扫描到现在已经过期的key 直接跳过
+		if er != nil || len(cmd.Val()) == 0 {
+			continue
+		}
+		val := cmd.Val()
+		intr := domain.Interactive{Biz: biz, BizId: bizId}
+		intr.ReadCnt, _ = strconv.ParseInt(val[fieldReadCnt], 10, 64)
+		intr.LikeCnt, _ = strconv.ParseInt(val[fieldLikeCnt], 10, 64)
+		intr.CollectCnt, _ = strconv.ParseInt(val[fieldCollectCnt], 10, 64)
+		res = append(res, intr)
+	}
+	return res, next, nil
+}
+
+func (i *InteractiveRedisCache) SetCntsIfUnchanged(
+	ctx context.Context,
+	biz string,
+	bizId int64,
+	expected domain.Interactive,
+	val domain.Interactive,
+) (bool, error) {
+	args := make([]any, 0, 9)
+	for _, cnt := range []struct {
+		field    string
+		expected int64
+		val      int64
+	}{
+		{fieldReadCnt, expected.ReadCnt, val.ReadCnt},
+		{fieldLikeCnt, expected.LikeCnt, val.LikeCnt},
+		{fieldCollectCnt, expected.CollectCnt, val.CollectCnt},
+	} {
+		if cnt.expected != cnt.val {
+			args = append(args, cnt.field, cnt.expected, cnt.val)
+		}
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	return i.client.Eval(ctx, luaCntCAS, []string{i.key(biz, bizId)}, args...).Bool()
+}
+
+func (i *InteractiveRedisCache) RankingShards() int {
+	return rankingShards
+}
+
+func (i *InteractiveRedisCache) ScanRanking(
+	ctx context.Context,
+	biz string,
+	shard int,
+	cursor uint64,
+	count int64,
+) ([]domain.Interactive, uint64, error) {
+	key := fmt.Sprintf("top_%s_%d", biz, shard)
+	// 返回的是 member score 交替排列的数组
+	members, next, err := i.client.ZScan(ctx, key, cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]domain.Interactive, 0, len(members)/2)
+	for idx := 0; idx+1 < len(members); idx += 2 {
+		bizId, er := strconv.ParseInt(members[idx], 10, 64)
+		if er != nil {
+			continue
+		}
+		score, er := strconv.ParseFloat(members[idx+1], 64)
+		if er != nil {
+			continue
+		}
+		res = append(res, domain.Interactive{
+			Biz:     biz,
+			BizId:   bizId,
+			LikeCnt: int64(score),
+		})
+	}
+	return res, next, nil
+}
+
+func (i *InteractiveRedisCache) SetRankingScoreIfUnchanged(
+	ctx context.Context,
+	biz string,
+	bizId int64,
+	expected int64,
+	val int64,
+) (bool, error) {
+	return i.client.Eval(ctx, luaRankingCAS, []string{i.rankingKey(biz, bizId)}, bizId, expected, val).Bool()
+}
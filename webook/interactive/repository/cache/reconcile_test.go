@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestInteractiveRedisCache_SetCntsIfUnchanged(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewInteractiveRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})).(*InteractiveRedisCache)
+	ctx := context.Background()
+	key := "interactive:article:1"
+	mr.HSet(key, fieldReadCnt, "10", fieldLikeCnt, "3")
+
+	// 核对期间点赞数变了 整个 key 都不修正
+	ok, err := c.SetCntsIfUnchanged(ctx, "article", 1,
+		domain.Interactive{ReadCnt: 10, LikeCnt: 2},
+		domain.Interactive{ReadCnt: 12, LikeCnt: 5},
+	)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "10", mr.HGet(key, fieldReadCnt))
+
+	// 没有的字段按0比较
+	ok, err = c.SetCntsIfUnchanged(ctx, "article", 1,
+		domain.Interactive{ReadCnt: 10, LikeCnt: 3},
+		domain.Interactive{ReadCnt: 12, LikeCnt: 3, CollectCnt: 1},
+	)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "12", mr.HGet(key, fieldReadCnt))
+	assert.Equal(t, "3", mr.HGet(key, fieldLikeCnt))
+	assert.Equal(t, "1", mr.HGet(key, fieldCollectCnt))
+
+	// 重复修正不会再生效
+	ok, err = c.SetCntsIfUnchanged(ctx, "article", 1,
+		domain.Interactive{ReadCnt: 10, LikeCnt: 3},
+		domain.Interactive{ReadCnt: 12, LikeCnt: 3, CollectCnt: 1},
+	)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 过期的 key 不会被写回去
+	ok, err = c.SetCntsIfUnchanged(ctx, "article", 2,
+		domain.Interactive{},
+		domain.Interactive{ReadCnt: 1},
+	)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, mr.Exists("interactive:article:2"))
+}
+
+func TestInteractiveRedisCache_SetRankingScoreIfUnchanged(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewInteractiveRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})).(*InteractiveRedisCache)
+	ctx := context.Background()
+	key := "top_article_1"
+	_, err := mr.ZAdd(key, 5, "1")
+	require.NoError(t, err)
+
+	ok, err := c.SetRankingScoreIfUnchanged(ctx, "article", 1, 4, 8)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.SetRankingScoreIfUnchanged(ctx, "article", 1, 5, 8)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	score, err := mr.ZScore(key, "1")
+	require.NoError(t, err)
+	assert.Equal(t, float64(8), score)
+
+	// 已经淘汰的元素不会被写回去
+	ok, err = c.SetRankingScoreIfUnchanged(ctx, "article", 101, 0, 8)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	members, err := mr.ZMembers(key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	// 按天的 HyperLogLog 只需要保留到每日任务合并完成
+	dailyUVExpiration = 3 * 24 * time.Hour
+)
+
+// InteractiveUV 基于 HyperLogLog 的独立访客统计
+// 每天一个 HyperLogLog 记录当天的访客 每日任务把前一天的合并到总量中
+type InteractiveUV interface {
+	// AddReader 记录一次阅读 同一个用户一天内只计一次
+	AddReader(ctx context.Context, biz string, bizId int64, uid int64, t time.Time) error
+	// DailyUV 某一天的独立访客数
+	DailyUV(ctx context.Context, biz string, bizId int64, day time.Time) (int64, error)
+	// TotalUV 截止到 now 的独立访客数 已合并的总量与最近两天的数据实时合并
+	TotalUV(ctx context.Context, biz string, bizId int64, now time.Time) (int64, error)
+	// BatchTotalUV 批量查询 返回值与参数一一对应
+	BatchTotalUV(ctx context.Context, biz string, bizIds []int64, now time.Time) ([]int64, error)
+	// MergeDailyUV 把某一天的数据合并到总量中 重复合并不影响结果
+	MergeDailyUV(ctx context.Context, biz string, bizId int64, day time.Time) (int64, error)
+	// ActiveBizIds 分批获得某一天有阅读的业务id
+	ActiveBizIds(ctx context.Context, biz string, day time.Time, cursor uint64, count int64) ([]int64, uint64, error)
+}
+
+func (i *InteractiveRedisCache) AddReader(ctx context.Context, biz string, bizId int64, uid int64, t time.Time) error {
+	dailyKey := i.dailyUVKey(biz, bizId, t)
+	activeKey := i.activeUVKey(biz, t)
+	pipe := i.client.TxPipeline()
+	pipe.PFAdd(ctx, dailyKey, uid)
+	pipe.Expire(ctx, dailyKey, dailyUVExpiration)
+	pipe.SAdd(ctx, activeKey, bizId)
+	pipe.Expire(ctx, activeKey, dailyUVExpiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (i *InteractiveRedisCache) DailyUV(ctx context.Context, biz string, bizId int64, day time.Time) (int64, error) {
+	return i.client.PFCount(ctx, i.dailyUVKey(biz, bizId, day)).Result()
+}
+
+// TotalUV
+// 前一天的数据可能还没有被合并 所以一起参与计算
+// PFCOUNT 多个key时返回的是并集的基数 不会重复计数
+func (i *InteractiveRedisCache) TotalUV(ctx context.Context, biz string, bizId int64, now time.Time) (int64, error) {
+	return i.client.PFCount(
+		ctx,
+		i.totalUVKey(biz, bizId),
+		i.dailyUVKey(biz, bizId, now),
+		i.dailyUVKey(biz, bizId, now.AddDate(0, 0, -1)),
+	).Result()
+}
+
+func (i *InteractiveRedisCache) BatchTotalUV(ctx context.Context, biz string, bizIds []int64, now time.Time) ([]int64, error) {
+	pipe := i.client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(bizIds))
+	for _, bizId := range bizIds {
+		cmds = append(cmds, pipe.PFCount(
+			ctx,
+			i.totalUVKey(biz, bizId),
+			i.dailyUVKey(biz, bizId, now),
+			i.dailyUVKey(biz, bizId, now.AddDate(0, 0, -1)),
+		))
+	}
+	if len(cmds) > 0 {
+		_, err := pipe.Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make([]int64, 0, len(cmds))
+	for _, cmd := range cmds {
+		res = append(res, cmd.Val())
+	}
+	return res, nil
+}
+
+func (i *InteractiveRedisCache) MergeDailyUV(ctx context.Context, biz string, bizId int64, day time.Time) (int64, error) {
+	totalKey := i.totalUVKey(biz, bizId)
+	err := i.client.PFMerge(ctx, totalKey, i.dailyUVKey(biz, bizId, day)).Err()
+	if err != nil {
+		return 0, err
+	}
+	return i.client.PFCount(ctx, totalKey).Result()
+}
+
+func (i *InteractiveRedisCache) ActiveBizIds(
+	ctx context.Context,
+	biz string,
+	day time.Time,
+	cursor uint64,
+	count int64,
+) ([]int64, uint64, error) {
+	members, next, err := i.client.SScan(ctx, i.activeUVKey(biz, day), cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, er := strconv.ParseInt(member, 10, 64)
+		if er != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, next, nil
+}
+
+func (i *InteractiveRedisCache) dailyUVKey(biz string, bizId int64, t time.Time) string {
+	return fmt.Sprintf("uv:%s:%d:%s", biz, bizId, t.Format("20060102"))
+}
+
+func (i *InteractiveRedisCache) totalUVKey(biz string, bizId int64) string {
+	return fmt.Sprintf("uv:%s:%d", biz, bizId)
+}
+
+func (i *InteractiveRedisCache) activeUVKey(biz string, t time.Time) string {
+	return fmt.Sprintf("uv:%s:active:%s", biz, t.Format("20060102"))
+}
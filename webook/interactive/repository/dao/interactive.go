@@ -10,13 +10,21 @@ import (
 type InteractiveDAO interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64) error
-	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	InsertCollectionBiz(ctx context.Context, ucb UserCollectionBiz) error
+	// InsertLikeInfo 返回这次点赞的版本 已经点过赞时返回0 不会重复计数
+	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (int64, error)
+	// DeleteLikeInfo 返回这次取消的版本 没有点过赞时返回0
+	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (int64, error)
+	// InsertCollectionBiz 返回收藏的版本 也就是创建时间
+	InsertCollectionBiz(ctx context.Context, ucb UserCollectionBiz) (int64, error)
 	GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error)
 	GetCollectInfo(ctx context.Context, biz string, id int64, uid int64) (UserCollectionBiz, error)
 	Get(ctx context.Context, biz string, id int64) (Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]Interactive, error)
+	UpsertDailyUV(ctx context.Context, uv DailyUV) error
+	UpdateUVCnt(ctx context.Context, biz string, bizId int64, uvCnt int64) error
+	BatchGetByBiz(ctx context.Context, biz string, startId int64, limit int) ([]Interactive, error)
+	UpsertSnapshots(ctx context.Context, snapshots []DailySnapshot) error
+	GetSnapshots(ctx context.Context, biz string, bizIds []int64, startDay, endDay string) ([]DailySnapshot, error)
 }
 
 type GORMInteractiveDAO struct {
@@ -75,42 +83,60 @@ func (dao *GORMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []stri
 	)
 }
 
-func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
-	now := time.Now().UnixMilli()
-	// 先插入点赞记录 如果已存在将status置为1,代表点赞
-	// 之后更新互动量
-	return dao.db.WithContext(ctx).Transaction(
+// InsertLikeInfo 点赞记录的状态真的变了才更新点赞数
+// 点赞记录的 update_time 就是状态的版本 同一条记录严格递增
+func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (int64, error) {
+	var version int64
+	err := dao.db.WithContext(ctx).Transaction(
 		func(tx *gorm.DB) error {
-			err := tx.Clauses(
-				clause.OnConflict{
-					DoUpdates: clause.Assignments(
+			var ulb UserLikeBiz
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("uid = ? AND biz_id = ? AND biz = ?", uid, id, biz).
+				First(&ulb).Error
+			switch err {
+			case nil:
+				if ulb.Status == 1 {
+					return nil
+				}
+				version = nextLikeVersion(ulb.UpdateTime)
+				err = tx.Model(&UserLikeBiz{}).
+					Where("id = ?", ulb.Id).
+					Updates(
 						map[string]interface{}{
-							"update_time": now,
+							"update_time": version,
 							"status":      1,
 						},
-					),
-				},
-			).Create(
-				&UserLikeBiz{
-					Uid:        uid,
-					Biz:        biz,
-					BizId:      id,
-					Status:     1,
-					UpdateTime: now,
-					CreateTime: now,
-				},
-			).Error
-
+					).Error
+			case gorm.ErrRecordNotFound:
+				version = time.Now().UnixMilli()
+				// 并发插入时只有一个会成功 另一个什么也不做
+				res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(
+					&UserLikeBiz{
+						Uid:        uid,
+						Biz:        biz,
+						BizId:      id,
+						Status:     1,
+						UpdateTime: version,
+						CreateTime: version,
+					},
+				)
+				err = res.Error
+				if err == nil && res.RowsAffected == 0 {
+					version = 0
+					return nil
+				}
+			}
 			if err != nil {
 				return err
 			}
 
-			return tx.WithContext(ctx).Clauses(
+			return tx.Clauses(
 				clause.OnConflict{
+					Columns: []clause.Column{{Name: "biz_id"}, {Name: "biz"}},
 					DoUpdates: clause.Assignments(
 						map[string]interface{}{
 							"like_cnt":    gorm.Expr("`like_cnt` + 1"),
-							"update_time": now,
+							"update_time": version,
 						},
 					),
 				},
@@ -119,28 +145,43 @@ func (dao *GORMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, i
 					Biz:        biz,
 					BizId:      id,
 					LikeCnt:    1,
-					CreateTime: now,
-					UpdateTime: now,
+					CreateTime: version,
+					UpdateTime: version,
 				},
 			).Error
 		},
 	)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
 }
 
-func (dao *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
-	now := time.Now().UnixMilli()
-	return dao.db.WithContext(ctx).Transaction(
+func (dao *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (int64, error) {
+	var version int64
+	err := dao.db.WithContext(ctx).Transaction(
 		func(tx *gorm.DB) error {
+			var ulb UserLikeBiz
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("uid = ? AND biz_id = ? AND biz = ?", uid, id, biz).
+				First(&ulb).Error
+			if err == gorm.ErrRecordNotFound || (err == nil && ulb.Status != 1) {
+				// 没有点过赞
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			version = nextLikeVersion(ulb.UpdateTime)
 			// 软删除
-			err := tx.Model(&UserLikeBiz{}).
-				Where("uid = ? AND biz_id =? AND biz = ?", uid, id, biz).
+			err = tx.Model(&UserLikeBiz{}).
+				Where("id = ?", ulb.Id).
 				Updates(
 					map[string]interface{}{
-						"update_time": now,
+						"update_time": version,
 						"status":      0,
 					},
 				).Error
-
 			if err != nil {
 				return err
 			}
@@ -150,19 +191,28 @@ func (dao *GORMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, i
 				Updates(
 					map[string]interface{}{
 						"like_cnt":    gorm.Expr("`like_cnt` - 1"),
-						"update_time": now,
+						"update_time": version,
 					},
 				).Error
 		},
 	)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// nextLikeVersion 同一毫秒内连续点赞取消 版本也不会重复
+func nextLikeVersion(last int64) int64 {
+	return max(time.Now().UnixMilli(), last+1)
 }
 
-func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, ucb UserCollectionBiz) error {
+func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, ucb UserCollectionBiz) (int64, error) {
 	now := time.Now().UnixMilli()
 	ucb.CreateTime = now
 	ucb.UpdateTime = now
 
-	return dao.db.WithContext(ctx).Transaction(
+	err := dao.db.WithContext(ctx).Transaction(
 		func(tx *gorm.DB) error {
 			err := tx.Create(&ucb).Error
 			if err != nil {
@@ -189,6 +239,10 @@ func (dao *GORMInteractiveDAO) InsertCollectionBiz(ctx context.Context, ucb User
 			).Error
 		},
 	)
+	if err != nil {
+		return 0, err
+	}
+	return now, nil
 }
 
 func (dao *GORMInteractiveDAO) GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error) {
@@ -248,6 +302,8 @@ type Interactive struct {
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
+	// 独立访客数 由每日任务从 HyperLogLog 同步过来
+	UvCnt      int64
 	UpdateTime int64
 	CreateTime int64
 }
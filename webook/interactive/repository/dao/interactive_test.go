@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"testing"
+)
+
+func TestGORMInteractiveDAO_Like(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: glogger.Default.LogMode(glogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&UserLikeBiz{}, &Interactive{}))
+	dao := NewGORMInteractiveDAO(db)
+	ctx := context.Background()
+	likeCnt := func() int64 {
+		intr, er := dao.Get(ctx, "article", 1)
+		require.NoError(t, er)
+		return intr.LikeCnt
+	}
+
+	liked, err := dao.InsertLikeInfo(ctx, "article", 1, 100)
+	require.NoError(t, err)
+	assert.Positive(t, liked)
+	// 重复点赞什么也不做
+	version, err := dao.InsertLikeInfo(ctx, "article", 1, 100)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	assert.Equal(t, int64(1), likeCnt())
+
+	canceled, err := dao.DeleteLikeInfo(ctx, "article", 1, 100)
+	require.NoError(t, err)
+	assert.Greater(t, canceled, liked)
+	version, err = dao.DeleteLikeInfo(ctx, "article", 1, 100)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	assert.Equal(t, int64(0), likeCnt())
+
+	// 同一毫秒内再点赞 版本也是新的
+	again, err := dao.InsertLikeInfo(ctx, "article", 1, 100)
+	require.NoError(t, err)
+	assert.Greater(t, again, canceled)
+	assert.Equal(t, int64(1), likeCnt())
+
+	// 没有点过赞的用户取消
+	version, err = dao.DeleteLikeInfo(ctx, "article", 1, 200)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	assert.Equal(t, int64(1), likeCnt())
+}
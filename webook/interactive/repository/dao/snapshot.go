@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// BatchGetByBiz 按 id 顺序分批获得某个业务的互动数据
+func (dao *GORMInteractiveDAO) BatchGetByBiz(ctx context.Context, biz string, startId int64, limit int) ([]Interactive, error) {
+	var res []Interactive
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND id > ?", biz, startId).
+		Order("id").
+		Limit(limit).
+		Find(&res).
+		Error
+	return res, err
+}
+
+// UpsertSnapshots 保存某一天的快照 重复执行会覆盖
+func (dao *GORMInteractiveDAO) UpsertSnapshots(ctx context.Context, snapshots []DailySnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	for i := range snapshots {
+		snapshots[i].CreateTime = now
+		snapshots[i].UpdateTime = now
+	}
+	return dao.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns(
+				[]string{"read_cnt", "like_cnt", "collect_cnt", "update_time"},
+			),
+		},
+	).Create(&snapshots).Error
+}
+
+// GetSnapshots 获得 [startDay, endDay] 之间的快照
+func (dao *GORMInteractiveDAO) GetSnapshots(
+	ctx context.Context,
+	biz string,
+	bizIds []int64,
+	startDay, endDay string,
+) ([]DailySnapshot, error) {
+	var res []DailySnapshot
+	err := dao.db.WithContext(ctx).
+		Where("biz = ? AND biz_id IN ? AND day BETWEEN ? AND ?", biz, bizIds, startDay, endDay).
+		Order("day").
+		Find(&res).
+		Error
+	return res, err
+}
+
+// DailySnapshot 每天的互动数据快照 记录的是当天结束时的累计值
+type DailySnapshot struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	BizId int64  `gorm:"uniqueIndex:biz_type_id_day"`
+	Biz   string `gorm:"type:varchar(128);uniqueIndex:biz_type_id_day"`
+	// 格式 20060102
+	Day        string `gorm:"type:char(8);uniqueIndex:biz_type_id_day"`
+	ReadCnt    int64
+	LikeCnt    int64
+	CollectCnt int64
+	UpdateTime int64
+	CreateTime int64
+}
+
+func (DailySnapshot) TableName() string {
+	return "interactive_daily_snapshots"
+}
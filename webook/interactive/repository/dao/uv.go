@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// UpsertDailyUV 保存某一天的独立访客数 重复执行会覆盖
+func (dao *GORMInteractiveDAO) UpsertDailyUV(ctx context.Context, uv DailyUV) error {
+	now := time.Now().UnixMilli()
+	uv.CreateTime = now
+	uv.UpdateTime = now
+	return dao.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			DoUpdates: clause.Assignments(
+				map[string]interface{}{
+					"uv_cnt":      uv.UvCnt,
+					"update_time": now,
+				},
+			),
+		},
+	).Create(&uv).Error
+}
+
+// UpdateUVCnt 更新累计的独立访客数
+func (dao *GORMInteractiveDAO) UpdateUVCnt(ctx context.Context, biz string, bizId int64, uvCnt int64) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			DoUpdates: clause.Assignments(
+				map[string]interface{}{
+					"uv_cnt":      uvCnt,
+					"update_time": now,
+				},
+			),
+		},
+	).Create(
+		&Interactive{
+			Biz:        biz,
+			BizId:      bizId,
+			UvCnt:      uvCnt,
+			CreateTime: now,
+			UpdateTime: now,
+		},
+	).Error
+}
+
+// DailyUV 每天的独立访客数
+type DailyUV struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	BizId int64  `gorm:"uniqueIndex:biz_type_id_day"`
+	Biz   string `gorm:"type:varchar(128);uniqueIndex:biz_type_id_day"`
+	// 格式 20060102
+	Day        string `gorm:"type:char(8);uniqueIndex:biz_type_id_day"`
+	UvCnt      int64
+	UpdateTime int64
+	CreateTime int64
+}
+
+func (DailyUV) TableName() string {
+	return "interactive_daily_uvs"
+}
@@ -7,18 +7,39 @@ import (
 	"github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
 	"github.com/ecodeclub/ekit/slice"
+	"time"
 )
 
 type InteractiveRepository interface {
+	InteractiveReconciler
+	InteractiveSnapshotRepository
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	BatchIncrReadCnt(ctx context.Context, biz []string, bizId []int64) error
-	IncrLike(ctx context.Context, biz string, id int64, uid int64) error
-	DecrLike(ctx context.Context, biz string, id int64, uid int64) error
-	AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error
+	// IncrLike 返回这次点赞的版本 已经点过赞时返回0
+	// ranking 为 false 时业务不参与排行榜 不更新排行榜
+	IncrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error)
+	// DecrLike 返回这次取消点赞的版本 没有点过赞时返回0
+	DecrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error)
+	// AddCollectionItem 返回收藏的版本
+	AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) (int64, error)
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
 	Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	Collected(ctx context.Context, biz string, id int64, uid int64) (bool, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error)
+	// MarkRead 去重窗口内的第一次阅读返回 true
+	MarkRead(ctx context.Context, biz string, bizId int64, uid int64, window time.Duration) (bool, error)
+	// BatchMarkRead 批量去重 返回值与参数一一对应
+	BatchMarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64, window time.Duration) ([]bool, error)
+	// UnmarkRead 撤销去重标记 计数失败时调用
+	UnmarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64) error
+	// AddReader 记录独立访客
+	AddReader(ctx context.Context, biz string, bizId int64, uid int64) error
+	// PersistDailyUV 把某一天的独立访客数同步到数据库
+	PersistDailyUV(ctx context.Context, biz string, day time.Time) error
+	// LikeTop 全时段的点赞排行
+	LikeTop(ctx context.Context, biz string, topN int64) ([]domain.Interactive, error)
+	// WindowLikeTop [start, end) 时间窗口内的点赞排行
+	WindowLikeTop(ctx context.Context, biz string, start, end time.Time, topN int64) ([]domain.Interactive, error)
 }
 
 type CachedInteractiveRepository struct {
@@ -44,12 +65,32 @@ func (c *CachedInteractiveRepository) GetByIds(ctx context.Context, biz string,
 	if err != nil {
 		return nil, err
 	}
-	return slice.Map[dao.Interactive, domain.Interactive](
+	res := slice.Map[dao.Interactive, domain.Interactive](
 		intrs,
 		func(idx int, src dao.Interactive) domain.Interactive {
 			return c.toDomain(src)
 		},
-	), nil
+	)
+	// 和 Get 一样使用实时合并出来的独立访客数 数据库中的值要等每日任务同步
+	bizIds := slice.Map[domain.Interactive, int64](
+		res,
+		func(idx int, src domain.Interactive) int64 {
+			return src.BizId
+		},
+	)
+	uvs, err := c.cache.BatchTotalUV(ctx, biz, bizIds, time.Now())
+	if err != nil {
+		c.l.Error(
+			"批量查询独立访客数失败",
+			logger.String("biz", biz),
+			logger.Error(err),
+		)
+		return res, nil
+	}
+	for i := range res {
+		res[i].UvCnt = uvs[i]
+	}
+	return res, nil
 }
 
 func (c *CachedInteractiveRepository) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
@@ -86,45 +127,64 @@ func (c *CachedInteractiveRepository) BatchIncrReadCnt(ctx context.Context, biz
 	return nil
 }
 
-func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
-	if err != nil {
-		return err
+func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	version, err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
+	if err != nil || version == 0 {
+		return version, err
 	}
 	// 更新缓存失败会造成数据与缓存不一致
 	// 从实际使用上来说无关紧要
 
 	// 更新文章互动量缓存中的点赞数
 	err = c.cache.IncrLikeCntIfPresent(ctx, biz, id)
-	if err != nil {
-		return err
+	if err != nil || !ranking {
+		return version, err
 	}
+	// 更新时间窗口排行榜
+	c.incrWindowRanking(ctx, biz, id, 1)
 	// 增加文章排行榜的文章点赞数
 	err = c.cache.IncrRankingIfPresent(ctx, biz, id)
 	if err == cache.ErrRankingUpdate {
 		// 从互动量缓存拿到文章点赞数
 		val, err := c.dao.Get(ctx, biz, id)
 		if err != nil {
-			return err
+			return version, err
 		}
 		// 设置点赞数到文章排行缓存
-		return c.cache.SetRankingScore(ctx, biz, id, val.LikeCnt)
+		return version, c.cache.SetRankingScore(ctx, biz, id, val.LikeCnt)
 	}
-	return err
+	return version, err
 }
 
-func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
-	if err != nil {
-		return err
+func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	version, err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
+	if err != nil || version == 0 {
+		return version, err
 	}
 	// 更新缓存失败会造成数据与缓存不一致
 	// 从实际使用上来说无关紧要
-	return c.cache.DecrLikeCntIfPresent(ctx, biz, id)
+	if ranking {
+		c.incrWindowRanking(ctx, biz, id, -1)
+	}
+	return version, c.cache.DecrLikeCntIfPresent(ctx, biz, id)
 }
 
-func (c *CachedInteractiveRepository) AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error {
-	err := c.dao.InsertCollectionBiz(
+// incrWindowRanking 时间窗口排行榜只是统计数据 失败了不影响点赞本身
+func (c *CachedInteractiveRepository) incrWindowRanking(ctx context.Context, biz string, id int64, delta int64) {
+	err := c.cache.IncrWindowRanking(ctx, biz, id, delta, time.Now())
+	if err != nil {
+		c.l.Error(
+			"更新时间窗口排行榜失败",
+			logger.String("biz", biz),
+			logger.Int64("bizId", id),
+			logger.Int64("delta", delta),
+			logger.Error(err),
+		)
+	}
+}
+
+func (c *CachedInteractiveRepository) AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) (int64, error) {
+	version, err := c.dao.InsertCollectionBiz(
 		ctx,
 		dao.UserCollectionBiz{
 			Biz:   biz,
@@ -134,15 +194,16 @@ func (c *CachedInteractiveRepository) AddCollectionItem(ctx context.Context, biz
 		},
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return c.cache.IncrCollectCntIfPresent(ctx, biz, id)
+	return version, c.cache.IncrCollectCntIfPresent(ctx, biz, id)
 }
 
 func (c *CachedInteractiveRepository) Get(ctx context.Context, biz string, id int64) (domain.Interactive, error) {
 	interactive, err := c.cache.Get(ctx, biz, id)
 	if err == nil {
+		interactive.UvCnt = c.totalUV(ctx, biz, id, interactive.UvCnt)
 		return interactive, nil
 	}
 	ie, err := c.dao.Get(ctx, biz, id)
@@ -152,6 +213,7 @@ func (c *CachedInteractiveRepository) Get(ctx context.Context, biz string, id in
 
 	if err == nil {
 		res := c.toDomain(ie)
+		res.UvCnt = c.totalUV(ctx, biz, id, res.UvCnt)
 		err = c.cache.Set(ctx, biz, id, res)
 		if err != nil {
 			c.l.Error(
@@ -190,14 +252,96 @@ func (c *CachedInteractiveRepository) Collected(ctx context.Context, biz string,
 	}
 }
 
-func (c *CachedInteractiveRepository) LikeTop(ctx context.Context, biz string) ([]domain.Interactive, error) {
-	return c.cache.LikeTop(ctx, biz, 100)
+func (c *CachedInteractiveRepository) MarkRead(ctx context.Context, biz string, bizId int64, uid int64, window time.Duration) (bool, error) {
+	return c.cache.MarkRead(ctx, biz, bizId, uid, window)
+}
+
+func (c *CachedInteractiveRepository) BatchMarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64, window time.Duration) ([]bool, error) {
+	return c.cache.BatchMarkRead(ctx, biz, bizIds, uids, window)
+}
+
+func (c *CachedInteractiveRepository) UnmarkRead(ctx context.Context, biz []string, bizIds []int64, uids []int64) error {
+	return c.cache.UnmarkRead(ctx, biz, bizIds, uids)
+}
+
+func (c *CachedInteractiveRepository) AddReader(ctx context.Context, biz string, bizId int64, uid int64) error {
+	return c.cache.AddReader(ctx, biz, bizId, uid, time.Now())
+}
+
+// PersistDailyUV
+// 遍历当天有阅读的业务 把当天的独立访客合并到总量 然后把当天和累计的数量写回数据库
+// 合并和写库都是幂等的 失败了可以重跑
+func (c *CachedInteractiveRepository) PersistDailyUV(ctx context.Context, biz string, day time.Time) error {
+	var cursor uint64
+	for {
+		ids, next, err := c.cache.ActiveBizIds(ctx, biz, day, cursor, 100)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			err = c.persistDailyUV(ctx, biz, id, day)
+			if err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (c *CachedInteractiveRepository) persistDailyUV(ctx context.Context, biz string, bizId int64, day time.Time) error {
+	daily, err := c.cache.DailyUV(ctx, biz, bizId, day)
+	if err != nil {
+		return err
+	}
+	err = c.dao.UpsertDailyUV(ctx, dao.DailyUV{
+		Biz:   biz,
+		BizId: bizId,
+		Day:   day.Format("20060102"),
+		UvCnt: daily,
+	})
+	if err != nil {
+		return err
+	}
+	total, err := c.cache.MergeDailyUV(ctx, biz, bizId, day)
+	if err != nil {
+		return err
+	}
+	return c.dao.UpdateUVCnt(ctx, biz, bizId, total)
+}
+
+// totalUV 实时合并出来的独立访客数 redis异常时使用数据库中的值
+func (c *CachedInteractiveRepository) totalUV(ctx context.Context, biz string, id int64, fallback int64) int64 {
+	uv, err := c.cache.TotalUV(ctx, biz, id, time.Now())
+	if err != nil {
+		c.l.Error(
+			"查询独立访客数失败",
+			logger.String("biz", biz),
+			logger.Int64("bizId", id),
+			logger.Error(err),
+		)
+		return fallback
+	}
+	return uv
+}
+
+func (c *CachedInteractiveRepository) LikeTop(ctx context.Context, biz string, topN int64) ([]domain.Interactive, error) {
+	return c.cache.LikeTop(ctx, biz, topN)
+}
+
+func (c *CachedInteractiveRepository) WindowLikeTop(ctx context.Context, biz string, start, end time.Time, topN int64) ([]domain.Interactive, error) {
+	return c.cache.WindowLikeTop(ctx, biz, start, end, topN)
 }
 
 func (c *CachedInteractiveRepository) toDomain(ie dao.Interactive) domain.Interactive {
 	return domain.Interactive{
+		Biz:        ie.Biz,
+		BizId:      ie.BizId,
 		ReadCnt:    ie.ReadCnt,
 		LikeCnt:    ie.LikeCnt,
 		CollectCnt: ie.CollectCnt,
+		UvCnt:      ie.UvCnt,
 	}
 }
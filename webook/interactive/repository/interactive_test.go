@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository/cache"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// storedInteractives 数据库里的独立访客数要等每日任务同步
+type storedInteractives struct {
+	dao.InteractiveDAO
+	intrs []dao.Interactive
+}
+
+func (s *storedInteractives) GetByIds(ctx context.Context, biz string, ids []int64) ([]dao.Interactive, error) {
+	return s.intrs, nil
+}
+
+func TestCachedInteractiveRepository_GetByIds(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisCache := cache.NewInteractiveRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	repo := NewCachedInteractiveRepository(&storedInteractives{intrs: []dao.Interactive{
+		{Biz: "article", BizId: 1, ReadCnt: 10, UvCnt: 1},
+		{Biz: "article", BizId: 2, ReadCnt: 20, UvCnt: 5},
+	}}, redisCache, logger.NewNopLogger())
+	ctx := context.Background()
+	now := time.Now()
+	for uid := int64(1); uid <= 3; uid++ {
+		require.NoError(t, redisCache.AddReader(ctx, "article", 1, uid, now))
+	}
+	// 昨天的还没有合并 也要算上
+	require.NoError(t, redisCache.AddReader(ctx, "article", 1, 4, now.AddDate(0, 0, -1)))
+
+	res, err := repo.GetByIds(ctx, "article", []int64{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Interactive{
+		{Biz: "article", BizId: 1, ReadCnt: 10, UvCnt: 4},
+		// 和 Get 一样以 redis 为准
+		{Biz: "article", BizId: 2, ReadCnt: 20, UvCnt: 0},
+	}, res)
+
+	// redis 异常时使用数据库中的值
+	mr.Close()
+	res, err = repo.GetByIds(ctx, "article", []int64{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res[0].UvCnt)
+	assert.Equal(t, int64(5), res[1].UvCnt)
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+)
+
+const (
+	DriftFieldReadCnt    = "read_cnt"
+	DriftFieldLikeCnt    = "like_cnt"
+	DriftFieldCollectCnt = "collect_cnt"
+	// DriftFieldRanking 排行榜中的点赞数
+	DriftFieldRanking = "ranking"
+
+	reconcileBatchSize = 100
+)
+
+// InteractiveReconciler
+// 更新数据库和更新缓存是分开的两步 第二步失败只会记录日志 缓存中的计数会一直偏离
+// 这里以数据库为准 找出缓存中的差异并修正
+// 先读缓存再读数据库 修正时缓存还是读到的值才写入数据库中的值
+// 期间有正常更新的跳过 下一次核对再处理
+type InteractiveReconciler interface {
+	// ReconcileCache 核对互动数据缓存 dryRun 时只返回差异不修正
+	ReconcileCache(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error)
+	// ReconcileRanking 核对排行榜中的点赞数 dryRun 时只返回差异不修正
+	ReconcileRanking(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error)
+}
+
+func (c *CachedInteractiveRepository) ReconcileCache(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error) {
+	var (
+		drifts []domain.InteractiveDrift
+		cursor uint64
+	)
+	for {
+		cached, next, err := c.cache.ScanCached(ctx, biz, cursor, reconcileBatchSize)
+		if err != nil {
+			return drifts, err
+		}
+		stored, err := c.storedByIds(ctx, biz, cached)
+		if err != nil {
+			return drifts, err
+		}
+		for _, intr := range cached {
+			st := stored[intr.BizId]
+			found := c.diffCnt(intr, st)
+			if len(found) == 0 {
+				continue
+			}
+			drifts = append(drifts, found...)
+			if dryRun {
+				continue
+			}
+			ok, err := c.cache.SetCntsIfUnchanged(ctx, biz, intr.BizId, intr, domain.Interactive{
+				ReadCnt:    st.ReadCnt,
+				LikeCnt:    st.LikeCnt,
+				CollectCnt: st.CollectCnt,
+			})
+			c.logRepair(biz, intr.BizId, ok, err)
+		}
+		if next == 0 {
+			return drifts, nil
+		}
+		cursor = next
+	}
+}
+
+func (c *CachedInteractiveRepository) ReconcileRanking(ctx context.Context, biz string, dryRun bool) ([]domain.InteractiveDrift, error) {
+	var drifts []domain.InteractiveDrift
+	for shard := 0; shard < c.cache.RankingShards(); shard++ {
+		var cursor uint64
+		for {
+			cached, next, err := c.cache.ScanRanking(ctx, biz, shard, cursor, reconcileBatchSize)
+			if err != nil {
+				return drifts, err
+			}
+			stored, err := c.storedByIds(ctx, biz, cached)
+			if err != nil {
+				return drifts, err
+			}
+			for _, intr := range cached {
+				if intr.LikeCnt == stored[intr.BizId].LikeCnt {
+					continue
+				}
+				drift := domain.InteractiveDrift{
+					Biz:    biz,
+					BizId:  intr.BizId,
+					Field:  DriftFieldRanking,
+					Cached: intr.LikeCnt,
+					Stored: stored[intr.BizId].LikeCnt,
+				}
+				drifts = append(drifts, drift)
+				if dryRun {
+					continue
+				}
+				ok, err := c.cache.SetRankingScoreIfUnchanged(ctx, biz, intr.BizId, drift.Cached, drift.Stored)
+				c.logRepair(biz, intr.BizId, ok, err)
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return drifts, nil
+}
+
+// storedByIds 数据库中没有的记录按0处理
+func (c *CachedInteractiveRepository) storedByIds(
+	ctx context.Context,
+	biz string,
+	cached []domain.Interactive,
+) (map[int64]dao.Interactive, error) {
+	res := make(map[int64]dao.Interactive, len(cached))
+	if len(cached) == 0 {
+		return res, nil
+	}
+	ids := make([]int64, 0, len(cached))
+	for _, intr := range cached {
+		ids = append(ids, intr.BizId)
+	}
+	intrs, err := c.dao.GetByIds(ctx, biz, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, intr := range intrs {
+		res[intr.BizId] = intr
+	}
+	return res, nil
+}
+
+func (c *CachedInteractiveRepository) diffCnt(cached domain.Interactive, stored dao.Interactive) []domain.InteractiveDrift {
+	var drifts []domain.InteractiveDrift
+	for _, pair := range []struct {
+		field  string
+		cached int64
+		stored int64
+	}{
+		{DriftFieldReadCnt, cached.ReadCnt, stored.ReadCnt},
+		{DriftFieldLikeCnt, cached.LikeCnt, stored.LikeCnt},
+		{DriftFieldCollectCnt, cached.CollectCnt, stored.CollectCnt},
+	} {
+		if pair.cached == pair.stored {
+			continue
+		}
+		drifts = append(drifts, domain.InteractiveDrift{
+			Biz:    cached.Biz,
+			BizId:  cached.BizId,
+			Field:  pair.field,
+			Cached: pair.cached,
+			Stored: pair.stored,
+		})
+	}
+	return drifts
+}
+
+func (c *CachedInteractiveRepository) logRepair(biz string, bizId int64, ok bool, err error) {
+	if err != nil {
+		c.l.Error(
+			"修正缓存失败",
+			logger.String("biz", biz),
+			logger.Int64("bizId", bizId),
+			logger.Error(err),
+		)
+		return
+	}
+	if !ok {
+		c.l.Debug(
+			"核对期间缓存有变化 下次再修正",
+			logger.String("biz", biz),
+			logger.Int64("bizId", bizId),
+		)
+	}
+}
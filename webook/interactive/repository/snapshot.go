@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+const snapshotBatchSize = 500
+
+type InteractiveSnapshotRepository interface {
+	// SnapshotDaily 把当前的累计值记录为 day 这一天的快照
+	SnapshotDaily(ctx context.Context, biz string, day time.Time) error
+	// GetSnapshots 获得 [start, end] 之间每天的快照 精度为天
+	GetSnapshots(ctx context.Context, biz string, ids []int64, start, end time.Time) ([]domain.InteractiveSnapshot, error)
+}
+
+func (c *CachedInteractiveRepository) SnapshotDaily(ctx context.Context, biz string, day time.Time) error {
+	dayStr := day.Format("20060102")
+	var startId int64
+	for {
+		intrs, err := c.dao.BatchGetByBiz(ctx, biz, startId, snapshotBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(intrs) == 0 {
+			return nil
+		}
+		snapshots := slice.Map[dao.Interactive, dao.DailySnapshot](
+			intrs,
+			func(idx int, src dao.Interactive) dao.DailySnapshot {
+				return dao.DailySnapshot{
+					Biz:        src.Biz,
+					BizId:      src.BizId,
+					Day:        dayStr,
+					ReadCnt:    src.ReadCnt,
+					LikeCnt:    src.LikeCnt,
+					CollectCnt: src.CollectCnt,
+				}
+			},
+		)
+		err = c.dao.UpsertSnapshots(ctx, snapshots)
+		if err != nil {
+			return err
+		}
+		if len(intrs) < snapshotBatchSize {
+			return nil
+		}
+		startId = intrs[len(intrs)-1].Id
+	}
+}
+
+func (c *CachedInteractiveRepository) GetSnapshots(
+	ctx context.Context,
+	biz string,
+	ids []int64,
+	start, end time.Time,
+) ([]domain.InteractiveSnapshot, error) {
+	if len(ids) == 0 {
+		return []domain.InteractiveSnapshot{}, nil
+	}
+	snapshots, err := c.dao.GetSnapshots(ctx, biz, ids, start.Format("20060102"), end.Format("20060102"))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.InteractiveSnapshot, 0, len(snapshots))
+	for _, s := range snapshots {
+		day, er := time.ParseInLocation("20060102", s.Day, time.Local)
+		if er != nil {
+			continue
+		}
+		res = append(res, domain.InteractiveSnapshot{
+			Biz:        s.Biz,
+			BizId:      s.BizId,
+			Day:        day,
+			ReadCnt:    s.ReadCnt,
+			LikeCnt:    s.LikeCnt,
+			CollectCnt: s.CollectCnt,
+		})
+	}
+	return res, nil
+}
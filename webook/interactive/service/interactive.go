@@ -2,11 +2,19 @@ package service
 
 import (
 	"context"
+	"errors"
+	bizpkg "github.com/Anwenya/GeekTime/webook/interactive/biz"
 	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	"github.com/Anwenya/GeekTime/webook/interactive/events"
 	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
 	"golang.org/x/sync/errgroup"
+	"time"
 )
 
+// ErrInvalidWindow 排行榜的时间窗口开始时间不早于结束时间
+var ErrInvalidWindow = errors.New("时间窗口不合法")
+
 type InteractiveService interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
 	Like(c context.Context, biz string, id int64, uid int64) error
@@ -14,17 +22,41 @@ type InteractiveService interface {
 	Collect(ctx context.Context, biz string, bizId, cid, uid int64) error
 	Get(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error)
+	// LikeTop 全时段的点赞排行
+	LikeTop(ctx context.Context, biz string, n int64) ([]domain.Interactive, error)
+	// WindowLikeTop [start, end) 时间窗口内的点赞排行
+	// start 不早于 end 时返回 ErrInvalidWindow 超过分桶保留时间的部分查不到
+	WindowLikeTop(ctx context.Context, biz string, start, end time.Time, n int64) ([]domain.Interactive, error)
+	// GetSnapshots [start, end] 之间每天的互动数据快照
+	GetSnapshots(ctx context.Context, biz string, ids []int64, start, end time.Time) ([]domain.InteractiveSnapshot, error)
 }
 
 type interactiveService struct {
-	repo repository.InteractiveRepository
+	repo     repository.InteractiveRepository
+	producer events.Producer
+	// 只允许注册过的业务使用 并且要开启对应的功能
+	registry bizpkg.Registry
+	l        logger.LoggerV1
 }
 
-func NewInteractiveService(repo repository.InteractiveRepository) InteractiveService {
-	return &interactiveService{repo: repo}
+func NewInteractiveService(
+	repo repository.InteractiveRepository,
+	producer events.Producer,
+	registry bizpkg.Registry,
+	l logger.LoggerV1,
+) InteractiveService {
+	return &interactiveService{
+		repo:     repo,
+		producer: producer,
+		registry: registry,
+		l:        l,
+	}
 }
 
 func (i *interactiveService) GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error) {
+	if err := bizpkg.Known(i.registry, biz); err != nil {
+		return nil, err
+	}
 	intrs, err := i.repo.GetByIds(ctx, biz, ids)
 	if err != nil {
 		return nil, err
@@ -37,22 +69,118 @@ func (i *interactiveService) GetByIds(ctx context.Context, biz string, ids []int
 }
 
 func (i *interactiveService) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
+	if err := bizpkg.Read(i.registry, biz); err != nil {
+		return err
+	}
 	return i.repo.IncrReadCnt(ctx, biz, bizId)
 }
 
+// Like 写入成功之后才发送事件 发送失败不影响本次操作的结果
+// 已经点过赞时什么也不做 也不发送事件
+// 幂等键用的是点赞状态的版本 同一次点赞不管发送几次都是同一个键
 func (i *interactiveService) Like(c context.Context, biz string, id int64, uid int64) error {
-	return i.repo.IncrLike(c, biz, id, uid)
+	err := bizpkg.Like(i.registry, biz)
+	if err != nil {
+		return err
+	}
+	version, err := i.repo.IncrLike(c, biz, id, uid, i.ranking(biz))
+	if version == 0 {
+		return err
+	}
+	// 数据库已经写成功了 缓存出错也要发事件
+	i.logCacheErr(err, biz, id, uid)
+	err = i.producer.ProduceLikeEvent(c, events.LikeEvent{
+		IdempotencyKey: events.IdempotencyKey(events.TopicLikeEvent, biz, id, uid, version),
+		Biz:            biz,
+		BizId:          id,
+		Uid:            uid,
+		LikeTime:       version,
+	})
+	i.logProduceErr(err, events.TopicLikeEvent, biz, id, uid)
+	return nil
 }
 
 func (i *interactiveService) CancelLike(c context.Context, biz string, id int64, uid int64) error {
-	return i.repo.DecrLike(c, biz, id, uid)
+	err := bizpkg.Like(i.registry, biz)
+	if err != nil {
+		return err
+	}
+	version, err := i.repo.DecrLike(c, biz, id, uid, i.ranking(biz))
+	if version == 0 {
+		return err
+	}
+	// 数据库已经写成功了 缓存出错也要发事件
+	i.logCacheErr(err, biz, id, uid)
+	err = i.producer.ProduceCancelLikeEvent(c, events.CancelLikeEvent{
+		IdempotencyKey: events.IdempotencyKey(events.TopicCancelLikeEvent, biz, id, uid, version),
+		Biz:            biz,
+		BizId:          id,
+		Uid:            uid,
+		CancelTime:     version,
+	})
+	i.logProduceErr(err, events.TopicCancelLikeEvent, biz, id, uid)
+	return nil
 }
 
 func (i *interactiveService) Collect(ctx context.Context, biz string, bizId, cid, uid int64) error {
-	return i.repo.AddCollectionItem(ctx, biz, bizId, cid, uid)
+	err := bizpkg.Collect(i.registry, biz)
+	if err != nil {
+		return err
+	}
+	version, err := i.repo.AddCollectionItem(ctx, biz, bizId, cid, uid)
+	if version == 0 {
+		return err
+	}
+	i.logCacheErr(err, biz, bizId, uid)
+	err = i.producer.ProduceCollectEvent(ctx, events.CollectEvent{
+		IdempotencyKey: events.IdempotencyKey(events.TopicCollectEvent, biz, bizId, uid, version),
+		Biz:            biz,
+		BizId:          bizId,
+		Uid:            uid,
+		Cid:            cid,
+		CollectTime:    version,
+	})
+	i.logProduceErr(err, events.TopicCollectEvent, biz, bizId, uid)
+	return nil
+}
+
+// ranking 没有开启排行榜的业务 点赞时也不写排行榜 否则排行榜的数据会一直增长
+func (i *interactiveService) ranking(biz string) bool {
+	return bizpkg.Ranking(i.registry, biz) == nil
+}
+
+// logCacheErr 缓存和排行榜只影响展示 不影响这次操作的结果
+func (i *interactiveService) logCacheErr(err error, biz string, bizId int64, uid int64) {
+	if err == nil {
+		return
+	}
+	i.l.Error(
+		"更新互动缓存失败",
+		logger.String("biz", biz),
+		logger.Int64("bizId", bizId),
+		logger.Int64("uid", uid),
+		logger.Error(err),
+	)
+}
+
+func (i *interactiveService) logProduceErr(err error, topic string, biz string, bizId int64, uid int64) {
+	if err == nil {
+		return
+	}
+	i.l.Error(
+		"发送互动事件失败",
+		logger.String("topic", topic),
+		logger.String("biz", biz),
+		logger.Int64("bizId", bizId),
+		logger.Int64("uid", uid),
+		logger.Error(err),
+	)
 }
 
 func (i *interactiveService) Get(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, error) {
+	if err := bizpkg.Known(i.registry, biz); err != nil {
+		return domain.Interactive{}, err
+	}
 	interactive, err := i.repo.Get(ctx, biz, id)
 	if err != nil {
 		return domain.Interactive{}, err
@@ -71,3 +199,27 @@ func (i *interactiveService) Get(ctx context.Context, biz string, id int64, uid
 	})
 	return interactive, eg.Wait()
 }
+
+func (i *interactiveService) LikeTop(ctx context.Context, biz string, n int64) ([]domain.Interactive, error) {
+	if err := bizpkg.Ranking(i.registry, biz); err != nil {
+		return nil, err
+	}
+	return i.repo.LikeTop(ctx, biz, n)
+}
+
+func (i *interactiveService) WindowLikeTop(ctx context.Context, biz string, start, end time.Time, n int64) ([]domain.Interactive, error) {
+	if err := bizpkg.Ranking(i.registry, biz); err != nil {
+		return nil, err
+	}
+	if !start.Before(end) {
+		return nil, ErrInvalidWindow
+	}
+	return i.repo.WindowLikeTop(ctx, biz, start, end, n)
+}
+
+func (i *interactiveService) GetSnapshots(ctx context.Context, biz string, ids []int64, start, end time.Time) ([]domain.InteractiveSnapshot, error) {
+	if err := bizpkg.Known(i.registry, biz); err != nil {
+		return nil, err
+	}
+	return i.repo.GetSnapshots(ctx, biz, ids, start, end)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	bizpkg "github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"github.com/Anwenya/GeekTime/webook/interactive/events"
+	"github.com/Anwenya/GeekTime/webook/interactive/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// rankedLikes 记录每次点赞和取消点赞是否更新排行榜
+type rankedLikes struct {
+	repository.InteractiveRepository
+	ranking map[string]bool
+}
+
+func (r *rankedLikes) IncrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	r.ranking["like:"+biz] = ranking
+	return 1, nil
+}
+
+func (r *rankedLikes) DecrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	r.ranking["cancel:"+biz] = ranking
+	return 1, nil
+}
+
+type nopProducer struct {
+	events.Producer
+}
+
+func (nopProducer) ProduceLikeEvent(ctx context.Context, evt events.LikeEvent) error {
+	return nil
+}
+
+func (nopProducer) ProduceCancelLikeEvent(ctx context.Context, evt events.CancelLikeEvent) error {
+	return nil
+}
+
+func TestInteractiveService_LikeRanking(t *testing.T) {
+	repo := &rankedLikes{ranking: map[string]bool{}}
+	svc := NewInteractiveService(repo, nopProducer{}, bizpkg.NewConfigRegistry([]bizpkg.Config{
+		{Name: "article", LikeEnabled: true, Ranking: true},
+		{Name: "comment", LikeEnabled: true},
+	}), logger.NewNopLogger())
+	ctx := context.Background()
+	for _, biz := range []string{"article", "comment"} {
+		require.NoError(t, svc.Like(ctx, biz, 1, 2))
+		require.NoError(t, svc.CancelLike(ctx, biz, 1, 2))
+	}
+	// 没有开启排行榜的业务不写排行榜
+	assert.Equal(t, map[string]bool{
+		"like:article":   true,
+		"cancel:article": true,
+		"like:comment":   false,
+		"cancel:comment": false,
+	}, repo.ranking)
+
+	_, err := svc.LikeTop(ctx, "comment", 10)
+	assert.ErrorIs(t, err, bizpkg.ErrDisabled)
+	assert.ErrorIs(t, svc.Like(ctx, "video", 1, 2), bizpkg.ErrUnknownBiz)
+}
+
+// cacheFailed 数据库写成功了 但是更新缓存失败
+type cacheFailed struct {
+	repository.InteractiveRepository
+}
+
+func (cacheFailed) IncrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	return 1, errors.New("缓存错误")
+}
+
+func (cacheFailed) DecrLike(ctx context.Context, biz string, id int64, uid int64, ranking bool) (int64, error) {
+	return 2, errors.New("缓存错误")
+}
+
+func (cacheFailed) AddCollectionItem(ctx context.Context, biz string, id int64, cid int64, uid int64) (int64, error) {
+	return 3, errors.New("缓存错误")
+}
+
+// recordProducer 记录发出去的事件
+type recordProducer struct {
+	events.Producer
+	topics []string
+}
+
+func (r *recordProducer) ProduceLikeEvent(ctx context.Context, evt events.LikeEvent) error {
+	r.topics = append(r.topics, events.TopicLikeEvent)
+	return nil
+}
+
+func (r *recordProducer) ProduceCancelLikeEvent(ctx context.Context, evt events.CancelLikeEvent) error {
+	r.topics = append(r.topics, events.TopicCancelLikeEvent)
+	return nil
+}
+
+func (r *recordProducer) ProduceCollectEvent(ctx context.Context, evt events.CollectEvent) error {
+	r.topics = append(r.topics, events.TopicCollectEvent)
+	return nil
+}
+
+func TestInteractiveService_CacheErr(t *testing.T) {
+	producer := &recordProducer{}
+	svc := NewInteractiveService(cacheFailed{}, producer, bizpkg.NewConfigRegistry([]bizpkg.Config{
+		{Name: "article", LikeEnabled: true, CollectEnabled: true, Ranking: true},
+	}), logger.NewNopLogger())
+	ctx := context.Background()
+	// 缓存失败不影响结果 事件也不能丢
+	require.NoError(t, svc.Like(ctx, "article", 1, 2))
+	require.NoError(t, svc.CancelLike(ctx, "article", 1, 2))
+	require.NoError(t, svc.Collect(ctx, "article", 1, 3, 2))
+	assert.Equal(t, []string{
+		events.TopicLikeEvent,
+		events.TopicCancelLikeEvent,
+		events.TopicCollectEvent,
+	}, producer.topics)
+}
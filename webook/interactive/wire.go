@@ -13,12 +13,14 @@ import (
 	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
 	"github.com/Anwenya/GeekTime/webook/pkg/grpcx"
 	"github.com/google/wire"
+	"github.com/robfig/cron/v3"
 )
 
 type App struct {
 	server      *grpcx.Server
 	consumers   []events.Consumer
 	adminServer *ginx.Server
+	cron        *cron.Cron
 }
 
 var thirdPartySet = wire.NewSet(
@@ -30,6 +32,8 @@ var thirdPartySet = wire.NewSet(
 	ioc.InitSaramaClient,
 	ioc.InitSaramaSyncProducer,
 	ioc.InitRedis,
+	ioc.InitBizRegistry,
+	ioc.InitLocker,
 )
 
 var interactiveServiceSet = wire.NewSet(
@@ -57,11 +61,17 @@ func InitApp() *App {
 		events.NewInteractiveReadEventConsumer,
 		events.NewHistoryRecordConsumer,
 		ioc.InitInteractiveProducer,
+		events.NewSaramaSyncProducer,
 		ioc.InitFixerConsumer,
 		ioc.InitConsumers,
 		ioc.NewGrpcxServer,
 		ioc.InitGinxServer,
 
+		ioc.InitDailyUVJob,
+		ioc.InitDailySnapshotJob,
+		ioc.InitReconcileJob,
+		ioc.InitJobs,
+
 		wire.Struct(new(App), "*"),
 	)
 	return new(App)
@@ -17,6 +17,7 @@ import (
 	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
 	"github.com/Anwenya/GeekTime/webook/pkg/grpcx"
 	"github.com/google/wire"
+	"github.com/robfig/cron/v3"
 )
 
 import (
@@ -37,23 +38,31 @@ func InitApp() *App {
 	cmdable := ioc.InitRedis()
 	interactiveCache := cache.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository.NewCachedInteractiveRepository(interactiveDAO, interactiveCache, loggerV1)
-	interactiveService := service.NewInteractiveService(interactiveRepository)
+	client := ioc.InitSaramaClient()
+	syncProducer := ioc.InitSaramaSyncProducer(client)
+	producer := events.NewSaramaSyncProducer(syncProducer)
+	registry := ioc.InitBizRegistry(loggerV1)
+	interactiveService := service.NewInteractiveService(interactiveRepository, producer, registry, loggerV1)
 	interactiveServiceServer := grpc.NewInteractiveServiceServer(interactiveService)
 	server := ioc.NewGrpcxServer(interactiveServiceServer, loggerV1)
-	client := ioc.InitSaramaClient()
-	interactiveReadEventConsumer := events.NewInteractiveReadEventConsumer(interactiveRepository, client, loggerV1)
+	interactiveReadEventConsumer := events.NewInteractiveReadEventConsumer(interactiveRepository, client, loggerV1, registry)
 	historyDao := dao.NewGORMHistoryDAO(db)
 	readHistoryRepository := repository.NewCachedReadHistoryRepository(historyDao)
 	historyRecordConsumer := events.NewHistoryRecordConsumer(readHistoryRepository, client, loggerV1)
 	consumer := ioc.InitFixerConsumer(client, loggerV1, srcDB, dstDB)
 	v := ioc.InitConsumers(interactiveReadEventConsumer, historyRecordConsumer, consumer)
-	syncProducer := ioc.InitSaramaSyncProducer(client)
-	producer := ioc.InitInteractiveProducer(syncProducer)
-	ginxServer := ioc.InitGinxServer(srcDB, dstDB, doubleWritePool, producer, loggerV1)
+	eventsProducer := ioc.InitInteractiveProducer(syncProducer)
+	ginxServer := ioc.InitGinxServer(srcDB, dstDB, doubleWritePool, eventsProducer, loggerV1)
+	dailyUVJob := ioc.InitDailyUVJob(interactiveRepository, registry, loggerV1)
+	dailySnapshotJob := ioc.InitDailySnapshotJob(interactiveRepository, registry, loggerV1)
+	reconcileJob := ioc.InitReconcileJob(interactiveRepository, registry, loggerV1)
+	locker := ioc.InitLocker(cmdable)
+	cron := ioc.InitJobs(loggerV1, locker, dailyUVJob, dailySnapshotJob, reconcileJob)
 	app := &App{
 		server:      server,
 		consumers:   v,
 		adminServer: ginxServer,
+		cron:        cron,
 	}
 	return app
 }
@@ -64,6 +73,7 @@ type App struct {
 	server      *grpcx.Server
 	consumers   []events.Consumer
 	adminServer *ginx.Server
+	cron        *cron.Cron
 }
 
 var thirdPartySet = wire.NewSet(ioc.InitLogger, ioc.InitDstDB, ioc.InitSrcDB, ioc.InitDoubleWritePool, ioc.InitBizDB, ioc.InitSaramaClient, ioc.InitSaramaSyncProducer, ioc.InitRedis)
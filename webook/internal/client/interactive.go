@@ -58,3 +58,11 @@ func (i *InteractiveClient) Get(ctx context.Context, in *interactivev1.GetReques
 func (i *InteractiveClient) GetByIds(ctx context.Context, in *interactivev1.GetByIdsRequest, opts ...grpc.CallOption) (*interactivev1.GetByIdsResponse, error) {
 	return i.selectClient().GetByIds(ctx, in, opts...)
 }
+
+func (i *InteractiveClient) LikeTop(ctx context.Context, in *interactivev1.LikeTopRequest, opts ...grpc.CallOption) (*interactivev1.LikeTopResponse, error) {
+	return i.selectClient().LikeTop(ctx, in, opts...)
+}
+
+func (i *InteractiveClient) GetSnapshots(ctx context.Context, in *interactivev1.GetSnapshotsRequest, opts ...grpc.CallOption) (*interactivev1.GetSnapshotsResponse, error) {
+	return i.selectClient().GetSnapshots(ctx, in, opts...)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
 	"github.com/Anwenya/GeekTime/webook/interactive/domain"
+	intrgrpc "github.com/Anwenya/GeekTime/webook/interactive/grpc"
 	"github.com/Anwenya/GeekTime/webook/interactive/service"
 	"google.golang.org/grpc"
+	"time"
 )
 
 type LocalInteractiveServiceAdapter struct {
@@ -60,6 +62,48 @@ func (l *LocalInteractiveServiceAdapter) GetByIds(ctx context.Context, in *inter
 	}, nil
 }
 
+func (l *LocalInteractiveServiceAdapter) LikeTop(ctx context.Context, in *interactivev1.LikeTopRequest, opts ...grpc.CallOption) (*interactivev1.LikeTopResponse, error) {
+	// 和 gRPC 服务端的默认数量和时间窗口保持一致
+	res, err := intrgrpc.LikeTop(ctx, l.svc, in)
+	if err != nil {
+		return nil, err
+	}
+	intrs := make([]*interactivev1.Interactive, 0, len(res))
+	for _, intr := range res {
+		intrs = append(intrs, l.toDTO(intr))
+	}
+	return &interactivev1.LikeTopResponse{
+		Interactives: intrs,
+	}, nil
+}
+
+func (l *LocalInteractiveServiceAdapter) GetSnapshots(ctx context.Context, in *interactivev1.GetSnapshotsRequest, opts ...grpc.CallOption) (*interactivev1.GetSnapshotsResponse, error) {
+	res, err := l.svc.GetSnapshots(
+		ctx,
+		in.GetBiz(),
+		in.GetBizIds(),
+		time.UnixMilli(in.GetStart()),
+		time.UnixMilli(in.GetEnd()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]*interactivev1.InteractiveSnapshot, 0, len(res))
+	for _, s := range res {
+		snapshots = append(snapshots, &interactivev1.InteractiveSnapshot{
+			Biz:        s.Biz,
+			BizId:      s.BizId,
+			Day:        s.Day.UnixMilli(),
+			ReadCnt:    s.ReadCnt,
+			LikeCnt:    s.LikeCnt,
+			CollectCnt: s.CollectCnt,
+		})
+	}
+	return &interactivev1.GetSnapshotsResponse{
+		Snapshots: snapshots,
+	}, nil
+}
+
 func (l *LocalInteractiveServiceAdapter) toDTO(interactive domain.Interactive) *interactivev1.Interactive {
 	return &interactivev1.Interactive{
 		Biz:        interactive.Biz,
@@ -69,5 +113,6 @@ func (l *LocalInteractiveServiceAdapter) toDTO(interactive domain.Interactive) *
 		Collected:  interactive.Collected,
 		Liked:      interactive.Liked,
 		LikeCnt:    interactive.LikeCnt,
+		UvCnt:      interactive.UvCnt,
 	}
 }
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// DailyStat 某一天结束时的累计互动数据 以及与前一天相比的增量
+type DailyStat struct {
+	Day          time.Time
+	ReadCnt      int64
+	LikeCnt      int64
+	CollectCnt   int64
+	ReadDelta    int64
+	LikeDelta    int64
+	CollectDelta int64
+}
+
+// ArticleTrend 单篇文章在时间段内的趋势
+type ArticleTrend struct {
+	Article Article
+	Stats   []DailyStat
+	// 时间段内的增量
+	ReadGain    int64
+	LikeGain    int64
+	CollectGain int64
+}
+
+// AuthorAnalytics 作者在时间段内的数据
+type AuthorAnalytics struct {
+	Start time.Time
+	End   time.Time
+	// Total 所有文章按天汇总
+	Total    []DailyStat
+	Articles []ArticleTrend
+	// TopArticles 时间段内阅读增量最多的文章
+	TopArticles []ArticleTrend
+}
@@ -2,6 +2,9 @@ package domain
 
 import "time"
 
+// BizArticle 文章在互动服务中的业务类型
+const BizArticle = "article"
+
 type Article struct {
 	Id         int64
 	Title      string
@@ -10,6 +13,12 @@ type Article struct {
 	Status     ArticleStatus
 	CreateTime time.Time
 	UpdateTime time.Time
+	// 作者选择的参与排名的阅读指标 read_cnt 或者 uv_cnt 为空时使用榜单的配置
+	ReadMetric string
+	// 分类 可以为空 按分类分组的榜单每个分类一份
+	Category string
+	// 标签 按标签分组的榜单每个标签一份
+	Tags []string
 }
 
 // Abstract 文章摘要
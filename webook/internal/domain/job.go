@@ -1,10 +1,23 @@
 package domain
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/robfig/cron/v3"
+	"math"
+	"strings"
 	"time"
 )
 
+// 支持秒级的 cron 表达式 以及 @every 1m 这种描述符
+var jobCronParser = cron.NewParser(
+	cron.Second | cron.Minute |
+		cron.Hour | cron.Dom |
+		cron.Month | cron.Dow |
+		cron.Descriptor,
+)
+
 type Job struct {
 	Id      int64
 	Version int
@@ -16,15 +29,367 @@ type Job struct {
 	// 任务配置
 	Config    string
 	CancelFun func()
+	// 续约时发现任务已经被别人抢走或者删除了就会关闭 执行中的任务应该停下来
+	// 续约一直失败 快要被别人抢走的时候也会关闭
+	LeaseLost <-chan struct{}
+
+	Status JobStatus
+	// 按照 cron 表达式计算出来的下一次执行时间
+	ScheduledTime time.Time
+	// 手动触发的时间 零值表示没有手动触发
+	TriggerTime time.Time
+	// 最近一次执行的情况
+	LastRun JobRun
+	// 连续失败的次数 成功或者放弃重试之后清零
+	Attempt int
+
+	Mode JobMode
+	// 分片模式下拆成几个分片
+	Shards int
+	// 广播和分片模式下 抢到的是分发出来的子任务 其他模式为 nil
+	Task *JobTask
+
+	// cron 表达式使用的时区 例如 Asia/Shanghai 为空时使用本地时区
+	Timezone string
+	// 停机或者执行太久错过了执行时间怎么处理
+	Misfire JobMisfirePolicy
+	// 一次执行最长多久 超过之后取消执行 0 表示不限制
+	MaxDuration time.Duration
+	// 越大越先执行 同样优先级的先到执行时间的先执行
+	Priority int
+
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+// JobPreemptFilter 本节点已经达到并发上限的执行器和任务 抢占的时候跳过
+type JobPreemptFilter struct {
+	Executors []string
+	JobIds    []int64
+}
+
+// Schedule 按照任务的时区解析 cron 表达式
+func (j Job) Schedule() (cron.Schedule, error) {
+	return ParseJobSchedule(j.Expression, j.Timezone)
+}
+
+// NextTime 从现在开始的下一次执行时间
+func (j Job) NextTime() (time.Time, error) {
+	s, err := j.Schedule()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.Next(time.Now()), nil
+}
+
+// NextAfter 执行完预定在 scheduled 的这一次之后 下一次的执行时间
+// 下一次也已经错过了的话按照 Misfire 策略处理
+// 只有 JobMisfireFireAll 会补上错过的执行 其他策略都从 now 开始算
+func (j Job) NextAfter(scheduled, now time.Time) (time.Time, error) {
+	s, err := j.Schedule()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if scheduled.IsZero() {
+		return s.Next(now), nil
+	}
+	next := s.Next(scheduled)
+	if next.IsZero() || next.After(now.Add(-JobMisfireThreshold)) ||
+		j.Misfire == JobMisfireFireAll {
+		return next, nil
+	}
+	return s.Next(now), nil
+}
+
+// Misfired 抢到任务的时候已经超过预定的执行时间太久了
+// 手动触发的不算
+func (j Job) Misfired(now time.Time) bool {
+	if !j.TriggerTime.IsZero() || j.ScheduledTime.IsZero() {
+		return false
+	}
+	return now.Sub(j.ScheduledTime) > JobMisfireThreshold
+}
+
+// ShardInfo 这次执行的分片序号和分片总数
+// 广播模式下总数是分发时存活的节点数量 不分片时返回 0 1
+func (j Job) ShardInfo() (int, int) {
+	if j.Task == nil {
+		return 0, 1
+	}
+	return j.Task.Shard, j.Task.Shards
+}
+
+// ParseJobExpression 校验 cron 表达式 使用本地时区
+func ParseJobExpression(expr string) (cron.Schedule, error) {
+	return jobCronParser.Parse(expr)
+}
+
+// ParseJobSchedule 在 tz 时区解析 cron 表达式 tz 为空时使用本地时区
+func ParseJobSchedule(expr string, tz string) (cron.Schedule, error) {
+	if tz == "" {
+		return ParseJobExpression(expr)
+	}
+	_, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("时区错误 %w", err)
+	}
+	if strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=") {
+		return nil, errors.New("表达式里不能再指定时区")
+	}
+	return jobCronParser.Parse("CRON_TZ=" + tz + " " + expr)
+}
+
+// JobMisfireThreshold 超过预定的执行时间这么久才算错过了
+const JobMisfireThreshold = time.Minute
+
+// JobMisfirePolicy 错过执行时间的处理策略
+type JobMisfirePolicy uint8
+
+const (
+	// JobMisfireFireOnce 错过的执行合并成一次 马上执行
+	JobMisfireFireOnce JobMisfirePolicy = iota
+	// JobMisfireFireAll 错过的每一次都按顺序补上
+	JobMisfireFireAll
+	// JobMisfireSkip 错过的都不执行 等下一次
+	JobMisfireSkip
+)
+
+func (p JobMisfirePolicy) String() string {
+	switch p {
+	case JobMisfireFireAll:
+		return "fire_all"
+	case JobMisfireSkip:
+		return "skip"
+	default:
+		return "fire_once"
+	}
+}
+
+// ParseJobMisfirePolicy 空字符串是 fire_once
+func ParseJobMisfirePolicy(s string) (JobMisfirePolicy, bool) {
+	switch s {
+	case "", "fire_once":
+		return JobMisfireFireOnce, true
+	case "fire_all":
+		return JobMisfireFireAll, true
+	case "skip":
+		return JobMisfireSkip, true
+	default:
+		return JobMisfireFireOnce, false
+	}
+}
+
+type JobStatus uint8
+
+const (
+	JobStatusWaiting JobStatus = iota
+	JobStatusRunning
+	JobStatusPaused
+	// JobStatusPausing 执行期间被暂停 执行完之后变成暂停
+	JobStatusPausing
+)
+
+// Paused 暂停之后不会再调度 执行期间被暂停的也算
+func (s JobStatus) Paused() bool {
+	return s == JobStatusPaused || s == JobStatusPausing
+}
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobStatusWaiting:
+		return "waiting"
+	case JobStatusRunning:
+		return "running"
+	case JobStatusPaused:
+		return "paused"
+	case JobStatusPausing:
+		return "pausing"
+	default:
+		return "unknown"
+	}
+}
+
+// JobMode 任务的执行方式
+type JobMode uint8
+
+const (
+	// JobModeSingle 每次只有一个节点执行
+	JobModeSingle JobMode = iota
+	// JobModeBroadcast 每个存活的节点都执行一次
+	JobModeBroadcast
+	// JobModeSharding 拆成多个分片 每个分片单独抢占
+	JobModeSharding
+)
+
+func (m JobMode) String() string {
+	switch m {
+	case JobModeBroadcast:
+		return "broadcast"
+	case JobModeSharding:
+		return "sharding"
+	default:
+		return "single"
+	}
+}
+
+// ParseJobMode 空字符串是 single
+func ParseJobMode(s string) (JobMode, bool) {
+	switch s {
+	case "", "single":
+		return JobModeSingle, true
+	case "broadcast":
+		return JobModeBroadcast, true
+	case "sharding":
+		return JobModeSharding, true
+	default:
+		return JobModeSingle, false
+	}
+}
+
+// JobTask 广播和分片任务每一轮分发出来的子任务
+// 每个子任务单独抢占 单独重试
+type JobTask struct {
+	Id    int64
+	JobId int64
+	// 这一轮的执行时间 同一轮的子任务相同
+	Tick   time.Time
+	Shard  int
+	Shards int
+	// 广播任务指定的节点 分片任务为空 哪个节点都可以抢
+	Node    string
+	Status  JobTaskStatus
+	Version int
+	// 连续失败的次数
+	Attempt int
+	// 重试的时候是下一次执行的时间
+	NextTime time.Time
+}
+
+type JobTaskStatus uint8
+
+const (
+	JobTaskStatusWaiting JobTaskStatus = iota
+	JobTaskStatusRunning
+	JobTaskStatusSuccess
+	JobTaskStatusFailed
+	// JobTaskStatusCanceled 节点下线了或者任务被删除了 不会再执行
+	JobTaskStatusCanceled
+)
+
+// JobNode 调度器节点 定期发送心跳
+type JobNode struct {
+	Name          string
+	StartTime     time.Time
+	HeartbeatTime time.Time
+}
+
+// RetryPolicy 任务配置里声明的重试策略 例如
+// {"retry":{"maxAttempts":3,"initialInterval":"10s","maxInterval":"5m","multiplier":2}}
+// 配置不是 JSON 对象或者没有 retry 时不重试
+func (j Job) RetryPolicy() (JobRetryPolicy, error) {
+	if !strings.HasPrefix(strings.TrimSpace(j.Config), "{") {
+		return JobRetryPolicy{}, nil
+	}
+	var cfg struct {
+		Retry *struct {
+			MaxAttempts     int     `json:"maxAttempts"`
+			InitialInterval string  `json:"initialInterval"`
+			MaxInterval     string  `json:"maxInterval"`
+			Multiplier      float64 `json:"multiplier"`
+		} `json:"retry"`
+	}
+	err := json.Unmarshal([]byte(j.Config), &cfg)
+	if err != nil || cfg.Retry == nil {
+		return JobRetryPolicy{}, err
+	}
+	policy := JobRetryPolicy{
+		MaxAttempts:     cfg.Retry.MaxAttempts,
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute * 10,
+		Multiplier:      2,
+	}
+	if cfg.Retry.InitialInterval != "" {
+		policy.InitialInterval, err = time.ParseDuration(cfg.Retry.InitialInterval)
+		if err != nil {
+			return JobRetryPolicy{}, fmt.Errorf("重试间隔错误 %w", err)
+		}
+	}
+	if cfg.Retry.MaxInterval != "" {
+		policy.MaxInterval, err = time.ParseDuration(cfg.Retry.MaxInterval)
+		if err != nil {
+			return JobRetryPolicy{}, fmt.Errorf("最大重试间隔错误 %w", err)
+		}
+	}
+	if cfg.Retry.Multiplier > 0 {
+		policy.Multiplier = cfg.Retry.Multiplier
+	}
+	if policy.MaxAttempts < 0 || policy.InitialInterval <= 0 ||
+		policy.MaxInterval < policy.InitialInterval || policy.Multiplier < 1 {
+		return JobRetryPolicy{}, fmt.Errorf("重试策略不合法 %s", j.Config)
+	}
+	return policy, nil
+}
+
+// JobRetryPolicy 指数退避的重试策略
+type JobRetryPolicy struct {
+	// 最多执行几次 包括第一次 小于等于1时不重试
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
 }
 
-func (j Job) NextTime() time.Time {
-	c := cron.NewParser(
-		cron.Second | cron.Minute |
-			cron.Hour | cron.Dom |
-			cron.Month | cron.Dow |
-			cron.Descriptor,
-	)
-	s, _ := c.Parse(j.Expression)
-	return s.Next(time.Now())
+// Backoff 第 attempt 次失败之后等多久再重试 attempt 从1开始
+func (p JobRetryPolicy) Backoff(attempt int) time.Duration {
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if interval > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	return time.Duration(interval)
+}
+
+// JobRun 任务的一次执行
+type JobRun struct {
+	Id      int64
+	JobId   int64
+	JobName string
+	// 执行任务的节点
+	Node string
+	// 第几次执行 重试时大于1
+	Attempt int
+	// 广播和分片任务的子任务 其他模式为0
+	TaskId    int64
+	Shard     int
+	StartTime time.Time
+	EndTime   time.Time
+	Status    JobRunStatus
+	// 失败的原因
+	Error string
+}
+
+type JobRunStatus uint8
+
+const (
+	// JobRunStatusUnknown 还没有执行过
+	JobRunStatusUnknown JobRunStatus = iota
+	JobRunStatusSuccess
+	JobRunStatusFailed
+	JobRunStatusRunning
+	// JobRunStatusYielded 节点负载太高 执行到一半让给了其他节点
+	JobRunStatusYielded
+)
+
+func (s JobRunStatus) String() string {
+	switch s {
+	case JobRunStatusSuccess:
+		return "success"
+	case JobRunStatusFailed:
+		return "failed"
+	case JobRunStatusRunning:
+		return "running"
+	case JobRunStatusYielded:
+		return "yielded"
+	default:
+		return "unknown"
+	}
 }
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestJob_RetryPolicy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		want    JobRetryPolicy
+		wantErr bool
+	}{
+		{name: "没有配置", config: ""},
+		{name: "不是 JSON", config: "hello"},
+		{name: "没有 retry", config: `{"strategy":"wilson"}`},
+		{
+			name:   "使用默认的间隔",
+			config: `{"strategy":"wilson","retry":{"maxAttempts":3}}`,
+			want: JobRetryPolicy{
+				MaxAttempts:     3,
+				InitialInterval: time.Second,
+				MaxInterval:     time.Minute * 10,
+				Multiplier:      2,
+			},
+		},
+		{
+			name:   "完整配置",
+			config: `{"retry":{"maxAttempts":5,"initialInterval":"10s","maxInterval":"1m","multiplier":3}}`,
+			want: JobRetryPolicy{
+				MaxAttempts:     5,
+				InitialInterval: time.Second * 10,
+				MaxInterval:     time.Minute,
+				Multiplier:      3,
+			},
+		},
+		{name: "间隔格式错误", config: `{"retry":{"maxAttempts":3,"initialInterval":"abc"}}`, wantErr: true},
+		{name: "最大间隔太小", config: `{"retry":{"maxAttempts":3,"initialInterval":"1m","maxInterval":"1s"}}`, wantErr: true},
+		{name: "JSON 格式错误", config: `{"retry":`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := Job{Config: tc.config}.RetryPolicy()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, policy)
+		})
+	}
+}
+
+func TestJobRetryPolicy_Backoff(t *testing.T) {
+	policy := JobRetryPolicy{
+		MaxAttempts:     10,
+		InitialInterval: time.Second,
+		MaxInterval:     time.Second * 10,
+		Multiplier:      2,
+	}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, time.Second*2, policy.Backoff(2))
+	assert.Equal(t, time.Second*8, policy.Backoff(4))
+	// 不超过最大间隔
+	assert.Equal(t, time.Second*10, policy.Backoff(5))
+	assert.Equal(t, time.Second*10, policy.Backoff(100))
+}
+
+func TestJob_NextAfter(t *testing.T) {
+	// 每个整点执行一次
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.Local)
+	testCases := []struct {
+		name      string
+		misfire   JobMisfirePolicy
+		scheduled time.Time
+		want      time.Time
+	}{
+		{
+			name:      "没有错过",
+			scheduled: time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local),
+			want:      time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local),
+		},
+		{
+			name:      "错过了 合并成一次",
+			scheduled: time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local),
+			want:      time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local),
+		},
+		{
+			name:      "错过了 跳过",
+			misfire:   JobMisfireSkip,
+			scheduled: time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local),
+			want:      time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local),
+		},
+		{
+			name:      "错过了 全部补上",
+			misfire:   JobMisfireFireAll,
+			scheduled: time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local),
+			want:      time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local),
+		},
+		{
+			name: "没有执行过",
+			want: time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := Job{Expression: "0 0 * * * ?", Misfire: tc.misfire}
+			next, err := job.NextAfter(tc.scheduled, now)
+			require.NoError(t, err)
+			assert.True(t, tc.want.Equal(next), next)
+		})
+	}
+}
+
+func TestJob_Timezone(t *testing.T) {
+	job := Job{Expression: "0 0 9 * * ?", Timezone: "Asia/Shanghai"}
+	next, err := job.NextAfter(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	// 北京时间九点是 UTC 一点
+	assert.True(t, time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC).Equal(next), next)
+
+	_, err = Job{Expression: "@every 1m", Timezone: "Asia/Shanghai"}.NextTime()
+	assert.NoError(t, err)
+	_, err = Job{Expression: "0 0 9 * * ?", Timezone: "Mars/Olympus"}.NextTime()
+	assert.Error(t, err)
+	_, err = Job{Expression: "CRON_TZ=UTC 0 0 9 * * ?", Timezone: "Asia/Shanghai"}.NextTime()
+	assert.Error(t, err)
+}
+
+func TestJob_Misfired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, Job{ScheduledTime: now.Add(-time.Second)}.Misfired(now))
+	assert.True(t, Job{ScheduledTime: now.Add(-time.Hour)}.Misfired(now))
+	// 手动触发的不算
+	assert.False(t, Job{ScheduledTime: now.Add(-time.Hour), TriggerTime: now}.Misfired(now))
+}
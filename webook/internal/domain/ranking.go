@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+// ScoredArticle 带分数的文章 用于分片计算的中间结果和榜单快照
+type ScoredArticle struct {
+	Score   float64
+	Article Article
+}
+
+// RankingSnapshot 某一时刻发布的榜单
+type RankingSnapshot struct {
+	Id int64
+	// 榜单名字 全站榜单是 global
+	Name  string
+	Ctime time.Time
+	// 按照最小间隔划分的时间段 同一个榜单每个时间段只保存一个快照
+	Bucket int64
+	Items  []RankingSnapshotItem
+}
+
+type RankingSnapshotItem struct {
+	ArticleId int64
+	// 从 1 开始
+	Position int
+	Score    float64
+}
+
+// RankPoint 文章在某个快照中的名次
+type RankPoint struct {
+	SnapshotId int64
+	Time       time.Time
+	// 0 表示不在榜上
+	Position int
+	Score    float64
+}
+
+// RankMove 文章在两个快照之间的名次变化
+type RankMove struct {
+	ArticleId int64
+	// 0 表示不在榜上
+	From int
+	To   int
+}
+
+// Delta 正数表示名次上升
+func (m RankMove) Delta() int {
+	if m.From == 0 || m.To == 0 {
+		return 0
+	}
+	return m.From - m.To
+}
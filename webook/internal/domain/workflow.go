@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Workflow 由已有任务组成的有向无环图 按照 cron 表达式触发
+// 上游都成功之后才会执行下游
+type Workflow struct {
+	Id         int64
+	Name       string
+	Expression string
+	Steps      []WorkflowStep
+	// 只用到了等待和暂停
+	Status        JobStatus
+	Version       int
+	ScheduledTime time.Time
+	CreateTime    time.Time
+	UpdateTime    time.Time
+}
+
+func (w Workflow) NextTime() time.Time {
+	s, _ := jobCronParser.Parse(w.Expression)
+	return s.Next(time.Now())
+}
+
+// WorkflowStep 工作流中的一个节点 名字就是任务的名字
+type WorkflowStep struct {
+	Job       string
+	Depends   []string
+	OnFailure WorkflowFailurePolicy
+	// OnFailure 是 retry 时生效 重试用完了就停止整个工作流
+	Retry JobRetryPolicy
+}
+
+type WorkflowFailurePolicy string
+
+const (
+	// WorkflowFailureStop 停止整个工作流 默认
+	WorkflowFailureStop WorkflowFailurePolicy = "stop"
+	// WorkflowFailureSkip 跳过这个节点 下游照常执行
+	WorkflowFailureSkip WorkflowFailurePolicy = "skip"
+	// WorkflowFailureRetry 重试 重试用完了就停止整个工作流
+	WorkflowFailureRetry WorkflowFailurePolicy = "retry"
+)
+
+// Validate 校验 cron 表达式 依赖关系和失败策略 有环也是不合法的
+func (w Workflow) Validate() error {
+	if w.Name == "" || len(w.Steps) == 0 {
+		return errors.New("名字和节点不能为空")
+	}
+	_, err := ParseJobExpression(w.Expression)
+	if err != nil {
+		return fmt.Errorf("cron 表达式错误 %s", err.Error())
+	}
+	steps := make(map[string]struct{}, len(w.Steps))
+	for _, step := range w.Steps {
+		if step.Job == "" {
+			return errors.New("节点的任务不能为空")
+		}
+		if _, ok := steps[step.Job]; ok {
+			return fmt.Errorf("节点重复 %s", step.Job)
+		}
+		steps[step.Job] = struct{}{}
+		switch step.OnFailure {
+		case "", WorkflowFailureStop, WorkflowFailureSkip:
+		case WorkflowFailureRetry:
+			if step.Retry.MaxAttempts <= 1 || step.Retry.InitialInterval <= 0 ||
+				step.Retry.MaxInterval < step.Retry.InitialInterval || step.Retry.Multiplier < 1 {
+				return fmt.Errorf("节点 %s 的重试策略不合法", step.Job)
+			}
+		default:
+			return fmt.Errorf("节点 %s 不支持的失败策略 %s", step.Job, step.OnFailure)
+		}
+	}
+	for _, step := range w.Steps {
+		for _, dep := range step.Depends {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("节点 %s 依赖的 %s 不存在", step.Job, dep)
+			}
+		}
+	}
+	if len(w.order()) != len(w.Steps) {
+		return errors.New("依赖关系有环")
+	}
+	return nil
+}
+
+// order 拓扑排序 有环时返回的节点数量少于总数
+func (w Workflow) order() []string {
+	indegree := make(map[string]int, len(w.Steps))
+	downstream := make(map[string][]string, len(w.Steps))
+	for _, step := range w.Steps {
+		indegree[step.Job] += 0
+		for _, dep := range step.Depends {
+			indegree[step.Job]++
+			downstream[dep] = append(downstream[dep], step.Job)
+		}
+	}
+	queue := make([]string, 0, len(w.Steps))
+	for _, step := range w.Steps {
+		if indegree[step.Job] == 0 {
+			queue = append(queue, step.Job)
+		}
+	}
+	res := make([]string, 0, len(w.Steps))
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		res = append(res, cur)
+		for _, next := range downstream[cur] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return res
+}
+
+// WorkflowRun 工作流的一次执行 状态保存在数据库里
+// 执行的节点崩溃之后 其他节点可以接着执行
+type WorkflowRun struct {
+	Id           int64
+	WorkflowId   int64
+	WorkflowName string
+	// 乐观锁 接手的节点会加一
+	Version   int
+	Node      string
+	Status    WorkflowRunStatus
+	Steps     []WorkflowStepRun
+	StartTime time.Time
+	EndTime   time.Time
+
+	CancelFun func()
+	// 续约时发现已经被其他节点接手就会关闭
+	LeaseLost <-chan struct{}
+}
+
+// Ready 可以开始执行的节点 所有上游都成功或者被跳过了
+func (r WorkflowRun) Ready(w Workflow) []string {
+	status := make(map[string]WorkflowStepStatus, len(r.Steps))
+	for _, step := range r.Steps {
+		status[step.Job] = step.Status
+	}
+	var res []string
+	for _, step := range w.Steps {
+		if status[step.Job] != WorkflowStepPending {
+			continue
+		}
+		ready := true
+		for _, dep := range step.Depends {
+			if s := status[dep]; s != WorkflowStepSuccess && s != WorkflowStepSkipped {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			res = append(res, step.Job)
+		}
+	}
+	return res
+}
+
+type WorkflowRunStatus uint8
+
+const (
+	WorkflowRunUnknown WorkflowRunStatus = iota
+	WorkflowRunRunning
+	WorkflowRunSuccess
+	WorkflowRunFailed
+)
+
+func (s WorkflowRunStatus) String() string {
+	switch s {
+	case WorkflowRunRunning:
+		return "running"
+	case WorkflowRunSuccess:
+		return "success"
+	case WorkflowRunFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type WorkflowStepRun struct {
+	Id        int64
+	Job       string
+	Status    WorkflowStepStatus
+	Attempt   int
+	StartTime time.Time
+	EndTime   time.Time
+	Error     string
+}
+
+type WorkflowStepStatus uint8
+
+const (
+	WorkflowStepPending WorkflowStepStatus = iota
+	WorkflowStepRunning
+	WorkflowStepSuccess
+	WorkflowStepFailed
+	// WorkflowStepSkipped 失败了但是失败策略是跳过
+	WorkflowStepSkipped
+	// WorkflowStepCanceled 工作流停止了 没有执行
+	WorkflowStepCanceled
+)
+
+func (s WorkflowStepStatus) String() string {
+	switch s {
+	case WorkflowStepPending:
+		return "pending"
+	case WorkflowStepRunning:
+		return "running"
+	case WorkflowStepSuccess:
+		return "success"
+	case WorkflowStepFailed:
+		return "failed"
+	case WorkflowStepSkipped:
+		return "skipped"
+	case WorkflowStepCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWorkflow_Validate(t *testing.T) {
+	retry := JobRetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      2,
+	}
+	testCases := []struct {
+		name    string
+		steps   []WorkflowStep
+		wantErr bool
+	}{
+		{
+			name: "合法",
+			steps: []WorkflowStep{
+				{Job: "a"},
+				{Job: "b", Depends: []string{"a"}, OnFailure: WorkflowFailureSkip},
+				{Job: "c", Depends: []string{"a"}, OnFailure: WorkflowFailureRetry, Retry: retry},
+				{Job: "d", Depends: []string{"b", "c"}},
+			},
+		},
+		{name: "没有节点", wantErr: true},
+		{
+			name:    "节点重复",
+			steps:   []WorkflowStep{{Job: "a"}, {Job: "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "依赖不存在",
+			steps:   []WorkflowStep{{Job: "a", Depends: []string{"b"}}},
+			wantErr: true,
+		},
+		{
+			name: "有环",
+			steps: []WorkflowStep{
+				{Job: "a"},
+				{Job: "b", Depends: []string{"a", "c"}},
+				{Job: "c", Depends: []string{"b"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "重试策略不合法",
+			steps:   []WorkflowStep{{Job: "a", OnFailure: WorkflowFailureRetry}},
+			wantErr: true,
+		},
+		{
+			name:    "不支持的失败策略",
+			steps:   []WorkflowStep{{Job: "a", OnFailure: "ignore"}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Workflow{Name: "wf", Expression: "0 0 * * * ?", Steps: tc.steps}.Validate()
+			assert.Equal(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestWorkflowRun_Ready(t *testing.T) {
+	wf := Workflow{
+		Steps: []WorkflowStep{
+			{Job: "a"},
+			{Job: "b", Depends: []string{"a"}},
+			{Job: "c", Depends: []string{"a"}},
+			{Job: "d", Depends: []string{"b", "c"}},
+		},
+	}
+	testCases := []struct {
+		name   string
+		status map[string]WorkflowStepStatus
+		want   []string
+	}{
+		{
+			name: "刚开始",
+			want: []string{"a"},
+		},
+		{
+			name:   "上游成功",
+			status: map[string]WorkflowStepStatus{"a": WorkflowStepSuccess},
+			want:   []string{"b", "c"},
+		},
+		{
+			name: "上游被跳过",
+			status: map[string]WorkflowStepStatus{
+				"a": WorkflowStepSuccess,
+				"b": WorkflowStepSkipped,
+				"c": WorkflowStepSuccess,
+			},
+			want: []string{"d"},
+		},
+		{
+			name: "上游失败",
+			status: map[string]WorkflowStepStatus{
+				"a": WorkflowStepSuccess,
+				"b": WorkflowStepFailed,
+				"c": WorkflowStepSuccess,
+			},
+		},
+		{
+			name: "上游还在执行",
+			status: map[string]WorkflowStepStatus{
+				"a": WorkflowStepSuccess,
+				"b": WorkflowStepRunning,
+			},
+			want: []string{"c"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := WorkflowRun{}
+			for _, step := range wf.Steps {
+				run.Steps = append(run.Steps, WorkflowStepRun{Job: step.Job, Status: tc.status[step.Job]})
+			}
+			assert.Equal(t, tc.want, run.Ready(wf))
+		})
+	}
+}
@@ -12,6 +12,8 @@ type Producer interface {
 }
 
 type ReadEvent struct {
+	// 业务类型 互动服务按照业务的配置计数
+	Biz      string
 	Aid      int64
 	Uid      int64
 	ReadTime int64
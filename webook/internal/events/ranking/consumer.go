@@ -0,0 +1,102 @@
+package ranking
+
+import (
+	"context"
+	intrevents "github.com/Anwenya/GeekTime/webook/interactive/events"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/events/article"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/Anwenya/GeekTime/webook/pkg/saramax"
+	"github.com/IBM/sarama"
+	"time"
+)
+
+const groupID = "ranking_stream"
+
+// Event 阅读 点赞 取消点赞 收藏事件的并集
+// 不同主题的消息体反序列化到同一个结构体里 按主题区分
+type Event struct {
+	// 业务类型 旧的阅读事件没有 都是文章
+	Biz string
+
+	// 阅读事件
+	Aid      int64
+	ReadTime int64
+
+	// 互动服务的事件
+	BizId       int64
+	LikeTime    int64
+	CancelTime  int64
+	CollectTime int64
+}
+
+// Consumer 消费阅读和互动事件 实时更新榜单分数
+type Consumer struct {
+	client sarama.Client
+	svc    service.IncrementalRankingService
+	l      logger.LoggerV1
+}
+
+func NewConsumer(
+	client sarama.Client,
+	svc service.IncrementalRankingService,
+	l logger.LoggerV1,
+) *Consumer {
+	return &Consumer{
+		client: client,
+		svc:    svc,
+		l:      l,
+	}
+}
+
+func (c *Consumer) Start() error {
+	cg, err := sarama.NewConsumerGroupFromClient(groupID, c.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := cg.Consume(
+			context.Background(),
+			[]string{
+				article.TopicReadEvent,
+				intrevents.TopicLikeEvent,
+				intrevents.TopicCancelLikeEvent,
+				intrevents.TopicCollectEvent,
+			},
+			saramax.NewHandler[Event]("ranking_stream", c.l, c.Consume),
+		)
+		if err != nil {
+			c.l.Error("退出消费", logger.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (c *Consumer) Consume(msg *sarama.ConsumerMessage, evt Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// 榜单只有文章
+	if evt.Biz != "" && evt.Biz != domain.BizArticle {
+		return nil
+	}
+	switch msg.Topic {
+	case article.TopicReadEvent:
+		return c.svc.OnRead(ctx, evt.Aid, eventTime(evt.ReadTime, msg))
+	case intrevents.TopicLikeEvent:
+		return c.svc.OnLike(ctx, evt.BizId, eventTime(evt.LikeTime, msg))
+	case intrevents.TopicCancelLikeEvent:
+		return c.svc.OnCancelLike(ctx, evt.BizId, eventTime(evt.CancelTime, msg))
+	case intrevents.TopicCollectEvent:
+		return c.svc.OnCollect(ctx, evt.BizId, eventTime(evt.CollectTime, msg))
+	}
+	return nil
+}
+
+// eventTime 优先使用事件发生的时间 重放消息时分数也是对的
+func eventTime(ms int64, msg *sarama.ConsumerMessage) time.Time {
+	if ms > 0 {
+		return time.UnixMilli(ms)
+	}
+	return msg.Timestamp
+}
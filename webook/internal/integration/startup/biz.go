@@ -0,0 +1,19 @@
+package startup
+
+import (
+	"github.com/Anwenya/GeekTime/webook/interactive/biz"
+	"time"
+)
+
+func InitBizRegistry() biz.Registry {
+	return biz.NewConfigRegistry([]biz.Config{
+		{
+			Name:           "article",
+			LikeEnabled:    true,
+			CollectEnabled: true,
+			ReadEnabled:    true,
+			DedupWindow:    time.Minute,
+			Ranking:        true,
+		},
+	})
+}
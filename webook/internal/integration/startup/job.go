@@ -0,0 +1,15 @@
+package startup
+
+import (
+	"github.com/Anwenya/GeekTime/webook/internal/job"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+)
+
+// InitJobRegistry 测试中不注册任务 也不会启动调度
+func InitJobRegistry(svc service.JobAdminService, l logger.LoggerV1) *job.Registry {
+	return job.NewRegistry(svc,
+		job.NewScheduler(nil, nil, nil, job.SchedulerConfig{}, nil, l),
+		job.NewWorkflowScheduler(nil, l),
+		nil, l)
+}
@@ -0,0 +1,8 @@
+package startup
+
+import "github.com/Anwenya/GeekTime/webook/internal/service"
+
+// InitRankingConfig 测试中不计算命名榜单
+func InitRankingConfig() service.RankingConfig {
+	return service.RankingConfig{}
+}
@@ -3,6 +3,7 @@
 package startup
 
 import (
+	events2 "github.com/Anwenya/GeekTime/webook/interactive/events"
 	repo2 "github.com/Anwenya/GeekTime/webook/interactive/repository"
 	cache2 "github.com/Anwenya/GeekTime/webook/interactive/repository/cache"
 	dao2 "github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
@@ -40,6 +41,8 @@ var interactiveServiceSet = wire.NewSet(
 	dao2.NewGORMInteractiveDAO,
 	cache2.NewInteractiveRedisCache,
 	repo2.NewCachedInteractiveRepository,
+	events2.NewSaramaSyncProducer,
+	InitBizRegistry,
 	service2.NewInteractiveService,
 )
 
@@ -66,11 +69,41 @@ func InitWebServer() *gin.Engine {
 		service.NewCodeService,
 		service.NewUserService,
 		service.NewArticleService,
+		service.NewAnalyticsService,
+
+		// 榜单
+		InitRankingConfig,
+		cache.NewRedisRankingCache,
+		repository.NewCachedRankingRepository,
+		service.NewBatchRankingService,
+		dao.NewGORMRankingSnapshotDAO,
+		repository.NewDBRankingSnapshotRepository,
+		ioc.InitRankingSnapshotService,
+		ioc.InitRankingListRepository,
+		ioc.InitRankingListService,
+
+		// 定时任务管理
+		dao.NewGORMJobDAO,
+		repository.NewPreemptJobRepository,
+		dao.NewGORMJobExecutionDAO,
+		repository.NewDBJobExecutionRepository,
+		dao.NewGORMJobNodeDAO,
+		repository.NewDBJobNodeRepository,
+		service.NewJobNodeService,
+		service.NewJobAdminService,
+		InitJobRegistry,
+		ioc.InitJobHandler,
+		dao.NewGORMWorkflowDAO,
+		repository.NewDBWorkflowRepository,
+		service.NewWorkflowService,
+		ioc.InitWorkflowHandler,
 
 		// handler
 		web.NewUserHandler,
 		web.NewOAuth2WechatHandler,
 		web.NewArticleHandler,
+		web.NewAnalyticsHandler,
+		web.NewRankingHandler,
 		token.NewRedisTokenHandler,
 		ioc.InitGinMiddlewares,
 		ioc.InitWebServer,
@@ -7,6 +7,7 @@
 package startup
 
 import (
+	events2 "github.com/Anwenya/GeekTime/webook/interactive/events"
 	repository2 "github.com/Anwenya/GeekTime/webook/interactive/repository"
 	cache2 "github.com/Anwenya/GeekTime/webook/interactive/repository/cache"
 	dao2 "github.com/Anwenya/GeekTime/webook/interactive/repository/dao"
@@ -39,7 +40,7 @@ func InitWebServer() *gin.Engine {
 	userService := service.NewUserService(userRepository)
 	codeCache := cache.NewRedisCodeCache(cmdable)
 	codeRepository := repository.NewCachedCodeRepository(codeCache)
-	smService := ioc.InitSMSService()
+	smService := ioc.InitSMSService(loggerV1)
 	codeService := service.NewCodeService(codeRepository, smService)
 	userHandler := web.NewUserHandler(userService, codeService, tokenHandler)
 	wechatService := ioc.InitWechatService(loggerV1)
@@ -54,9 +55,37 @@ func InitWebServer() *gin.Engine {
 	interactiveDAO := dao2.NewGORMInteractiveDAO(db)
 	interactiveCache := cache2.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository2.NewCachedInteractiveRepository(interactiveDAO, interactiveCache, loggerV1)
-	interactiveService := service2.NewInteractiveService(interactiveRepository)
+	eventsProducer := events2.NewSaramaSyncProducer(syncProducer)
+	registry := InitBizRegistry()
+	interactiveService := service2.NewInteractiveService(interactiveRepository, eventsProducer, registry, loggerV1)
 	articleHandler := web.NewArticleHandler(loggerV1, articleService, interactiveService)
-	engine := ioc.InitWebServer(v, userHandler, oAuth2WechatHandler, articleHandler)
+	analyticsService := service.NewAnalyticsService(articleService, interactiveService)
+	analyticsHandler := web.NewAnalyticsHandler(analyticsService, loggerV1)
+	rankingConfig := InitRankingConfig()
+	rankingListRepository := ioc.InitRankingListRepository(cmdable, rankingConfig)
+	rankingCache := cache.NewRedisRankingCache(cmdable)
+	rankingRepository := repository.NewCachedRankingRepository(rankingCache)
+	rankingSnapshotDAO := dao.NewGORMRankingSnapshotDAO(db)
+	rankingSnapshotRepository := repository.NewDBRankingSnapshotRepository(rankingSnapshotDAO)
+	rankingSnapshotService := ioc.InitRankingSnapshotService(rankingSnapshotRepository, rankingConfig, loggerV1)
+	rankingService := service.NewBatchRankingService(interactiveService, articleService, rankingRepository, rankingSnapshotService, rankingConfig)
+	rankingListService := ioc.InitRankingListService(articleService, interactiveService, rankingListRepository, rankingService, rankingSnapshotService, rankingConfig)
+	rankingHandler := web.NewRankingHandler(rankingListService, rankingSnapshotService)
+	jobDAO := dao.NewGORMJobDAO(db)
+	cronJobRepository := repository.NewPreemptJobRepository(jobDAO)
+	jobExecutionDAO := dao.NewGORMJobExecutionDAO(db)
+	jobExecutionRepository := repository.NewDBJobExecutionRepository(jobExecutionDAO)
+	jobNodeDAO := dao.NewGORMJobNodeDAO(db)
+	jobNodeRepository := repository.NewDBJobNodeRepository(jobNodeDAO)
+	jobNodeService := service.NewJobNodeService(jobNodeRepository)
+	jobAdminService := service.NewJobAdminService(cronJobRepository, jobExecutionRepository, jobNodeService)
+	jobRegistry := InitJobRegistry(jobAdminService, loggerV1)
+	jobHandler := ioc.InitJobHandler(jobAdminService, jobRegistry)
+	workflowDAO := dao.NewGORMWorkflowDAO(db)
+	workflowRepository := repository.NewDBWorkflowRepository(workflowDAO)
+	workflowService := service.NewWorkflowService(workflowRepository, cronJobRepository)
+	workflowHandler := ioc.InitWorkflowHandler(workflowService)
+	engine := ioc.InitWebServer(v, userHandler, oAuth2WechatHandler, articleHandler, analyticsHandler, rankingHandler, jobHandler, workflowHandler)
 	return engine
 }
 
@@ -76,7 +105,9 @@ func InitArticleHandler(dao3 dao.ArticleDAO) *web.ArticleHandler {
 	interactiveDAO := dao2.NewGORMInteractiveDAO(db)
 	interactiveCache := cache2.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository2.NewCachedInteractiveRepository(interactiveDAO, interactiveCache, loggerV1)
-	interactiveService := service2.NewInteractiveService(interactiveRepository)
+	eventsProducer := events2.NewSaramaSyncProducer(syncProducer)
+	registry := InitBizRegistry()
+	interactiveService := service2.NewInteractiveService(interactiveRepository, eventsProducer, registry, loggerV1)
 	articleHandler := web.NewArticleHandler(loggerV1, articleService, interactiveService)
 	return articleHandler
 }
@@ -0,0 +1,34 @@
+package ioc
+
+import (
+	"github.com/Anwenya/GeekTime/webook/internal/job"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	etcdv3 "go.etcd.io/etcd/client/v3"
+	"gorm.io/gorm"
+	"time"
+)
+
+// InitLocker 单例任务用的分布式锁 可以选 redis mysql 或者 etcd 的选举
+func InitLocker(client redis.Cmdable, db *gorm.DB, etcdClient *etcdv3.Client) dlock.Locker {
+	type Config struct {
+		Store string        `yaml:"store"`
+		TTL   time.Duration `yaml:"ttl"`
+	}
+	cfg := Config{Store: "redis", TTL: time.Second * 30}
+	err := viper.UnmarshalKey("dlock", &cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	switch cfg.Store {
+	case "redis":
+		return dlock.NewClient(dlock.NewRedisStore(client), cfg.TTL)
+	case "mysql":
+		return dlock.NewClient(dlock.NewMySQLStore(db), cfg.TTL)
+	case "etcd":
+		return dlock.NewEtcdLocker(etcdClient, job.NodeName(), cfg.TTL)
+	default:
+		panic(any("不支持的分布式锁存储 " + cfg.Store))
+	}
+}
@@ -1,44 +1,270 @@
 package ioc
 
 import (
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
 	"github.com/Anwenya/GeekTime/webook/internal/job"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
 	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
-	rlock "github.com/gotomicro/redis-lock"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/robfig/cron/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	etcdv3 "go.etcd.io/etcd/client/v3"
+	"gorm.io/gorm"
+	"net/http"
 	"time"
 )
 
-func InitRankingJob(
-	svc service.RankingService,
-	client *rlock.Client,
+// InitJobDAO 任务多了之后轮询 MySQL 压力太大 可以把任务放到 redis 里
+// 执行记录 分片子任务这些还是在 MySQL 里
+func InitJobDAO(db *gorm.DB, client redis.Cmdable) dao.JobDAO {
+	store := viper.GetString("job.store")
+	switch store {
+	case "", "mysql":
+		return dao.NewGORMJobDAO(db)
+	case "redis":
+		return dao.NewRedisJobDAO(client)
+	default:
+		panic(any("不支持的任务存储 " + store))
+	}
+}
+
+func InitRankingConfig() service.RankingConfig {
+	var cfg service.RankingConfig
+	err := viper.UnmarshalKey("ranking", &cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	// 提前发现配置错误的计分规则
+	if cfg.Score.Strategy != "" {
+		_, err = score.New(cfg.Score)
+		if err != nil {
+			panic(any(err))
+		}
+	}
+	return cfg
+}
+
+func InitStreamRankingConfig() service.StreamRankingConfig {
+	cfg := service.StreamRankingConfig{
+		HalfLife:    time.Hour * 24,
+		LikeWeight:  1,
+		N:           100,
+		MaxSize:     10000,
+		Materialize: "@every 1m",
+		Rebuild:     "@every 6h",
+	}
+	err := viper.UnmarshalKey("ranking.stream", &cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	if cfg.HalfLife <= 0 {
+		panic(any("实时榜单的半衰期必须大于0"))
+	}
+	return cfg
+}
+
+func InitStreamRankingCache(client redis.Cmdable, cfg service.StreamRankingConfig) cache.StreamRankingCache {
+	return cache.NewRedisStreamRankingCache(client, cfg.HalfLife, cfg.MaxSize)
+}
+
+func InitRankingListRepository(client redis.Cmdable, cfg service.RankingConfig) repository.RankingListRepository {
+	opts := make(map[string]repository.RankingListOption, len(cfg.Lists))
+	for _, list := range cfg.Lists {
+		opt := repository.RankingListOption{
+			Expiration:      list.Expiration,
+			LocalExpiration: list.LocalExpiration,
+		}
+		if opt.Expiration <= 0 {
+			opt.Expiration = time.Hour
+		}
+		opts[list.Name] = opt
+	}
+	return repository.NewCachedRankingListRepository(
+		cache.NewRedisRankingListCache(client),
+		cache.NewLocalRankingListCache(1024),
+		opts,
+	)
+}
+
+func InitRankingListService(
+	artSvc service.ArticleService,
+	intrSvc interactivev1.InteractiveServiceClient,
+	repo repository.RankingListRepository,
+	global service.RankingService,
+	snapshots service.RankingSnapshotService,
+	cfg service.RankingConfig,
+) service.RankingListService {
+	svc, err := service.NewBatchRankingListService(artSvc, intrSvc, repo, global, snapshots, cfg.Lists)
+	if err != nil {
+		panic(any(err))
+	}
+	return svc
+}
+
+func InitRankingSnapshotService(
+	repo repository.RankingSnapshotRepository,
+	cfg service.RankingConfig,
 	l logger.LoggerV1,
-) job.Job {
-	return job.NewRankingJob(svc, time.Second*30, client, l)
-}
-
-func InitJobs(l logger.LoggerV1, rjob job.Job) *cron.Cron {
-	builder := job.NewCronJobBuilder(
-		prometheus.SummaryOpts{
-			Namespace: "GeekTime",
-			Subsystem: "webook",
-			Name:      "cron_job",
-			Help:      "定时任务执行",
-			Objectives: map[float64]float64{
-				0.5:   0.01,
-				0.75:  0.01,
-				0.9:   0.01,
-				0.99:  0.001,
-				0.999: 0.0001,
-			},
-		},
-		l,
+) service.RankingSnapshotService {
+	return service.NewRankingSnapshotService(repo, cfg.Snapshot, l)
+}
+
+func InitShardedRankingService(
+	intrSvc interactivev1.InteractiveServiceClient,
+	artSvc service.ArticleService,
+	repo repository.RankingRepository,
+	client redis.Cmdable,
+	snapshots service.RankingSnapshotService,
+	cfg service.RankingConfig,
+	l logger.LoggerV1,
+) service.ShardedRankingService {
+	// 中间结果只需要保留到这一轮结束
+	shardRepo := repository.NewCachedRankingShardRepository(
+		cache.NewRedisRankingShardCache(client, shardedRankingInterval(cfg)*2),
 	)
-	expr := cron.New(cron.WithSeconds())
-	_, err := expr.AddJob("@every 30m", builder.Build(rjob))
+	return service.NewBatchShardedRankingService(intrSvc, artSvc, repo, shardRepo, snapshots, cfg, l)
+}
+
+func InitShardedRankingJob(
+	svc service.ShardedRankingService,
+	client dlock.Locker,
+	cfg service.RankingConfig,
+	l logger.LoggerV1,
+) *job.ShardedRankingJob {
+	timeout := cfg.Sharded.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute * 5
+	}
+	return job.NewShardedRankingJob(svc, client, shardedRankingInterval(cfg), timeout, l)
+}
+
+func shardedRankingInterval(cfg service.RankingConfig) time.Duration {
+	if cfg.Sharded.Interval <= 0 {
+		return time.Minute * 30
+	}
+	return cfg.Sharded.Interval
+}
+
+// InitJobMetrics 本地定时任务和调度器共用 只能注册一次
+func InitJobMetrics() *job.Metrics {
+	return job.NewMetrics("GeekTime", "webook")
+}
+
+// InitJobLoadBalancer job.load.enabled 为 false 时不做负载均衡
+func InitJobLoadBalancer(client redis.Cmdable, metrics *job.Metrics, l logger.LoggerV1) *job.LoadBalancer {
+	type Config struct {
+		Enabled                bool
+		job.LoadBalancerConfig `mapstructure:",squash"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("job.load", &cfg)
 	if err != nil {
 		panic(any(err))
 	}
-	return expr
+	if !cfg.Enabled {
+		return nil
+	}
+	return job.NewLoadBalancer(client, cfg.LoadBalancerConfig, metrics, l)
+}
+
+// InitJobSchedulerConfig 本节点的并发上限 配置在 job.scheduler
+func InitJobSchedulerConfig() job.SchedulerConfig {
+	var cfg job.SchedulerConfig
+	err := viper.UnmarshalKey("job.scheduler", &cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	return cfg
+}
+
+// InitJobRegistry 系统里所有的定时任务都在这里注册
+func InitJobRegistry(
+	l logger.LoggerV1,
+	svc service.JobAdminService,
+	scheduler *job.Scheduler,
+	workflows *job.WorkflowScheduler,
+	etcdClient *etcdv3.Client,
+	metrics *job.Metrics,
+	rankingSvc service.RankingService,
+	streamCfg service.StreamRankingConfig,
+	streamSvc service.IncrementalRankingService,
+	rankingCfg service.RankingConfig,
+	listSvc service.RankingListService,
+	shardedJob *job.ShardedRankingJob,
+	snapshotSvc service.RankingSnapshotService,
+) *job.Registry {
+	registry := job.NewRegistry(svc, scheduler, workflows, metrics, l)
+	registry.RegisterExecutor(job.NewHTTPExecutor(&http.Client{}, time.Minute))
+	grpcExec, err := job.NewGRPCExecutor(etcdClient, time.Minute)
+	if err != nil {
+		panic(any(err))
+	}
+	registry.RegisterExecutor(grpcExec)
+
+	var defs []job.Definition
+	if rankingCfg.Snapshot.Enabled && rankingCfg.Snapshot.CleanupSpec != "" {
+		defs = append(defs, job.Definition{
+			Name: "ranking_snapshot_cleanup",
+			Spec: rankingCfg.Snapshot.CleanupSpec,
+			Mode: job.RunModeSingleton,
+			Func: job.NewRankingSnapshotCleanupJob(snapshotSvc, time.Minute*10).Exec,
+		})
+	}
+	if len(rankingCfg.Lists) > 0 {
+		spec := rankingCfg.ListSpec
+		if spec == "" {
+			spec = "@every 10m"
+		}
+		defs = append(defs, job.Definition{
+			Name: "ranking_list",
+			Spec: spec,
+			Mode: job.RunModeSingleton,
+			Func: job.NewRankingListJob(listSvc, time.Minute).Exec,
+		})
+	}
+	switch {
+	case streamCfg.Enabled:
+		// 实时榜单负责更新排行榜 批量计算只用来定期全量重建
+		defs = append(defs,
+			job.Definition{
+				Name: "ranking_materialize",
+				Spec: streamCfg.Materialize,
+				Mode: job.RunModeSingleton,
+				Func: job.NewStreamRankingMaterializeJob(streamSvc, time.Second*10).Exec,
+			},
+			job.Definition{
+				Name: "ranking_rebuild",
+				Spec: streamCfg.Rebuild,
+				Mode: job.RunModeSingleton,
+				Func: job.NewStreamRankingRebuildJob(streamSvc, time.Minute).Exec,
+			},
+		)
+	case rankingCfg.Sharded.Enabled:
+		// 每个节点都会执行 分片由节点之间通过分布式锁认领
+		defs = append(defs, job.Definition{
+			Name: shardedJob.Name(),
+			Spec: rankingCfg.Sharded.Spec,
+			Mode: job.RunModeBroadcast,
+			Func: shardedJob.Exec,
+		})
+	default:
+		// 任务配置里可以指定计分规则 没有配置时用 ranking.score
+		defs = append(defs, job.Definition{
+			Name: "ranking",
+			Spec: "@every 30m",
+			Mode: job.RunModeSingleton,
+			Func: job.NewRankingFunc(rankingSvc),
+		})
+	}
+	for _, def := range defs {
+		err = registry.Register(def)
+		if err != nil {
+			panic(any(err))
+		}
+	}
+	return registry
 }
@@ -0,0 +1,26 @@
+package ioc
+
+import (
+	_ "github.com/Anwenya/GeekTime/webook/config"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestInitRankingConfig 提交的 dev.yaml 必须能解析成榜单配置
+func TestInitRankingConfig(t *testing.T) {
+	var cfg service.RankingConfig
+	require.NotPanics(t, func() {
+		cfg = InitRankingConfig()
+	})
+	require.NotEmpty(t, cfg.Lists)
+	for _, list := range cfg.Lists {
+		_, err := score.New(list.Score)
+		assert.NoError(t, err, list.Name)
+	}
+	require.NotPanics(t, func() {
+		InitStreamRankingConfig()
+	})
+}
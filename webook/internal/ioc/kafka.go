@@ -3,6 +3,8 @@ package ioc
 import (
 	"github.com/Anwenya/GeekTime/webook/config"
 	"github.com/Anwenya/GeekTime/webook/internal/events"
+	"github.com/Anwenya/GeekTime/webook/internal/events/ranking"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
 	"github.com/IBM/sarama"
 )
 
@@ -24,6 +26,13 @@ func InitSyncProducer(c sarama.Client) sarama.SyncProducer {
 	return p
 }
 
-func InitConsumers() []events.Consumer {
-	return []events.Consumer{}
+func InitConsumers(
+	streamCfg service.StreamRankingConfig,
+	rankingConsumer *ranking.Consumer,
+) []events.Consumer {
+	res := []events.Consumer{}
+	if streamCfg.Enabled {
+		res = append(res, rankingConsumer)
+	}
+	return res
 }
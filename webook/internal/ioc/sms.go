@@ -1,10 +1,134 @@
 package ioc
 
 import (
+	"fmt"
 	"github.com/Anwenya/GeekTime/webook/internal/service/sms"
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/failover"
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/fakesms"
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/httpsms"
 	"github.com/Anwenya/GeekTime/webook/internal/service/sms/localsms"
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/tencent"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/spf13/viper"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	tencentsms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111"
+	"net/http"
+	"os"
 )
 
-func InitSMSService() sms.SMService {
-	return localsms.NewService()
+type SMSConfig struct {
+	// 多个服务商时怎么切换 sequential 或者 timeout
+	Failover string `yaml:"failover"`
+	// timeout 模式下连续超时多少次换下一个
+	Threshold int32               `yaml:"threshold"`
+	Providers []SMSProviderConfig `yaml:"providers"`
+}
+
+type SMSProviderConfig struct {
+	Name string `yaml:"name"`
+	// local tencent http 或者 fake
+	Type    string           `yaml:"type"`
+	Tencent TencentSMSConfig `yaml:"tencent"`
+	HTTP    httpsms.Config   `yaml:"http"`
+	// 在本进程里启动一个假的短信服务 通过 http 的方式调用
+	Fake FakeSMSConfig `yaml:"fake"`
+}
+
+type TencentSMSConfig struct {
+	AppId    string `yaml:"appId"`
+	SignName string `yaml:"signName"`
+	Region   string `yaml:"region"`
+	// 为空时读取环境变量 SMS_SECRET_ID SMS_SECRET_KEY
+	SecretId  string `yaml:"secretId"`
+	SecretKey string `yaml:"secretKey"`
+}
+
+type FakeSMSConfig struct {
+	// 监听的地址 端口为0时随机
+	Addr           string `yaml:"addr"`
+	SignName       string `yaml:"signName"`
+	fakesms.Config `mapstructure:",squash"`
+}
+
+// InitSMSService 按照配置的顺序使用服务商 没有配置时只打印日志
+func InitSMSService(l logger.LoggerV1) sms.SMService {
+	var cfg SMSConfig
+	err := viper.UnmarshalKey("sms", &cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	if len(cfg.Providers) == 0 {
+		return localsms.NewService()
+	}
+	sss := make([]sms.SMService, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		svc, err := initSMSProvider(p, l)
+		if err != nil {
+			panic(any(fmt.Errorf("短信服务商 %s 初始化失败 %w", p.Name, err)))
+		}
+		sss = append(sss, svc)
+	}
+	if len(sss) == 1 {
+		return sss[0]
+	}
+	switch cfg.Failover {
+	case "", "sequential":
+		return failover.NewFailOverSMService(sss)
+	case "timeout":
+		if cfg.Threshold <= 0 {
+			cfg.Threshold = 3
+		}
+		return failover.NewTimeoutFailoverSMService(sss, cfg.Threshold)
+	default:
+		panic(any("不支持的短信切换方式 " + cfg.Failover))
+	}
+}
+
+func initSMSProvider(cfg SMSProviderConfig, l logger.LoggerV1) (sms.SMService, error) {
+	switch cfg.Type {
+	case "local":
+		return localsms.NewService(), nil
+	case "tencent":
+		tc := cfg.Tencent
+		if tc.SecretId == "" {
+			tc.SecretId = os.Getenv("SMS_SECRET_ID")
+		}
+		if tc.SecretKey == "" {
+			tc.SecretKey = os.Getenv("SMS_SECRET_KEY")
+		}
+		if tc.Region == "" {
+			tc.Region = "ap-nanjing"
+		}
+		client, err := tencentsms.NewClient(
+			common.NewCredential(tc.SecretId, tc.SecretKey),
+			tc.Region,
+			profile.NewClientProfile(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return tencent.NewService(client, tc.AppId, tc.SignName, l), nil
+	case "http":
+		return httpsms.NewService(http.DefaultClient, cfg.HTTP), nil
+	case "fake":
+		fc := cfg.Fake
+		if fc.Addr == "" {
+			fc.Addr = "127.0.0.1:0"
+		}
+		server := fakesms.NewServer(fc.Config)
+		endpoint, err := server.Start(fc.Addr)
+		if err != nil {
+			return nil, err
+		}
+		l.Info("启动了假的短信服务", logger.String("endpoint", endpoint))
+		return httpsms.NewService(http.DefaultClient, httpsms.Config{
+			Endpoint: endpoint,
+			AppKey:   fc.AppKey,
+			Secret:   fc.Secret,
+			SignName: fc.SignName,
+		}), nil
+	default:
+		return nil, fmt.Errorf("不支持的短信服务商类型 %s", cfg.Type)
+	}
 }
@@ -2,6 +2,8 @@ package ioc
 
 import (
 	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/job"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
 	"github.com/Anwenya/GeekTime/webook/internal/web"
 	"github.com/Anwenya/GeekTime/webook/internal/web/middleware"
 	itoken "github.com/Anwenya/GeekTime/webook/internal/web/token"
@@ -13,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
@@ -21,15 +24,41 @@ func InitWebServer(
 	userHandler *web.UserHandler,
 	wechatHandler *web.OAuth2WechatHandler,
 	articleHandler *web.ArticleHandler,
+	analyticsHandler *web.AnalyticsHandler,
+	rankingHandler *web.RankingHandler,
+	jobHandler *web.JobHandler,
+	workflowHandler *web.WorkflowHandler,
 ) *gin.Engine {
 	server := gin.Default()
 	server.Use(middlewares...)
 	userHandler.RegisterRoutes(server)
 	wechatHandler.RegisterRoutes(server)
 	articleHandler.RegisterRoutes(server)
+	analyticsHandler.RegisterRoutes(server)
+	rankingHandler.RegisterRoutes(server)
+	jobHandler.RegisterRoutes(server)
+	workflowHandler.RegisterRoutes(server)
 	return server
 }
 
+// InitJobHandler 管理员的用户id配置在 admin.uids
+func InitJobHandler(svc service.JobAdminService, registry *job.Registry) *web.JobHandler {
+	return web.NewJobHandler(svc, registry, adminUids())
+}
+
+func InitWorkflowHandler(svc service.WorkflowService) *web.WorkflowHandler {
+	return web.NewWorkflowHandler(svc, adminUids())
+}
+
+func adminUids() []int64 {
+	var uids []int64
+	err := viper.UnmarshalKey("admin.uids", &uids)
+	if err != nil {
+		panic(any(err))
+	}
+	return uids
+}
+
 func InitGinMiddlewares(
 	redisClient redis.Cmdable,
 	th itoken.TokenHandler,
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package job
+
+import "time"
+
+// processCPUTime 其他平台不统计 CPU 只按照正在执行的任务数量计算负载
+func processCPUTime() time.Duration {
+	return 0
+}
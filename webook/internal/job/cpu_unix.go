@@ -0,0 +1,18 @@
+//go:build unix
+
+package job
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime 进程累计使用的 CPU 时间 包括用户态和内核态
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
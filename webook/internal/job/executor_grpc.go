@@ -0,0 +1,118 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jobv1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/job/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	etcdv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/resolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	gresolver "google.golang.org/grpc/resolver"
+	"sync"
+	"time"
+)
+
+// GRPCExecutor 调用业务方实现的 JobExecutorService
+// 服务地址从 etcd 里面找 和其他 gRPC 服务的注册方式一样
+// 任务配置例如 {"grpc":{"service":"ranking","timeout":"1m"}}
+type GRPCExecutor struct {
+	builder gresolver.Builder
+	// 任务没有配置超时时间的时候使用
+	timeout time.Duration
+
+	mutex sync.Mutex
+	// 每个服务一个连接
+	conns map[string]*grpc.ClientConn
+}
+
+func NewGRPCExecutor(client *etcdv3.Client, timeout time.Duration) (*GRPCExecutor, error) {
+	builder, err := resolver.NewBuilder(client)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCExecutor{
+		builder: builder,
+		timeout: timeout,
+		conns:   map[string]*grpc.ClientConn{},
+	}, nil
+}
+
+type grpcJobConfig struct {
+	Service string `json:"service"`
+	Timeout string `json:"timeout"`
+}
+
+func (g *GRPCExecutor) Name() string {
+	return "grpc"
+}
+
+func (g *GRPCExecutor) Exec(ctx context.Context, job domain.Job) error {
+	var cfg struct {
+		GRPC *grpcJobConfig `json:"grpc"`
+	}
+	err := json.Unmarshal([]byte(job.Config), &cfg)
+	if err != nil {
+		return fmt.Errorf("gRPC 任务配置错误 %w", err)
+	}
+	if cfg.GRPC == nil || cfg.GRPC.Service == "" {
+		return errors.New("gRPC 任务没有配置 service")
+	}
+	timeout, err := remoteTimeout(cfg.GRPC.Timeout, g.timeout)
+	if err != nil {
+		return err
+	}
+	cc, err := g.conn(cfg.GRPC.Service)
+	if err != nil {
+		return err
+	}
+
+	// 续约失败或者超时的时候取消调用 服务端的 ctx 也会被取消
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	shard, shards := job.ShardInfo()
+	_, err = jobv1.NewJobExecutorServiceClient(cc).Execute(ctx, &jobv1.ExecuteRequest{
+		JobId:   job.Id,
+		Name:    job.Name,
+		Config:  job.Config,
+		Attempt: int32(job.Attempt + 1),
+		Shard:   int32(shard),
+		Shards:  int32(shards),
+	})
+	return err
+}
+
+func (g *GRPCExecutor) conn(service string) (*grpc.ClientConn, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	cc, ok := g.conns[service]
+	if ok {
+		return cc, nil
+	}
+	cc, err := grpc.Dial(
+		fmt.Sprintf("etcd:///service/%s", service),
+		grpc.WithResolvers(g.builder),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// 任务分散到不同的实例上
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`),
+	)
+	if err != nil {
+		return nil, err
+	}
+	g.conns[service] = cc
+	return cc, nil
+}
+
+func (g *GRPCExecutor) Close() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var errs []error
+	for service, cc := range g.conns {
+		errs = append(errs, cc.Close())
+		delete(g.conns, service)
+	}
+	return errors.Join(errs...)
+}
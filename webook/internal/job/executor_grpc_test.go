@@ -0,0 +1,136 @@
+package job
+
+import (
+	"context"
+	"errors"
+	jobv1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/job/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// recordedJobExecutor 记录收到的请求 slow 任务一直执行到被取消
+type recordedJobExecutor struct {
+	jobv1.UnimplementedJobExecutorServiceServer
+	reqs     chan *jobv1.ExecuteRequest
+	canceled chan struct{}
+}
+
+func (r *recordedJobExecutor) Execute(ctx context.Context, req *jobv1.ExecuteRequest) (*jobv1.ExecuteResponse, error) {
+	r.reqs <- req
+	switch req.Name {
+	case "slow":
+		select {
+		case <-ctx.Done():
+			close(r.canceled)
+			return nil, ctx.Err()
+		case <-time.After(time.Second * 5):
+			return &jobv1.ExecuteResponse{}, nil
+		}
+	case "fail":
+		return nil, status.Error(codes.Internal, "执行失败")
+	default:
+		return &jobv1.ExecuteResponse{}, nil
+	}
+}
+
+// initGRPCExecutor 用 bufconn 代替 etcd 里面找到的服务
+func initGRPCExecutor(t *testing.T) (*GRPCExecutor, *recordedJobExecutor) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := &recordedJobExecutor{
+		reqs:     make(chan *jobv1.ExecuteRequest, 10),
+		canceled: make(chan struct{}),
+	}
+	server := grpc.NewServer()
+	jobv1.RegisterJobExecutorServiceServer(server, srv)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	exec := &GRPCExecutor{
+		timeout: time.Minute,
+		conns:   map[string]*grpc.ClientConn{"ranking": cc},
+	}
+	t.Cleanup(func() {
+		_ = exec.Close()
+	})
+	return exec, srv
+}
+
+func TestGRPCExecutor_Exec(t *testing.T) {
+	exec, srv := initGRPCExecutor(t)
+	ctx := context.Background()
+
+	cfg := `{"grpc":{"service":"ranking","timeout":"10s"}}`
+	err := exec.Exec(ctx, domain.Job{Id: 1, Name: "ok", Config: cfg, Attempt: 2})
+	require.NoError(t, err)
+	req := <-srv.reqs
+	assert.Equal(t, int64(1), req.JobId)
+	assert.Equal(t, "ok", req.Name)
+	assert.Equal(t, cfg, req.Config)
+	// 服务端看到的是第几次执行
+	assert.Equal(t, int32(3), req.Attempt)
+	// 不是子任务的只有一个分片
+	assert.Equal(t, int32(0), req.Shard)
+	assert.Equal(t, int32(1), req.Shards)
+
+	err = exec.Exec(ctx, domain.Job{Id: 2, Name: "shard", Config: cfg, Task: &domain.JobTask{Shard: 2, Shards: 3}})
+	require.NoError(t, err)
+	req = <-srv.reqs
+	assert.Equal(t, int32(2), req.Shard)
+	assert.Equal(t, int32(3), req.Shards)
+
+	err = exec.Exec(ctx, domain.Job{Name: "fail", Config: cfg})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	<-srv.reqs
+
+	// 配置错误的不发请求
+	err = exec.Exec(ctx, domain.Job{Name: "ok", Config: `{"grpc":{}}`})
+	assert.Error(t, err)
+	err = exec.Exec(ctx, domain.Job{Name: "ok", Config: `{"grpc":{"service":"ranking","timeout":"abc"}}`})
+	assert.Error(t, err)
+	assert.Empty(t, srv.reqs)
+}
+
+func TestGRPCExecutor_LeaseLost(t *testing.T) {
+	exec, srv := initGRPCExecutor(t)
+	s := &Scheduler{l: logger.NewNopLogger(), executions: map[*execution]struct{}{}}
+	leaseLost := make(chan struct{})
+	job := domain.Job{Id: 1, Name: "slow", Config: `{"grpc":{"service":"ranking"}}`, LeaseLost: leaseLost}
+	ctx, cancel := s.execContext(context.Background(), job)
+	defer cancel()
+
+	// 续约失败 调度器取消执行
+	time.AfterFunc(time.Millisecond*100, func() {
+		close(leaseLost)
+	})
+	start := time.Now()
+	err := exec.Exec(ctx, job)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.True(t, errors.Is(context.Cause(ctx), errJobLeaseLost))
+	assert.Less(t, time.Since(start), time.Second*5)
+
+	// 服务端的 ctx 也被取消了
+	select {
+	case <-srv.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("服务端没有感知到取消")
+	}
+}
@@ -0,0 +1,122 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPExecutor 调用任务配置的 HTTP 接口 返回 2xx 表示执行成功
+// 任务配置例如
+// {"http":{"url":"http://ranking/jobs/rebuild","method":"POST","timeout":"1m","headers":{"X-Token":"xxx"}}}
+// 请求体是 HTTPJobRequest
+type HTTPExecutor struct {
+	client *http.Client
+	// 任务没有配置超时时间的时候使用
+	timeout time.Duration
+}
+
+func NewHTTPExecutor(client *http.Client, timeout time.Duration) *HTTPExecutor {
+	return &HTTPExecutor{
+		client:  client,
+		timeout: timeout,
+	}
+}
+
+// HTTPJobRequest 发给业务方的请求体
+type HTTPJobRequest struct {
+	JobId  int64  `json:"jobId"`
+	Name   string `json:"name"`
+	Config string `json:"config"`
+	// 第几次执行 重试时大于1
+	Attempt int `json:"attempt"`
+	// 分片序号和分片总数 不分片的任务是 0 1
+	Shard  int `json:"shard"`
+	Shards int `json:"shards"`
+}
+
+type httpJobConfig struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Timeout string            `json:"timeout"`
+	Headers map[string]string `json:"headers"`
+}
+
+func (h *HTTPExecutor) Name() string {
+	return "http"
+}
+
+func (h *HTTPExecutor) Exec(ctx context.Context, job domain.Job) error {
+	var cfg struct {
+		HTTP *httpJobConfig `json:"http"`
+	}
+	err := json.Unmarshal([]byte(job.Config), &cfg)
+	if err != nil {
+		return fmt.Errorf("HTTP 任务配置错误 %w", err)
+	}
+	if cfg.HTTP == nil || cfg.HTTP.URL == "" {
+		return errors.New("HTTP 任务没有配置 url")
+	}
+	timeout, err := remoteTimeout(cfg.HTTP.Timeout, h.timeout)
+	if err != nil {
+		return err
+	}
+	method := cfg.HTTP.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	shard, shards := job.ShardInfo()
+	body, err := json.Marshal(HTTPJobRequest{
+		JobId:   job.Id,
+		Name:    job.Name,
+		Config:  job.Config,
+		Attempt: job.Attempt + 1,
+		Shard:   shard,
+		Shards:  shards,
+	})
+	if err != nil {
+		return err
+	}
+	// 续约失败或者超时的时候取消请求
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, cfg.HTTP.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range cfg.HTTP.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	// 带上一部分响应 方便排查问题
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("HTTP 任务返回 %d %s", resp.StatusCode, string(msg))
+}
+
+// remoteTimeout 任务配置的超时时间 没有配置就用默认的
+func remoteTimeout(val string, defaultTimeout time.Duration) (time.Duration, error) {
+	if val == "" {
+		return defaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(val)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("任务的超时时间配置错误 %s", val)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,102 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPExecutor_Exec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req HTTPJobRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || r.Header.Get("X-Token") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Name {
+		case "ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "shard":
+			if req.Shard != 2 || req.Shards != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case "slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second * 5):
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("boom"))
+		}
+	}))
+	defer server.Close()
+
+	config := func(timeout string) string {
+		return fmt.Sprintf(`{"http":{"url":%q,"timeout":%q,"headers":{"X-Token":"token"}}}`, server.URL, timeout)
+	}
+	testCases := []struct {
+		name    string
+		job     domain.Job
+		wantErr string
+	}{
+		{name: "成功", job: domain.Job{Name: "ok", Config: config("1s")}},
+		{
+			name: "分片",
+			job: domain.Job{
+				Name:   "shard",
+				Config: config("1s"),
+				Task:   &domain.JobTask{Shard: 2, Shards: 3},
+			},
+		},
+		{name: "业务方返回错误", job: domain.Job{Name: "fail", Config: config("1s")}, wantErr: "HTTP 任务返回 500 boom"},
+		{name: "超时", job: domain.Job{Name: "slow", Config: config("100ms")}, wantErr: "context deadline exceeded"},
+		{name: "没有配置 url", job: domain.Job{Name: "ok", Config: `{"http":{}}`}, wantErr: "HTTP 任务没有配置 url"},
+		{name: "超时时间错误", job: domain.Job{Name: "ok", Config: config("abc")}, wantErr: "任务的超时时间配置错误 abc"},
+	}
+
+	exec := NewHTTPExecutor(http.DefaultClient, time.Second)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := exec.Exec(context.Background(), tc.job)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+// 续约失败的时候 Scheduler 会取消 ctx
+func TestHTTPExecutor_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体之后才能感知到连接断开
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 5):
+		}
+	}))
+	defer server.Close()
+
+	exec := NewHTTPExecutor(http.DefaultClient, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*100, cancel)
+	start := time.Now()
+	err := exec.Exec(ctx, domain.Job{Config: fmt.Sprintf(`{"http":{"url":%q}}`, server.URL)})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second*5)
+}
@@ -0,0 +1,193 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/redis/go-redis/v9"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// NodeLoad 节点上报到 redis 的负载
+type NodeLoad struct {
+	Node string `json:"node"`
+	// 正在执行的任务数量
+	Running int64 `json:"running"`
+	// 进程的 CPU 使用率 0 到 1 之间
+	CPU float64 `json:"cpu"`
+	// 上报的时间 毫秒
+	Time int64 `json:"time"`
+}
+
+type LoadBalancerConfig struct {
+	// 上报负载的间隔
+	Interval time.Duration `yaml:"interval"`
+	// 负载比平均值高出多少比例算繁忙
+	Ratio float64 `yaml:"ratio"`
+	// 至少要比平均值高出这么多才算繁忙 避免负载都很低的时候频繁让出任务
+	Slack float64 `yaml:"slack"`
+	// CPU 打满相当于同时执行多少个任务
+	CPUWeight float64 `yaml:"cpuWeight"`
+}
+
+// LoadBalancer 各个节点定期把负载上报到 redis
+// 比其他节点明显繁忙的节点不再抢任务 并且让出正在执行的任务
+// 负载不超过平均值的节点永远不会繁忙 所以总有节点会抢任务
+type LoadBalancer struct {
+	client  redis.Cmdable
+	key     string
+	cfg     LoadBalancerConfig
+	metrics *Metrics
+	l       logger.LoggerV1
+
+	busy atomic.Bool
+
+	// 计算 CPU 使用率
+	lastCPU  time.Duration
+	lastTime time.Time
+}
+
+func NewLoadBalancer(
+	client redis.Cmdable,
+	cfg LoadBalancerConfig,
+	metrics *Metrics,
+	l logger.LoggerV1,
+) *LoadBalancer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second * 5
+	}
+	if cfg.Ratio <= 0 {
+		cfg.Ratio = 0.2
+	}
+	if cfg.Slack <= 0 {
+		cfg.Slack = 2
+	}
+	if cfg.CPUWeight <= 0 {
+		cfg.CPUWeight = 10
+	}
+	return &LoadBalancer{
+		client:  client,
+		key:     "job:nodes:load",
+		cfg:     cfg,
+		metrics: metrics,
+		l:       l,
+	}
+}
+
+// Busy 最近一次检查的时候 这个节点是不是比其他节点明显繁忙
+func (b *LoadBalancer) Busy() bool {
+	return b.busy.Load()
+}
+
+// Run 定期上报负载并且重新判断是否繁忙 ctx 结束的时候删除自己的负载
+// running 返回正在执行的任务数量
+// 每次检查之后调用 onCheck
+func (b *LoadBalancer) Run(ctx context.Context, node string, running func() int64, onCheck func(busy bool)) {
+	b.lastCPU = processCPUTime()
+	b.lastTime = time.Now()
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+	defer b.remove(node)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := b.check(ctx, NodeLoad{
+			Node:    node,
+			Running: running(),
+			CPU:     b.cpuUsage(),
+			Time:    time.Now().UnixMilli(),
+		})
+		if err != nil {
+			// 查不到其他节点的负载 按照不繁忙处理 退化成不做负载均衡
+			b.l.Error("上报节点负载失败", logger.Error(err), logger.String("node", node))
+			b.busy.Store(false)
+			continue
+		}
+		onCheck(b.Busy())
+	}
+}
+
+func (b *LoadBalancer) check(ctx context.Context, load NodeLoad) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	val, err := json.Marshal(load)
+	if err != nil {
+		return err
+	}
+	err = b.client.HSet(ctx, b.key, load.Node, val).Err()
+	if err != nil {
+		return err
+	}
+	vals, err := b.client.HGetAll(ctx, b.key).Result()
+	if err != nil {
+		return err
+	}
+
+	// 很久没有上报的节点已经下线了
+	expired := time.Now().Add(-b.cfg.Interval * 3).UnixMilli()
+	scores := make([]float64, 0, len(vals))
+	var stale []string
+	for node, val := range vals {
+		var l NodeLoad
+		if json.Unmarshal([]byte(val), &l) != nil || l.Time < expired {
+			stale = append(stale, node)
+			continue
+		}
+		scores = append(scores, b.score(l))
+	}
+	if len(stale) > 0 {
+		b.client.HDel(ctx, b.key, stale...)
+	}
+
+	mine := b.score(load)
+	avg := calculateAverage(scores)
+	b.busy.Store(b.isBusy(mine, avg))
+	b.metrics.ObserveLoad(load.Node, mine, avg, len(scores))
+	return nil
+}
+
+// isBusy 比平均负载高出一定比例 并且差距不是太小
+func (b *LoadBalancer) isBusy(mine, avg float64) bool {
+	return mine > avg*(1+b.cfg.Ratio) && mine-avg > b.cfg.Slack
+}
+
+// score 一个节点的负载 CPU 按照权重折算成任务数量
+func (b *LoadBalancer) score(load NodeLoad) float64 {
+	return float64(load.Running) + load.CPU*b.cfg.CPUWeight
+}
+
+// cpuUsage 上次调用以来进程的 CPU 使用率 按照 CPU 核数归一化
+func (b *LoadBalancer) cpuUsage() float64 {
+	now := time.Now()
+	cpu := processCPUTime()
+	elapsed := now.Sub(b.lastTime) * time.Duration(runtime.NumCPU())
+	used := cpu - b.lastCPU
+	b.lastCPU, b.lastTime = cpu, now
+	if elapsed <= 0 {
+		return 0
+	}
+	return min(max(float64(used)/float64(elapsed), 0), 1)
+}
+
+func (b *LoadBalancer) remove(node string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := b.client.HDel(ctx, b.key, node).Err()
+	if err != nil {
+		b.l.Warn("删除节点负载失败", logger.Error(err), logger.String("node", node))
+	}
+}
+
+// 计算平均数
+func calculateAverage(numbers []float64) float64 {
+	total := 0.0
+	for _, num := range numbers {
+		total += num
+	}
+	return total / float64(len(numbers))
+}
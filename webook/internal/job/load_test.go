@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_isBusy(t *testing.T) {
+	b := NewLoadBalancer(nil, LoadBalancerConfig{}, nil, logger.NewNopLogger())
+	testCases := []struct {
+		name string
+		mine float64
+		avg  float64
+		want bool
+	}{
+		{name: "比平均值低", mine: 1, avg: 5},
+		{name: "等于平均值", mine: 5, avg: 5},
+		{name: "高出的比例不够", mine: 11, avg: 10},
+		{name: "负载都很低", mine: 2, avg: 0.5},
+		{name: "明显繁忙", mine: 20, avg: 10, want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, b.isBusy(tc.mine, tc.avg))
+		})
+	}
+}
+
+func TestScheduler_onLoadCheck(t *testing.T) {
+	s := &Scheduler{
+		l:          logger.NewNopLogger(),
+		executions: map[*execution]struct{}{},
+	}
+	now := time.Now()
+	ctxs := make(map[string]context.Context)
+	add := func(name string, start time.Time, task *domain.JobTask) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		ctxs[name] = ctx
+		s.executions[&execution{job: domain.Job{Name: name, Task: task}, start: start, cancel: cancel}] = struct{}{}
+	}
+	add("old", now.Add(-time.Minute), nil)
+	add("new", now, nil)
+	// 指定了节点的广播子任务让不出去
+	add("broadcast", now.Add(time.Second), &domain.JobTask{Node: "node-1"})
+
+	s.onLoadCheck(false)
+	assert.NoError(t, ctxs["new"].Err())
+
+	s.onLoadCheck(true)
+	assert.True(t, errors.Is(context.Cause(ctxs["new"]), errJobYielded))
+	assert.NoError(t, ctxs["old"].Err())
+	assert.NoError(t, ctxs["broadcast"].Err())
+}
@@ -0,0 +1,176 @@
+package job
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// Metrics 定时任务的监控指标 本地定时任务和数据库调度的任务共用
+// 告警可以基于:
+//   - cron_job_runs_total{status="failed"} 的增长速率
+//   - time() - cron_job_last_success_timestamp_seconds 太久没有成功
+//   - cron_job_duration_seconds 的分位数
+//
+// 负载均衡的情况看 cron_job_node_load 和 cron_job_cluster_load_avg 的差距
+// 低优先级的任务一直堆积看 cron_job_queue_depth 执行器是不是被打满了看 cron_job_executor_running
+type Metrics struct {
+	duration    *prometheus.HistogramVec
+	runs        *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	running     *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+
+	nodeLoad    *prometheus.GaugeVec
+	clusterLoad prometheus.Gauge
+	liveNodes   prometheus.Gauge
+	skipped     prometheus.Counter
+	yielded     *prometheus.CounterVec
+
+	queueDepth      *prometheus.GaugeVec
+	executorRunning *prometheus.GaugeVec
+	limited         *prometheus.CounterVec
+}
+
+func NewMetrics(namespace, subsystem string) *Metrics {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_duration_seconds",
+			Help:      "定时任务的执行时间",
+			Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800},
+		}, []string{"job", "status"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_runs_total",
+			Help:      "定时任务的执行次数",
+		}, []string{"job", "status"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_retries_total",
+			Help:      "定时任务的重试次数",
+		}, []string{"job"}),
+		running: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_running",
+			Help:      "正在执行的定时任务",
+		}, []string{"job"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_last_success_timestamp_seconds",
+			Help:      "定时任务最近一次成功的时间",
+		}, []string{"job"}),
+		nodeLoad: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_node_load",
+			Help:      "调度节点的负载",
+		}, []string{"node"}),
+		clusterLoad: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_cluster_load_avg",
+			Help:      "所有调度节点的平均负载",
+		}),
+		liveNodes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_load_nodes",
+			Help:      "上报了负载的调度节点数量",
+		}),
+		skipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_preempt_skipped_total",
+			Help:      "负载太高放弃抢任务的次数",
+		}),
+		yielded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_yielded_total",
+			Help:      "负载太高让出正在执行的任务的次数",
+		}, []string{"job"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_queue_depth",
+			Help:      "到了执行时间还在等待的任务",
+		}, []string{"priority"}),
+		executorRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_executor_running",
+			Help:      "每个执行器正在执行的任务",
+		}, []string{"executor"}),
+		limited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "cron_job_limited_total",
+			Help:      "达到并发上限放回去的任务",
+		}, []string{"executor"}),
+	}
+	prometheus.MustRegister(m.duration, m.runs, m.retries, m.running, m.lastSuccess,
+		m.nodeLoad, m.clusterLoad, m.liveNodes, m.skipped, m.yielded,
+		m.queueDepth, m.executorRunning, m.limited)
+	return m
+}
+
+// Start 开始执行 返回的函数在执行结束时调用
+func (m *Metrics) Start(job string, attempt int) func(err error) {
+	start := time.Now()
+	m.running.WithLabelValues(job).Inc()
+	if attempt > 1 {
+		m.retries.WithLabelValues(job).Inc()
+	}
+	return func(err error) {
+		m.running.WithLabelValues(job).Dec()
+		status := "success"
+		switch {
+		case errors.Is(err, errJobYielded):
+			status = "yielded"
+			m.yielded.WithLabelValues(job).Inc()
+		case err != nil:
+			status = "failed"
+		default:
+			m.lastSuccess.WithLabelValues(job).SetToCurrentTime()
+		}
+		m.duration.WithLabelValues(job, status).Observe(time.Since(start).Seconds())
+		m.runs.WithLabelValues(job, status).Inc()
+	}
+}
+
+// ObserveLoad 记录自己的负载和集群的平均负载
+func (m *Metrics) ObserveLoad(node string, load float64, avg float64, nodes int) {
+	m.nodeLoad.WithLabelValues(node).Set(load)
+	m.clusterLoad.Set(avg)
+	m.liveNodes.Set(float64(nodes))
+}
+
+// PreemptSkipped 负载太高 这一轮不抢任务
+func (m *Metrics) PreemptSkipped() {
+	m.skipped.Inc()
+}
+
+// ObserveQueue 按照优先级记录等待中的任务 上一次有这一次没有的优先级清零
+func (m *Metrics) ObserveQueue(depth map[int]int64) {
+	m.queueDepth.Reset()
+	for priority, n := range depth {
+		m.queueDepth.WithLabelValues(strconv.Itoa(priority)).Set(float64(n))
+	}
+}
+
+// ExecutorRunning 执行器正在执行的任务数量
+func (m *Metrics) ExecutorRunning(executor string, n int64) {
+	m.executorRunning.WithLabelValues(executor).Set(float64(n))
+}
+
+// Limited 执行器或者任务达到并发上限 抢到的任务放回去了
+func (m *Metrics) Limited(executor string) {
+	m.limited.WithLabelValues(executor).Inc()
+}
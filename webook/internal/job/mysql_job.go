@@ -2,14 +2,24 @@ package job
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
 	"github.com/Anwenya/GeekTime/webook/internal/service"
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/Anwenya/GeekTime/webook/pkg/netx"
 	"golang.org/x/sync/semaphore"
+	"os"
+	"sync"
 	"time"
 )
 
+var (
+	errJobTimeout   = errors.New("任务执行超时")
+	errJobLeaseLost = errors.New("任务已经被其他节点抢占或者续约失败")
+	errJobYielded   = errors.New("节点负载太高 任务让给其他节点")
+)
+
 type Executor interface {
 	Name() string
 	Exec(ctx context.Context, job domain.Job) error
@@ -19,7 +29,7 @@ type LocalFuncExecutor struct {
 	funcs map[string]func(ctx context.Context, j domain.Job) error
 }
 
-func NewLocalFuncExecutor() Executor {
+func NewLocalFuncExecutor() *LocalFuncExecutor {
 	return &LocalFuncExecutor{
 		funcs: map[string]func(ctx context.Context, j domain.Job) error{},
 	}
@@ -44,33 +54,110 @@ func (l *LocalFuncExecutor) RegisterFunc(
 	l.funcs[name] = fn
 }
 
+// SchedulerConfig 本节点的并发上限 0 表示不限制
+type SchedulerConfig struct {
+	// 所有任务加起来最多同时执行多少个 默认 100
+	MaxRunning int64
+	// 每个执行器最多同时执行多少个 例如 {"http": 10}
+	Executors map[string]int64
+	// 每个任务最多同时执行多少个 按照名字配置 用来限制广播和分片任务的子任务
+	Jobs map[string]int64
+}
+
 // Scheduler 调度器
+// 普通任务抢到就执行 广播和分片任务抢到之后分发子任务 子任务再由各个节点抢占执行
+// 执行器满了的普通任务不抢 留给其他节点 抢到之后才发现满了的放回去
 type Scheduler struct {
 	dbTimeout time.Duration
 	svc       service.CronJobService
+	// 广播任务按照注册的节点分发
+	nodes service.JobNodeService
+	// 心跳间隔
+	heartbeatInterval time.Duration
 
 	executors map[string]Executor
 
-	l logger.LoggerV1
+	l       logger.LoggerV1
+	metrics *Metrics
 
 	limiter *semaphore.Weighted
+	cfg     SchedulerConfig
+	// 执行器和任务正在执行的数量 用 mutex 保护
+	byExecutor map[string]int64
+	byJob      map[int64]*jobRunning
+	// 执行记录里的节点名字
+	node string
+
+	// 为 nil 时不做负载均衡
+	balancer *LoadBalancer
+	// 正在执行的任务 负载太高的时候从里面挑一个让出去
+	mutex      sync.Mutex
+	executions map[*execution]struct{}
+}
+
+type jobRunning struct {
+	name string
+	n    int64
 }
 
-func NewScheduler(svc service.CronJobService, l logger.LoggerV1) *Scheduler {
+type execution struct {
+	job    domain.Job
+	start  time.Time
+	cancel context.CancelCauseFunc
+}
+
+// NewScheduler balancer 为 nil 时不做负载均衡
+func NewScheduler(
+	svc service.CronJobService,
+	nodes service.JobNodeService,
+	balancer *LoadBalancer,
+	cfg SchedulerConfig,
+	metrics *Metrics,
+	l logger.LoggerV1,
+) *Scheduler {
+	if cfg.MaxRunning <= 0 {
+		cfg.MaxRunning = 100
+	}
 	return &Scheduler{
-		svc:       svc,
-		dbTimeout: time.Second,
-		limiter:   semaphore.NewWeighted(100),
-		l:         l,
-		executors: map[string]Executor{},
+		svc:               svc,
+		nodes:             nodes,
+		balancer:          balancer,
+		executions:        map[*execution]struct{}{},
+		heartbeatInterval: time.Second * 10,
+		dbTimeout:         time.Second,
+		limiter:           semaphore.NewWeighted(cfg.MaxRunning),
+		cfg:               cfg,
+		byExecutor:        map[string]int64{},
+		byJob:             map[int64]*jobRunning{},
+		l:                 l,
+		metrics:           metrics,
+		executors:         map[string]Executor{},
+		node:              NodeName(),
 	}
 }
 
+// NodeName 主机名 取不到就用 IP
+func NodeName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return netx.GetOutboundIP()
+	}
+	return name
+}
+
 func (s *Scheduler) RegisterExecutor(exec Executor) {
 	s.executors[exec.Name()] = exec
 }
 
 func (s *Scheduler) Schedule(ctx context.Context) error {
+	// 先注册 广播任务才能分发到这个节点
+	s.heartbeat(ctx)
+	go s.keepHeartbeat(ctx)
+	defer s.leave()
+	if s.balancer != nil {
+		go s.balancer.Run(ctx, s.node, s.running, s.onLoadCheck)
+	}
+
 	for {
 		// 主动放弃调度
 		if ctx.Err() != nil {
@@ -83,29 +170,46 @@ func (s *Scheduler) Schedule(ctx context.Context) error {
 			return err
 		}
 
-		// 抢任务
-		dbCtx, cancel := context.WithTimeout(ctx, s.dbTimeout)
-		job, err := s.svc.Preempt(dbCtx)
-		cancel()
+		// 比其他节点忙的时候不抢 让给其他节点
+		if s.balancer != nil && s.balancer.Busy() {
+			s.limiter.Release(1)
+			s.metrics.PreemptSkipped()
+			time.Sleep(time.Second * 3)
+			continue
+		}
 
+		// 抢任务
+		job, err := s.preempt(ctx)
 		if err != nil {
-			// 有异常 睡眠之后继续新一轮
-			s.l.Error(
-				"抢占任务异常",
-				logger.Error(err),
-			)
+			s.limiter.Release(1)
+			if !errors.Is(err, service.ErrJobNotFound) {
+				// 有异常 睡眠之后继续新一轮
+				s.l.Error(
+					"抢占任务异常",
+					logger.Error(err),
+				)
+			}
 			time.Sleep(time.Second * 3)
 			continue
 		}
 
-		exec, ok := s.executors[job.Executor]
-		if !ok {
-			// 没有对应的处理函数 继续新一轮
-			s.l.Error(
-				"找不到执行器",
-				logger.Int64("jid", job.Id),
-				logger.String("executor", job.Executor),
-			)
+		if job.Task == nil && job.Mode != domain.JobModeSingle {
+			// 只负责分发子任务
+			go func() {
+				defer func() {
+					s.limiter.Release(1)
+					job.CancelFun()
+				}()
+				s.dispatch(job)
+			}()
+			continue
+		}
+
+		if !s.acquire(job) {
+			// 抢的时候还没满 或者是不按执行器过滤的子任务
+			s.giveBack(job)
+			s.limiter.Release(1)
+			time.Sleep(time.Second)
 			continue
 		}
 
@@ -113,30 +217,268 @@ func (s *Scheduler) Schedule(ctx context.Context) error {
 		go func() {
 			// 释放
 			defer func() {
+				s.release(job)
 				s.limiter.Release(1)
 				job.CancelFun()
 			}()
+			s.exec(ctx, job)
+		}()
+	}
+}
 
-			// 执行
-			err := exec.Exec(ctx, job)
-			if err != nil {
-				s.l.Error(
-					"执行任务失败",
-					logger.Int64("jid", job.Id),
-					logger.Error(err),
-				)
-				return
-			}
+// preempt 先抢普通任务 没有的话再抢子任务
+func (s *Scheduler) preempt(ctx context.Context) (domain.Job, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, s.dbTimeout)
+	defer cancel()
+	filter := s.filter()
+	job, err := s.svc.Preempt(dbCtx, filter)
+	if !errors.Is(err, service.ErrJobNotFound) {
+		return job, err
+	}
+	return s.svc.PreemptTask(dbCtx, s.node, filter)
+}
 
-			// 执行完成后更新下一次执行的时间
-			err = s.svc.ResetNextTime(ctx, job)
-			if err != nil {
-				s.l.Error(
-					"重置下次执行时间失败",
-					logger.Int64("jid", job.Id),
-					logger.Error(err),
-				)
-			}
-		}()
+// filter 已经达到并发上限的执行器和任务
+func (s *Scheduler) filter() domain.JobPreemptFilter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var res domain.JobPreemptFilter
+	for exec, n := range s.byExecutor {
+		if limit := s.cfg.Executors[exec]; limit > 0 && n >= limit {
+			res.Executors = append(res.Executors, exec)
+		}
+	}
+	for jid, r := range s.byJob {
+		if limit := s.cfg.Jobs[r.name]; limit > 0 && r.n >= limit {
+			res.JobIds = append(res.JobIds, jid)
+		}
+	}
+	return res
+}
+
+// acquire 执行器或者任务已经达到并发上限的时候返回 false
+func (s *Scheduler) acquire(job domain.Job) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if limit := s.cfg.Executors[job.Executor]; limit > 0 && s.byExecutor[job.Executor] >= limit {
+		return false
+	}
+	r, ok := s.byJob[job.Id]
+	if limit := s.cfg.Jobs[job.Name]; ok && limit > 0 && r.n >= limit {
+		return false
+	}
+	if !ok {
+		r = &jobRunning{name: job.Name}
+		s.byJob[job.Id] = r
+	}
+	r.n++
+	s.byExecutor[job.Executor]++
+	s.metrics.ExecutorRunning(job.Executor, s.byExecutor[job.Executor])
+	return true
+}
+
+func (s *Scheduler) release(job domain.Job) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.byExecutor[job.Executor]--
+	s.metrics.ExecutorRunning(job.Executor, s.byExecutor[job.Executor])
+	if r, ok := s.byJob[job.Id]; ok {
+		r.n--
+		if r.n <= 0 {
+			delete(s.byJob, job.Id)
+		}
+	}
+}
+
+// giveBack 不执行 马上放回去 子任务的执行次数不变
+func (s *Scheduler) giveBack(job domain.Job) {
+	s.metrics.Limited(job.Executor)
+	if job.Task != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.dbTimeout)
+		err := s.svc.Yield(ctx, job, domain.JobRun{})
+		cancel()
+		if err != nil {
+			s.l.Error("放回子任务失败", logger.Int64("jid", job.Id), logger.Error(err))
+		}
+	}
+	// 普通任务在这里释放
+	job.CancelFun()
+}
+
+// exec 找不到执行器的时候也算执行失败 这样会推进调度 不会一直被抢
+func (s *Scheduler) exec(ctx context.Context, job domain.Job) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.dbTimeout)
+	run := s.svc.Start(dbCtx, job, s.node)
+	cancel()
+	done := s.metrics.Start(job.Name, run.Attempt)
+	var err error
+	exec, ok := s.executors[job.Executor]
+	if ok {
+		execCtx, cancelExec := s.execContext(ctx, job)
+		defer cancelExec()
+		err = exec.Exec(execCtx, job)
+		// 带上取消的原因 方便在执行记录里排查
+		if cause := context.Cause(execCtx); err != nil && cause != nil && !errors.Is(err, cause) {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
+	} else {
+		err = fmt.Errorf("找不到执行器 %s", job.Executor)
+	}
+	done(err)
+	run.EndTime = time.Now()
+	run.Status = domain.JobRunStatusSuccess
+	if err != nil {
+		s.l.Error(
+			"执行任务失败",
+			logger.Int64("jid", job.Id),
+			logger.Int("attempt", run.Attempt),
+			logger.Error(err),
+		)
+		run.Status = domain.JobRunStatusFailed
+		run.Error = err.Error()
+	}
+
+	dbCtx, cancel = context.WithTimeout(context.Background(), s.dbTimeout)
+	defer cancel()
+	if errors.Is(err, errJobYielded) {
+		// 不记录结果 其他节点马上就可以抢到
+		err = s.svc.Yield(dbCtx, job, run)
+		if err != nil {
+			s.l.Error("让出任务失败", logger.Int64("jid", job.Id), logger.Error(err))
+		}
+		return
+	}
+	// 记录执行结果 并更新下一次执行的时间
+	err = s.svc.Complete(dbCtx, job, run)
+	if err != nil {
+		s.l.Error(
+			"记录执行结果失败",
+			logger.Int64("jid", job.Id),
+			logger.Error(err),
+		)
+	}
+}
+
+// dispatch 分发失败的时候和执行失败一样按照重试策略重试
+func (s *Scheduler) dispatch(job domain.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.dbTimeout*3)
+	defer cancel()
+	run := domain.JobRun{
+		StartTime: time.Now(),
+		Status:    domain.JobRunStatusSuccess,
+	}
+	err := s.svc.Dispatch(ctx, job)
+	run.EndTime = time.Now()
+	if err != nil {
+		s.l.Error("分发子任务失败", logger.Int64("jid", job.Id), logger.Error(err))
+		run.Status = domain.JobRunStatusFailed
+		run.Error = err.Error()
+	}
+	err = s.svc.Complete(ctx, job, run)
+	if err != nil {
+		s.l.Error("记录分发结果失败", logger.Int64("jid", job.Id), logger.Error(err))
+	}
+}
+
+func (s *Scheduler) keepHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.heartbeat(ctx)
+			s.observeQueue(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.dbTimeout)
+	defer cancel()
+	err := s.nodes.Heartbeat(ctx, s.node)
+	if err != nil {
+		s.l.Error("调度节点心跳失败", logger.Error(err), logger.String("node", s.node))
+	}
+}
+
+// observeQueue 每个节点看到的是同一个队列 随着心跳一起上报
+func (s *Scheduler) observeQueue(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.dbTimeout)
+	defer cancel()
+	depth, err := s.svc.CountDue(ctx)
+	if err != nil {
+		s.l.Error("统计等待中的任务失败", logger.Error(err))
+		return
+	}
+	s.metrics.ObserveQueue(depth)
+}
+
+// leave 正常退出的时候注销 不用等心跳超时
+func (s *Scheduler) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.dbTimeout)
+	defer cancel()
+	err := s.nodes.Leave(ctx, s.node)
+	if err != nil {
+		s.l.Error("注销调度节点失败", logger.Error(err), logger.String("node", s.node))
+	}
+}
+
+// execContext 超过最长执行时间 或者任务被别人抢走之后取消执行
+func (s *Scheduler) execContext(ctx context.Context, job domain.Job) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	cancelTimeout := func() {}
+	if job.MaxDuration > 0 {
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, job.MaxDuration,
+			fmt.Errorf("%w %s", errJobTimeout, job.MaxDuration))
+	}
+	go func() {
+		select {
+		case <-job.LeaseLost:
+			s.l.Warn("任务已经被其他节点抢占或者续约失败 取消执行", logger.Int64("jid", job.Id))
+			cancel(errJobLeaseLost)
+		case <-ctx.Done():
+		}
+	}()
+	exec := &execution{job: job, start: time.Now(), cancel: cancel}
+	s.mutex.Lock()
+	s.executions[exec] = struct{}{}
+	s.mutex.Unlock()
+	return ctx, func() {
+		s.mutex.Lock()
+		delete(s.executions, exec)
+		s.mutex.Unlock()
+		cancelTimeout()
+		cancel(nil)
+	}
+}
+
+func (s *Scheduler) running() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int64(len(s.executions))
+}
+
+// onLoadCheck 比其他节点忙的时候让出最近开始的一个任务 损失的进度最少
+// 指定了节点的广播子任务让不出去
+func (s *Scheduler) onLoadCheck(busy bool) {
+	if !busy {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var latest *execution
+	for exec := range s.executions {
+		if exec.job.Task != nil && exec.job.Task.Node != "" {
+			continue
+		}
+		if latest == nil || exec.start.After(latest.start) {
+			latest = exec
+		}
+	}
+	if latest != nil {
+		s.l.Info("节点负载太高 让出任务", logger.Int64("jid", latest.job.Id))
+		latest.cancel(errJobYielded)
 	}
 }
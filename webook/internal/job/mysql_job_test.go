@@ -0,0 +1,39 @@
+package job
+
+import (
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScheduler_acquire(t *testing.T) {
+	s := NewScheduler(nil, nil, nil, SchedulerConfig{
+		Executors: map[string]int64{"http": 2},
+		Jobs:      map[string]int64{"sharded": 1},
+	}, NewMetrics("test", "scheduler"), logger.NewNopLogger())
+
+	first := domain.Job{Id: 1, Name: "a", Executor: "http"}
+	second := domain.Job{Id: 2, Name: "b", Executor: "http"}
+	assert.True(t, s.acquire(first))
+	assert.True(t, s.acquire(second))
+	// http 执行器满了 其他执行器不受影响
+	assert.False(t, s.acquire(domain.Job{Id: 3, Name: "c", Executor: "http"}))
+	assert.True(t, s.acquire(domain.Job{Id: 4, Name: "d", Executor: "local"}))
+
+	// 同一个任务的子任务
+	task := domain.Job{Id: 5, Name: "sharded", Executor: "local", Task: &domain.JobTask{Id: 1}}
+	assert.True(t, s.acquire(task))
+	assert.False(t, s.acquire(task))
+	assert.Equal(t, domain.JobPreemptFilter{
+		Executors: []string{"http"},
+		JobIds:    []int64{5},
+	}, s.filter())
+
+	s.release(first)
+	s.release(task)
+	assert.Equal(t, domain.JobPreemptFilter{}, s.filter())
+	assert.True(t, s.acquire(domain.Job{Id: 3, Name: "c", Executor: "http"}))
+	// 执行完的任务不再占用
+	assert.Len(t, s.byJob, 3)
+}
@@ -0,0 +1,35 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+)
+
+// NewRankingFunc 注册到 LocalFuncExecutor 的排行榜任务
+// 任务配置是 JSON 格式的 score.Config 例如 {"strategy":"wilson","z":1.96}
+// 修改数据库中的任务配置就可以切换计分规则 不需要重新部署
+// 没有配置时使用服务默认的计分规则
+// 每次抢到任务版本号都会加一 用它作为 fencing token 租约丢了的节点写不了榜单
+func NewRankingFunc(svc service.RankingService) func(ctx context.Context, j domain.Job) error {
+	return func(ctx context.Context, j domain.Job) error {
+		ctx = dlock.WithToken(ctx, fmt.Sprintf("job:%d", j.Id), int64(j.Version))
+		if j.Config == "" {
+			return svc.TopN(ctx)
+		}
+		var cfg score.Config
+		err := json.Unmarshal([]byte(j.Config), &cfg)
+		if err != nil {
+			return err
+		}
+		strategy, err := score.New(cfg)
+		if err != nil {
+			return err
+		}
+		return svc.TopNWithStrategy(ctx, strategy)
+	}
+}
@@ -0,0 +1,44 @@
+package job
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// cachedRanking 直接把榜单写到缓存里
+type cachedRanking struct {
+	service.RankingService
+	cache cache.RankingCache
+}
+
+func (c *cachedRanking) TopN(ctx context.Context) error {
+	return c.cache.Set(ctx, []domain.Article{{Id: 1}})
+}
+
+func (c *cachedRanking) TopNWithStrategy(ctx context.Context, strategy score.Strategy) error {
+	return c.TopN(ctx)
+}
+
+func TestNewRankingFunc_Fencing(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fn := NewRankingFunc(&cachedRanking{
+		cache: cache.NewRedisRankingCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	})
+	ctx := context.Background()
+
+	require.NoError(t, fn(ctx, domain.Job{Id: 1, Version: 3}))
+	require.NoError(t, fn(ctx, domain.Job{Id: 1, Version: 4, Config: `{"strategy":"hn"}`}))
+	// 租约丢了之后别人已经用新的版本号写过榜单
+	err := fn(ctx, domain.Job{Id: 1, Version: 3})
+	assert.ErrorIs(t, err, cache.ErrStaleFencingToken)
+	// 其他任务的版本号单独比较
+	require.NoError(t, fn(ctx, domain.Job{Id: 2, Version: 1}))
+}
@@ -0,0 +1,71 @@
+package job
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"time"
+)
+
+// IdempotentRankingJob 幂等的榜单任务
+// 实时榜单写入前N名 全量重建 命名榜单的计算 以及快照的清理
+// 多个实例同时执行也没有问题 所以不加锁 注册成单例任务只是为了不重复计算
+type IdempotentRankingJob struct {
+	name    string
+	fn      func(ctx context.Context) error
+	timeout time.Duration
+}
+
+// NewStreamRankingMaterializeJob 定时把实时榜单的前N名写入排行榜
+func NewStreamRankingMaterializeJob(svc service.IncrementalRankingService, timeout time.Duration) *IdempotentRankingJob {
+	return &IdempotentRankingJob{
+		name:    "ranking_materialize",
+		fn:      svc.Materialize,
+		timeout: timeout,
+	}
+}
+
+// NewStreamRankingRebuildJob 定时用批量计算的数据重建实时榜单
+func NewStreamRankingRebuildJob(svc service.IncrementalRankingService, timeout time.Duration) *IdempotentRankingJob {
+	return &IdempotentRankingJob{
+		name:    "ranking_rebuild",
+		fn:      svc.Rebuild,
+		timeout: timeout,
+	}
+}
+
+// NewRankingListJob 定时计算所有命名榜单
+func NewRankingListJob(svc service.RankingListService, timeout time.Duration) *IdempotentRankingJob {
+	return &IdempotentRankingJob{
+		name:    "ranking_list",
+		fn:      svc.Refresh,
+		timeout: timeout,
+	}
+}
+
+// NewRankingSnapshotCleanupJob 定时删除过期的榜单快照
+func NewRankingSnapshotCleanupJob(svc service.RankingSnapshotService, timeout time.Duration) *IdempotentRankingJob {
+	return &IdempotentRankingJob{
+		name: "ranking_snapshot_cleanup",
+		fn: func(ctx context.Context) error {
+			_, err := svc.Cleanup(ctx)
+			return err
+		},
+		timeout: timeout,
+	}
+}
+
+func (s *IdempotentRankingJob) Name() string {
+	return s.name
+}
+
+func (s *IdempotentRankingJob) Run() error {
+	return s.Exec(context.Background(), domain.Job{})
+}
+
+// Exec 交给 Scheduler 执行时使用
+func (s *IdempotentRankingJob) Exec(ctx context.Context, _ domain.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.fn(ctx)
+}
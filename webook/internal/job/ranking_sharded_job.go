@@ -0,0 +1,178 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"math/rand"
+	"time"
+)
+
+// ShardedRankingJob 所有节点都执行
+// 每个节点通过分布式锁认领分片 计算分片内的前N名
+// 所有分片都有结果后 抢到合并锁的节点负责合并
+// 持有分片的节点崩溃后锁会过期 其他节点会接手这个分片
+// 锁的过期时间和续约由 dlock.Locker 负责 锁丢了会取消正在进行的计算和合并
+// 轮次取广播任务的执行时间 同一次广播的子任务相同 不依赖各个节点的时钟
+type ShardedRankingJob struct {
+	svc    service.ShardedRankingService
+	client dlock.Locker
+	l      logger.LoggerV1
+
+	// 本地执行时按照这个周期对齐轮次
+	interval time.Duration
+	timeout  time.Duration
+	// 分片被别人持有时 隔多久再检查一次
+	pollInterval time.Duration
+}
+
+func NewShardedRankingJob(
+	svc service.ShardedRankingService,
+	client dlock.Locker,
+	interval time.Duration,
+	timeout time.Duration,
+	l logger.LoggerV1,
+) *ShardedRankingJob {
+	return &ShardedRankingJob{
+		svc:          svc,
+		client:       client,
+		l:            l,
+		interval:     interval,
+		timeout:      timeout,
+		pollInterval: time.Second,
+	}
+}
+
+func (s *ShardedRankingJob) Name() string {
+	return "ranking_sharded"
+}
+
+func (s *ShardedRankingJob) Run() error {
+	return s.Exec(context.Background(), domain.Job{})
+}
+
+// Exec 交给 Scheduler 广播执行时使用
+func (s *ShardedRankingJob) Exec(ctx context.Context, j domain.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.run(ctx, s.round(j))
+}
+
+// round 广播的子任务用分发时的 tick 手动触发的时候也一样
+// 没有调度信息时 所有节点按照周期对齐到同一个轮次
+func (s *ShardedRankingJob) round(j domain.Job) int64 {
+	switch {
+	case j.Task != nil && !j.Task.Tick.IsZero():
+		return j.Task.Tick.Unix()
+	case !j.ScheduledTime.IsZero():
+		return j.ScheduledTime.Unix()
+	default:
+		return time.Now().Truncate(s.interval).Unix()
+	}
+}
+
+func (s *ShardedRankingJob) run(ctx context.Context, round int64) error {
+	for {
+		pending, err := s.svc.PendingShards(ctx, round)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		claimed := false
+		// 打乱顺序 减少节点之间的竞争
+		rand.Shuffle(len(pending), func(i, j int) {
+			pending[i], pending[j] = pending[j], pending[i]
+		})
+		for _, shard := range pending {
+			ok, err := s.computeShard(ctx, round, shard)
+			if err != nil {
+				return err
+			}
+			claimed = claimed || ok
+		}
+
+		if !claimed {
+			// 剩下的分片都在别人手里 等一会儿再看
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.pollInterval):
+			}
+		}
+	}
+
+	return s.merge(ctx, round)
+}
+
+// computeShard 没抢到锁时返回 false
+func (s *ShardedRankingJob) computeShard(ctx context.Context, round int64, shard int) (bool, error) {
+	lock, err := s.client.TryLock(ctx, fmt.Sprintf("job:ranking:%d:shard:%d", round, shard))
+	if errors.Is(err, dlock.ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer s.unlock(lock)
+
+	// 续约失败就停止计算 锁过期后由其他节点接手
+	ctx, cancel := withLock(ctx, lock)
+	defer cancel()
+
+	// 拿到锁之后再确认一次 可能在抢锁之前别人刚刚算完
+	pending, err := s.svc.PendingShards(ctx, round)
+	if err != nil {
+		return true, err
+	}
+	for _, p := range pending {
+		if p == shard {
+			return true, s.svc.ComputeShard(ctx, round, shard)
+		}
+	}
+	return true, nil
+}
+
+func (s *ShardedRankingJob) merge(ctx context.Context, round int64) error {
+	lock, err := s.client.TryLock(ctx, fmt.Sprintf("job:ranking:%d:merge", round))
+	if errors.Is(err, dlock.ErrLocked) {
+		// 别人在合并
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer s.unlock(lock)
+	ctx, cancel := withLock(ctx, lock)
+	defer cancel()
+	return s.svc.Merge(ctx, round)
+}
+
+func (s *ShardedRankingJob) unlock(lock dlock.Lock) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := lock.Unlock(ctx)
+	if err != nil {
+		s.l.Warn("释放分片锁失败", logger.Error(err))
+	}
+}
+
+// withLock ctx 过期或者锁丢了都会取消
+// 每一轮的锁都是新的 key 不带 fencing token 否则会和调度器写榜单时的 token 混在一起
+func withLock(ctx context.Context, lock dlock.Lock) (context.Context, context.CancelFunc) {
+	lockCtx := lock.Context()
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(lockCtx, func() {
+		cancel(context.Cause(lockCtx))
+	})
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
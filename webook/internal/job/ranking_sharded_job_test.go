@@ -0,0 +1,187 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryShardedRankingService 把中间结果记在内存里
+type memoryShardedRankingService struct {
+	service.ShardedRankingService
+	shards int
+	mutex  sync.Mutex
+	// 每个轮次每个分片计算的次数
+	computed map[int64]map[int]int
+	merged   map[int64]int
+	// 合并的时候还有没算完的分片
+	mergeErr error
+	// 不为空时计算分片会阻塞到 ctx 结束
+	block chan struct{}
+}
+
+func newMemoryShardedRankingService(shards int) *memoryShardedRankingService {
+	return &memoryShardedRankingService{
+		shards:   shards,
+		computed: map[int64]map[int]int{},
+		merged:   map[int64]int{},
+	}
+}
+
+func (m *memoryShardedRankingService) ComputeShard(ctx context.Context, round int64, shard int) error {
+	if m.block != nil {
+		close(m.block)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.computed[round] == nil {
+		m.computed[round] = map[int]int{}
+	}
+	m.computed[round][shard]++
+	return nil
+}
+
+func (m *memoryShardedRankingService) PendingShards(ctx context.Context, round int64) ([]int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var res []int
+	for i := 0; i < m.shards; i++ {
+		if m.computed[round][i] == 0 {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+func (m *memoryShardedRankingService) Merge(ctx context.Context, round int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.computed[round]) != m.shards {
+		m.mergeErr = fmt.Errorf("轮次 %d 只算完了 %d 个分片", round, len(m.computed[round]))
+		return m.mergeErr
+	}
+	m.merged[round]++
+	return nil
+}
+
+func (m *memoryShardedRankingService) Shards() int {
+	return m.shards
+}
+
+func newTestShardedRankingJob(svc service.ShardedRankingService, client dlock.Locker) *ShardedRankingJob {
+	j := NewShardedRankingJob(svc, client, time.Minute, time.Second*10, logger.NewNopLogger())
+	j.pollInterval = time.Millisecond * 10
+	return j
+}
+
+func TestShardedRankingJob_Claim(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := dlock.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	svc := newMemoryShardedRankingService(16)
+	tick := time.Now().Truncate(time.Second)
+	task := domain.Job{Task: &domain.JobTask{Tick: tick}}
+
+	// 三个节点同时执行同一次广播
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			j := newTestShardedRankingJob(svc, dlock.NewClient(store, time.Second*3))
+			errs[i] = j.Exec(context.Background(), task)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// 轮次是广播的 tick 每个分片只算一次
+	round := tick.Unix()
+	require.Len(t, svc.computed, 1)
+	require.Len(t, svc.computed[round], 16)
+	for shard, cnt := range svc.computed[round] {
+		assert.Equal(t, 1, cnt, "分片 %d", shard)
+	}
+	// 所有分片算完之后才合并
+	assert.NoError(t, svc.mergeErr)
+	assert.Positive(t, svc.merged[round])
+}
+
+func TestShardedRankingJob_Takeover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := dlock.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	svc := newMemoryShardedRankingService(4)
+	tick := time.Now().Truncate(time.Second)
+	round := tick.Unix()
+
+	// 持有分片 2 的节点崩溃了 没有释放锁
+	_, err := store.Acquire(context.Background(), fmt.Sprintf("job:ranking:%d:shard:%d", round, 2), "dead", time.Minute)
+	require.NoError(t, err)
+
+	j := newTestShardedRankingJob(svc, dlock.NewClient(store, time.Second*3))
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Exec(context.Background(), domain.Job{Task: &domain.JobTask{Tick: tick}})
+	}()
+	// 其他分片算完了 一直在等分片 2
+	require.Eventually(t, func() bool {
+		pending, er := svc.PendingShards(context.Background(), round)
+		return er == nil && len(pending) == 1 && pending[0] == 2
+	}, time.Second*3, time.Millisecond*10)
+	select {
+	case err = <-done:
+		t.Fatalf("分片 2 还没算就结束了 %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// 锁过期之后接手
+	mr.FastForward(time.Minute)
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("没有接手分片 2")
+	}
+	assert.Equal(t, 1, svc.computed[round][2])
+	assert.NoError(t, svc.mergeErr)
+	assert.Equal(t, 1, svc.merged[round])
+}
+
+func TestShardedRankingJob_LockLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := dlock.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	svc := newMemoryShardedRankingService(1)
+	svc.block = make(chan struct{})
+	tick := time.Now().Truncate(time.Second)
+
+	j := newTestShardedRankingJob(svc, dlock.NewClient(store, time.Millisecond*300))
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Exec(context.Background(), domain.Job{Task: &domain.JobTask{Tick: tick}})
+	}()
+	<-svc.block
+	// 锁被其他节点抢走了 续约失败之后停止计算
+	mr.Del(fmt.Sprintf("job:ranking:%d:shard:%d", tick.Unix(), 0))
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, context.Canceled) || errors.Is(err, dlock.ErrLockLost), err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("锁丢了还在计算")
+	}
+	assert.Empty(t, svc.merged)
+}
@@ -0,0 +1,229 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// RunMode 任务在集群里怎么执行
+type RunMode uint8
+
+const (
+	// RunModeLocal 每个节点按照自己的 cron 执行 任务自己处理多个节点同时执行的问题
+	RunModeLocal RunMode = iota
+	// RunModeSingleton 任务保存在数据库里 每次只有一个节点执行
+	RunModeSingleton
+	// RunModeBroadcast 任务保存在数据库里 每次每个存活的节点都执行一次
+	RunModeBroadcast
+)
+
+func (m RunMode) String() string {
+	switch m {
+	case RunModeLocal:
+		return "local"
+	case RunModeSingleton:
+		return "singleton"
+	case RunModeBroadcast:
+		return "broadcast"
+	default:
+		return "unknown"
+	}
+}
+
+// Definition 代码里定义的任务
+type Definition struct {
+	Name string
+	// cron 表达式 支持秒
+	Spec string
+	Mode RunMode
+	// 在本节点执行的函数 Executor 为空时必须设置
+	Func func(ctx context.Context, j domain.Job) error
+	// 数据库里的任务交给其他执行器执行 例如 http grpc
+	// 本地任务不能设置
+	Executor string
+	// 新建数据库里的任务时使用 之后以后台修改的为准
+	Config string
+	// 数据库里的任务越大越先执行
+	Priority int
+}
+
+// FuncOf 把只有 Run 方法的任务转成 Definition 的 Func 任务自己控制超时
+func FuncOf(job Job) func(ctx context.Context, j domain.Job) error {
+	return func(ctx context.Context, j domain.Job) error {
+		return job.Run()
+	}
+}
+
+// Registry 所有的定时任务都注册在这里
+// 本地任务注册到 cron 分布式任务启动时同步到数据库 由 Scheduler 抢占执行
+type Registry struct {
+	defs []Definition
+	// 防止重名
+	names map[string]struct{}
+
+	cron      *cron.Cron
+	builder   *CronJobBuilder
+	local     *LocalFuncExecutor
+	scheduler *Scheduler
+	workflows *WorkflowScheduler
+	svc       service.JobAdminService
+	l         logger.LoggerV1
+
+	syncTimeout time.Duration
+	cancel      context.CancelFunc
+}
+
+func NewRegistry(
+	svc service.JobAdminService,
+	scheduler *Scheduler,
+	workflows *WorkflowScheduler,
+	metrics *Metrics,
+	l logger.LoggerV1,
+) *Registry {
+	r := &Registry{
+		names:       map[string]struct{}{},
+		cron:        cron.New(cron.WithSeconds()),
+		builder:     NewCronJobBuilder(metrics, l),
+		local:       NewLocalFuncExecutor(),
+		scheduler:   scheduler,
+		workflows:   workflows,
+		svc:         svc,
+		l:           l,
+		syncTimeout: time.Second * 10,
+	}
+	r.RegisterExecutor(r.local)
+	return r
+}
+
+// RegisterExecutor 数据库里的任务和工作流都可以用这个执行器
+func (r *Registry) RegisterExecutor(exec Executor) {
+	r.scheduler.RegisterExecutor(exec)
+	r.workflows.RegisterExecutor(exec)
+}
+
+// Register 要在 Start 之前调用
+func (r *Registry) Register(def Definition) error {
+	if def.Name == "" {
+		return errors.New("任务名字不能为空")
+	}
+	if _, ok := r.names[def.Name]; ok {
+		return fmt.Errorf("任务 %s 重复注册", def.Name)
+	}
+	if def.Executor == "" && def.Func == nil {
+		return fmt.Errorf("任务 %s 没有设置执行函数", def.Name)
+	}
+	_, err := domain.ParseJobExpression(def.Spec)
+	if err != nil {
+		return fmt.Errorf("任务 %s 的 cron 表达式错误 %w", def.Name, err)
+	}
+
+	switch def.Mode {
+	case RunModeLocal:
+		if def.Executor != "" {
+			return fmt.Errorf("本地任务 %s 不能指定执行器", def.Name)
+		}
+		_, err = r.cron.AddJob(def.Spec, r.builder.Build(localJob{def: def}))
+		if err != nil {
+			return err
+		}
+	case RunModeSingleton, RunModeBroadcast:
+		if def.Executor == "" {
+			r.local.RegisterFunc(def.Name, def.Func)
+		}
+	default:
+		return fmt.Errorf("任务 %s 的执行方式未知 %d", def.Name, def.Mode)
+	}
+	r.names[def.Name] = struct{}{}
+	r.defs = append(r.defs, def)
+	return nil
+}
+
+// Definitions 注册过的所有任务 按照注册的顺序
+func (r *Registry) Definitions() []Definition {
+	res := make([]Definition, len(r.defs))
+	copy(res, r.defs)
+	return res
+}
+
+// Start 先把分布式任务同步到数据库 再开始调度
+func (r *Registry) Start() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.syncTimeout)
+	err := r.sync(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.cron.Start()
+	go func() {
+		err := r.scheduler.Schedule(ctx)
+		r.l.Info("任务调度退出", logger.Error(err))
+	}()
+	go func() {
+		err := r.workflows.Schedule(ctx)
+		r.l.Info("工作流调度退出", logger.Error(err))
+	}()
+	return nil
+}
+
+// Stop 停止调度 返回的 ctx 在本地任务都执行完之后关闭
+func (r *Registry) Stop() context.Context {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return r.cron.Stop()
+}
+
+// sync 代码里的定义为准 只新建和更新 不会删除数据库里的任务
+// 后台手动创建的任务和已经下线的任务保持原样
+func (r *Registry) sync(ctx context.Context) error {
+	jobs := make([]domain.Job, 0, len(r.defs))
+	for _, def := range r.defs {
+		if def.Mode == RunModeLocal {
+			continue
+		}
+		job := domain.Job{
+			Name:       def.Name,
+			Expression: def.Spec,
+			Executor:   def.Executor,
+			Config:     def.Config,
+			Mode:       domain.JobModeSingle,
+			Priority:   def.Priority,
+		}
+		if job.Executor == "" {
+			job.Executor = r.local.Name()
+		}
+		if def.Mode == RunModeBroadcast {
+			job.Mode = domain.JobModeBroadcast
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	return r.svc.Sync(ctx, jobs)
+}
+
+// localJob 本地任务每次执行的时候拿到的是代码里的定义
+type localJob struct {
+	def Definition
+}
+
+func (l localJob) Name() string {
+	return l.def.Name
+}
+
+func (l localJob) Run() error {
+	return l.def.Func(context.Background(), domain.Job{
+		Name:       l.def.Name,
+		Expression: l.def.Spec,
+		Config:     l.def.Config,
+	})
+}
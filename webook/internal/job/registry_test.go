@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// syncRecorder 只记录同步到数据库的任务
+type syncRecorder struct {
+	service.JobAdminService
+	jobs []domain.Job
+}
+
+func (s *syncRecorder) Sync(ctx context.Context, jobs []domain.Job) error {
+	s.jobs = jobs
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	svc := &syncRecorder{}
+	l := logger.NewNopLogger()
+	r := NewRegistry(svc, NewScheduler(nil, nil, nil, SchedulerConfig{}, nil, l), NewWorkflowScheduler(nil, l), nil, l)
+	fn := func(ctx context.Context, j domain.Job) error {
+		return nil
+	}
+
+	require.NoError(t, r.Register(Definition{Name: "local", Spec: "@every 1m", Func: fn}))
+	require.NoError(t, r.Register(Definition{
+		Name: "singleton", Spec: "0 */5 * * * *", Mode: RunModeSingleton, Func: fn, Config: "{}",
+	}))
+	require.NoError(t, r.Register(Definition{
+		Name: "broadcast", Spec: "@every 1h", Mode: RunModeBroadcast, Executor: "http",
+	}))
+
+	testCases := []struct {
+		name string
+		def  Definition
+	}{
+		{name: "重名", def: Definition{Name: "local", Spec: "@every 1m", Func: fn}},
+		{name: "没有名字", def: Definition{Spec: "@every 1m", Func: fn}},
+		{name: "表达式错误", def: Definition{Name: "a", Spec: "abc", Func: fn}},
+		{name: "没有执行函数", def: Definition{Name: "a", Spec: "@every 1m", Mode: RunModeSingleton}},
+		{name: "本地任务指定执行器", def: Definition{Name: "a", Spec: "@every 1m", Executor: "http"}},
+		{name: "未知的执行方式", def: Definition{Name: "a", Spec: "@every 1m", Mode: 10, Func: fn}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, r.Register(tc.def))
+		})
+	}
+
+	names := make([]string, 0, 3)
+	for _, def := range r.Definitions() {
+		names = append(names, def.Name)
+	}
+	assert.Equal(t, []string{"local", "singleton", "broadcast"}, names)
+	assert.Len(t, r.cron.Entries(), 1)
+
+	// 只有分布式任务会同步到数据库
+	require.NoError(t, r.sync(context.Background()))
+	assert.Equal(t, []domain.Job{
+		{
+			Name:       "singleton",
+			Expression: "0 */5 * * * *",
+			Executor:   "local",
+			Config:     "{}",
+			Mode:       domain.JobModeSingle,
+		},
+		{
+			Name:       "broadcast",
+			Expression: "@every 1h",
+			Executor:   "http",
+			Mode:       domain.JobModeBroadcast,
+		},
+	}, svc.jobs)
+	// 分布式任务由本地执行器执行
+	assert.NoError(t, r.local.Exec(context.Background(), domain.Job{Name: "singleton"}))
+}
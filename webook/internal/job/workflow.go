@@ -0,0 +1,312 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"golang.org/x/sync/semaphore"
+	"time"
+)
+
+// WorkflowScheduler 执行工作流
+// 节点直接在抢到工作流的节点上执行 用的是和 Scheduler 一样的执行器
+// 每个节点的状态变化都会保存下来 节点崩溃之后其他节点从保存的状态继续执行
+// 崩溃时正在执行的节点会重新执行一次
+type WorkflowScheduler struct {
+	svc       service.WorkflowRunService
+	executors map[string]Executor
+	l         logger.LoggerV1
+
+	dbTimeout time.Duration
+	// 没有工作流可以执行时 隔多久再看一次
+	pollInterval time.Duration
+	// 同时执行的工作流数量
+	limiter *semaphore.Weighted
+	node    string
+}
+
+func NewWorkflowScheduler(svc service.WorkflowRunService, l logger.LoggerV1) *WorkflowScheduler {
+	return &WorkflowScheduler{
+		svc:          svc,
+		executors:    map[string]Executor{},
+		l:            l,
+		dbTimeout:    time.Second,
+		pollInterval: time.Second,
+		limiter:      semaphore.NewWeighted(10),
+		node:         NodeName(),
+	}
+}
+
+func (s *WorkflowScheduler) RegisterExecutor(exec Executor) {
+	s.executors[exec.Name()] = exec
+}
+
+func (s *WorkflowScheduler) Schedule(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := s.limiter.Acquire(ctx, 1)
+		if err != nil {
+			return err
+		}
+
+		dbCtx, cancel := context.WithTimeout(ctx, s.dbTimeout)
+		wf, run, err := s.svc.Preempt(dbCtx, s.node)
+		cancel()
+		if err != nil {
+			s.limiter.Release(1)
+			if !errors.Is(err, service.ErrNoWorkflowRun) {
+				s.l.Error("抢占工作流异常", logger.Error(err))
+			}
+			time.Sleep(s.pollInterval)
+			continue
+		}
+
+		go func() {
+			defer func() {
+				s.limiter.Release(1)
+				run.CancelFun()
+			}()
+			s.run(ctx, wf, run)
+		}()
+	}
+}
+
+func (s *WorkflowScheduler) run(ctx context.Context, wf domain.Workflow, run domain.WorkflowRun) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-run.LeaseLost:
+			s.l.Warn("工作流已经被其他节点接手 停止执行", logger.Int64("runId", run.Id))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	names := make([]string, 0, len(wf.Steps))
+	defs := make(map[string]domain.WorkflowStep, len(wf.Steps))
+	for _, step := range wf.Steps {
+		names = append(names, step.Job)
+		defs[step.Job] = step
+	}
+	jobs, err := s.svc.Jobs(ctx, names)
+	if err != nil {
+		// 不再续约 过一会儿会被重新接手
+		s.l.Error("查询工作流的任务失败", logger.Error(err), logger.Int64("runId", run.Id))
+		return
+	}
+
+	steps := make(map[string]*domain.WorkflowStepRun, len(run.Steps))
+	for i := range run.Steps {
+		step := &run.Steps[i]
+		// 上次崩溃时正在执行的节点 重新执行
+		if step.Status == domain.WorkflowStepRunning {
+			step.Status = domain.WorkflowStepPending
+		}
+		steps[step.Job] = step
+	}
+
+	results := make(chan stepResult)
+	running := 0
+	stopped := false
+	// 保存节点状态失败 不知道数据库里是什么状态
+	interrupted := false
+	for {
+		if !stopped && !interrupted && ctx.Err() == nil {
+			for _, name := range run.Ready(wf) {
+				step := steps[name]
+				step.Status = domain.WorkflowStepRunning
+				running++
+				go func(step domain.WorkflowStepRun) {
+					res, err := s.runStep(ctx, cancel, run, defs[step.Job], jobs, step)
+					results <- stepResult{step: res, err: err}
+				}(*step)
+			}
+		}
+		if running == 0 {
+			break
+		}
+		res := <-results
+		running--
+		*steps[res.step.Job] = res.step
+		if res.err != nil {
+			// 正在执行的节点会执行完 不再开始新的节点
+			interrupted = true
+		}
+		if res.step.Status == domain.WorkflowStepFailed {
+			stopped = true
+		}
+	}
+	if ctx.Err() != nil || interrupted {
+		// 续约失败 调度器退出了或者保存状态失败 不再续约 留给其他节点接着执行
+		return
+	}
+	s.finish(ctx, run, stopped)
+}
+
+type stepResult struct {
+	step domain.WorkflowStepRun
+	// 保存节点状态失败
+	err error
+}
+
+// runStep 执行一个节点 失败策略是重试时在这里重试
+// ctx 被取消时直接返回 不保存结果 保存状态失败时返回 error
+func (s *WorkflowScheduler) runStep(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	run domain.WorkflowRun,
+	def domain.WorkflowStep,
+	jobs map[string]domain.Job,
+	step domain.WorkflowStepRun,
+) (domain.WorkflowStepRun, error) {
+	job, ok := jobs[step.Job]
+	var exec Executor
+	if ok {
+		exec, ok = s.executors[job.Executor]
+	}
+	for {
+		step.Attempt++
+		step.Status = domain.WorkflowStepRunning
+		step.StartTime = time.Now()
+		step.EndTime = time.Time{}
+		record, err := s.svc.StartStep(ctx, run, step, job)
+		if err != nil {
+			s.stepErr(cancel, run, step, err)
+			return step, err
+		}
+
+		switch {
+		case job.Id == 0:
+			err = fmt.Errorf("任务不存在 %s", step.Job)
+		case !ok:
+			err = fmt.Errorf("找不到执行器 %s", job.Executor)
+		default:
+			job.Attempt = step.Attempt - 1
+			err = s.exec(ctx, exec, job)
+		}
+		if ctx.Err() != nil {
+			return step, nil
+		}
+		step.EndTime = time.Now()
+		step.Error = ""
+		if err == nil {
+			step.Status = domain.WorkflowStepSuccess
+		} else {
+			step.Error = err.Error()
+			step.Status = s.failedStatus(def, step)
+		}
+		er := s.svc.FinishStep(ctx, run, step, record)
+		if er != nil {
+			s.stepErr(cancel, run, step, er)
+			return step, er
+		}
+		if step.Status != domain.WorkflowStepRunning {
+			return step, nil
+		}
+
+		s.l.Warn("工作流节点执行失败 稍后重试",
+			logger.Int64("runId", run.Id),
+			logger.String("job", step.Job),
+			logger.Int("attempt", step.Attempt),
+			logger.Error(err))
+		select {
+		case <-ctx.Done():
+			return step, nil
+		case <-time.After(def.Retry.Backoff(step.Attempt)):
+		}
+	}
+}
+
+// failedStatus 失败之后节点的状态 还要重试的时候仍然是执行中
+func (s *WorkflowScheduler) failedStatus(def domain.WorkflowStep, step domain.WorkflowStepRun) domain.WorkflowStepStatus {
+	switch def.OnFailure {
+	case domain.WorkflowFailureSkip:
+		return domain.WorkflowStepSkipped
+	case domain.WorkflowFailureRetry:
+		if step.Attempt < def.Retry.MaxAttempts {
+			return domain.WorkflowStepRunning
+		}
+		return domain.WorkflowStepFailed
+	default:
+		return domain.WorkflowStepFailed
+	}
+}
+
+func (s *WorkflowScheduler) stepErr(
+	cancel context.CancelFunc,
+	run domain.WorkflowRun,
+	step domain.WorkflowStepRun,
+	err error,
+) {
+	s.l.Error("保存工作流节点状态失败",
+		logger.Error(err),
+		logger.Int64("runId", run.Id),
+		logger.String("job", step.Job))
+	if errors.Is(err, service.ErrWorkflowLeaseLost) {
+		// 已经不归自己了
+		cancel()
+	}
+}
+
+// finish 停止时没有执行的节点标记为取消
+// 只有所有节点都成功或者被跳过才算成功
+func (s *WorkflowScheduler) finish(ctx context.Context, run domain.WorkflowRun, stopped bool) {
+	if !stopped {
+		for _, step := range run.Steps {
+			if step.Status != domain.WorkflowStepSuccess && step.Status != domain.WorkflowStepSkipped {
+				s.l.Error("工作流还有节点没有执行完",
+					logger.Int64("runId", run.Id),
+					logger.String("job", step.Job),
+					logger.String("status", step.Status.String()))
+				stopped = true
+				break
+			}
+		}
+	}
+	run.Status = domain.WorkflowRunSuccess
+	if stopped {
+		run.Status = domain.WorkflowRunFailed
+		for _, step := range run.Steps {
+			if step.Status != domain.WorkflowStepPending {
+				continue
+			}
+			step.Status = domain.WorkflowStepCanceled
+			err := s.svc.FinishStep(ctx, run, step, domain.JobRun{})
+			if err != nil {
+				s.l.Error("保存工作流节点状态失败", logger.Error(err), logger.Int64("runId", run.Id))
+				return
+			}
+		}
+	}
+	run.EndTime = time.Now()
+	err := s.svc.FinishRun(ctx, run)
+	if err != nil {
+		s.l.Error("保存工作流执行结果失败", logger.Error(err), logger.Int64("runId", run.Id))
+		return
+	}
+	s.l.Info("工作流执行结束",
+		logger.Int64("runId", run.Id),
+		logger.String("workflow", run.WorkflowName),
+		logger.String("status", run.Status.String()))
+}
+
+// exec 超过任务的最长执行时间只取消这一次执行 不影响整个工作流
+func (s *WorkflowScheduler) exec(ctx context.Context, exec Executor, job domain.Job) error {
+	if job.MaxDuration <= 0 {
+		return exec.Exec(ctx, job)
+	}
+	execCtx, cancel := context.WithTimeoutCause(ctx, job.MaxDuration,
+		fmt.Errorf("%w %s", errJobTimeout, job.MaxDuration))
+	defer cancel()
+	err := exec.Exec(execCtx, job)
+	if err != nil && ctx.Err() == nil && execCtx.Err() != nil {
+		err = fmt.Errorf("%w: %w", context.Cause(execCtx), err)
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryWorkflowRunService 把节点的状态记在内存里
+type memoryWorkflowRunService struct {
+	service.WorkflowRunService
+	mutex sync.Mutex
+	// 最后保存的节点状态
+	steps map[string]domain.WorkflowStepRun
+	// 保存这个节点的结果时失败
+	failFinish string
+	finished   *domain.WorkflowRun
+}
+
+func (m *memoryWorkflowRunService) Jobs(ctx context.Context, names []string) (map[string]domain.Job, error) {
+	res := make(map[string]domain.Job, len(names))
+	for i, name := range names {
+		res[name] = domain.Job{Id: int64(i + 1), Name: name, Executor: "local"}
+	}
+	return res, nil
+}
+
+func (m *memoryWorkflowRunService) StartStep(ctx context.Context, run domain.WorkflowRun, step domain.WorkflowStepRun, job domain.Job) (domain.JobRun, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.steps[step.Job] = step
+	return domain.JobRun{}, nil
+}
+
+func (m *memoryWorkflowRunService) FinishStep(ctx context.Context, run domain.WorkflowRun, step domain.WorkflowStepRun, exec domain.JobRun) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if step.Job == m.failFinish {
+		return errors.New("模拟的数据库错误")
+	}
+	m.steps[step.Job] = step
+	return nil
+}
+
+func (m *memoryWorkflowRunService) FinishRun(ctx context.Context, run domain.WorkflowRun) error {
+	m.finished = &run
+	return nil
+}
+
+func TestWorkflowScheduler_run(t *testing.T) {
+	retry := domain.JobRetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		Multiplier:      1,
+	}
+	// a -> b -> c
+	steps := func(onFailure domain.WorkflowFailurePolicy) []domain.WorkflowStep {
+		return []domain.WorkflowStep{
+			{Job: "a", OnFailure: onFailure, Retry: retry},
+			{Job: "b", Depends: []string{"a"}},
+			{Job: "c", Depends: []string{"b"}},
+		}
+	}
+	testCases := []struct {
+		name  string
+		steps []domain.WorkflowStep
+		// 已经保存的节点状态 没有的是待执行
+		saved      map[string]domain.WorkflowStepStatus
+		failFinish string
+		// 每个节点前几次执行失败
+		failures map[string]int
+
+		wantStatus domain.WorkflowRunStatus
+		// 没有结束 等待其他节点接手
+		wantUnfinished bool
+		wantSteps      map[string]domain.WorkflowStepStatus
+		wantExecs      map[string]int
+	}{
+		{
+			name:       "全部成功",
+			steps:      steps(""),
+			wantStatus: domain.WorkflowRunSuccess,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepSuccess,
+				"b": domain.WorkflowStepSuccess,
+				"c": domain.WorkflowStepSuccess,
+			},
+			wantExecs: map[string]int{"a": 1, "b": 1, "c": 1},
+		},
+		{
+			name:       "失败停止",
+			steps:      steps(domain.WorkflowFailureStop),
+			failures:   map[string]int{"a": 1},
+			wantStatus: domain.WorkflowRunFailed,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepFailed,
+				"b": domain.WorkflowStepCanceled,
+				"c": domain.WorkflowStepCanceled,
+			},
+			wantExecs: map[string]int{"a": 1},
+		},
+		{
+			name:       "失败跳过",
+			steps:      steps(domain.WorkflowFailureSkip),
+			failures:   map[string]int{"a": 1},
+			wantStatus: domain.WorkflowRunSuccess,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepSkipped,
+				"b": domain.WorkflowStepSuccess,
+				"c": domain.WorkflowStepSuccess,
+			},
+			wantExecs: map[string]int{"a": 1, "b": 1, "c": 1},
+		},
+		{
+			name:       "重试成功",
+			steps:      steps(domain.WorkflowFailureRetry),
+			failures:   map[string]int{"a": 2},
+			wantStatus: domain.WorkflowRunSuccess,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepSuccess,
+				"b": domain.WorkflowStepSuccess,
+				"c": domain.WorkflowStepSuccess,
+			},
+			wantExecs: map[string]int{"a": 3, "b": 1, "c": 1},
+		},
+		{
+			name:       "重试用完",
+			steps:      steps(domain.WorkflowFailureRetry),
+			failures:   map[string]int{"a": 3},
+			wantStatus: domain.WorkflowRunFailed,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepFailed,
+				"b": domain.WorkflowStepCanceled,
+				"c": domain.WorkflowStepCanceled,
+			},
+			wantExecs: map[string]int{"a": 3},
+		},
+		{
+			name:  "崩溃之后接着执行",
+			steps: steps(""),
+			saved: map[string]domain.WorkflowStepStatus{
+				"a": domain.WorkflowStepSuccess,
+				// 崩溃时正在执行 重新执行
+				"b": domain.WorkflowStepRunning,
+			},
+			wantStatus: domain.WorkflowRunSuccess,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				"b": domain.WorkflowStepSuccess,
+				"c": domain.WorkflowStepSuccess,
+			},
+			wantExecs: map[string]int{"b": 1, "c": 1},
+		},
+		{
+			name:           "保存状态失败",
+			steps:          steps(""),
+			failFinish:     "a",
+			wantUnfinished: true,
+			wantSteps: map[string]domain.WorkflowStepStatus{
+				// 数据库里还是执行中 接手的节点会重新执行
+				"a": domain.WorkflowStepRunning,
+			},
+			wantExecs: map[string]int{"a": 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &memoryWorkflowRunService{
+				steps:      map[string]domain.WorkflowStepRun{},
+				failFinish: tc.failFinish,
+			}
+			s := NewWorkflowScheduler(svc, logger.NewNopLogger())
+			var mutex sync.Mutex
+			execs := map[string]int{}
+			exec := NewLocalFuncExecutor()
+			for _, step := range tc.steps {
+				exec.RegisterFunc(step.Job, func(ctx context.Context, j domain.Job) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+					execs[j.Name]++
+					if execs[j.Name] <= tc.failures[j.Name] {
+						return errors.New("模拟的执行失败")
+					}
+					return nil
+				})
+			}
+			s.RegisterExecutor(exec)
+
+			wf := domain.Workflow{Id: 1, Name: "wf", Steps: tc.steps}
+			run := domain.WorkflowRun{Id: 1, WorkflowId: 1, Status: domain.WorkflowRunRunning}
+			for _, step := range tc.steps {
+				run.Steps = append(run.Steps, domain.WorkflowStepRun{
+					Job:    step.Job,
+					Status: tc.saved[step.Job],
+				})
+			}
+			s.run(context.Background(), wf, run)
+
+			if tc.wantUnfinished {
+				assert.Nil(t, svc.finished)
+			} else if assert.NotNil(t, svc.finished) {
+				assert.Equal(t, tc.wantStatus, svc.finished.Status)
+			}
+			status := make(map[string]domain.WorkflowStepStatus, len(svc.steps))
+			for name, step := range svc.steps {
+				status[name] = step.Status
+			}
+			assert.Equal(t, tc.wantSteps, status)
+			assert.Equal(t, tc.wantExecs, execs)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
 	"github.com/ecodeclub/ekit/slice"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
@@ -20,6 +21,7 @@ type ArticleRepository interface {
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id int64) (domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error)
+	ListPubByShard(ctx context.Context, start time.Time, shard int, shards int, offset int, limit int) ([]domain.Article, error)
 }
 
 // CachedArticleRepository
@@ -70,6 +72,26 @@ func (c *CachedArticleRepository) ListPub(ctx context.Context, start time.Time,
 	), nil
 }
 
+func (c *CachedArticleRepository) ListPubByShard(
+	ctx context.Context,
+	start time.Time,
+	shard int,
+	shards int,
+	offset int,
+	limit int,
+) ([]domain.Article, error) {
+	arts, err := c.dao.ListPubByShard(ctx, start, shard, shards, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](
+		arts,
+		func(idx int, src dao.PublishedArticle) domain.Article {
+			return c.toDomain(dao.Article(src))
+		},
+	), nil
+}
+
 // NewCachedArticleRepositoryV2
 // 分库写法 仅用于跑测试
 func NewCachedArticleRepositoryV2(
@@ -341,11 +363,14 @@ func (c *CachedArticleRepository) SyncV2(ctx context.Context, art domain.Article
 
 func (c *CachedArticleRepository) toEntity(art domain.Article) dao.Article {
 	return dao.Article{
-		Id:       art.Id,
-		Title:    art.Title,
-		Content:  art.Content,
-		AuthorId: art.Author.Id,
-		Status:   art.Status.ToUint8(),
+		Id:         art.Id,
+		Title:      art.Title,
+		Content:    art.Content,
+		AuthorId:   art.Author.Id,
+		Status:     art.Status.ToUint8(),
+		ReadMetric: art.ReadMetric,
+		Category:   art.Category,
+		Tags:       strings.Join(art.Tags, ","),
 	}
 }
 
@@ -360,7 +385,18 @@ func (c *CachedArticleRepository) toDomain(art dao.Article) domain.Article {
 		CreateTime: time.UnixMilli(art.CreateTime),
 		UpdateTime: time.UnixMilli(art.UpdateTime),
 		Status:     domain.ArticleStatus(art.Status),
+		ReadMetric: art.ReadMetric,
+		Category:   art.Category,
+		Tags:       c.tagsOf(art.Tags),
+	}
+}
+
+// tagsOf 没有标签时是 nil
+func (c *CachedArticleRepository) tagsOf(tags string) []string {
+	if tags == "" {
+		return nil
 	}
+	return strings.Split(tags, ",")
 }
 
 func (c *CachedArticleRepository) preCache(ctx context.Context, arts []domain.Article) {
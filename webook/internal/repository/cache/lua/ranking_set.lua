@@ -0,0 +1,16 @@
+local key = KEYS[1]
+-- 每种锁的存储一个 key 不同存储的 token 不能比较
+local fencingKey = KEYS[2]
+local val = ARGV[1]
+local expiration = ARGV[2]
+local token = tonumber(ARGV[3])
+local fencingExpiration = ARGV[4]
+
+-- 已经有更新的锁持有者写过了
+local last = tonumber(redis.call("GET", fencingKey))
+if last ~= nil and token < last then
+    return 0
+end
+redis.call("SET", fencingKey, token, "PX", fencingExpiration)
+redis.call("SET", key, val, "PX", expiration)
+return 1
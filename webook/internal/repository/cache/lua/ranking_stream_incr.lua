@@ -0,0 +1,20 @@
+-- 实时榜单 有序集合
+local key = KEYS[1]
+-- 衰减的基准时间
+local epochKey = KEYS[2]
+local member = ARGV[1]
+local weight = tonumber(ARGV[2])
+-- 秒
+local now = tonumber(ARGV[3])
+local halfLife = tonumber(ARGV[4])
+
+local epoch = tonumber(redis.call("GET", epochKey))
+if epoch == nil then
+    epoch = now
+    redis.call("SET", epochKey, now)
+end
+
+-- 不去衰减已有的分数 而是让新的分数按时间指数增长
+-- 两者的排序结果是一样的
+local factor = math.pow(2, (now - epoch) / halfLife)
+return redis.call("ZINCRBY", key, weight * factor, member)
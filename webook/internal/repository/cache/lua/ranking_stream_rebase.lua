@@ -0,0 +1,24 @@
+local key = KEYS[1]
+local epochKey = KEYS[2]
+local now = tonumber(ARGV[1])
+local halfLife = tonumber(ARGV[2])
+-- 距离基准时间超过多少个半衰期就重新计算基准
+local maxHalfLives = tonumber(ARGV[3])
+-- 有序集合最多保留多少个元素
+local maxSize = tonumber(ARGV[4])
+
+-- 取消点赞之后分数可能不是正数了
+redis.call("ZREMRANGEBYSCORE", key, "-inf", 0)
+redis.call("ZREMRANGEBYRANK", key, 0, -(maxSize + 1))
+
+local epoch = tonumber(redis.call("GET", epochKey))
+if epoch == nil or now - epoch < maxHalfLives * halfLife then
+    return 0
+end
+
+-- 把所有分数整体缩小 避免数值溢出
+if redis.call("EXISTS", key) == 1 then
+    redis.call("ZUNIONSTORE", key, 1, key, "WEIGHTS", math.pow(2, -(now - epoch) / halfLife))
+end
+redis.call("SET", epochKey, now)
+return 1
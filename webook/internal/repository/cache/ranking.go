@@ -2,31 +2,46 @@ package cache
 
 import (
 	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
 
+//go:embed lua/ranking_set.lua
+var luaRankingSet string
+
+// ErrStaleFencingToken 计算榜单期间锁被别人抢走了 并且新的持有者已经写过榜单
+var ErrStaleFencingToken = errors.New("fencing token 已经过期")
+
 type RankingCache interface {
 	Set(ctx context.Context, arts []domain.Article) error
 	Get(ctx context.Context) ([]domain.Article, error)
 }
 
 type RedisRankingCache struct {
-	client     redis.Cmdable
-	key        string
+	client redis.Cmdable
+	key    string
+	// 最近一次写入榜单的 fencing token 后面拼上锁的存储
+	fencingKey string
 	expiration time.Duration
+	// 比锁的持有者可能的最长执行时间长很多就可以
+	fencingExpiration time.Duration
 }
 
 func NewRedisRankingCache(client redis.Cmdable) RankingCache {
 	return &RedisRankingCache{
-		client: client,
-		key:    "ranking:top_n",
+		client:     client,
+		key:        "ranking:top_n",
+		fencingKey: "ranking:top_n:fencing",
 		// 所有对榜单的访问都是走缓存的
 		// 也可以考虑将过期时间设置很大
 		// 或者不设置过期时间
-		expiration: time.Minute * 3,
+		expiration:        time.Minute * 3,
+		fencingExpiration: time.Hour * 24,
 	}
 }
 
@@ -38,7 +53,25 @@ func (r *RedisRankingCache) Set(ctx context.Context, arts []domain.Article) erro
 	if err != nil {
 		return err
 	}
-	return r.client.Set(ctx, r.key, val, r.expiration).Err()
+	// 持有分布式锁时 拒绝比上一次写入更旧的 token
+	// 切换锁的存储之后 token 从头开始算
+	fence, ok := dlock.FenceFromContext(ctx)
+	if !ok {
+		return r.client.Set(ctx, r.key, val, r.expiration).Err()
+	}
+	res, err := r.client.Eval(
+		ctx,
+		luaRankingSet,
+		[]string{r.key, r.fencingKey + ":" + fence.Source},
+		val, r.expiration.Milliseconds(), fence.Token, r.fencingExpiration.Milliseconds(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrStaleFencingToken
+	}
+	return nil
 }
 
 func (r *RedisRankingCache) Get(ctx context.Context) ([]domain.Article, error) {
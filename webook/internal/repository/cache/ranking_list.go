@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// RankingListCache 命名榜单 每个榜单一个 key
+type RankingListCache interface {
+	Set(ctx context.Context, list string, arts []domain.Article, expiration time.Duration) error
+	Get(ctx context.Context, list string) ([]domain.Article, error)
+}
+
+type RedisRankingListCache struct {
+	client redis.Cmdable
+}
+
+func NewRedisRankingListCache(client redis.Cmdable) RankingListCache {
+	return &RedisRankingListCache{client: client}
+}
+
+func (r *RedisRankingListCache) Set(
+	ctx context.Context,
+	list string,
+	arts []domain.Article,
+	expiration time.Duration,
+) error {
+	for i := range arts {
+		arts[i].Content = arts[i].Abstract()
+	}
+	val, err := json.Marshal(arts)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key(list), val, expiration).Err()
+}
+
+func (r *RedisRankingListCache) Get(ctx context.Context, list string) ([]domain.Article, error) {
+	val, err := r.client.Get(ctx, r.key(list)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var res []domain.Article
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func (r *RedisRankingListCache) key(list string) string {
+	return fmt.Sprintf("ranking:list:%s", list)
+}
+
+// LocalRankingListCache 每个榜单一个 LocalRankingCache
+// 按作者分组的榜单数量没有上限 超过 maxEntries 时淘汰最久没有用过的榜单
+type LocalRankingListCache struct {
+	mutex sync.Mutex
+	lists map[string]*list.Element
+	// 最近用过的在前面 元素是 *localRankingListEntry
+	order      *list.List
+	maxEntries int
+}
+
+type localRankingListEntry struct {
+	name  string
+	cache *LocalRankingCache
+}
+
+func NewLocalRankingListCache(maxEntries int) *LocalRankingListCache {
+	return &LocalRankingListCache{
+		lists:      make(map[string]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+func (l *LocalRankingListCache) Set(
+	ctx context.Context,
+	name string,
+	arts []domain.Article,
+	expiration time.Duration,
+) error {
+	l.mutex.Lock()
+	c, ok := l.touch(name)
+	if !ok {
+		if l.order.Len() >= l.maxEntries {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.lists, oldest.Value.(*localRankingListEntry).name)
+		}
+		c = NewLocalRankingCache(expiration)
+		l.lists[name] = l.order.PushFront(&localRankingListEntry{name: name, cache: c})
+	}
+	l.mutex.Unlock()
+	return c.Set(ctx, arts)
+}
+
+func (l *LocalRankingListCache) Get(ctx context.Context, name string) ([]domain.Article, error) {
+	c, err := l.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx)
+}
+
+// ForceGet 不检查过期时间
+func (l *LocalRankingListCache) ForceGet(ctx context.Context, name string) ([]domain.Article, error) {
+	c, err := l.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.ForceGet(ctx)
+}
+
+func (l *LocalRankingListCache) get(name string) (*LocalRankingCache, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	c, ok := l.touch(name)
+	if !ok {
+		return nil, errors.New("本地缓存失效")
+	}
+	return c, nil
+}
+
+// touch 标记为最近用过 调用方需要持有锁
+func (l *LocalRankingListCache) touch(name string) (*LocalRankingCache, bool) {
+	elem, ok := l.lists[name]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*localRankingListEntry).cache, true
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLocalRankingListCache_Evict(t *testing.T) {
+	c := NewLocalRankingListCache(2)
+	ctx := context.Background()
+	arts := func(id int64) []domain.Article {
+		return []domain.Article{{Id: id}}
+	}
+	require.NoError(t, c.Set(ctx, "a", arts(1), time.Minute))
+	require.NoError(t, c.Set(ctx, "b", arts(2), time.Minute))
+	// 用过 a 之后 b 是最久没有用过的
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	// 满了之后新的榜单照样缓存
+	require.NoError(t, c.Set(ctx, "c", arts(3), time.Minute))
+
+	_, err = c.Get(ctx, "b")
+	assert.Error(t, err)
+	res, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, arts(1), res)
+	res, err = c.ForceGet(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, arts(3), res)
+
+	// 更新已有的榜单不会淘汰其他榜单
+	require.NoError(t, c.Set(ctx, "a", arts(4), time.Minute))
+	res, err = c.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, arts(3), res)
+	res, err = c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, arts(4), res)
+}
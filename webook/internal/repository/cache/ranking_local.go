@@ -18,6 +18,14 @@ type LocalRankingCache struct {
 	expiration time.Duration
 }
 
+func NewLocalRankingCache(expiration time.Duration) *LocalRankingCache {
+	return &LocalRankingCache{
+		topN:       atomicx.NewValue[[]domain.Article](),
+		ddl:        atomicx.NewValueOf[time.Time](time.Now()),
+		expiration: expiration,
+	}
+}
+
 func (l *LocalRankingCache) Set(ctx context.Context, arts []domain.Article) error {
 	l.topN.Store(arts)
 	// 过期时间
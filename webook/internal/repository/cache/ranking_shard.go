@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RankingShardCache 分片计算热榜的中间结果
+// round 是一轮计算的开始时间 同一轮的所有节点相同
+type RankingShardCache interface {
+	SetPartial(ctx context.Context, round int64, shard int, arts []domain.ScoredArticle) error
+	// GetPartials 没有中间结果的分片不在返回值中
+	GetPartials(ctx context.Context, round int64, shards int) (map[int][]domain.ScoredArticle, error)
+	IsMerged(ctx context.Context, round int64) (bool, error)
+	MarkMerged(ctx context.Context, round int64) error
+}
+
+type RedisRankingShardCache struct {
+	client redis.Cmdable
+	// 中间结果只在一轮计算中有用
+	expiration time.Duration
+}
+
+func NewRedisRankingShardCache(client redis.Cmdable, expiration time.Duration) RankingShardCache {
+	return &RedisRankingShardCache{
+		client:     client,
+		expiration: expiration,
+	}
+}
+
+func (r *RedisRankingShardCache) SetPartial(
+	ctx context.Context,
+	round int64,
+	shard int,
+	arts []domain.ScoredArticle,
+) error {
+	for i := range arts {
+		arts[i].Article.Content = arts[i].Article.Abstract()
+	}
+	val, err := json.Marshal(arts)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.partialKey(round, shard), val, r.expiration).Err()
+}
+
+func (r *RedisRankingShardCache) GetPartials(
+	ctx context.Context,
+	round int64,
+	shards int,
+) (map[int][]domain.ScoredArticle, error) {
+	keys := make([]string, 0, shards)
+	for i := 0; i < shards; i++ {
+		keys = append(keys, r.partialKey(round, i))
+	}
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int][]domain.ScoredArticle, shards)
+	for i, val := range vals {
+		str, ok := val.(string)
+		if !ok {
+			// 还没有算完
+			continue
+		}
+		var arts []domain.ScoredArticle
+		err = json.Unmarshal([]byte(str), &arts)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = arts
+	}
+	return res, nil
+}
+
+func (r *RedisRankingShardCache) IsMerged(ctx context.Context, round int64) (bool, error) {
+	cnt, err := r.client.Exists(ctx, r.mergedKey(round)).Result()
+	return cnt > 0, err
+}
+
+func (r *RedisRankingShardCache) MarkMerged(ctx context.Context, round int64) error {
+	return r.client.Set(ctx, r.mergedKey(round), 1, r.expiration).Err()
+}
+
+func (r *RedisRankingShardCache) partialKey(round int64, shard int) string {
+	return fmt.Sprintf("ranking:shard:%d:partial:%d", round, shard)
+}
+
+func (r *RedisRankingShardCache) mergedKey(round int64) string {
+	return fmt.Sprintf("ranking:shard:%d:merged", round)
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/ranking_stream_incr.lua
+	luaStreamRankingIncr string
+	//go:embed lua/ranking_stream_rebase.lua
+	luaStreamRankingRebase string
+)
+
+// StreamRankingCache 实时榜单
+// 分数按照时间衰减 半衰期内分数减半
+type StreamRankingCache interface {
+	// IncrScore 在 t 时刻给文章加上 weight 分
+	IncrScore(ctx context.Context, aid int64, weight float64, t time.Time) error
+	// Rebase 裁剪榜单 必要时重新计算衰减的基准时间
+	Rebase(ctx context.Context, now time.Time) error
+	// TopN 按分数从高到低取前 n 篇文章 只有文章id和分数
+	TopN(ctx context.Context, n int) ([]domain.ScoredArticle, error)
+	// Reset 用全量计算的分数替换整个榜单
+	// 分数是以 epoch 为基准时间的分数
+	Reset(ctx context.Context, scores map[int64]float64, epoch time.Time) error
+}
+
+type RedisStreamRankingCache struct {
+	client   redis.Cmdable
+	key      string
+	epochKey string
+
+	halfLife time.Duration
+	// 超过多少个半衰期重新计算基准时间
+	// 2^32 左右 float64 的精度还是够用的
+	maxHalfLives int
+	maxSize      int
+}
+
+func NewRedisStreamRankingCache(
+	client redis.Cmdable,
+	halfLife time.Duration,
+	maxSize int,
+) StreamRankingCache {
+	return &RedisStreamRankingCache{
+		client:       client,
+		key:          "ranking:stream",
+		epochKey:     "ranking:stream:epoch",
+		halfLife:     halfLife,
+		maxHalfLives: 32,
+		maxSize:      maxSize,
+	}
+}
+
+func (r *RedisStreamRankingCache) IncrScore(ctx context.Context, aid int64, weight float64, t time.Time) error {
+	return r.client.Eval(
+		ctx,
+		luaStreamRankingIncr,
+		[]string{r.key, r.epochKey},
+		aid, weight, t.Unix(), int64(r.halfLife.Seconds()),
+	).Err()
+}
+
+func (r *RedisStreamRankingCache) Rebase(ctx context.Context, now time.Time) error {
+	return r.client.Eval(
+		ctx,
+		luaStreamRankingRebase,
+		[]string{r.key, r.epochKey},
+		now.Unix(), int64(r.halfLife.Seconds()), r.maxHalfLives, r.maxSize,
+	).Err()
+}
+
+func (r *RedisStreamRankingCache) TopN(ctx context.Context, n int) ([]domain.ScoredArticle, error) {
+	vals, err := r.client.ZRevRangeWithScores(ctx, r.key, 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.ScoredArticle, 0, len(vals))
+	for _, val := range vals {
+		member, _ := val.Member.(string)
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, domain.ScoredArticle{
+			Score:   val.Score,
+			Article: domain.Article{Id: id},
+		})
+	}
+	return res, nil
+}
+
+func (r *RedisStreamRankingCache) Reset(ctx context.Context, scores map[int64]float64, epoch time.Time) error {
+	// 先写到临时的 key 再替换 避免读到一半的榜单
+	// 多个实例同时重建时也不会互相干扰
+	tmpKey := fmt.Sprintf("%s:rebuild:%d", r.key, time.Now().UnixNano())
+	members := make([]redis.Z, 0, len(scores))
+	for aid, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		members = append(members, redis.Z{Score: score, Member: aid})
+	}
+
+	pipe := r.client.TxPipeline()
+	if len(members) > 0 {
+		pipe.ZAdd(ctx, tmpKey, members...)
+		pipe.Rename(ctx, tmpKey, r.key)
+	} else {
+		pipe.Del(ctx, r.key)
+	}
+	pipe.Set(ctx, r.epochKey, epoch.Unix(), 0)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Rebase(ctx, epoch)
+}
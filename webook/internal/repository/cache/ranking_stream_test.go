@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func initStreamRankingCache(t *testing.T, halfLife time.Duration, maxSize int) (*miniredis.Miniredis, StreamRankingCache) {
+	mr := miniredis.RunT(t)
+	return mr, NewRedisStreamRankingCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), halfLife, maxSize)
+}
+
+// topScores 文章id对应的分数 按分数从高到低
+func topScores(t *testing.T, c StreamRankingCache, n int) ([]int64, []float64) {
+	res, err := c.TopN(context.Background(), n)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(res))
+	scores := make([]float64, 0, len(res))
+	for _, art := range res {
+		ids = append(ids, art.Article.Id)
+		scores = append(scores, art.Score)
+	}
+	return ids, scores
+}
+
+func TestRedisStreamRankingCache_IncrScore(t *testing.T) {
+	mr, c := initStreamRankingCache(t, time.Hour, 100)
+	ctx := context.Background()
+	epoch := time.Unix(1700000000, 0)
+
+	require.NoError(t, c.IncrScore(ctx, 1, 3, epoch))
+	// 第一次写入的时间就是衰减的基准时间
+	val, err := mr.Get("ranking:stream:epoch")
+	require.NoError(t, err)
+	assert.Equal(t, "1700000000", val)
+	require.NoError(t, c.IncrScore(ctx, 2, 1, epoch.Add(time.Hour)))
+	require.NoError(t, c.IncrScore(ctx, 3, 1, epoch.Add(2*time.Hour)))
+	// 同一篇文章的分数累加
+	require.NoError(t, c.IncrScore(ctx, 2, 1, epoch.Add(2*time.Hour)))
+
+	// 每过一个半衰期 同样的互动分数翻倍 相当于之前的分数减半
+	ids, scores := topScores(t, c, 10)
+	assert.Equal(t, []int64{2, 3, 1}, ids)
+	assert.InDeltaSlice(t, []float64{6, 4, 3}, scores, 1e-9)
+
+	ids, _ = topScores(t, c, 2)
+	assert.Equal(t, []int64{2, 3}, ids)
+}
+
+func TestRedisStreamRankingCache_RebaseTrim(t *testing.T) {
+	_, c := initStreamRankingCache(t, time.Hour, 2)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	for aid := int64(1); aid <= 4; aid++ {
+		require.NoError(t, c.IncrScore(ctx, aid, float64(aid), now))
+	}
+	// 取消点赞之后分数不是正数了
+	require.NoError(t, c.IncrScore(ctx, 5, 1, now))
+	require.NoError(t, c.IncrScore(ctx, 5, -1, now))
+
+	require.NoError(t, c.Rebase(ctx, now))
+	// 只保留分数最高的 maxSize 个 没有到重新计算基准的时候 分数不变
+	ids, scores := topScores(t, c, 10)
+	assert.Equal(t, []int64{4, 3}, ids)
+	assert.InDeltaSlice(t, []float64{4, 3}, scores, 1e-9)
+}
+
+func TestRedisStreamRankingCache_Rebase(t *testing.T) {
+	mr, c := initStreamRankingCache(t, time.Second, 100)
+	ctx := context.Background()
+	epoch := time.Unix(1700000000, 0)
+	require.NoError(t, c.IncrScore(ctx, 1, 1, epoch))
+	require.NoError(t, c.IncrScore(ctx, 2, 1, epoch.Add(10*time.Second)))
+
+	// 还没有超过 32 个半衰期
+	require.NoError(t, c.Rebase(ctx, epoch.Add(31*time.Second)))
+	_, scores := topScores(t, c, 10)
+	assert.InDeltaSlice(t, []float64{1024, 1}, scores, 1e-9)
+
+	// 整体缩小到以 now 为基准 排序不变
+	now := epoch.Add(40 * time.Second)
+	require.NoError(t, c.Rebase(ctx, now))
+	val, err := mr.Get("ranking:stream:epoch")
+	require.NoError(t, err)
+	assert.Equal(t, "1700000040", val)
+	ids, scores := topScores(t, c, 10)
+	assert.Equal(t, []int64{2, 1}, ids)
+	assert.InDelta(t, 1.0/(1<<30), scores[0], 1e-15)
+	assert.InDelta(t, 1.0/(1<<40), scores[1], 1e-18)
+
+	// 新的互动按新的基准计算
+	require.NoError(t, c.IncrScore(ctx, 3, 1, now))
+	ids, scores = topScores(t, c, 1)
+	assert.Equal(t, []int64{3}, ids)
+	assert.InDelta(t, 1.0, scores[0], 1e-9)
+}
+
+func TestRedisStreamRankingCache_Reset(t *testing.T) {
+	_, c := initStreamRankingCache(t, time.Hour, 100)
+	ctx := context.Background()
+	epoch := time.Unix(1700000000, 0)
+	require.NoError(t, c.IncrScore(ctx, 1, 10, epoch))
+
+	// 全量重建的分数替换原来的榜单 不是正数的不参与排名
+	require.NoError(t, c.Reset(ctx, map[int64]float64{2: 2, 3: 1, 4: 0}, epoch))
+	ids, scores := topScores(t, c, 10)
+	assert.Equal(t, []int64{2, 3}, ids)
+	assert.InDeltaSlice(t, []float64{2, 1}, scores, 1e-9)
+	require.NoError(t, c.IncrScore(ctx, 3, 2, epoch.Add(time.Hour)))
+	ids, _ = topScores(t, c, 1)
+	assert.Equal(t, []int64{3}, ids)
+
+	require.NoError(t, c.Reset(ctx, map[int64]float64{}, epoch))
+	ids, _ = topScores(t, c, 10)
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/pkg/dlock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRedisRankingCache_SetFencing(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewRedisRankingCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	arts := []domain.Article{{Id: 1, Title: "标题"}}
+	set := func(source string, token int64) error {
+		return c.Set(dlock.WithToken(context.Background(), source, token), arts)
+	}
+
+	require.NoError(t, set("redis", 100))
+	assert.ErrorIs(t, set("redis", 99), ErrStaleFencingToken)
+	// 切换到 mysql 之后 token 从1开始 不能和 redis 的比较
+	require.NoError(t, set("mysql", 1))
+	assert.ErrorIs(t, set("mysql", 0), ErrStaleFencingToken)
+	require.NoError(t, set("redis", 101))
+	// 没有持有锁的写入不检查
+	require.NoError(t, c.Set(context.Background(), arts))
+
+	// 记录的 token 会过期
+	assert.Positive(t, mr.TTL("ranking:top_n:fencing:redis"))
+	assert.Positive(t, mr.TTL("ranking:top_n:fencing:mysql"))
+}
@@ -21,6 +21,8 @@ type ArticleDAO interface {
 	GetById(ctx context.Context, id int64) (Article, error)
 	GetPubById(ctx context.Context, id int64) (PublishedArticle, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error)
+	// ListPubByShard 按照 id 取模分片 只查询其中一个分片
+	ListPubByShard(ctx context.Context, start time.Time, shard int, shards int, offset int, limit int) ([]PublishedArticle, error)
 }
 
 // GORMArticleDAO
@@ -55,6 +57,32 @@ func (a *GORMArticleDAO) ListPub(ctx context.Context, start time.Time, offset in
 	return res, err
 }
 
+// ListPubByShard
+// 分片计算热榜时 每个节点只查询自己分片的文章
+func (a *GORMArticleDAO) ListPubByShard(
+	ctx context.Context,
+	start time.Time,
+	shard int,
+	shards int,
+	offset int,
+	limit int,
+) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	const ArticleStatusPublished = 2
+	err := a.db.WithContext(ctx).
+		Where(
+			"update_time<? AND status = ? AND id % ? = ?",
+			start.UnixMilli(),
+			ArticleStatusPublished,
+			shards,
+			shard,
+		).
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
 // GetByAuthor 查询文章列表
 func (a *GORMArticleDAO) GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]Article, error) {
 	var arts []Article
@@ -85,6 +113,9 @@ func (a *GORMArticleDAO) UpdateById(ctx context.Context, art Article) error {
 			"title":       art.Title,
 			"content":     art.Content,
 			"status":      art.Status,
+			"read_metric": art.ReadMetric,
+			"category":    art.Category,
+			"tags":        art.Tags,
 			"update_time": now,
 		})
 	if res.Error != nil {
@@ -134,6 +165,9 @@ func (a *GORMArticleDAO) Sync(ctx context.Context, art Article) (int64, error) {
 						"title":       pa.Title,
 						"content":     pa.Content,
 						"status":      pa.Status,
+						"read_metric": pa.ReadMetric,
+						"category":    pa.Category,
+						"tags":        pa.Tags,
 						"update_time": now,
 					},
 				),
@@ -225,6 +259,9 @@ func (a *GORMArticleDAO) SyncV1(ctx context.Context, art Article) (int64, error)
 					"title":       pa.Title,
 					"content":     pa.Content,
 					"status":      pa.Status,
+					"read_metric": pa.ReadMetric,
+					"category":    pa.Category,
+					"tags":        pa.Tags,
 					"update_time": now,
 				},
 			),
@@ -245,6 +282,10 @@ type Article struct {
 	Content    string `gorm:"type=BLOB" bson:"content,omitempty"`
 	AuthorId   int64  `gorm:"index" bson:"author_id,omitempty"`
 	Status     uint8  `bson:"status,omitempty"`
+	ReadMetric string `gorm:"type:varchar(16)" bson:"read_metric,omitempty"`
+	Category   string `gorm:"type:varchar(64);index" bson:"category,omitempty"`
+	// 多个标签用逗号分隔
+	Tags       string `gorm:"type:varchar(512)" bson:"tags,omitempty"`
 	CreateTime int64  `bson:"create_time,omitempty"`
 	UpdateTime int64  `bson:"update_time,omitempty"`
 }
@@ -279,6 +320,10 @@ func (a *ArticleMongoDBDAO) ListPub(ctx context.Context, start time.Time, offset
 	panic("implement me")
 }
 
+func (a *ArticleMongoDBDAO) ListPubByShard(ctx context.Context, start time.Time, shard int, shards int, offset int, limit int) ([]PublishedArticle, error) {
+	panic("implement me")
+}
+
 // Insert 插入到作者集合
 func (a *ArticleMongoDBDAO) Insert(ctx context.Context, art Article) (int64, error) {
 	now := time.Now().UnixMilli()
@@ -303,6 +348,9 @@ func (a *ArticleMongoDBDAO) UpdateById(ctx context.Context, art Article) error {
 				"title":       art.Title,
 				"content":     art.Content,
 				"status":      art.Status,
+				"read_metric": art.ReadMetric,
+				"category":    art.Category,
+				"tags":        art.Tags,
 				"update_time": now,
 			},
 		},
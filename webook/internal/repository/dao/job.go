@@ -2,37 +2,76 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 	"time"
 )
 
+var (
+	ErrJobNotFound      = gorm.ErrRecordNotFound
+	ErrDuplicateJobName = errors.New("任务名字重复")
+	ErrJobLeaseLost     = errors.New("任务已经被其他节点抢占")
+)
+
+// jobLeaseTimeout 执行中的任务超过这么久没有续约 认为节点已经崩溃 其他节点可以抢占
+// 相当于连续两次续约失败
+const jobLeaseTimeout = 2 * time.Minute
+
 type JobDAO interface {
-	Preempt(ctx context.Context) (Job, error)
+	// Preempt 优先级高的先抢 优先级相同的先到执行时间的先抢
+	// excludeExecutors 是本节点已经满了的执行器 这些任务留给其他节点
+	// 广播和分片任务抢到之后只分发子任务 不受影响
+	Preempt(ctx context.Context, excludeExecutors []string) (Job, error)
+	// CountDue 到了执行时间还在等待的任务 按照优先级计数
+	CountDue(ctx context.Context) (map[int]int64, error)
 	Release(ctx context.Context, jid int64, version int) error
-	UpdateTime(ctx context.Context, jid int64) error
+	// UpdateTime 续约 版本号变了说明任务已经被别人抢走或者删除了 返回 ErrJobLeaseLost
+	UpdateTime(ctx context.Context, jid int64, version int) error
 	UpdateNextTime(ctx context.Context, jid int64, t time.Time) error
+	// Complete 记录执行结果 attempt 是连续失败的次数
+	// nextTime 为0时不修改下次执行时间
+	// 手动触发的时间还是 triggerTime 时清除 执行期间再次触发的不清除
+	Complete(ctx context.Context, jid int64, version int, run JobRun, attempt int, nextTime int64, triggerTime int64) error
+
+	Insert(ctx context.Context, job Job) (int64, error)
+	// Update 修改任务的定义 不修改状态
+	Update(ctx context.Context, job Job) error
+	Delete(ctx context.Context, jid int64) error
+	FindById(ctx context.Context, jid int64) (Job, error)
+	FindByNames(ctx context.Context, names []string) ([]Job, error)
+	List(ctx context.Context, offset, limit int) ([]Job, error)
+	// Pause 正在执行的任务变成 jobStatusPausing 执行完释放的时候再变成暂停
+	Pause(ctx context.Context, jid int64) error
+	// Resume 只恢复暂停的任务
+	// 执行期间被暂停的任务回到执行中 续约和版本号都不变 原来的节点接着执行
+	Resume(ctx context.Context, jid int64, nextTime int64) error
+	// Trigger 手动触发 暂停的任务不会触发
+	Trigger(ctx context.Context, jid int64, t int64) error
 }
 
 type GORMJobDAO struct {
 	db *gorm.DB
 }
 
-func NewGORMJobDAO(db *gorm.DB) *GORMJobDAO {
+func NewGORMJobDAO(db *gorm.DB) JobDAO {
 	return &GORMJobDAO{db: db}
 }
 
-func (j *GORMJobDAO) Preempt(ctx context.Context) (Job, error) {
+func (j *GORMJobDAO) Preempt(ctx context.Context, excludeExecutors []string) (Job, error) {
 	db := j.db.WithContext(ctx)
 	// 乐观锁
 	for {
 		var job Job
 		now := time.Now().UnixMilli()
-		// 拿一个等待执行并且可以执行的任务
-		// 或者 一个正在执行但续约失败的任务(status = 1 AND update_time < now - 2 * 续约间隔)
-		// 认为连续两次续约失败
-		err := db.Where("(status = ? AND next_time < ?) OR (status = ? AND update_time < ?)",
-			jobStatusWaiting, now, now-(time.Minute*2).Milliseconds()).
-			First(&job).Error
+		// 拿一个等待执行并且可以执行的任务 到了执行时间或者被手动触发了
+		// 或者 一个正在执行但续约失败的任务(status = 1 AND update_time < now - 续约超时)
+		query := db.Where("(status = ? AND (next_time < ? OR (trigger_time > 0 AND trigger_time <= ?))) OR (status = ? AND update_time < ?)",
+			jobStatusWaiting, now, now, jobStatusRunning, now-jobLeaseTimeout.Milliseconds())
+		if len(excludeExecutors) > 0 {
+			query = query.Where("(mode <> ? OR executor NOT IN ?)", jobModeSingle, excludeExecutors)
+		}
+		err := query.Order("priority DESC, next_time ASC").First(&job).Error
 		if err != nil {
 			return job, err
 		}
@@ -54,29 +93,64 @@ func (j *GORMJobDAO) Preempt(ctx context.Context) (Job, error) {
 			// 没抢到
 			continue
 		}
+		// 释放的时候要用更新后的版本号
+		job.Version = job.Version + 1
+		job.Status = jobStatusRunning
 		return job, err
 	}
 }
 
+func (j *GORMJobDAO) CountDue(ctx context.Context) (map[int]int64, error) {
+	now := time.Now().UnixMilli()
+	var rows []struct {
+		Priority int
+		Cnt      int64
+	}
+	err := j.db.WithContext(ctx).
+		Model(&Job{}).
+		Select("priority, COUNT(*) AS cnt").
+		Where("status = ? AND (next_time < ? OR (trigger_time > 0 AND trigger_time <= ?))",
+			jobStatusWaiting, now, now).
+		Group("priority").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		res[row.Priority] = row.Cnt
+	}
+	return res, nil
+}
+
 func (j *GORMJobDAO) Release(ctx context.Context, jid int64, version int) error {
 	now := time.Now().UnixMilli()
+	// 执行期间被暂停的任务变成暂停
 	return j.db.WithContext(ctx).
 		Model(&Job{}).
-		Where("id = ? AND version = ?", jid, version).
+		Where("id = ? AND version = ? AND status IN ?", jid, version, []int{jobStatusRunning, jobStatusPausing}).
 		Updates(map[string]any{
-			"status":      jobStatusWaiting,
+			"status": gorm.Expr("CASE WHEN status = ? THEN ? ELSE ? END",
+				jobStatusPausing, jobStatusPaused, jobStatusWaiting),
 			"update_time": now,
 		}).Error
 }
 
-func (j *GORMJobDAO) UpdateTime(ctx context.Context, jid int64) error {
+func (j *GORMJobDAO) UpdateTime(ctx context.Context, jid int64, version int) error {
 	now := time.Now().UnixMilli()
-	return j.db.WithContext(ctx).
+	res := j.db.WithContext(ctx).
 		Model(&Job{}).
-		Where("id = ?", jid).
+		Where("id = ? AND version = ?", jid, version).
 		Updates(map[string]any{
 			"update_time": now,
-		}).Error
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
 }
 
 func (j *GORMJobDAO) UpdateNextTime(ctx context.Context, jid int64, t time.Time) error {
@@ -90,20 +164,224 @@ func (j *GORMJobDAO) UpdateNextTime(ctx context.Context, jid int64, t time.Time)
 		}).Error
 }
 
+func (j *GORMJobDAO) Complete(
+	ctx context.Context,
+	jid int64,
+	version int,
+	run JobRun,
+	attempt int,
+	nextTime int64,
+	triggerTime int64,
+) error {
+	now := time.Now().UnixMilli()
+	updates := map[string]any{
+		"attempt":         attempt,
+		"last_start_time": run.StartTime,
+		"last_end_time":   run.EndTime,
+		"last_status":     run.Status,
+		"last_error":      run.Error,
+		"update_time":     now,
+	}
+	if nextTime > 0 {
+		updates["next_time"] = nextTime
+	}
+	if triggerTime > 0 {
+		updates["trigger_time"] = gorm.Expr("CASE WHEN trigger_time = ? THEN 0 ELSE trigger_time END", triggerTime)
+	}
+	return j.db.WithContext(ctx).
+		Model(&Job{}).
+		Where("id = ? AND version = ?", jid, version).
+		Updates(updates).Error
+}
+
+func (j *GORMJobDAO) Insert(ctx context.Context, job Job) (int64, error) {
+	now := time.Now().UnixMilli()
+	job.CreateTime = now
+	job.UpdateTime = now
+	job.Status = jobStatusWaiting
+	err := j.db.WithContext(ctx).Create(&job).Error
+	if isDuplicateErr(err) {
+		return 0, ErrDuplicateJobName
+	}
+	return job.Id, err
+}
+
+func (j *GORMJobDAO) Update(ctx context.Context, job Job) error {
+	now := time.Now().UnixMilli()
+	res := j.db.WithContext(ctx).
+		Model(&Job{}).
+		Where("id = ?", job.Id).
+		Updates(map[string]any{
+			"name":         job.Name,
+			"executor":     job.Executor,
+			"expression":   job.Expression,
+			"config":       job.Config,
+			"mode":         job.Mode,
+			"shards":       job.Shards,
+			"timezone":     job.Timezone,
+			"misfire":      job.Misfire,
+			"max_duration": job.MaxDuration,
+			"priority":     job.Priority,
+			"next_time":    job.NextTime,
+			"update_time":  now,
+		})
+	if isDuplicateErr(res.Error) {
+		return ErrDuplicateJobName
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func (j *GORMJobDAO) Delete(ctx context.Context, jid int64) error {
+	res := j.db.WithContext(ctx).Where("id = ?", jid).Delete(&Job{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func (j *GORMJobDAO) FindById(ctx context.Context, jid int64) (Job, error) {
+	var res Job
+	err := j.db.WithContext(ctx).Where("id = ?", jid).First(&res).Error
+	return res, err
+}
+
+func (j *GORMJobDAO) FindByNames(ctx context.Context, names []string) ([]Job, error) {
+	var res []Job
+	if len(names) == 0 {
+		return res, nil
+	}
+	err := j.db.WithContext(ctx).Where("name IN ?", names).Find(&res).Error
+	return res, err
+}
+
+func (j *GORMJobDAO) List(ctx context.Context, offset, limit int) ([]Job, error) {
+	var res []Job
+	err := j.db.WithContext(ctx).
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (j *GORMJobDAO) Pause(ctx context.Context, jid int64) error {
+	db := j.db.WithContext(ctx)
+	for {
+		// 正在执行的任务会执行完 释放的时候变成暂停
+		// 不修改更新时间 节点崩溃的时候租约照常过期
+		res := db.Model(&Job{}).
+			Where("id = ? AND status = ?", jid, jobStatusRunning).
+			Update("status", jobStatusPausing)
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		res = db.Model(&Job{}).
+			Where("id = ? AND status = ?", jid, jobStatusWaiting).
+			Updates(map[string]any{
+				"status":      jobStatusPaused,
+				"update_time": time.Now().UnixMilli(),
+			})
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		job, err := j.FindById(ctx, jid)
+		if err != nil {
+			return err
+		}
+		if job.Status == jobStatusPaused || job.Status == jobStatusPausing {
+			return nil
+		}
+		// 两次更新之间被抢占或者释放了 重试
+	}
+}
+
+func (j *GORMJobDAO) Resume(ctx context.Context, jid int64, nextTime int64) error {
+	db := j.db.WithContext(ctx)
+	// 原来的节点还在执行 直接回到执行中
+	// 如果节点已经崩溃了 租约过期之后其他节点可以抢占
+	res := db.Model(&Job{}).
+		Where("id = ? AND status = ?", jid, jobStatusPausing).
+		Update("status", jobStatusRunning)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return db.Model(&Job{}).
+		Where("id = ? AND status = ?", jid, jobStatusPaused).
+		Updates(map[string]any{
+			"status":       jobStatusWaiting,
+			"next_time":    nextTime,
+			"trigger_time": 0,
+			"update_time":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (j *GORMJobDAO) Trigger(ctx context.Context, jid int64, t int64) error {
+	now := time.Now().UnixMilli()
+	return j.db.WithContext(ctx).
+		Model(&Job{}).
+		Where("id = ? AND status NOT IN ?", jid, []int{jobStatusPaused, jobStatusPausing}).
+		Updates(map[string]any{
+			"trigger_time": t,
+			"update_time":  now,
+		}).Error
+}
+
+// Job redis 标签是 RedisJobDAO 中 hash 的字段名 和列名保持一致
 type Job struct {
-	Id         int64  `gorm:"primaryKey,autoIncrement"`
-	Name       string `gorm:"type:varchar(128);unique"`
-	Executor   string
-	Expression string
-	Config     string
-	Status     int
-	Version    int
-	NextTime   int64 `gorm:"index"`
+	Id         int64  `gorm:"primaryKey,autoIncrement" redis:"id"`
+	Name       string `gorm:"type:varchar(128);unique" redis:"name"`
+	Executor   string `redis:"executor"`
+	Expression string `redis:"expression"`
+	Config     string `redis:"config"`
+	Status     int    `redis:"status"`
+	Version    int    `redis:"version"`
+	NextTime   int64  `gorm:"index" redis:"next_time"`
+	// 执行方式 和 domain.JobMode 对应
+	Mode   uint8 `redis:"mode"`
+	Shards int   `redis:"shards"`
+	// 为空时使用本地时区
+	Timezone string `gorm:"type:varchar(64)" redis:"timezone"`
+	// 和 domain.JobMisfirePolicy 对应
+	Misfire uint8 `redis:"misfire"`
+	// 一次执行最长多久 毫秒 0 表示不限制
+	MaxDuration int64 `redis:"max_duration"`
+	// 越大越先执行
+	Priority int `gorm:"index" redis:"priority"`
+	// 手动触发的时间 执行完成后清零
+	TriggerTime int64 `gorm:"index" redis:"trigger_time"`
+
+	// 最近一次执行的情况
+	LastStartTime int64  `redis:"last_start_time"`
+	LastEndTime   int64  `redis:"last_end_time"`
+	LastStatus    uint8  `redis:"last_status"`
+	LastError     string `gorm:"type:varchar(1024)" redis:"last_error"`
+	// 连续失败的次数
+	Attempt int `redis:"attempt"`
+
+	UpdateTime int64 `redis:"update_time"`
+	CreateTime int64 `redis:"create_time"`
+}
 
-	UpdateTime int64
-	CreateTime int64
+// JobRun 最近一次执行的情况 时间都是毫秒
+type JobRun struct {
+	StartTime int64
+	EndTime   int64
+	Status    uint8
+	Error     string
 }
 
+// jobModeSingle 和 domain.JobModeSingle 对应
+const jobModeSingle = 0
+
 const (
 	// jobStatusWaiting 没人抢
 	jobStatusWaiting = iota
@@ -111,4 +389,15 @@ const (
 	jobStatusRunning
 	// jobStatusPaused 不再需要调度了
 	jobStatusPaused
+	// jobStatusPausing 执行期间被暂停了 释放的时候变成暂停 其他节点不能抢占
+	jobStatusPausing
 )
+
+// isDuplicateErr 名字冲突
+// 其他数据库需要打开 gorm 的 TranslateError 转换成 gorm.ErrDuplicatedKey
+func isDuplicateErr(err error) bool {
+	if me, ok := err.(*mysql.MySQLError); ok && me.Number == 1062 {
+		return true
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+type JobExecutionDAO interface {
+	Insert(ctx context.Context, e JobExecution) (int64, error)
+	// Finish 记录执行结束的时间和结果
+	Finish(ctx context.Context, id int64, endTime int64, status uint8, errMsg string) error
+	// List 按开始时间倒序 jobId 为0时查询所有任务 status 为0时查询所有状态
+	List(ctx context.Context, jobId int64, status uint8, offset, limit int) ([]JobExecution, error)
+}
+
+type GORMJobExecutionDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMJobExecutionDAO(db *gorm.DB) JobExecutionDAO {
+	return &GORMJobExecutionDAO{db: db}
+}
+
+func (g *GORMJobExecutionDAO) Insert(ctx context.Context, e JobExecution) (int64, error) {
+	err := g.db.WithContext(ctx).Create(&e).Error
+	return e.Id, err
+}
+
+func (g *GORMJobExecutionDAO) Finish(
+	ctx context.Context,
+	id int64,
+	endTime int64,
+	status uint8,
+	errMsg string,
+) error {
+	return g.db.WithContext(ctx).
+		Model(&JobExecution{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"end_time": endTime,
+			"status":   status,
+			"error":    errMsg,
+		}).Error
+}
+
+func (g *GORMJobExecutionDAO) List(
+	ctx context.Context,
+	jobId int64,
+	status uint8,
+	offset, limit int,
+) ([]JobExecution, error) {
+	db := g.db.WithContext(ctx)
+	if jobId > 0 {
+		db = db.Where("job_id = ?", jobId)
+	}
+	if status > 0 {
+		db = db.Where("status = ?", status)
+	}
+	var res []JobExecution
+	err := db.Order("start_time DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+// JobExecution 任务的执行记录 每次执行一条 重试也是单独的一条
+type JobExecution struct {
+	Id      int64  `gorm:"primaryKey,autoIncrement"`
+	JobId   int64  `gorm:"index:idx_job_start"`
+	JobName string `gorm:"type:varchar(128)"`
+	Node    string `gorm:"type:varchar(128)"`
+	Attempt int
+	// 广播和分片任务的子任务
+	TaskId int64
+	Shard  int
+	// 毫秒
+	StartTime int64 `gorm:"index:idx_job_start;index:idx_status_start"`
+	EndTime   int64
+	Status    uint8  `gorm:"index:idx_status_start"`
+	Error     string `gorm:"type:varchar(1024)"`
+}
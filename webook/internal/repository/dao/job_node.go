@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// JobNodeDAO 调度器节点的注册表
+type JobNodeDAO interface {
+	// Heartbeat 第一次心跳的时候注册
+	Heartbeat(ctx context.Context, name string) error
+	Delete(ctx context.Context, name string) error
+	// FindAlive since 之后有心跳的节点 按名字排序
+	FindAlive(ctx context.Context, since int64) ([]JobNode, error)
+}
+
+type GORMJobNodeDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMJobNodeDAO(db *gorm.DB) JobNodeDAO {
+	return &GORMJobNodeDAO{db: db}
+}
+
+func (g *GORMJobNodeDAO) Heartbeat(ctx context.Context, name string) error {
+	now := time.Now().UnixMilli()
+	return g.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			DoUpdates: clause.Assignments(
+				map[string]interface{}{
+					"heartbeat_time": now,
+				},
+			),
+		},
+	).Create(&JobNode{
+		Name:          name,
+		StartTime:     now,
+		HeartbeatTime: now,
+	}).Error
+}
+
+func (g *GORMJobNodeDAO) Delete(ctx context.Context, name string) error {
+	return g.db.WithContext(ctx).Where("name = ?", name).Delete(&JobNode{}).Error
+}
+
+func (g *GORMJobNodeDAO) FindAlive(ctx context.Context, since int64) ([]JobNode, error) {
+	var res []JobNode
+	err := g.db.WithContext(ctx).
+		Where("heartbeat_time >= ?", since).
+		Order("name ASC").
+		Find(&res).Error
+	return res, err
+}
+
+type JobNode struct {
+	Id   int64  `gorm:"primaryKey,autoIncrement"`
+	Name string `gorm:"type:varchar(128);unique"`
+	// 毫秒
+	StartTime     int64
+	HeartbeatTime int64 `gorm:"index"`
+}
@@ -0,0 +1,388 @@
+package dao
+
+import (
+	"context"
+	_ "embed"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/job_schedule.lua
+	luaJobSchedule string
+	//go:embed lua/job_preempt.lua
+	luaJobPreempt string
+	//go:embed lua/job_insert.lua
+	luaJobInsert string
+	//go:embed lua/job_update.lua
+	luaJobUpdate string
+	//go:embed lua/job_delete.lua
+	luaJobDelete string
+	//go:embed lua/job_set.lua
+	luaJobSet string
+	//go:embed lua/job_count_due.lua
+	luaJobCountDue string
+)
+
+// RedisJobDAO 任务存在 redis 中 语义和 GORMJobDAO 一致
+// 每个任务是一个 hash 可以被抢占的时间按照优先级放在不同的有序集合里
+// 抢占的时候从高优先级开始取分数最小的任务 不需要轮询数据库
+// 执行中的任务的分数是续约超时的时间 节点崩溃后租约自然过期 其他节点就能抢到
+// 抢占和删除的脚本会在 lua 里拼出任务的 key 没法都通过 KEYS 传进去
+// 所以所有的 key 都带上 {job} 这个 hash tag 在 redis cluster 里落在同一个槽
+// 代价是所有任务都在一个节点上
+type RedisJobDAO struct {
+	client redis.Cmdable
+	// 任务详情 hash 的前缀
+	prefix string
+	// 自增的 id
+	idKey string
+	// 名字到 id 的映射 保证名字唯一
+	nameKey string
+	// 所有任务的 id 用来分页
+	idsKey string
+	// 任务可以被抢占的时间 后面拼上优先级
+	schedulePrefix string
+	// 有任务的优先级
+	prioritiesKey string
+}
+
+func NewRedisJobDAO(client redis.Cmdable) JobDAO {
+	return &RedisJobDAO{
+		client:         client,
+		prefix:         "{job}:info:",
+		idKey:          "{job}:id",
+		nameKey:        "{job}:names",
+		idsKey:         "{job}:ids",
+		schedulePrefix: "{job}:schedule:",
+		prioritiesKey:  "{job}:priorities",
+	}
+}
+
+func (r *RedisJobDAO) Preempt(ctx context.Context, excludeExecutors []string) (Job, error) {
+	now := time.Now().UnixMilli()
+	args := []any{r.prefix, now, jobLeaseTimeout.Milliseconds()}
+	for _, exec := range excludeExecutors {
+		args = append(args, exec)
+	}
+	res, err := r.eval(ctx, luaJobPreempt, []string{r.schedulePrefix, r.prioritiesKey}, args...).Int64Slice()
+	if err == redis.Nil {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job, err := r.FindById(ctx, res[0])
+	if err != nil {
+		return Job{}, err
+	}
+	// 释放的时候要用抢占时的版本号
+	job.Version = int(res[1])
+	job.Status = jobStatusRunning
+	return job, nil
+}
+
+func (r *RedisJobDAO) CountDue(ctx context.Context) (map[int]int64, error) {
+	vals, err := r.eval(ctx, luaJobCountDue, []string{r.schedulePrefix, r.prioritiesKey},
+		r.prefix, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int]int64, len(vals)/2)
+	for i := 0; i+1 < len(vals); i += 2 {
+		res[int(vals[i])] = vals[i+1]
+	}
+	return res, nil
+}
+
+func (r *RedisJobDAO) Release(ctx context.Context, jid int64, version int) error {
+	now := time.Now().UnixMilli()
+	ok, err := r.set(ctx, jid, version, jobStatusRunning, false, 0,
+		"status", jobStatusWaiting,
+		"update_time", now)
+	if err != nil || ok {
+		return err
+	}
+	// 执行期间被暂停的任务变成暂停
+	_, err = r.set(ctx, jid, version, jobStatusPausing, false, 0,
+		"status", jobStatusPaused,
+		"update_time", now)
+	return err
+}
+
+func (r *RedisJobDAO) UpdateTime(ctx context.Context, jid int64, version int) error {
+	ok, err := r.set(ctx, jid, version, -1, false, 0,
+		"update_time", time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
+
+func (r *RedisJobDAO) UpdateNextTime(ctx context.Context, jid int64, t time.Time) error {
+	_, err := r.set(ctx, jid, -1, -1, false, 0,
+		"update_time", time.Now().UnixMilli(),
+		"next_time", t.UnixMilli())
+	return err
+}
+
+func (r *RedisJobDAO) Complete(
+	ctx context.Context,
+	jid int64,
+	version int,
+	run JobRun,
+	attempt int,
+	nextTime int64,
+	triggerTime int64,
+) error {
+	fields := []any{
+		"attempt", attempt,
+		"last_start_time", run.StartTime,
+		"last_end_time", run.EndTime,
+		"last_status", run.Status,
+		"last_error", run.Error,
+		"update_time", time.Now().UnixMilli(),
+	}
+	if nextTime > 0 {
+		fields = append(fields, "next_time", nextTime)
+	}
+	_, err := r.set(ctx, jid, version, -1, false, triggerTime, fields...)
+	return err
+}
+
+func (r *RedisJobDAO) Insert(ctx context.Context, job Job) (int64, error) {
+	now := time.Now().UnixMilli()
+	args := []any{r.prefix, job.Name, jobLeaseTimeout.Milliseconds()}
+	args = append(args, r.definition(job)...)
+	args = append(args,
+		"status", jobStatusWaiting,
+		"version", job.Version,
+		"trigger_time", job.TriggerTime,
+		"last_start_time", job.LastStartTime,
+		"last_end_time", job.LastEndTime,
+		"last_status", job.LastStatus,
+		"last_error", job.LastError,
+		"attempt", job.Attempt,
+		"update_time", now,
+		"create_time", now,
+	)
+	id, err := r.eval(ctx, luaJobInsert,
+		[]string{r.idKey, r.nameKey, r.idsKey, r.schedulePrefix, r.prioritiesKey}, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if id < 0 {
+		return 0, ErrDuplicateJobName
+	}
+	return id, nil
+}
+
+func (r *RedisJobDAO) Update(ctx context.Context, job Job) error {
+	args := []any{job.Id, job.Name, jobLeaseTimeout.Milliseconds()}
+	args = append(args, r.definition(job)...)
+	args = append(args, "update_time", time.Now().UnixMilli())
+	res, err := r.eval(ctx, luaJobUpdate,
+		[]string{r.key(job.Id), r.nameKey, r.schedulePrefix, r.prioritiesKey}, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return ErrJobNotFound
+	case -1:
+		return ErrDuplicateJobName
+	default:
+		return nil
+	}
+}
+
+func (r *RedisJobDAO) Delete(ctx context.Context, jid int64) error {
+	res, err := r.eval(ctx, luaJobDelete,
+		[]string{r.key(jid), r.nameKey, r.idsKey, r.schedulePrefix, r.prioritiesKey}, jid).Int()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func (r *RedisJobDAO) FindById(ctx context.Context, jid int64) (Job, error) {
+	jobs, err := r.findByIds(ctx, []int64{jid})
+	if err != nil {
+		return Job{}, err
+	}
+	if len(jobs) == 0 {
+		return Job{}, ErrJobNotFound
+	}
+	return jobs[0], nil
+}
+
+func (r *RedisJobDAO) FindByNames(ctx context.Context, names []string) ([]Job, error) {
+	if len(names) == 0 {
+		return []Job{}, nil
+	}
+	vals, err := r.client.HMGet(ctx, r.nameKey, names...).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(vals))
+	for _, val := range vals {
+		str, ok := val.(string)
+		if !ok {
+			// 不存在的名字
+			continue
+		}
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return r.findByIds(ctx, ids)
+}
+
+func (r *RedisJobDAO) List(ctx context.Context, offset, limit int) ([]Job, error) {
+	vals, err := r.client.ZRange(ctx, r.idsKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(vals))
+	for _, val := range vals {
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return r.findByIds(ctx, ids)
+}
+
+func (r *RedisJobDAO) Pause(ctx context.Context, jid int64) error {
+	for {
+		// 正在执行的任务会执行完 释放的时候变成暂停
+		// 不修改更新时间 节点崩溃的时候租约照常过期
+		ok, err := r.set(ctx, jid, -1, jobStatusRunning, false, 0,
+			"status", jobStatusPausing)
+		if err != nil || ok {
+			return err
+		}
+		ok, err = r.set(ctx, jid, -1, jobStatusWaiting, false, 0,
+			"status", jobStatusPaused,
+			"update_time", time.Now().UnixMilli())
+		if err != nil || ok {
+			return err
+		}
+		job, err := r.FindById(ctx, jid)
+		if err != nil {
+			return err
+		}
+		if job.Status == jobStatusPaused || job.Status == jobStatusPausing {
+			return nil
+		}
+		// 两次修改之间被抢占或者释放了 重试
+	}
+}
+
+func (r *RedisJobDAO) Resume(ctx context.Context, jid int64, nextTime int64) error {
+	// 原来的节点还在执行 直接回到执行中
+	// 如果节点已经崩溃了 租约过期之后其他节点可以抢占
+	ok, err := r.set(ctx, jid, -1, jobStatusPausing, false, 0,
+		"status", jobStatusRunning)
+	if err != nil || ok {
+		return err
+	}
+	_, err = r.set(ctx, jid, -1, jobStatusPaused, false, 0,
+		"status", jobStatusWaiting,
+		"next_time", nextTime,
+		"trigger_time", 0,
+		"update_time", time.Now().UnixMilli())
+	return err
+}
+
+func (r *RedisJobDAO) Trigger(ctx context.Context, jid int64, t int64) error {
+	_, err := r.set(ctx, jid, -1, -1, true, 0,
+		"trigger_time", t,
+		"update_time", time.Now().UnixMilli())
+	return err
+}
+
+// set 满足条件时修改字段 不满足条件或者任务不存在时返回 false
+// version status 为 -1 时不检查 skipPaused 为 true 时不修改暂停的任务
+// 手动触发的时间还是 triggerTime 时清零
+func (r *RedisJobDAO) set(
+	ctx context.Context,
+	jid int64,
+	version int,
+	status int,
+	skipPaused bool,
+	triggerTime int64,
+	fields ...any,
+) (bool, error) {
+	args := append([]any{jid, version, status, skipPaused, triggerTime, jobLeaseTimeout.Milliseconds()}, fields...)
+	res, err := r.eval(ctx, luaJobSet, []string{r.key(jid), r.schedulePrefix, r.prioritiesKey}, args...).Int()
+	return res == 1, err
+}
+
+func (r *RedisJobDAO) findByIds(ctx context.Context, ids []int64) ([]Job, error) {
+	res := make([]Job, 0, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.HGetAll(ctx, r.key(id)))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		if len(cmd.Val()) == 0 {
+			// 查询期间被删掉了
+			continue
+		}
+		var job Job
+		err = cmd.Scan(&job)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, job)
+	}
+	return res, nil
+}
+
+// definition 任务的定义 Insert 和 Update 都会修改
+func (r *RedisJobDAO) definition(job Job) []any {
+	return []any{
+		"name", job.Name,
+		"executor", job.Executor,
+		"expression", job.Expression,
+		"config", job.Config,
+		"mode", job.Mode,
+		"shards", job.Shards,
+		"timezone", job.Timezone,
+		"misfire", job.Misfire,
+		"max_duration", job.MaxDuration,
+		"priority", job.Priority,
+		"next_time", job.NextTime,
+	}
+}
+
+func (r *RedisJobDAO) eval(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+	return r.client.Eval(ctx, luaJobSchedule+script, keys, args...)
+}
+
+func (r *RedisJobDAO) key(jid int64) string {
+	return r.prefix + strconv.FormatInt(jid, 10)
+}
+
+func (r *RedisJobDAO) scheduleKey(priority int) string {
+	return r.schedulePrefix + strconv.Itoa(priority)
+}
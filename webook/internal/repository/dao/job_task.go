@@ -0,0 +1,176 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrJobTaskNotFound = gorm.ErrRecordNotFound
+
+// JobTaskDAO 广播和分片任务分发出来的子任务
+type JobTaskDAO interface {
+	// Insert 同一轮重复分发的子任务会被忽略
+	Insert(ctx context.Context, tasks []JobTask) error
+	// Preempt 抢一个到了执行时间的子任务 先抢优先级高的任务的
+	// 指定了节点的子任务只有这个节点能抢
+	// excludeJobIds 是在本节点已经达到并发上限的任务 它们的子任务留给其他节点
+	Preempt(ctx context.Context, node string, excludeJobIds []int64) (JobTask, error)
+	// UpdateTime 续约 版本号变了返回 ErrJobLeaseLost
+	UpdateTime(ctx context.Context, id int64, version int) error
+	// Release 没有执行完就放回去 其他节点可以马上抢到
+	Release(ctx context.Context, id int64, version int) error
+	// Complete 记录执行结果 status 是 waiting 时表示要重试
+	Complete(ctx context.Context, id int64, version int, status uint8, attempt int, nextTime int64) error
+	// CancelBefore 取消 tick 之前还没开始执行的广播子任务
+	// 这些节点很可能已经下线了
+	CancelBefore(ctx context.Context, jid int64, tick int64) error
+}
+
+type GORMJobTaskDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMJobTaskDAO(db *gorm.DB) JobTaskDAO {
+	return &GORMJobTaskDAO{db: db}
+}
+
+func (g *GORMJobTaskDAO) Insert(ctx context.Context, tasks []JobTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	for i := range tasks {
+		tasks[i].Status = jobTaskStatusWaiting
+		tasks[i].CreateTime = now
+		tasks[i].UpdateTime = now
+	}
+	return g.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&tasks).Error
+}
+
+func (g *GORMJobTaskDAO) Preempt(ctx context.Context, node string, excludeJobIds []int64) (JobTask, error) {
+	db := g.db.WithContext(ctx)
+	for {
+		var task JobTask
+		now := time.Now().UnixMilli()
+		// 和 Job 一样 连续两次续约失败的子任务也可以抢
+		// 关联任务表 先抢优先级高的任务的子任务
+		query := db.Model(&JobTask{}).
+			Joins("JOIN jobs ON jobs.id = job_tasks.job_id").
+			Where("job_tasks.node IN ? AND ((job_tasks.status = ? AND job_tasks.next_time <= ?) OR (job_tasks.status = ? AND job_tasks.update_time < ?))",
+				[]string{"", node},
+				jobTaskStatusWaiting, now,
+				jobTaskStatusRunning, now-(time.Minute*2).Milliseconds())
+		if len(excludeJobIds) > 0 {
+			query = query.Where("job_tasks.job_id NOT IN ?", excludeJobIds)
+		}
+		err := query.Order("jobs.priority DESC, job_tasks.next_time ASC").First(&task).Error
+		if err != nil {
+			return task, err
+		}
+		res := db.Model(&JobTask{}).
+			Where("id = ? AND version = ?", task.Id, task.Version).
+			Updates(map[string]any{
+				"status":      jobTaskStatusRunning,
+				"version":     task.Version + 1,
+				"update_time": now,
+			})
+		if res.Error != nil {
+			return JobTask{}, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		task.Version = task.Version + 1
+		task.Status = jobTaskStatusRunning
+		return task, nil
+	}
+}
+
+func (g *GORMJobTaskDAO) UpdateTime(ctx context.Context, id int64, version int) error {
+	res := g.db.WithContext(ctx).
+		Model(&JobTask{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(map[string]any{
+			"update_time": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
+
+func (g *GORMJobTaskDAO) Release(ctx context.Context, id int64, version int) error {
+	return g.db.WithContext(ctx).
+		Model(&JobTask{}).
+		Where("id = ? AND version = ? AND status = ?", id, version, jobTaskStatusRunning).
+		Updates(map[string]any{
+			"status":      jobTaskStatusWaiting,
+			"update_time": time.Now().UnixMilli(),
+		}).Error
+}
+
+func (g *GORMJobTaskDAO) Complete(
+	ctx context.Context,
+	id int64,
+	version int,
+	status uint8,
+	attempt int,
+	nextTime int64,
+) error {
+	updates := map[string]any{
+		"status":      status,
+		"attempt":     attempt,
+		"update_time": time.Now().UnixMilli(),
+	}
+	if nextTime > 0 {
+		updates["next_time"] = nextTime
+	}
+	return g.db.WithContext(ctx).
+		Model(&JobTask{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(updates).Error
+}
+
+func (g *GORMJobTaskDAO) CancelBefore(ctx context.Context, jid int64, tick int64) error {
+	return g.db.WithContext(ctx).
+		Model(&JobTask{}).
+		Where("job_id = ? AND tick < ? AND node <> '' AND status = ?", jid, tick, jobTaskStatusWaiting).
+		Updates(map[string]any{
+			"status":      jobTaskStatusCanceled,
+			"update_time": time.Now().UnixMilli(),
+		}).Error
+}
+
+type JobTask struct {
+	Id    int64 `gorm:"primaryKey,autoIncrement"`
+	JobId int64 `gorm:"uniqueIndex:uk_job_tick_shard"`
+	// 这一轮的执行时间 毫秒
+	Tick   int64 `gorm:"uniqueIndex:uk_job_tick_shard"`
+	Shard  int   `gorm:"uniqueIndex:uk_job_tick_shard"`
+	Shards int
+	// 广播任务指定的节点
+	Node     string `gorm:"type:varchar(128);index:idx_node_status_next"`
+	Status   uint8  `gorm:"index:idx_node_status_next"`
+	NextTime int64  `gorm:"index:idx_node_status_next"`
+	Version  int
+	Attempt  int
+
+	UpdateTime int64
+	CreateTime int64
+}
+
+const (
+	// 和 domain.JobTaskStatus 对应
+	jobTaskStatusWaiting = iota
+	jobTaskStatusRunning
+	jobTaskStatusSuccess
+	jobTaskStatusFailed
+	jobTaskStatusCanceled
+)
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+func TestGORMJobTaskDAO_PreemptPriority(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		TranslateError: true,
+		Logger:         glogger.Default.LogMode(glogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Job{}, &JobTask{}))
+	jobDAO := NewGORMJobDAO(db)
+	dao := NewGORMJobTaskDAO(db)
+	ctx := context.Background()
+
+	later := time.Now().Add(time.Hour).UnixMilli()
+	low, err := jobDAO.Insert(ctx, Job{Name: "low", Mode: 2, NextTime: later})
+	require.NoError(t, err)
+	high, err := jobDAO.Insert(ctx, Job{Name: "high", Mode: 2, Priority: 10, NextTime: later})
+	require.NoError(t, err)
+	due := time.Now().Add(-time.Minute).UnixMilli()
+	require.NoError(t, dao.Insert(ctx, []JobTask{
+		{JobId: low, Tick: due, Shard: 0, Shards: 2, NextTime: due - 1000},
+		{JobId: low, Tick: due, Shard: 1, Shards: 2, NextTime: due - 1000},
+		{JobId: high, Tick: due, Shard: 0, Shards: 2, NextTime: due},
+		{JobId: high, Tick: due, Shard: 1, Shards: 2, NextTime: due - 500},
+		// 指定给其他节点的
+		{JobId: high, Tick: due, Shard: 2, Shards: 2, Node: "node-2", NextTime: due - 2000},
+	}))
+
+	var got []int64
+	for {
+		task, err := dao.Preempt(ctx, "node-1", nil)
+		if err == ErrJobTaskNotFound {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, uint8(jobTaskStatusRunning), task.Status)
+		got = append(got, task.JobId*10+int64(task.Shard))
+	}
+	// 优先级高的先抢 同一个优先级里先到执行时间的先抢
+	assert.Equal(t, high*10+1, got[0])
+	assert.Equal(t, high*10, got[1])
+	assert.ElementsMatch(t, []int64{low * 10, low*10 + 1}, got[2:])
+
+	// 被排除的任务的子任务留给其他节点
+	task, err := dao.Preempt(ctx, "node-2", []int64{high})
+	assert.Equal(t, ErrJobTaskNotFound, err)
+	task, err = dao.Preempt(ctx, "node-2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, high, task.JobId)
+	assert.Equal(t, 2, task.Shard)
+}
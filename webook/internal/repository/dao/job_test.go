@@ -0,0 +1,526 @@
+package dao
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// JobDAOSuite 所有 JobDAO 的实现都要通过的测试
+type JobDAOSuite struct {
+	suite.Suite
+	// 每个用例都用一个新的存储
+	newStore func(t *testing.T) (JobDAO, jobAger)
+	dao      JobDAO
+	// 模拟时间流逝 让执行中的任务的租约过期
+	age jobAger
+}
+
+// jobAger 把任务的更新时间往前挪 d
+type jobAger func(jid int64, d time.Duration)
+
+func TestGORMJobDAO(t *testing.T) {
+	suite.Run(t, &JobDAOSuite{newStore: func(t *testing.T) (JobDAO, jobAger) {
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+			TranslateError: true,
+			Logger:         glogger.Default.LogMode(glogger.Silent),
+		})
+		require.NoError(t, err)
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		// 内存数据库每个连接都是独立的
+		sqlDB.SetMaxOpenConns(1)
+		require.NoError(t, db.AutoMigrate(&Job{}))
+		return NewGORMJobDAO(db), func(jid int64, d time.Duration) {
+			err := db.Model(&Job{}).Where("id = ?", jid).
+				Update("update_time", gorm.Expr("update_time - ?", d.Milliseconds())).Error
+			require.NoError(t, err)
+		}
+	}})
+}
+
+func TestRedisJobDAO(t *testing.T) {
+	suite.Run(t, &JobDAOSuite{newStore: func(t *testing.T) (JobDAO, jobAger) {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		dao := NewRedisJobDAO(client).(*RedisJobDAO)
+		return dao, func(jid int64, d time.Duration) {
+			ctx := context.Background()
+			id := strconv.FormatInt(jid, 10)
+			require.NoError(t, client.HIncrBy(ctx, dao.key(jid), "update_time", -d.Milliseconds()).Err())
+			// 只有执行中的任务的分数和更新时间有关
+			job := client.HMGet(ctx, dao.key(jid), "status", "priority").Val()
+			if job[0] == strconv.Itoa(jobStatusRunning) {
+				priority, err := strconv.Atoi(job[1].(string))
+				require.NoError(t, err)
+				require.NoError(t, client.ZIncrBy(ctx, dao.scheduleKey(priority), float64(-d.Milliseconds()), id).Err())
+			}
+		}
+	}})
+}
+
+// redis cluster 下脚本里拼出来的 key 必须和 KEYS 在同一个槽
+func TestRedisJobDAO_HashTag(t *testing.T) {
+	mr := miniredis.RunT(t)
+	dao := NewRedisJobDAO(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+	id, err := dao.Insert(ctx, Job{Name: "ranking", Priority: 1})
+	require.NoError(t, err)
+	_, err = dao.Insert(ctx, Job{Name: "snapshot"})
+	require.NoError(t, err)
+	_, err = dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, dao.Delete(ctx, id))
+	keys := mr.Keys()
+	require.NotEmpty(t, keys)
+	for _, key := range keys {
+		assert.True(t, strings.HasPrefix(key, "{job}:"), key)
+	}
+}
+
+func (s *JobDAOSuite) SetupTest() {
+	s.dao, s.age = s.newStore(s.T())
+}
+
+func (s *JobDAOSuite) TestInsertAndFind() {
+	t := s.T()
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	id, err := s.dao.Insert(ctx, Job{
+		Name:        "ranking",
+		Executor:    "local",
+		Expression:  "@every 1m",
+		Config:      `{"n":100}`,
+		Mode:        2,
+		Shards:      4,
+		Timezone:    "Asia/Shanghai",
+		Misfire:     1,
+		MaxDuration: 60000,
+		Priority:    5,
+		NextTime:    now + 1000,
+	})
+	require.NoError(t, err)
+	assert.True(t, id > 0)
+
+	job, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, job.CreateTime >= now)
+	assert.Equal(t, job.CreateTime, job.UpdateTime)
+	job.CreateTime, job.UpdateTime = 0, 0
+	assert.Equal(t, Job{
+		Id:          id,
+		Name:        "ranking",
+		Executor:    "local",
+		Expression:  "@every 1m",
+		Config:      `{"n":100}`,
+		Status:      jobStatusWaiting,
+		Mode:        2,
+		Shards:      4,
+		Timezone:    "Asia/Shanghai",
+		Misfire:     1,
+		MaxDuration: 60000,
+		Priority:    5,
+		NextTime:    now + 1000,
+	}, job)
+
+	_, err = s.dao.Insert(ctx, Job{Name: "ranking"})
+	assert.Equal(t, ErrDuplicateJobName, err)
+
+	_, err = s.dao.FindById(ctx, id+100)
+	assert.Equal(t, ErrJobNotFound, err)
+}
+
+func (s *JobDAOSuite) TestFindByNamesAndList() {
+	t := s.T()
+	ctx := context.Background()
+	ids := make([]int64, 0, 5)
+	for i := 0; i < 5; i++ {
+		id, err := s.dao.Insert(ctx, Job{Name: "job_" + strconv.Itoa(i), NextTime: time.Now().Add(time.Hour).UnixMilli()})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	jobs, err := s.dao.FindByNames(ctx, []string{"job_1", "job_3", "not_exist"})
+	require.NoError(t, err)
+	names := make(map[string]int64, len(jobs))
+	for _, job := range jobs {
+		names[job.Name] = job.Id
+	}
+	assert.Equal(t, map[string]int64{"job_1": ids[1], "job_3": ids[3]}, names)
+
+	jobs, err = s.dao.FindByNames(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 0)
+
+	jobs, err = s.dao.List(ctx, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, ids[1:4], s.ids(jobs))
+
+	jobs, err = s.dao.List(ctx, 4, 3)
+	require.NoError(t, err)
+	assert.Equal(t, ids[4:], s.ids(jobs))
+}
+
+func (s *JobDAOSuite) TestUpdateAndDelete() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Job{Name: "a", Executor: "local", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	require.NoError(t, err)
+	other, err := s.dao.Insert(ctx, Job{Name: "b", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	require.NoError(t, err)
+	// 修改定义不影响状态
+	require.NoError(t, s.dao.Pause(ctx, id))
+
+	next := time.Now().Add(-time.Second).UnixMilli()
+	err = s.dao.Update(ctx, Job{Id: id, Name: "c", Executor: "http", Expression: "@every 5s", Shards: 2, NextTime: next})
+	require.NoError(t, err)
+	job, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "c", job.Name)
+	assert.Equal(t, "http", job.Executor)
+	assert.Equal(t, "@every 5s", job.Expression)
+	assert.Equal(t, 2, job.Shards)
+	assert.Equal(t, next, job.NextTime)
+	assert.Equal(t, jobStatusPaused, job.Status)
+	s.assertNoPreempt()
+
+	// 改名之后原来的名字可以再用
+	_, err = s.dao.Insert(ctx, Job{Name: "a", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	require.NoError(t, err)
+	assert.Equal(t, ErrDuplicateJobName, s.dao.Update(ctx, Job{Id: id, Name: "b"}))
+	assert.Equal(t, ErrJobNotFound, s.dao.Update(ctx, Job{Id: id + 100, Name: "d"}))
+
+	require.NoError(t, s.dao.Delete(ctx, other))
+	_, err = s.dao.FindById(ctx, other)
+	assert.Equal(t, ErrJobNotFound, err)
+	assert.Equal(t, ErrJobNotFound, s.dao.Delete(ctx, other))
+	_, err = s.dao.Insert(ctx, Job{Name: "b", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	assert.NoError(t, err)
+}
+
+func (s *JobDAOSuite) TestPreemptAndRelease() {
+	t := s.T()
+	ctx := context.Background()
+	s.assertNoPreempt()
+
+	_, err := s.dao.Insert(ctx, Job{Name: "later", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	require.NoError(t, err)
+	id, err := s.dao.Insert(ctx, Job{Name: "due", NextTime: time.Now().Add(-time.Second).UnixMilli()})
+	require.NoError(t, err)
+
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, job.Id)
+	assert.Equal(t, 1, job.Version)
+	assert.Equal(t, jobStatusRunning, job.Status)
+	// 已经被抢占了
+	s.assertNoPreempt()
+
+	// 版本号不对不会释放
+	require.NoError(t, s.dao.Release(ctx, id, 0))
+	s.assertNoPreempt()
+	require.NoError(t, s.dao.Release(ctx, id, job.Version))
+	released, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, jobStatusWaiting, released.Status)
+
+	job, err = s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, job.Id)
+	assert.Equal(t, 2, job.Version)
+
+	// 执行期间被暂停 释放之后还是暂停
+	require.NoError(t, s.dao.Pause(ctx, id))
+	require.NoError(t, s.dao.Release(ctx, id, job.Version))
+	paused, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, jobStatusPaused, paused.Status)
+	s.assertNoPreempt()
+}
+
+func (s *JobDAOSuite) TestPreemptPriority() {
+	t := s.T()
+	ctx := context.Background()
+	due := time.Now().Add(-time.Minute).UnixMilli()
+	low, err := s.dao.Insert(ctx, Job{Name: "low", Executor: "local", NextTime: due - 1000})
+	require.NoError(t, err)
+	high, err := s.dao.Insert(ctx, Job{Name: "high", Executor: "http", Priority: 10, NextTime: due})
+	require.NoError(t, err)
+	earlier, err := s.dao.Insert(ctx, Job{Name: "earlier", Executor: "http", Priority: 10, NextTime: due - 500})
+	require.NoError(t, err)
+	broadcast, err := s.dao.Insert(ctx, Job{Name: "broadcast", Executor: "http", Mode: 1, Priority: 5, NextTime: due})
+	require.NoError(t, err)
+
+	depth, err := s.dao.CountDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 1, 5: 1, 10: 2}, depth)
+
+	// 优先级相同的先到执行时间的先抢
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, earlier, job.Id)
+	// 执行器满了 广播任务只分发子任务 不受影响
+	job, err = s.dao.Preempt(ctx, []string{"http"})
+	require.NoError(t, err)
+	assert.Equal(t, broadcast, job.Id)
+	job, err = s.dao.Preempt(ctx, []string{"http"})
+	require.NoError(t, err)
+	assert.Equal(t, low, job.Id)
+	_, err = s.dao.Preempt(ctx, []string{"http"})
+	assert.Equal(t, ErrJobNotFound, err)
+	job, err = s.dao.Preempt(ctx, []string{"grpc"})
+	require.NoError(t, err)
+	assert.Equal(t, high, job.Id)
+
+	// 执行中的不算等待
+	depth, err = s.dao.CountDue(ctx)
+	require.NoError(t, err)
+	assert.Len(t, depth, 0)
+}
+
+func (s *JobDAOSuite) TestPreemptManyDue() {
+	t := s.T()
+	ctx := context.Background()
+	due := time.Now().Add(-time.Minute).UnixMilli()
+	// 先到执行时间的一大批任务的执行器都满了
+	for i := 0; i < 150; i++ {
+		_, err := s.dao.Insert(ctx, Job{Name: "busy-" + strconv.Itoa(i), Executor: "http", NextTime: due - 1000 + int64(i)})
+		require.NoError(t, err)
+	}
+	local, err := s.dao.Insert(ctx, Job{Name: "local", Executor: "local", NextTime: due})
+	require.NoError(t, err)
+	high, err := s.dao.Insert(ctx, Job{Name: "high", Executor: "http", Priority: 10, NextTime: due})
+	require.NoError(t, err)
+
+	depth, err := s.dao.CountDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 151, 10: 1}, depth)
+
+	// 排在所有被排除的任务后面也能抢到
+	job, err := s.dao.Preempt(ctx, []string{"http"})
+	require.NoError(t, err)
+	assert.Equal(t, local, job.Id)
+
+	// 调高优先级之后先抢
+	raised, err := s.dao.FindByNames(ctx, []string{"busy-149"})
+	require.NoError(t, err)
+	require.Len(t, raised, 1)
+	raised[0].Priority = 20
+	require.NoError(t, s.dao.Update(ctx, raised[0]))
+	job, err = s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, raised[0].Id, job.Id)
+	job, err = s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, high, job.Id)
+
+	depth, err = s.dao.CountDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 149}, depth)
+}
+
+func (s *JobDAOSuite) TestLease() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Job{Name: "due", NextTime: time.Now().Add(-time.Second).UnixMilli()})
+	require.NoError(t, err)
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.dao.UpdateTime(ctx, id, job.Version))
+	assert.Equal(t, ErrJobLeaseLost, s.dao.UpdateTime(ctx, id, job.Version-1))
+
+	// 续约之后还没过期
+	s.age(id, jobLeaseTimeout-time.Second*10)
+	s.assertNoPreempt()
+
+	// 租约过期 其他节点可以抢占
+	s.age(id, time.Second*20)
+	taken, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, taken.Id)
+	assert.Equal(t, job.Version+1, taken.Version)
+	assert.Equal(t, ErrJobLeaseLost, s.dao.UpdateTime(ctx, id, job.Version))
+}
+
+func (s *JobDAOSuite) TestTrigger() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Job{Name: "later", NextTime: time.Now().Add(time.Hour).UnixMilli()})
+	require.NoError(t, err)
+
+	// 还没到触发的时间
+	require.NoError(t, s.dao.Trigger(ctx, id, time.Now().Add(time.Minute).UnixMilli()))
+	s.assertNoPreempt()
+
+	trigger := time.Now().UnixMilli()
+	require.NoError(t, s.dao.Trigger(ctx, id, trigger))
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, job.Id)
+	assert.Equal(t, trigger, job.TriggerTime)
+
+	// 执行期间又触发了一次 不清除
+	again := trigger + 1
+	require.NoError(t, s.dao.Trigger(ctx, id, again))
+	require.NoError(t, s.dao.Complete(ctx, id, job.Version, JobRun{}, 0, 0, trigger))
+	completed, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, again, completed.TriggerTime)
+
+	require.NoError(t, s.dao.Complete(ctx, id, job.Version, JobRun{}, 0, 0, again))
+	completed, err = s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), completed.TriggerTime)
+
+	// 暂停的任务不会被触发
+	require.NoError(t, s.dao.Release(ctx, id, job.Version))
+	require.NoError(t, s.dao.Pause(ctx, id))
+	require.NoError(t, s.dao.Trigger(ctx, id, trigger))
+	paused, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), paused.TriggerTime)
+	s.assertNoPreempt()
+}
+
+func (s *JobDAOSuite) TestComplete() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Job{Name: "due", NextTime: time.Now().Add(-time.Second).UnixMilli()})
+	require.NoError(t, err)
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+
+	run := JobRun{StartTime: 1000, EndTime: 2000, Status: 2, Error: "超时"}
+	next := time.Now().Add(time.Hour).UnixMilli()
+	// 版本号不对不会修改
+	require.NoError(t, s.dao.Complete(ctx, id, job.Version-1, run, 3, next, 0))
+	res, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Attempt)
+	assert.Equal(t, job.NextTime, res.NextTime)
+
+	require.NoError(t, s.dao.Complete(ctx, id, job.Version, run, 3, next, 0))
+	res, err = s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, run, JobRun{StartTime: res.LastStartTime, EndTime: res.LastEndTime, Status: res.LastStatus, Error: res.LastError})
+	assert.Equal(t, 3, res.Attempt)
+	assert.Equal(t, next, res.NextTime)
+	assert.Equal(t, jobStatusRunning, res.Status)
+
+	// nextTime 为0时不修改
+	require.NoError(t, s.dao.Complete(ctx, id, job.Version, run, 0, 0, 0))
+	res, err = s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, next, res.NextTime)
+
+	// 下次执行时间还没到
+	require.NoError(t, s.dao.Release(ctx, id, job.Version))
+	s.assertNoPreempt()
+}
+
+func (s *JobDAOSuite) TestPauseAndResume() {
+	t := s.T()
+	ctx := context.Background()
+	assert.Equal(t, ErrJobNotFound, s.dao.Pause(ctx, 100))
+
+	id, err := s.dao.Insert(ctx, Job{Name: "due", NextTime: time.Now().Add(-time.Second).UnixMilli()})
+	require.NoError(t, err)
+	require.NoError(t, s.dao.Trigger(ctx, id, time.Now().UnixMilli()))
+	require.NoError(t, s.dao.Pause(ctx, id))
+	s.assertNoPreempt()
+
+	// 恢复时清除手动触发
+	next := time.Now().Add(time.Hour).UnixMilli()
+	require.NoError(t, s.dao.Resume(ctx, id, next))
+	job, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, jobStatusWaiting, job.Status)
+	assert.Equal(t, next, job.NextTime)
+	assert.Equal(t, int64(0), job.TriggerTime)
+	s.assertNoPreempt()
+
+	// 只恢复暂停的任务
+	require.NoError(t, s.dao.Resume(ctx, id, time.Now().Add(-time.Second).UnixMilli()))
+	job, err = s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, next, job.NextTime)
+
+	require.NoError(t, s.dao.UpdateNextTime(ctx, id, time.Now().Add(-time.Second)))
+	job, err = s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, job.Id)
+}
+
+func (s *JobDAOSuite) TestPauseWhileRunning() {
+	t := s.T()
+	ctx := context.Background()
+	id, err := s.dao.Insert(ctx, Job{Name: "due", NextTime: time.Now().Add(-time.Second).UnixMilli()})
+	require.NoError(t, err)
+	job, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	status := func() int {
+		j, er := s.dao.FindById(ctx, id)
+		require.NoError(t, er)
+		return j.Status
+	}
+
+	require.NoError(t, s.dao.Pause(ctx, id))
+	assert.Equal(t, jobStatusPausing, status())
+	// 执行期间暂停的任务不能触发 原来的节点还能续约
+	require.NoError(t, s.dao.Trigger(ctx, id, time.Now().UnixMilli()))
+	pausing, err := s.dao.FindById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pausing.TriggerTime)
+	require.NoError(t, s.dao.UpdateTime(ctx, id, job.Version))
+	s.assertNoPreempt()
+
+	// 恢复之后还是原来的节点在执行 其他节点抢不到
+	next := time.Now().Add(-time.Second).UnixMilli()
+	require.NoError(t, s.dao.Resume(ctx, id, next))
+	assert.Equal(t, jobStatusRunning, status())
+	s.assertNoPreempt()
+	require.NoError(t, s.dao.UpdateTime(ctx, id, job.Version))
+
+	// 再次暂停 释放的时候变成暂停
+	require.NoError(t, s.dao.Pause(ctx, id))
+	require.NoError(t, s.dao.Release(ctx, id, job.Version))
+	assert.Equal(t, jobStatusPaused, status())
+	require.NoError(t, s.dao.Resume(ctx, id, next))
+	assert.Equal(t, jobStatusWaiting, status())
+	job, err = s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+
+	// 节点崩溃 暂停期间租约过期也不会被抢
+	require.NoError(t, s.dao.Pause(ctx, id))
+	s.age(id, jobLeaseTimeout+time.Second)
+	s.assertNoPreempt()
+	// 恢复之后租约已经过期了 其他节点接手
+	require.NoError(t, s.dao.Resume(ctx, id, next))
+	taken, err := s.dao.Preempt(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, job.Version+1, taken.Version)
+}
+
+func (s *JobDAOSuite) assertNoPreempt() {
+	_, err := s.dao.Preempt(context.Background(), nil)
+	assert.Equal(s.T(), ErrJobNotFound, err)
+}
+
+func (s *JobDAOSuite) ids(jobs []Job) []int64 {
+	res := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		res = append(res, job.Id)
+	}
+	return res
+}
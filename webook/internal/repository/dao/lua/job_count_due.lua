@@ -0,0 +1,22 @@
+local schedulePrefix = KEYS[1]
+local prioritiesKey = KEYS[2]
+local prefix = ARGV[1]
+local now = tonumber(ARGV[2])
+
+-- 到了执行时间还在等待的任务 按照优先级计数
+-- 返回 优先级 数量 交替排列的数组
+local res = {}
+for _, priority in ipairs(redis.call("ZRANGE", prioritiesKey, 0, -1)) do
+    local ids = redis.call("ZRANGEBYSCORE", schedulePrefix .. priority, "-inf", now)
+    local count = 0
+    for _, id in ipairs(ids) do
+        if redis.call("HGET", prefix .. id, "status") == "0" then
+            count = count + 1
+        end
+    end
+    if count > 0 then
+        table.insert(res, tonumber(priority))
+        table.insert(res, count)
+    end
+end
+return res
@@ -0,0 +1,16 @@
+local jobKey = KEYS[1]
+local nameKey = KEYS[2]
+local idsKey = KEYS[3]
+local schedulePrefix = KEYS[4]
+local prioritiesKey = KEYS[5]
+local id = ARGV[1]
+
+local name, priority = unpack(redis.call("HMGET", jobKey, "name", "priority"))
+if not name then
+    return 0
+end
+redis.call("HDEL", nameKey, name)
+redis.call("DEL", jobKey)
+redis.call("ZREM", idsKey, id)
+unschedule(schedulePrefix, prioritiesKey, tonumber(priority) or 0, id)
+return 1
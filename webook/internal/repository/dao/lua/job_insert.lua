@@ -0,0 +1,20 @@
+local idKey = KEYS[1]
+local nameKey = KEYS[2]
+local idsKey = KEYS[3]
+local schedulePrefix = KEYS[4]
+local prioritiesKey = KEYS[5]
+local prefix = ARGV[1]
+local name = ARGV[2]
+local leaseTimeout = tonumber(ARGV[3])
+
+if redis.call("HEXISTS", nameKey, name) == 1 then
+    -- 名字重复
+    return -1
+end
+local id = redis.call("INCR", idKey)
+local jobKey = prefix .. id
+redis.call("HSET", nameKey, name, id)
+redis.call("HSET", jobKey, "id", id, unpack(ARGV, 4))
+redis.call("ZADD", idsKey, id, id)
+reschedule(schedulePrefix, prioritiesKey, jobKey, id, leaseTimeout)
+return id
@@ -0,0 +1,58 @@
+local schedulePrefix = KEYS[1]
+local prioritiesKey = KEYS[2]
+local prefix = ARGV[1]
+local now = tonumber(ARGV[2])
+local leaseTimeout = tonumber(ARGV[3])
+-- 本节点没有空闲的执行器 这些任务留给其他节点
+-- 广播和分片任务只分发子任务 不受影响
+local excluded = {}
+for i = 4, #ARGV do
+    excluded[ARGV[i]] = true
+end
+
+-- 在一个优先级里按分数从小到大分批找 直到找到没有被排除的任务或者没有可以抢占的任务
+local batch = 100
+local function find(priority)
+    local key = schedulePrefix .. priority
+    local offset = 0
+    local deleted = {}
+    local found
+    while not found do
+        local ids = redis.call("ZRANGEBYSCORE", key, "-inf", now, "LIMIT", offset, batch)
+        for _, id in ipairs(ids) do
+            local job = redis.call("HMGET", prefix .. id, "executor", "mode")
+            if not job[1] then
+                -- 任务已经被删掉了
+                table.insert(deleted, id)
+            elseif job[2] ~= "0" or not excluded[job[1]] then
+                found = id
+                break
+            end
+        end
+        if #ids < batch then
+            break
+        end
+        offset = offset + batch
+    end
+    for _, id in ipairs(deleted) do
+        unschedule(schedulePrefix, prioritiesKey, priority, id)
+    end
+    return found
+end
+
+-- 优先级从高到低 优先级相同的取分数小的
+local chosen
+for _, priority in ipairs(redis.call("ZREVRANGE", prioritiesKey, 0, -1)) do
+    chosen = find(priority)
+    if chosen then
+        break
+    end
+end
+if chosen == nil then
+    return false
+end
+local chosenKey = prefix .. chosen
+local version = tonumber(redis.call("HGET", chosenKey, "version")) + 1
+redis.call("HSET", chosenKey, "status", 1, "version", version, "update_time", now)
+reschedule(schedulePrefix, prioritiesKey, chosenKey, chosen, leaseTimeout)
+return { tonumber(chosen), version }
@@ -0,0 +1,34 @@
+-- 所有任务脚本共用 加在脚本的最前面
+-- 每个优先级一个有序集合 分数是任务可以被抢占的时间 分数不超过当前时间的任务可以被抢占
+-- 另外用一个有序集合记录有任务的优先级 分数就是优先级 抢占的时候从高到低找
+-- 等待中的任务取下次执行时间和手动触发时间里早的那个 执行中的任务是续约超时的时间
+-- 暂停的任务不参与调度
+-- +1 是为了和 MySQL 的 next_time < now 以及 update_time < now - 续约超时 保持一致
+local function unschedule(schedulePrefix, prioritiesKey, priority, id)
+    local key = schedulePrefix .. priority
+    redis.call("ZREM", key, id)
+    if redis.call("ZCARD", key) == 0 then
+        redis.call("ZREM", prioritiesKey, priority)
+    end
+end
+
+local function reschedule(schedulePrefix, prioritiesKey, jobKey, id, leaseTimeout)
+    local job = redis.call("HMGET", jobKey, "status", "next_time", "trigger_time", "update_time", "priority")
+    local status = tonumber(job[1])
+    local priority = tonumber(job[5]) or 0
+    local score
+    if status == 0 then
+        score = tonumber(job[2]) + 1
+        local trigger = tonumber(job[3])
+        if trigger > 0 and trigger < score then
+            score = trigger
+        end
+    elseif status == 1 then
+        score = tonumber(job[4]) + leaseTimeout + 1
+    else
+        unschedule(schedulePrefix, prioritiesKey, priority, id)
+        return
+    end
+    redis.call("ZADD", schedulePrefix .. priority, score, id)
+    redis.call("ZADD", prioritiesKey, priority, priority)
+end
@@ -0,0 +1,33 @@
+-- 满足条件时修改任务的字段 相当于 UPDATE ... WHERE
+local jobKey = KEYS[1]
+local schedulePrefix = KEYS[2]
+local prioritiesKey = KEYS[3]
+local id = ARGV[1]
+-- 为 -1 时不检查
+local version = tonumber(ARGV[2])
+local status = tonumber(ARGV[3])
+-- 为 1 时暂停的任务不修改 包括执行期间被暂停的
+local skipPaused = ARGV[4] == "1"
+-- 手动触发的时间还是 trigger 时清零 为 0 时不处理
+local trigger = tonumber(ARGV[5])
+local leaseTimeout = tonumber(ARGV[6])
+
+local job = redis.call("HMGET", jobKey, "version", "status", "trigger_time")
+if not job[1] then
+    return 0
+end
+if version >= 0 and tonumber(job[1]) ~= version then
+    return 0
+end
+if status >= 0 and tonumber(job[2]) ~= status then
+    return 0
+end
+if skipPaused and (job[2] == "2" or job[2] == "3") then
+    return 0
+end
+if trigger > 0 and tonumber(job[3]) == trigger then
+    redis.call("HSET", jobKey, "trigger_time", 0)
+end
+redis.call("HSET", jobKey, unpack(ARGV, 7))
+reschedule(schedulePrefix, prioritiesKey, jobKey, id, leaseTimeout)
+return 1
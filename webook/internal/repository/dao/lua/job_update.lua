@@ -0,0 +1,27 @@
+local jobKey = KEYS[1]
+local nameKey = KEYS[2]
+local schedulePrefix = KEYS[3]
+local prioritiesKey = KEYS[4]
+local id = ARGV[1]
+local name = ARGV[2]
+local leaseTimeout = tonumber(ARGV[3])
+
+local old, priority = unpack(redis.call("HMGET", jobKey, "name", "priority"))
+if not old then
+    -- 任务不存在
+    return 0
+end
+if old ~= name then
+    local owner = redis.call("HGET", nameKey, name)
+    if owner and owner ~= id then
+        -- 名字重复
+        return -1
+    end
+    redis.call("HDEL", nameKey, old)
+    redis.call("HSET", nameKey, name, id)
+end
+-- 优先级可能变了 先从原来的集合里删掉
+unschedule(schedulePrefix, prioritiesKey, tonumber(priority) or 0, id)
+redis.call("HSET", jobKey, unpack(ARGV, 4))
+reschedule(schedulePrefix, prioritiesKey, jobKey, id, leaseTimeout)
+return 1
@@ -0,0 +1,157 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRankingSnapshotNotFound = gorm.ErrRecordNotFound
+	// ErrDuplicateRankingSnapshot 这个时间段已经有快照了 多个节点同时发布榜单的时候只有一个能保存成功
+	ErrDuplicateRankingSnapshot = errors.New("榜单快照重复")
+)
+
+type RankingSnapshotDAO interface {
+	// Insert 同一个榜单同一个时间段的快照已经存在时返回 ErrDuplicateRankingSnapshot
+	Insert(ctx context.Context, snapshot RankingSnapshot, items []RankingSnapshotItem) (int64, error)
+	// Latest 最近一次快照
+	Latest(ctx context.Context, name string) (RankingSnapshot, error)
+	// LatestBefore ctime <= t 的最后一个快照
+	LatestBefore(ctx context.Context, name string, t int64) (RankingSnapshot, error)
+	// ListByRange 按时间升序
+	ListByRange(ctx context.Context, name string, start, end int64, limit int) ([]RankingSnapshot, error)
+	GetItems(ctx context.Context, snapshotId int64) ([]RankingSnapshotItem, error)
+	GetArticleItems(ctx context.Context, snapshotIds []int64, aid int64) ([]RankingSnapshotItem, error)
+	// DeleteBefore 删除 ctime < t 的快照 每次最多删除 limit 个 返回删除的快照数量
+	DeleteBefore(ctx context.Context, t int64, limit int) (int64, error)
+}
+
+type GORMRankingSnapshotDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMRankingSnapshotDAO(db *gorm.DB) RankingSnapshotDAO {
+	return &GORMRankingSnapshotDAO{db: db}
+}
+
+func (g *GORMRankingSnapshotDAO) Insert(
+	ctx context.Context,
+	snapshot RankingSnapshot,
+	items []RankingSnapshotItem,
+) (int64, error) {
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&snapshot).Error
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for i := range items {
+			items[i].SnapshotId = snapshot.Id
+		}
+		return tx.Create(&items).Error
+	})
+	if isDuplicateErr(err) {
+		return 0, ErrDuplicateRankingSnapshot
+	}
+	return snapshot.Id, err
+}
+
+func (g *GORMRankingSnapshotDAO) Latest(ctx context.Context, name string) (RankingSnapshot, error) {
+	var res RankingSnapshot
+	err := g.db.WithContext(ctx).
+		Where("name = ?", name).
+		Order("ctime DESC").
+		First(&res).Error
+	return res, err
+}
+
+func (g *GORMRankingSnapshotDAO) LatestBefore(ctx context.Context, name string, t int64) (RankingSnapshot, error) {
+	var res RankingSnapshot
+	err := g.db.WithContext(ctx).
+		Where("name = ? AND ctime <= ?", name, t).
+		Order("ctime DESC").
+		First(&res).Error
+	return res, err
+}
+
+func (g *GORMRankingSnapshotDAO) ListByRange(
+	ctx context.Context,
+	name string,
+	start, end int64,
+	limit int,
+) ([]RankingSnapshot, error) {
+	var res []RankingSnapshot
+	err := g.db.WithContext(ctx).
+		Where("name = ? AND ctime >= ? AND ctime <= ?", name, start, end).
+		Order("ctime ASC").
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (g *GORMRankingSnapshotDAO) GetItems(ctx context.Context, snapshotId int64) ([]RankingSnapshotItem, error) {
+	var res []RankingSnapshotItem
+	err := g.db.WithContext(ctx).
+		Where("snapshot_id = ?", snapshotId).
+		Order("position ASC").
+		Find(&res).Error
+	return res, err
+}
+
+func (g *GORMRankingSnapshotDAO) GetArticleItems(
+	ctx context.Context,
+	snapshotIds []int64,
+	aid int64,
+) ([]RankingSnapshotItem, error) {
+	var res []RankingSnapshotItem
+	if len(snapshotIds) == 0 {
+		return res, nil
+	}
+	err := g.db.WithContext(ctx).
+		Where("snapshot_id IN ? AND article_id = ?", snapshotIds, aid).
+		Find(&res).Error
+	return res, err
+}
+
+func (g *GORMRankingSnapshotDAO) DeleteBefore(ctx context.Context, t int64, limit int) (int64, error) {
+	var ids []int64
+	err := g.db.WithContext(ctx).
+		Model(&RankingSnapshot{}).
+		Where("ctime < ?", t).
+		Order("ctime ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("snapshot_id IN ?", ids).Delete(&RankingSnapshotItem{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&RankingSnapshot{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+type RankingSnapshot struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Name  string `gorm:"type:varchar(64);index:idx_name_ctime;uniqueIndex:uk_name_bucket"`
+	Ctime int64  `gorm:"index:idx_name_ctime"`
+	// 检查最近一次快照再插入的做法在多个节点之间有并发问题 靠唯一索引保证最小间隔
+	Bucket int64 `gorm:"uniqueIndex:uk_name_bucket"`
+}
+
+type RankingSnapshotItem struct {
+	Id         int64 `gorm:"primaryKey,autoIncrement"`
+	SnapshotId int64 `gorm:"index:idx_snapshot_article"`
+	ArticleId  int64 `gorm:"index:idx_snapshot_article;index:idx_article_id"`
+	Position   int
+	Score      float64
+}
@@ -0,0 +1,327 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrWorkflowNotFound      = gorm.ErrRecordNotFound
+	ErrDuplicateWorkflowName = errors.New("工作流名字重复")
+	// ErrWorkflowPreempted 这一轮已经被其他节点触发了
+	ErrWorkflowPreempted = errors.New("工作流已经被其他节点触发")
+	// ErrWorkflowLeaseLost 工作流的执行已经被其他节点接手了
+	ErrWorkflowLeaseLost = errors.New("工作流已经被其他节点接手")
+)
+
+type WorkflowDAO interface {
+	Insert(ctx context.Context, w Workflow) (int64, error)
+	Update(ctx context.Context, w Workflow) error
+	Delete(ctx context.Context, id int64) error
+	FindById(ctx context.Context, id int64) (Workflow, error)
+	List(ctx context.Context, offset, limit int) ([]Workflow, error)
+
+	// FindDue 一个到了执行时间的工作流
+	FindDue(ctx context.Context, now int64) (Workflow, error)
+	// CreateRun 在同一个事务里推进工作流的下次执行时间并创建执行记录
+	// 版本号变了返回 ErrWorkflowPreempted
+	// 上一次执行还没有结束时只推进时间 返回的 id 为0
+	CreateRun(ctx context.Context, w Workflow, nextTime int64, run WorkflowRun, steps []WorkflowStepRun) (int64, error)
+	// PreemptRun 接手一个续约超时的执行 说明原来的节点已经崩溃了
+	PreemptRun(ctx context.Context, node string, staleBefore int64) (WorkflowRun, error)
+	// RefreshRun 续约 版本号变了返回 ErrWorkflowLeaseLost
+	RefreshRun(ctx context.Context, id int64, version int) error
+	// UpdateStep 更新节点的状态 同时续约
+	UpdateStep(ctx context.Context, runId int64, version int, step WorkflowStepRun) error
+	FinishRun(ctx context.Context, id int64, version int, status uint8, endTime int64) error
+	FindRunById(ctx context.Context, id int64) (WorkflowRun, error)
+	ListRuns(ctx context.Context, workflowId int64, offset, limit int) ([]WorkflowRun, error)
+	GetSteps(ctx context.Context, runId int64) ([]WorkflowStepRun, error)
+}
+
+type GORMWorkflowDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMWorkflowDAO(db *gorm.DB) WorkflowDAO {
+	return &GORMWorkflowDAO{db: db}
+}
+
+func (g *GORMWorkflowDAO) Insert(ctx context.Context, w Workflow) (int64, error) {
+	now := time.Now().UnixMilli()
+	w.CreateTime = now
+	w.UpdateTime = now
+	w.Status = jobStatusWaiting
+	err := g.db.WithContext(ctx).Create(&w).Error
+	if me, ok := err.(*mysql.MySQLError); ok && me.Number == 1062 {
+		return 0, ErrDuplicateWorkflowName
+	}
+	return w.Id, err
+}
+
+func (g *GORMWorkflowDAO) Update(ctx context.Context, w Workflow) error {
+	now := time.Now().UnixMilli()
+	res := g.db.WithContext(ctx).
+		Model(&Workflow{}).
+		Where("id = ?", w.Id).
+		Updates(map[string]any{
+			"name":        w.Name,
+			"expression":  w.Expression,
+			"steps":       w.Steps,
+			"next_time":   w.NextTime,
+			"update_time": now,
+		})
+	if me, ok := res.Error.(*mysql.MySQLError); ok && me.Number == 1062 {
+		return ErrDuplicateWorkflowName
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+func (g *GORMWorkflowDAO) Delete(ctx context.Context, id int64) error {
+	// 执行记录保留下来
+	res := g.db.WithContext(ctx).Where("id = ?", id).Delete(&Workflow{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+func (g *GORMWorkflowDAO) FindById(ctx context.Context, id int64) (Workflow, error) {
+	var res Workflow
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+func (g *GORMWorkflowDAO) List(ctx context.Context, offset, limit int) ([]Workflow, error) {
+	var res []Workflow
+	err := g.db.WithContext(ctx).
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (g *GORMWorkflowDAO) FindDue(ctx context.Context, now int64) (Workflow, error) {
+	var res Workflow
+	err := g.db.WithContext(ctx).
+		Where("status = ? AND next_time <= ?", jobStatusWaiting, now).
+		First(&res).Error
+	return res, err
+}
+
+func (g *GORMWorkflowDAO) CreateRun(
+	ctx context.Context,
+	w Workflow,
+	nextTime int64,
+	run WorkflowRun,
+	steps []WorkflowStepRun,
+) (int64, error) {
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		res := tx.Model(&Workflow{}).
+			Where("id = ? AND version = ?", w.Id, w.Version).
+			Updates(map[string]any{
+				"version":     w.Version + 1,
+				"next_time":   nextTime,
+				"update_time": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWorkflowPreempted
+		}
+
+		// 同一个工作流同时只有一个执行
+		var cnt int64
+		err := tx.Model(&WorkflowRun{}).
+			Where("workflow_id = ? AND status = ?", w.Id, workflowRunRunning).
+			Count(&cnt).Error
+		if err != nil || cnt > 0 {
+			return err
+		}
+
+		run.Status = workflowRunRunning
+		run.UpdateTime = now
+		err = tx.Create(&run).Error
+		if err != nil {
+			return err
+		}
+		for i := range steps {
+			steps[i].RunId = run.Id
+		}
+		return tx.Create(&steps).Error
+	})
+	return run.Id, err
+}
+
+func (g *GORMWorkflowDAO) PreemptRun(ctx context.Context, node string, staleBefore int64) (WorkflowRun, error) {
+	db := g.db.WithContext(ctx)
+	for {
+		var run WorkflowRun
+		err := db.Where("status = ? AND update_time < ?", workflowRunRunning, staleBefore).
+			First(&run).Error
+		if err != nil {
+			return run, err
+		}
+		now := time.Now().UnixMilli()
+		res := db.Model(&WorkflowRun{}).
+			Where("id = ? AND version = ?", run.Id, run.Version).
+			Updates(map[string]any{
+				"version":     run.Version + 1,
+				"node":        node,
+				"update_time": now,
+			})
+		if res.Error != nil {
+			return WorkflowRun{}, res.Error
+		}
+		if res.RowsAffected == 0 {
+			// 被别人接手了
+			continue
+		}
+		run.Version++
+		run.Node = node
+		run.UpdateTime = now
+		return run, nil
+	}
+}
+
+func (g *GORMWorkflowDAO) RefreshRun(ctx context.Context, id int64, version int) error {
+	return g.refreshRun(g.db.WithContext(ctx), id, version)
+}
+
+func (g *GORMWorkflowDAO) refreshRun(db *gorm.DB, id int64, version int) error {
+	res := db.Model(&WorkflowRun{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(map[string]any{
+			"update_time": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWorkflowLeaseLost
+	}
+	return nil
+}
+
+func (g *GORMWorkflowDAO) UpdateStep(ctx context.Context, runId int64, version int, step WorkflowStepRun) error {
+	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 先确认执行还是自己的
+		err := g.refreshRun(tx, runId, version)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&WorkflowStepRun{}).
+			Where("id = ?", step.Id).
+			Updates(map[string]any{
+				"status":     step.Status,
+				"attempt":    step.Attempt,
+				"start_time": step.StartTime,
+				"end_time":   step.EndTime,
+				"error":      step.Error,
+			}).Error
+	})
+}
+
+func (g *GORMWorkflowDAO) FinishRun(ctx context.Context, id int64, version int, status uint8, endTime int64) error {
+	res := g.db.WithContext(ctx).
+		Model(&WorkflowRun{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(map[string]any{
+			"status":      status,
+			"end_time":    endTime,
+			"update_time": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWorkflowLeaseLost
+	}
+	return nil
+}
+
+func (g *GORMWorkflowDAO) FindRunById(ctx context.Context, id int64) (WorkflowRun, error) {
+	var res WorkflowRun
+	err := g.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+func (g *GORMWorkflowDAO) ListRuns(ctx context.Context, workflowId int64, offset, limit int) ([]WorkflowRun, error) {
+	var res []WorkflowRun
+	err := g.db.WithContext(ctx).
+		Where("workflow_id = ?", workflowId).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (g *GORMWorkflowDAO) GetSteps(ctx context.Context, runId int64) ([]WorkflowStepRun, error) {
+	var res []WorkflowStepRun
+	err := g.db.WithContext(ctx).
+		Where("run_id = ?", runId).
+		Order("id ASC").
+		Find(&res).Error
+	return res, err
+}
+
+type Workflow struct {
+	Id         int64  `gorm:"primaryKey,autoIncrement"`
+	Name       string `gorm:"type:varchar(128);unique"`
+	Expression string
+	// 节点定义 JSON 格式
+	Steps    string `gorm:"type:text"`
+	Status   int
+	Version  int
+	NextTime int64 `gorm:"index"`
+
+	UpdateTime int64
+	CreateTime int64
+}
+
+type WorkflowRun struct {
+	Id           int64 `gorm:"primaryKey,autoIncrement"`
+	WorkflowId   int64 `gorm:"index"`
+	WorkflowName string
+	Version      int
+	// 正在执行的节点
+	Node   string `gorm:"type:varchar(128)"`
+	Status uint8  `gorm:"index:idx_status_utime"`
+	// 毫秒
+	StartTime int64
+	EndTime   int64
+	// 续约时间
+	UpdateTime int64 `gorm:"index:idx_status_utime"`
+}
+
+type WorkflowStepRun struct {
+	Id        int64  `gorm:"primaryKey,autoIncrement"`
+	RunId     int64  `gorm:"uniqueIndex:uk_run_job"`
+	Job       string `gorm:"type:varchar(128);uniqueIndex:uk_run_job"`
+	Status    uint8
+	Attempt   int
+	StartTime int64
+	EndTime   int64
+	Error     string `gorm:"type:varchar(1024)"`
+}
+
+const (
+	// 和 domain.WorkflowRunStatus 对应
+	workflowRunRunning = 1
+)
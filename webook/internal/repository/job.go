@@ -4,14 +4,37 @@ import (
 	"context"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
 	"time"
 )
 
+var (
+	ErrJobNotFound      = dao.ErrJobNotFound
+	ErrDuplicateJobName = dao.ErrDuplicateJobName
+	ErrJobLeaseLost     = dao.ErrJobLeaseLost
+)
+
 type CronJobRepository interface {
-	Preempt(ctx context.Context) (domain.Job, error)
+	// Preempt 优先级高的先抢 excludeExecutors 的任务留给其他节点
+	Preempt(ctx context.Context, excludeExecutors []string) (domain.Job, error)
+	// CountDue 到了执行时间还在等待的任务 按照优先级计数
+	CountDue(ctx context.Context) (map[int]int64, error)
 	Release(ctx context.Context, jid int64, version int) error
-	UpdateTime(ctx context.Context, id int64) error
+	UpdateTime(ctx context.Context, id int64, version int) error
 	UpdateNextTime(ctx context.Context, id int64, time time.Time) error
+	// Complete 记录执行结果 attempt 是连续失败的次数
+	// nextTime 为零值时不修改下次执行时间
+	Complete(ctx context.Context, job domain.Job, run domain.JobRun, attempt int, nextTime time.Time) error
+
+	Create(ctx context.Context, job domain.Job) (int64, error)
+	Update(ctx context.Context, job domain.Job) error
+	Delete(ctx context.Context, id int64) error
+	FindById(ctx context.Context, id int64) (domain.Job, error)
+	FindByNames(ctx context.Context, names []string) ([]domain.Job, error)
+	List(ctx context.Context, offset, limit int) ([]domain.Job, error)
+	Pause(ctx context.Context, id int64) error
+	Resume(ctx context.Context, id int64, nextTime time.Time) error
+	Trigger(ctx context.Context, id int64, t time.Time) error
 }
 
 type PreemptJobRepository struct {
@@ -22,25 +45,151 @@ func NewPreemptJobRepository(dao dao.JobDAO) CronJobRepository {
 	return &PreemptJobRepository{dao: dao}
 }
 
-func (p *PreemptJobRepository) Preempt(ctx context.Context) (domain.Job, error) {
-	j, err := p.dao.Preempt(ctx)
-	return domain.Job{
-		Id:         j.Id,
-		Version:    j.Version,
-		Expression: j.Expression,
-		Executor:   j.Executor,
-		Name:       j.Name,
-	}, err
+func (p *PreemptJobRepository) Preempt(ctx context.Context, excludeExecutors []string) (domain.Job, error) {
+	j, err := p.dao.Preempt(ctx, excludeExecutors)
+	return p.toDomain(j), err
+}
+
+func (p *PreemptJobRepository) CountDue(ctx context.Context) (map[int]int64, error) {
+	return p.dao.CountDue(ctx)
 }
 
 func (p *PreemptJobRepository) Release(ctx context.Context, jid int64, version int) error {
 	return p.dao.Release(ctx, jid, version)
 }
 
-func (p *PreemptJobRepository) UpdateTime(ctx context.Context, id int64) error {
-	return p.dao.UpdateTime(ctx, id)
+func (p *PreemptJobRepository) UpdateTime(ctx context.Context, id int64, version int) error {
+	return p.dao.UpdateTime(ctx, id, version)
 }
 
 func (p *PreemptJobRepository) UpdateNextTime(ctx context.Context, id int64, time time.Time) error {
 	return p.dao.UpdateNextTime(ctx, id, time)
 }
+
+func (p *PreemptJobRepository) Complete(
+	ctx context.Context,
+	job domain.Job,
+	run domain.JobRun,
+	attempt int,
+	nextTime time.Time,
+) error {
+	return p.dao.Complete(ctx, job.Id, job.Version, dao.JobRun{
+		StartTime: run.StartTime.UnixMilli(),
+		EndTime:   run.EndTime.UnixMilli(),
+		Status:    uint8(run.Status),
+		Error:     run.Error,
+	}, attempt, p.toMillis(nextTime), p.toMillis(job.TriggerTime))
+}
+
+func (p *PreemptJobRepository) Create(ctx context.Context, job domain.Job) (int64, error) {
+	return p.dao.Insert(ctx, p.toEntity(job))
+}
+
+func (p *PreemptJobRepository) Update(ctx context.Context, job domain.Job) error {
+	return p.dao.Update(ctx, p.toEntity(job))
+}
+
+func (p *PreemptJobRepository) Delete(ctx context.Context, id int64) error {
+	return p.dao.Delete(ctx, id)
+}
+
+func (p *PreemptJobRepository) FindById(ctx context.Context, id int64) (domain.Job, error) {
+	j, err := p.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return p.toDomain(j), nil
+}
+
+func (p *PreemptJobRepository) FindByNames(ctx context.Context, names []string) ([]domain.Job, error) {
+	jobs, err := p.dao.FindByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Job, domain.Job](jobs, func(idx int, src dao.Job) domain.Job {
+		return p.toDomain(src)
+	}), nil
+}
+
+func (p *PreemptJobRepository) List(ctx context.Context, offset, limit int) ([]domain.Job, error) {
+	jobs, err := p.dao.List(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Job, domain.Job](jobs, func(idx int, src dao.Job) domain.Job {
+		return p.toDomain(src)
+	}), nil
+}
+
+func (p *PreemptJobRepository) Pause(ctx context.Context, id int64) error {
+	return p.dao.Pause(ctx, id)
+}
+
+func (p *PreemptJobRepository) Resume(ctx context.Context, id int64, nextTime time.Time) error {
+	return p.dao.Resume(ctx, id, nextTime.UnixMilli())
+}
+
+func (p *PreemptJobRepository) Trigger(ctx context.Context, id int64, t time.Time) error {
+	return p.dao.Trigger(ctx, id, t.UnixMilli())
+}
+
+func (p *PreemptJobRepository) toDomain(j dao.Job) domain.Job {
+	return domain.Job{
+		Id:            j.Id,
+		Version:       j.Version,
+		Expression:    j.Expression,
+		Executor:      j.Executor,
+		Name:          j.Name,
+		Config:        j.Config,
+		Status:        domain.JobStatus(j.Status),
+		ScheduledTime: p.toTime(j.NextTime),
+		TriggerTime:   p.toTime(j.TriggerTime),
+		LastRun: domain.JobRun{
+			StartTime: p.toTime(j.LastStartTime),
+			EndTime:   p.toTime(j.LastEndTime),
+			Status:    domain.JobRunStatus(j.LastStatus),
+			Error:     j.LastError,
+		},
+		Attempt:     j.Attempt,
+		Mode:        domain.JobMode(j.Mode),
+		Shards:      j.Shards,
+		Timezone:    j.Timezone,
+		Misfire:     domain.JobMisfirePolicy(j.Misfire),
+		MaxDuration: time.Duration(j.MaxDuration) * time.Millisecond,
+		Priority:    j.Priority,
+		CreateTime:  time.UnixMilli(j.CreateTime),
+		UpdateTime:  time.UnixMilli(j.UpdateTime),
+	}
+}
+
+func (p *PreemptJobRepository) toEntity(j domain.Job) dao.Job {
+	return dao.Job{
+		Id:          j.Id,
+		Name:        j.Name,
+		Executor:    j.Executor,
+		Expression:  j.Expression,
+		Config:      j.Config,
+		Mode:        uint8(j.Mode),
+		Shards:      j.Shards,
+		Timezone:    j.Timezone,
+		Misfire:     uint8(j.Misfire),
+		MaxDuration: j.MaxDuration.Milliseconds(),
+		Priority:    j.Priority,
+		NextTime:    p.toMillis(j.ScheduledTime),
+	}
+}
+
+// toTime 0 表示没有 转换成零值
+func (p *PreemptJobRepository) toTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func (p *PreemptJobRepository) toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+// JobExecutionRepository 任务的执行记录
+type JobExecutionRepository interface {
+	Create(ctx context.Context, run domain.JobRun) (int64, error)
+	Finish(ctx context.Context, run domain.JobRun) error
+	// List jobId 为0时查询所有任务 status 为 JobRunStatusUnknown 时查询所有状态
+	List(ctx context.Context, jobId int64, status domain.JobRunStatus, offset, limit int) ([]domain.JobRun, error)
+}
+
+type DBJobExecutionRepository struct {
+	dao dao.JobExecutionDAO
+}
+
+func NewDBJobExecutionRepository(dao dao.JobExecutionDAO) JobExecutionRepository {
+	return &DBJobExecutionRepository{dao: dao}
+}
+
+func (d *DBJobExecutionRepository) Create(ctx context.Context, run domain.JobRun) (int64, error) {
+	return d.dao.Insert(ctx, dao.JobExecution{
+		JobId:     run.JobId,
+		JobName:   run.JobName,
+		Node:      run.Node,
+		Attempt:   run.Attempt,
+		TaskId:    run.TaskId,
+		Shard:     run.Shard,
+		StartTime: run.StartTime.UnixMilli(),
+		Status:    uint8(run.Status),
+	})
+}
+
+func (d *DBJobExecutionRepository) Finish(ctx context.Context, run domain.JobRun) error {
+	return d.dao.Finish(ctx, run.Id, run.EndTime.UnixMilli(), uint8(run.Status), run.Error)
+}
+
+func (d *DBJobExecutionRepository) List(
+	ctx context.Context,
+	jobId int64,
+	status domain.JobRunStatus,
+	offset, limit int,
+) ([]domain.JobRun, error) {
+	executions, err := d.dao.List(ctx, jobId, uint8(status), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.JobExecution, domain.JobRun](
+		executions,
+		func(idx int, src dao.JobExecution) domain.JobRun {
+			run := domain.JobRun{
+				Id:        src.Id,
+				JobId:     src.JobId,
+				JobName:   src.JobName,
+				Node:      src.Node,
+				Attempt:   src.Attempt,
+				TaskId:    src.TaskId,
+				Shard:     src.Shard,
+				StartTime: time.UnixMilli(src.StartTime),
+				Status:    domain.JobRunStatus(src.Status),
+				Error:     src.Error,
+			}
+			// 还没有结束
+			if src.EndTime > 0 {
+				run.EndTime = time.UnixMilli(src.EndTime)
+			}
+			return run
+		},
+	), nil
+}
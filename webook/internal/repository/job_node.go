@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+// JobNodeRepository 调度器节点的注册表
+type JobNodeRepository interface {
+	Heartbeat(ctx context.Context, name string) error
+	Delete(ctx context.Context, name string) error
+	// FindAlive since 之后有心跳的节点
+	FindAlive(ctx context.Context, since time.Time) ([]domain.JobNode, error)
+}
+
+type DBJobNodeRepository struct {
+	dao dao.JobNodeDAO
+}
+
+func NewDBJobNodeRepository(dao dao.JobNodeDAO) JobNodeRepository {
+	return &DBJobNodeRepository{dao: dao}
+}
+
+func (d *DBJobNodeRepository) Heartbeat(ctx context.Context, name string) error {
+	return d.dao.Heartbeat(ctx, name)
+}
+
+func (d *DBJobNodeRepository) Delete(ctx context.Context, name string) error {
+	return d.dao.Delete(ctx, name)
+}
+
+func (d *DBJobNodeRepository) FindAlive(ctx context.Context, since time.Time) ([]domain.JobNode, error) {
+	nodes, err := d.dao.FindAlive(ctx, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.JobNode, domain.JobNode](nodes, func(idx int, src dao.JobNode) domain.JobNode {
+		return domain.JobNode{
+			Name:          src.Name,
+			StartTime:     time.UnixMilli(src.StartTime),
+			HeartbeatTime: time.UnixMilli(src.HeartbeatTime),
+		}
+	}), nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+var ErrJobTaskNotFound = dao.ErrJobTaskNotFound
+
+// JobTaskRepository 广播和分片任务的子任务
+type JobTaskRepository interface {
+	Create(ctx context.Context, tasks []domain.JobTask) error
+	// Preempt excludeJobIds 是本节点已经达到并发上限的任务
+	Preempt(ctx context.Context, node string, excludeJobIds []int64) (domain.JobTask, error)
+	UpdateTime(ctx context.Context, id int64, version int) error
+	Release(ctx context.Context, task domain.JobTask) error
+	// Complete 状态是 JobTaskStatusWaiting 时会在 nextTime 重试
+	Complete(ctx context.Context, task domain.JobTask, status domain.JobTaskStatus, attempt int, nextTime time.Time) error
+	CancelBefore(ctx context.Context, jid int64, tick time.Time) error
+}
+
+type DBJobTaskRepository struct {
+	dao dao.JobTaskDAO
+}
+
+func NewDBJobTaskRepository(dao dao.JobTaskDAO) JobTaskRepository {
+	return &DBJobTaskRepository{dao: dao}
+}
+
+func (d *DBJobTaskRepository) Create(ctx context.Context, tasks []domain.JobTask) error {
+	return d.dao.Insert(ctx, slice.Map[domain.JobTask, dao.JobTask](
+		tasks,
+		func(idx int, src domain.JobTask) dao.JobTask {
+			return dao.JobTask{
+				JobId:    src.JobId,
+				Tick:     src.Tick.UnixMilli(),
+				Shard:    src.Shard,
+				Shards:   src.Shards,
+				Node:     src.Node,
+				NextTime: src.NextTime.UnixMilli(),
+			}
+		},
+	))
+}
+
+func (d *DBJobTaskRepository) Preempt(ctx context.Context, node string, excludeJobIds []int64) (domain.JobTask, error) {
+	task, err := d.dao.Preempt(ctx, node, excludeJobIds)
+	if err != nil {
+		return domain.JobTask{}, err
+	}
+	return domain.JobTask{
+		Id:       task.Id,
+		JobId:    task.JobId,
+		Tick:     time.UnixMilli(task.Tick),
+		Shard:    task.Shard,
+		Shards:   task.Shards,
+		Node:     task.Node,
+		Status:   domain.JobTaskStatus(task.Status),
+		Version:  task.Version,
+		Attempt:  task.Attempt,
+		NextTime: time.UnixMilli(task.NextTime),
+	}, nil
+}
+
+func (d *DBJobTaskRepository) UpdateTime(ctx context.Context, id int64, version int) error {
+	return d.dao.UpdateTime(ctx, id, version)
+}
+
+func (d *DBJobTaskRepository) Release(ctx context.Context, task domain.JobTask) error {
+	return d.dao.Release(ctx, task.Id, task.Version)
+}
+
+func (d *DBJobTaskRepository) Complete(
+	ctx context.Context,
+	task domain.JobTask,
+	status domain.JobTaskStatus,
+	attempt int,
+	nextTime time.Time,
+) error {
+	var next int64
+	if !nextTime.IsZero() {
+		next = nextTime.UnixMilli()
+	}
+	return d.dao.Complete(ctx, task.Id, task.Version, uint8(status), attempt, next)
+}
+
+func (d *DBJobTaskRepository) CancelBefore(ctx context.Context, jid int64, tick time.Time) error {
+	return d.dao.CancelBefore(ctx, jid, tick.UnixMilli())
+}
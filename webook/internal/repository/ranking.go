@@ -2,11 +2,15 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
 )
 
+var ErrStaleFencingToken = cache.ErrStaleFencingToken
+
 type RankingRepository interface {
+	// ReplaceTopN ctx 里带着 fencing token 时 过期的持有者返回 ErrStaleFencingToken
 	ReplaceTopN(ctx context.Context, arts []domain.Article) error
 	GetTopN(ctx context.Context) ([]domain.Article, error)
 }
@@ -49,9 +53,14 @@ func NewCachedDoubleRankingRepository(
 }
 
 func (c *CachedDoubleRankingRepository) ReplaceTopN(ctx context.Context, arts []domain.Article) error {
+	err := c.redisCache.Set(ctx, arts)
+	if errors.Is(err, ErrStaleFencingToken) {
+		// 过期的榜单也不能写到本地缓存
+		return err
+	}
 	// 本地缓存基本不可能出错
 	_ = c.localCache.Set(ctx, arts)
-	return c.redisCache.Set(ctx, arts)
+	return err
 }
 
 func (c *CachedDoubleRankingRepository) GetTopN(ctx context.Context) ([]domain.Article, error) {
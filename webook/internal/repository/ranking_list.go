@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+	"time"
+)
+
+// RankingListOption 命名榜单的缓存配置
+type RankingListOption struct {
+	// redis 的过期时间
+	Expiration time.Duration
+	// 本地缓存的过期时间 为0时不使用本地缓存
+	LocalExpiration time.Duration
+}
+
+// RankingListRepository 命名榜单
+// group 是榜单内的分组 例如按作者分组时是作者id 不分组时为空
+type RankingListRepository interface {
+	ReplaceTopN(ctx context.Context, name string, group string, arts []domain.Article) error
+	GetTopN(ctx context.Context, name string, group string) ([]domain.Article, error)
+}
+
+type CachedRankingListRepository struct {
+	redisCache cache.RankingListCache
+	localCache *cache.LocalRankingListCache
+	opts       map[string]RankingListOption
+}
+
+func NewCachedRankingListRepository(
+	redisCache cache.RankingListCache,
+	localCache *cache.LocalRankingListCache,
+	opts map[string]RankingListOption,
+) RankingListRepository {
+	return &CachedRankingListRepository{
+		redisCache: redisCache,
+		localCache: localCache,
+		opts:       opts,
+	}
+}
+
+func (c *CachedRankingListRepository) ReplaceTopN(
+	ctx context.Context,
+	name string,
+	group string,
+	arts []domain.Article,
+) error {
+	opt := c.opts[name]
+	key := c.key(name, group)
+	if opt.LocalExpiration > 0 {
+		// 本地缓存基本不可能出错 榜单太多时淘汰最久没有用过的
+		_ = c.localCache.Set(ctx, key, arts, opt.LocalExpiration)
+	}
+	return c.redisCache.Set(ctx, key, arts, opt.Expiration)
+}
+
+// GetTopN 和 CachedDoubleRankingRepository 一样
+// 先查本地缓存 再查 redis 都失败时强制使用本地缓存
+func (c *CachedRankingListRepository) GetTopN(
+	ctx context.Context,
+	name string,
+	group string,
+) ([]domain.Article, error) {
+	opt := c.opts[name]
+	key := c.key(name, group)
+	if opt.LocalExpiration <= 0 {
+		return c.redisCache.Get(ctx, key)
+	}
+
+	res, err := c.localCache.Get(ctx, key)
+	if err == nil {
+		return res, nil
+	}
+	res, err = c.redisCache.Get(ctx, key)
+	if err != nil {
+		return c.localCache.ForceGet(ctx, key)
+	}
+
+	// 回写本地缓存
+	_ = c.localCache.Set(ctx, key, res, opt.LocalExpiration)
+	return res, nil
+}
+
+func (c *CachedRankingListRepository) key(name string, group string) string {
+	if group == "" {
+		return name
+	}
+	return fmt.Sprintf("%s:%s", name, group)
+}
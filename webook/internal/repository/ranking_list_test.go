@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// memoryRankingListCache 代替 redis 可以模拟 redis 出错
+type memoryRankingListCache struct {
+	lists map[string][]domain.Article
+	err   error
+}
+
+func (m *memoryRankingListCache) Set(ctx context.Context, list string, arts []domain.Article, expiration time.Duration) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.lists[list] = arts
+	return nil
+}
+
+func (m *memoryRankingListCache) Get(ctx context.Context, list string) ([]domain.Article, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	arts, ok := m.lists[list]
+	if !ok {
+		return nil, errors.New("key 不存在")
+	}
+	return arts, nil
+}
+
+func TestCachedRankingListRepository_GetTopN(t *testing.T) {
+	ctx := context.Background()
+	arts := func(id int64) []domain.Article {
+		return []domain.Article{{Id: id}}
+	}
+	testCases := []struct {
+		name string
+		// 本地缓存的过期时间
+		local time.Duration
+		// 发布之后 redis 里的榜单换成了其他节点发布的
+		redisArts []domain.Article
+		redisErr  error
+		// 等本地缓存过期
+		wait bool
+
+		wantArts []domain.Article
+		wantErr  bool
+	}{
+		{
+			name:      "不使用本地缓存",
+			redisArts: arts(2),
+			wantArts:  arts(2),
+		},
+		{
+			name:      "本地缓存没有过期",
+			local:     time.Minute,
+			redisArts: arts(2),
+			wantArts:  arts(1),
+		},
+		{
+			name:      "本地缓存过期了查 redis",
+			local:     time.Millisecond,
+			redisArts: arts(2),
+			wait:      true,
+			wantArts:  arts(2),
+		},
+		{
+			name:     "redis 出错时用过期的本地缓存",
+			local:    time.Millisecond,
+			redisErr: errors.New("模拟的 redis 错误"),
+			wait:     true,
+			wantArts: arts(1),
+		},
+		{
+			name:     "不使用本地缓存时 redis 出错",
+			redisErr: errors.New("模拟的 redis 错误"),
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redisCache := &memoryRankingListCache{lists: map[string][]domain.Article{}}
+			repo := NewCachedRankingListRepository(redisCache, cache.NewLocalRankingListCache(16),
+				map[string]RankingListOption{"author": {Expiration: time.Minute, LocalExpiration: tc.local}})
+			require.NoError(t, repo.ReplaceTopN(ctx, "author", "1", arts(1)))
+			assert.Equal(t, arts(1), redisCache.lists["author:1"])
+
+			if tc.redisArts != nil {
+				redisCache.lists["author:1"] = tc.redisArts
+			}
+			redisCache.err = tc.redisErr
+			if tc.wait {
+				time.Sleep(time.Millisecond * 5)
+			}
+			res, err := repo.GetTopN(ctx, "author", "1")
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantArts, res)
+		})
+	}
+}
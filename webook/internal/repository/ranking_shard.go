@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+)
+
+// RankingShardRepository 分片计算热榜的中间结果
+type RankingShardRepository interface {
+	SavePartial(ctx context.Context, round int64, shard int, arts []domain.ScoredArticle) error
+	GetPartials(ctx context.Context, round int64, shards int) (map[int][]domain.ScoredArticle, error)
+	IsMerged(ctx context.Context, round int64) (bool, error)
+	MarkMerged(ctx context.Context, round int64) error
+}
+
+type CachedRankingShardRepository struct {
+	cache cache.RankingShardCache
+}
+
+func NewCachedRankingShardRepository(cache cache.RankingShardCache) RankingShardRepository {
+	return &CachedRankingShardRepository{cache: cache}
+}
+
+func (c *CachedRankingShardRepository) SavePartial(
+	ctx context.Context,
+	round int64,
+	shard int,
+	arts []domain.ScoredArticle,
+) error {
+	return c.cache.SetPartial(ctx, round, shard, arts)
+}
+
+func (c *CachedRankingShardRepository) GetPartials(
+	ctx context.Context,
+	round int64,
+	shards int,
+) (map[int][]domain.ScoredArticle, error) {
+	return c.cache.GetPartials(ctx, round, shards)
+}
+
+func (c *CachedRankingShardRepository) IsMerged(ctx context.Context, round int64) (bool, error) {
+	return c.cache.IsMerged(ctx, round)
+}
+
+func (c *CachedRankingShardRepository) MarkMerged(ctx context.Context, round int64) error {
+	return c.cache.MarkMerged(ctx, round)
+}
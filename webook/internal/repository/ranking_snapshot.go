@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+var (
+	ErrRankingSnapshotNotFound  = dao.ErrRankingSnapshotNotFound
+	ErrDuplicateRankingSnapshot = dao.ErrDuplicateRankingSnapshot
+)
+
+// RankingSnapshotRepository 榜单的历史快照
+type RankingSnapshotRepository interface {
+	// Save 同一个榜单同一个时间段的快照已经存在时返回 ErrDuplicateRankingSnapshot
+	Save(ctx context.Context, snapshot domain.RankingSnapshot) (int64, error)
+	// LatestTime 最近一次快照的时间 没有快照时返回 ErrRankingSnapshotNotFound
+	LatestTime(ctx context.Context, name string) (time.Time, error)
+	// AsOf t 时刻正在展示的榜单 也就是 t 之前的最后一个快照
+	AsOf(ctx context.Context, name string, t time.Time) (domain.RankingSnapshot, error)
+	// ListByRange 只有快照本身 不包含榜单内容
+	ListByRange(ctx context.Context, name string, start, end time.Time, limit int) ([]domain.RankingSnapshot, error)
+	// ArticleItems 文章在这些快照中的名次 key 是快照id 不在榜上的快照没有对应的 key
+	ArticleItems(ctx context.Context, snapshotIds []int64, aid int64) (map[int64]domain.RankingSnapshotItem, error)
+	DeleteBefore(ctx context.Context, t time.Time, limit int) (int64, error)
+}
+
+type DBRankingSnapshotRepository struct {
+	dao dao.RankingSnapshotDAO
+}
+
+func NewDBRankingSnapshotRepository(dao dao.RankingSnapshotDAO) RankingSnapshotRepository {
+	return &DBRankingSnapshotRepository{dao: dao}
+}
+
+func (d *DBRankingSnapshotRepository) Save(ctx context.Context, snapshot domain.RankingSnapshot) (int64, error) {
+	items := slice.Map[domain.RankingSnapshotItem, dao.RankingSnapshotItem](
+		snapshot.Items,
+		func(idx int, src domain.RankingSnapshotItem) dao.RankingSnapshotItem {
+			return dao.RankingSnapshotItem{
+				ArticleId: src.ArticleId,
+				Position:  src.Position,
+				Score:     src.Score,
+			}
+		},
+	)
+	return d.dao.Insert(ctx, dao.RankingSnapshot{
+		Name:   snapshot.Name,
+		Ctime:  snapshot.Ctime.UnixMilli(),
+		Bucket: snapshot.Bucket,
+	}, items)
+}
+
+func (d *DBRankingSnapshotRepository) LatestTime(ctx context.Context, name string) (time.Time, error) {
+	snapshot, err := d.dao.Latest(ctx, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(snapshot.Ctime), nil
+}
+
+func (d *DBRankingSnapshotRepository) AsOf(ctx context.Context, name string, t time.Time) (domain.RankingSnapshot, error) {
+	snapshot, err := d.dao.LatestBefore(ctx, name, t.UnixMilli())
+	if err != nil {
+		return domain.RankingSnapshot{}, err
+	}
+	items, err := d.dao.GetItems(ctx, snapshot.Id)
+	if err != nil {
+		return domain.RankingSnapshot{}, err
+	}
+	res := d.toDomain(snapshot)
+	res.Items = slice.Map[dao.RankingSnapshotItem, domain.RankingSnapshotItem](
+		items,
+		func(idx int, src dao.RankingSnapshotItem) domain.RankingSnapshotItem {
+			return d.itemToDomain(src)
+		},
+	)
+	return res, nil
+}
+
+func (d *DBRankingSnapshotRepository) ListByRange(
+	ctx context.Context,
+	name string,
+	start, end time.Time,
+	limit int,
+) ([]domain.RankingSnapshot, error) {
+	snapshots, err := d.dao.ListByRange(ctx, name, start.UnixMilli(), end.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.RankingSnapshot, domain.RankingSnapshot](
+		snapshots,
+		func(idx int, src dao.RankingSnapshot) domain.RankingSnapshot {
+			return d.toDomain(src)
+		},
+	), nil
+}
+
+func (d *DBRankingSnapshotRepository) ArticleItems(
+	ctx context.Context,
+	snapshotIds []int64,
+	aid int64,
+) (map[int64]domain.RankingSnapshotItem, error) {
+	items, err := d.dao.GetArticleItems(ctx, snapshotIds, aid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]domain.RankingSnapshotItem, len(items))
+	for _, item := range items {
+		res[item.SnapshotId] = d.itemToDomain(item)
+	}
+	return res, nil
+}
+
+func (d *DBRankingSnapshotRepository) DeleteBefore(ctx context.Context, t time.Time, limit int) (int64, error) {
+	return d.dao.DeleteBefore(ctx, t.UnixMilli(), limit)
+}
+
+func (d *DBRankingSnapshotRepository) toDomain(snapshot dao.RankingSnapshot) domain.RankingSnapshot {
+	return domain.RankingSnapshot{
+		Id:     snapshot.Id,
+		Name:   snapshot.Name,
+		Ctime:  time.UnixMilli(snapshot.Ctime),
+		Bucket: snapshot.Bucket,
+	}
+}
+
+func (d *DBRankingSnapshotRepository) itemToDomain(item dao.RankingSnapshotItem) domain.RankingSnapshotItem {
+	return domain.RankingSnapshotItem{
+		ArticleId: item.ArticleId,
+		Position:  item.Position,
+		Score:     item.Score,
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
+	"time"
+)
+
+// StreamRankingRepository 实时榜单的分数
+// 和 RankingRepository 不同 这里只有文章id和分数
+type StreamRankingRepository interface {
+	IncrScore(ctx context.Context, aid int64, weight float64, t time.Time) error
+	Rebase(ctx context.Context, now time.Time) error
+	// TopN 只有文章id和分数
+	TopN(ctx context.Context, n int) ([]domain.ScoredArticle, error)
+	Reset(ctx context.Context, scores map[int64]float64, epoch time.Time) error
+}
+
+type CachedStreamRankingRepository struct {
+	cache cache.StreamRankingCache
+}
+
+func NewCachedStreamRankingRepository(cache cache.StreamRankingCache) StreamRankingRepository {
+	return &CachedStreamRankingRepository{cache: cache}
+}
+
+func (c *CachedStreamRankingRepository) IncrScore(ctx context.Context, aid int64, weight float64, t time.Time) error {
+	return c.cache.IncrScore(ctx, aid, weight, t)
+}
+
+func (c *CachedStreamRankingRepository) Rebase(ctx context.Context, now time.Time) error {
+	return c.cache.Rebase(ctx, now)
+}
+
+func (c *CachedStreamRankingRepository) TopN(ctx context.Context, n int) ([]domain.ScoredArticle, error) {
+	return c.cache.TopN(ctx, n)
+}
+
+func (c *CachedStreamRankingRepository) Reset(ctx context.Context, scores map[int64]float64, epoch time.Time) error {
+	return c.cache.Reset(ctx, scores, epoch)
+}
@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+var (
+	ErrWorkflowNotFound      = dao.ErrWorkflowNotFound
+	ErrDuplicateWorkflowName = dao.ErrDuplicateWorkflowName
+	ErrWorkflowPreempted     = dao.ErrWorkflowPreempted
+	ErrWorkflowLeaseLost     = dao.ErrWorkflowLeaseLost
+)
+
+type WorkflowRepository interface {
+	Create(ctx context.Context, w domain.Workflow) (int64, error)
+	Update(ctx context.Context, w domain.Workflow) error
+	Delete(ctx context.Context, id int64) error
+	FindById(ctx context.Context, id int64) (domain.Workflow, error)
+	List(ctx context.Context, offset, limit int) ([]domain.Workflow, error)
+
+	FindDue(ctx context.Context, now time.Time) (domain.Workflow, error)
+	// CreateRun 上一次执行还没有结束时不创建 返回的 id 为0
+	CreateRun(ctx context.Context, w domain.Workflow, nextTime time.Time, run domain.WorkflowRun) (int64, error)
+	PreemptRun(ctx context.Context, node string, staleBefore time.Time) (domain.WorkflowRun, error)
+	RefreshRun(ctx context.Context, id int64, version int) error
+	UpdateStep(ctx context.Context, run domain.WorkflowRun, step domain.WorkflowStepRun) error
+	FinishRun(ctx context.Context, run domain.WorkflowRun) error
+	// FindRunById 包括所有节点的状态
+	FindRunById(ctx context.Context, id int64) (domain.WorkflowRun, error)
+	// ListRuns 不包括节点的状态
+	ListRuns(ctx context.Context, workflowId int64, offset, limit int) ([]domain.WorkflowRun, error)
+}
+
+type DBWorkflowRepository struct {
+	dao dao.WorkflowDAO
+}
+
+func NewDBWorkflowRepository(dao dao.WorkflowDAO) WorkflowRepository {
+	return &DBWorkflowRepository{dao: dao}
+}
+
+func (d *DBWorkflowRepository) Create(ctx context.Context, w domain.Workflow) (int64, error) {
+	entity, err := d.toEntity(w)
+	if err != nil {
+		return 0, err
+	}
+	return d.dao.Insert(ctx, entity)
+}
+
+func (d *DBWorkflowRepository) Update(ctx context.Context, w domain.Workflow) error {
+	entity, err := d.toEntity(w)
+	if err != nil {
+		return err
+	}
+	return d.dao.Update(ctx, entity)
+}
+
+func (d *DBWorkflowRepository) Delete(ctx context.Context, id int64) error {
+	return d.dao.Delete(ctx, id)
+}
+
+func (d *DBWorkflowRepository) FindById(ctx context.Context, id int64) (domain.Workflow, error) {
+	w, err := d.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Workflow{}, err
+	}
+	return d.toDomain(w)
+}
+
+func (d *DBWorkflowRepository) List(ctx context.Context, offset, limit int) ([]domain.Workflow, error) {
+	ws, err := d.dao.List(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Workflow, 0, len(ws))
+	for _, w := range ws {
+		dw, err := d.toDomain(w)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, dw)
+	}
+	return res, nil
+}
+
+func (d *DBWorkflowRepository) FindDue(ctx context.Context, now time.Time) (domain.Workflow, error) {
+	w, err := d.dao.FindDue(ctx, now.UnixMilli())
+	if err != nil {
+		return domain.Workflow{}, err
+	}
+	return d.toDomain(w)
+}
+
+func (d *DBWorkflowRepository) CreateRun(
+	ctx context.Context,
+	w domain.Workflow,
+	nextTime time.Time,
+	run domain.WorkflowRun,
+) (int64, error) {
+	steps := slice.Map[domain.WorkflowStepRun, dao.WorkflowStepRun](
+		run.Steps,
+		func(idx int, src domain.WorkflowStepRun) dao.WorkflowStepRun {
+			return d.toStepEntity(src)
+		},
+	)
+	return d.dao.CreateRun(ctx, dao.Workflow{Id: w.Id, Version: w.Version}, nextTime.UnixMilli(), dao.WorkflowRun{
+		WorkflowId:   run.WorkflowId,
+		WorkflowName: run.WorkflowName,
+		Version:      run.Version,
+		Node:         run.Node,
+		StartTime:    run.StartTime.UnixMilli(),
+	}, steps)
+}
+
+func (d *DBWorkflowRepository) PreemptRun(
+	ctx context.Context,
+	node string,
+	staleBefore time.Time,
+) (domain.WorkflowRun, error) {
+	run, err := d.dao.PreemptRun(ctx, node, staleBefore.UnixMilli())
+	if err != nil {
+		return domain.WorkflowRun{}, err
+	}
+	return d.withSteps(ctx, run)
+}
+
+func (d *DBWorkflowRepository) RefreshRun(ctx context.Context, id int64, version int) error {
+	return d.dao.RefreshRun(ctx, id, version)
+}
+
+func (d *DBWorkflowRepository) UpdateStep(
+	ctx context.Context,
+	run domain.WorkflowRun,
+	step domain.WorkflowStepRun,
+) error {
+	return d.dao.UpdateStep(ctx, run.Id, run.Version, d.toStepEntity(step))
+}
+
+func (d *DBWorkflowRepository) FinishRun(ctx context.Context, run domain.WorkflowRun) error {
+	return d.dao.FinishRun(ctx, run.Id, run.Version, uint8(run.Status), run.EndTime.UnixMilli())
+}
+
+func (d *DBWorkflowRepository) FindRunById(ctx context.Context, id int64) (domain.WorkflowRun, error) {
+	run, err := d.dao.FindRunById(ctx, id)
+	if err != nil {
+		return domain.WorkflowRun{}, err
+	}
+	return d.withSteps(ctx, run)
+}
+
+func (d *DBWorkflowRepository) ListRuns(
+	ctx context.Context,
+	workflowId int64,
+	offset, limit int,
+) ([]domain.WorkflowRun, error) {
+	runs, err := d.dao.ListRuns(ctx, workflowId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.WorkflowRun, domain.WorkflowRun](runs, func(idx int, src dao.WorkflowRun) domain.WorkflowRun {
+		return d.toRunDomain(src)
+	}), nil
+}
+
+func (d *DBWorkflowRepository) withSteps(ctx context.Context, run dao.WorkflowRun) (domain.WorkflowRun, error) {
+	steps, err := d.dao.GetSteps(ctx, run.Id)
+	if err != nil {
+		return domain.WorkflowRun{}, err
+	}
+	res := d.toRunDomain(run)
+	res.Steps = slice.Map[dao.WorkflowStepRun, domain.WorkflowStepRun](
+		steps,
+		func(idx int, src dao.WorkflowStepRun) domain.WorkflowStepRun {
+			return domain.WorkflowStepRun{
+				Id:        src.Id,
+				Job:       src.Job,
+				Status:    domain.WorkflowStepStatus(src.Status),
+				Attempt:   src.Attempt,
+				StartTime: d.toTime(src.StartTime),
+				EndTime:   d.toTime(src.EndTime),
+				Error:     src.Error,
+			}
+		},
+	)
+	return res, nil
+}
+
+func (d *DBWorkflowRepository) toRunDomain(run dao.WorkflowRun) domain.WorkflowRun {
+	return domain.WorkflowRun{
+		Id:           run.Id,
+		WorkflowId:   run.WorkflowId,
+		WorkflowName: run.WorkflowName,
+		Version:      run.Version,
+		Node:         run.Node,
+		Status:       domain.WorkflowRunStatus(run.Status),
+		StartTime:    d.toTime(run.StartTime),
+		EndTime:      d.toTime(run.EndTime),
+	}
+}
+
+func (d *DBWorkflowRepository) toStepEntity(step domain.WorkflowStepRun) dao.WorkflowStepRun {
+	res := dao.WorkflowStepRun{
+		Id:      step.Id,
+		Job:     step.Job,
+		Status:  uint8(step.Status),
+		Attempt: step.Attempt,
+		Error:   step.Error,
+	}
+	if !step.StartTime.IsZero() {
+		res.StartTime = step.StartTime.UnixMilli()
+	}
+	if !step.EndTime.IsZero() {
+		res.EndTime = step.EndTime.UnixMilli()
+	}
+	return res
+}
+
+// workflowStep 数据库里保存的节点定义 时间都是毫秒
+type workflowStep struct {
+	Job       string         `json:"job"`
+	Depends   []string       `json:"depends,omitempty"`
+	OnFailure string         `json:"onFailure,omitempty"`
+	Retry     *workflowRetry `json:"retry,omitempty"`
+}
+
+type workflowRetry struct {
+	MaxAttempts     int     `json:"maxAttempts"`
+	InitialInterval int64   `json:"initialInterval"`
+	MaxInterval     int64   `json:"maxInterval"`
+	Multiplier      float64 `json:"multiplier"`
+}
+
+func (d *DBWorkflowRepository) toEntity(w domain.Workflow) (dao.Workflow, error) {
+	steps := make([]workflowStep, 0, len(w.Steps))
+	for _, step := range w.Steps {
+		s := workflowStep{
+			Job:       step.Job,
+			Depends:   step.Depends,
+			OnFailure: string(step.OnFailure),
+		}
+		if step.OnFailure == domain.WorkflowFailureRetry {
+			s.Retry = &workflowRetry{
+				MaxAttempts:     step.Retry.MaxAttempts,
+				InitialInterval: step.Retry.InitialInterval.Milliseconds(),
+				MaxInterval:     step.Retry.MaxInterval.Milliseconds(),
+				Multiplier:      step.Retry.Multiplier,
+			}
+		}
+		steps = append(steps, s)
+	}
+	val, err := json.Marshal(steps)
+	if err != nil {
+		return dao.Workflow{}, err
+	}
+	res := dao.Workflow{
+		Id:         w.Id,
+		Name:       w.Name,
+		Expression: w.Expression,
+		Steps:      string(val),
+	}
+	if !w.ScheduledTime.IsZero() {
+		res.NextTime = w.ScheduledTime.UnixMilli()
+	}
+	return res, nil
+}
+
+func (d *DBWorkflowRepository) toDomain(w dao.Workflow) (domain.Workflow, error) {
+	var steps []workflowStep
+	err := json.Unmarshal([]byte(w.Steps), &steps)
+	if err != nil {
+		return domain.Workflow{}, err
+	}
+	res := domain.Workflow{
+		Id:            w.Id,
+		Name:          w.Name,
+		Expression:    w.Expression,
+		Status:        domain.JobStatus(w.Status),
+		Version:       w.Version,
+		ScheduledTime: d.toTime(w.NextTime),
+		CreateTime:    time.UnixMilli(w.CreateTime),
+		UpdateTime:    time.UnixMilli(w.UpdateTime),
+		Steps:         make([]domain.WorkflowStep, 0, len(steps)),
+	}
+	for _, step := range steps {
+		s := domain.WorkflowStep{
+			Job:       step.Job,
+			Depends:   step.Depends,
+			OnFailure: domain.WorkflowFailurePolicy(step.OnFailure),
+		}
+		if step.Retry != nil {
+			s.Retry = domain.JobRetryPolicy{
+				MaxAttempts:     step.Retry.MaxAttempts,
+				InitialInterval: time.Duration(step.Retry.InitialInterval) * time.Millisecond,
+				MaxInterval:     time.Duration(step.Retry.MaxInterval) * time.Millisecond,
+				Multiplier:      step.Retry.Multiplier,
+			}
+		}
+		res.Steps = append(res.Steps, s)
+	}
+	return res, nil
+}
+
+func (d *DBWorkflowRepository) toTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
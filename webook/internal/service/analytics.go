@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"sort"
+	"time"
+)
+
+type AnalyticsService interface {
+	// AuthorTrend 作者所有文章在 [start, end] 之间每天的数据 精度为天
+	AuthorTrend(ctx context.Context, uid int64, start, end time.Time, topN int) (domain.AuthorAnalytics, error)
+}
+
+type analyticsService struct {
+	artSvc  ArticleService
+	intrSvc interactivev1.InteractiveServiceClient
+	biz     string
+	// 分批查询作者的文章和快照
+	batchSize int
+}
+
+func NewAnalyticsService(artSvc ArticleService, intrSvc interactivev1.InteractiveServiceClient) AnalyticsService {
+	return &analyticsService{
+		artSvc:    artSvc,
+		intrSvc:   intrSvc,
+		biz:       domain.BizArticle,
+		batchSize: 100,
+	}
+}
+
+func (a *analyticsService) AuthorTrend(
+	ctx context.Context,
+	uid int64,
+	start, end time.Time,
+	topN int,
+) (domain.AuthorAnalytics, error) {
+	start = a.truncateDay(start)
+	end = a.truncateDay(end)
+	days := a.days(start, end)
+	res := domain.AuthorAnalytics{
+		Start:    start,
+		End:      end,
+		Total:    make([]domain.DailyStat, len(days)),
+		Articles: []domain.ArticleTrend{},
+	}
+	if len(days) == 0 {
+		return res, nil
+	}
+	for idx, day := range days {
+		res.Total[idx].Day = day
+	}
+
+	offset := 0
+	for {
+		arts, err := a.artSvc.GetByAuthor(ctx, uid, offset, a.batchSize)
+		if err != nil {
+			return domain.AuthorAnalytics{}, err
+		}
+		if len(arts) == 0 {
+			break
+		}
+		trends, err := a.articleTrends(ctx, arts, days)
+		if err != nil {
+			return domain.AuthorAnalytics{}, err
+		}
+		for _, trend := range trends {
+			for idx, stat := range trend.Stats {
+				a.accumulate(&res.Total[idx], stat)
+			}
+		}
+		res.Articles = append(res.Articles, trends...)
+		if len(arts) < a.batchSize {
+			break
+		}
+		offset += len(arts)
+	}
+
+	res.TopArticles = a.top(res.Articles, topN)
+	return res, nil
+}
+
+// articleTrends
+// 多查前一天的快照用于计算第一天的增量
+// 某一天没有快照时沿用之前的累计值 文章发表之前的都按0处理
+func (a *analyticsService) articleTrends(
+	ctx context.Context,
+	arts []domain.Article,
+	days []time.Time,
+) ([]domain.ArticleTrend, error) {
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.Id)
+	}
+	prev := days[0].AddDate(0, 0, -1)
+	resp, err := a.intrSvc.GetSnapshots(ctx, &interactivev1.GetSnapshotsRequest{
+		Biz:    a.biz,
+		BizIds: ids,
+		Start:  prev.UnixMilli(),
+		End:    days[len(days)-1].UnixMilli(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 文章id -> 日期 -> 快照
+	snapshots := make(map[int64]map[int64]*interactivev1.InteractiveSnapshot, len(arts))
+	for _, s := range resp.GetSnapshots() {
+		byDay, ok := snapshots[s.GetBizId()]
+		if !ok {
+			byDay = make(map[int64]*interactivev1.InteractiveSnapshot)
+			snapshots[s.GetBizId()] = byDay
+		}
+		byDay[s.GetDay()] = s
+	}
+
+	trends := make([]domain.ArticleTrend, 0, len(arts))
+	for _, art := range arts {
+		byDay := snapshots[art.Id]
+		var last domain.DailyStat
+		if s, ok := byDay[prev.UnixMilli()]; ok {
+			last = a.toStat(prev, s)
+		}
+		trend := domain.ArticleTrend{
+			Article: domain.Article{Id: art.Id, Title: art.Title},
+			Stats:   make([]domain.DailyStat, 0, len(days)),
+		}
+		for _, day := range days {
+			stat := last
+			stat.Day = day
+			if s, ok := byDay[day.UnixMilli()]; ok {
+				stat = a.toStat(day, s)
+			}
+			stat.ReadDelta = stat.ReadCnt - last.ReadCnt
+			stat.LikeDelta = stat.LikeCnt - last.LikeCnt
+			stat.CollectDelta = stat.CollectCnt - last.CollectCnt
+			trend.ReadGain += stat.ReadDelta
+			trend.LikeGain += stat.LikeDelta
+			trend.CollectGain += stat.CollectDelta
+			trend.Stats = append(trend.Stats, stat)
+			last = stat
+		}
+		trends = append(trends, trend)
+	}
+	return trends, nil
+}
+
+// top 按阅读增量排序 相同时看点赞增量
+func (a *analyticsService) top(trends []domain.ArticleTrend, n int) []domain.ArticleTrend {
+	res := make([]domain.ArticleTrend, len(trends))
+	copy(res, trends)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].ReadGain != res[j].ReadGain {
+			return res[i].ReadGain > res[j].ReadGain
+		}
+		return res[i].LikeGain > res[j].LikeGain
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+func (a *analyticsService) accumulate(dst *domain.DailyStat, src domain.DailyStat) {
+	dst.ReadCnt += src.ReadCnt
+	dst.LikeCnt += src.LikeCnt
+	dst.CollectCnt += src.CollectCnt
+	dst.ReadDelta += src.ReadDelta
+	dst.LikeDelta += src.LikeDelta
+	dst.CollectDelta += src.CollectDelta
+}
+
+func (a *analyticsService) toStat(day time.Time, s *interactivev1.InteractiveSnapshot) domain.DailyStat {
+	return domain.DailyStat{
+		Day:        day,
+		ReadCnt:    s.GetReadCnt(),
+		LikeCnt:    s.GetLikeCnt(),
+		CollectCnt: s.GetCollectCnt(),
+	}
+}
+
+func (a *analyticsService) truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (a *analyticsService) days(start, end time.Time) []time.Time {
+	var res []time.Time
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		res = append(res, day)
+	}
+	return res
+}
@@ -18,6 +18,7 @@ type ArticleService interface {
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id, uid int64) (domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error)
+	ListPubByShard(ctx context.Context, start time.Time, shard, shards, offset, limit int) ([]domain.Article, error)
 }
 
 type articleService struct {
@@ -45,6 +46,10 @@ func (a *articleService) ListPub(ctx context.Context, start time.Time, offset, l
 	return a.repo.ListPub(ctx, start, offset, limit)
 }
 
+func (a *articleService) ListPubByShard(ctx context.Context, start time.Time, shard, shards, offset, limit int) ([]domain.Article, error) {
+	return a.repo.ListPubByShard(ctx, start, shard, shards, offset, limit)
+}
+
 func (a *articleService) GetById(ctx context.Context, id int64) (domain.Article, error) {
 	return a.repo.GetById(ctx, id)
 }
@@ -56,6 +61,7 @@ func (a *articleService) GetPubById(ctx context.Context, id, uid int64) (domain.
 			// 成功阅读文章时 生成一个记录阅读量的消息
 			err := a.producer.ProduceReadEvent(
 				article.ReadEvent{
+					Biz:      domain.BizArticle,
 					Aid:      id,
 					Uid:      uid,
 					ReadTime: time.Now().UnixMilli(),
@@ -2,49 +2,91 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
 	"github.com/Anwenya/GeekTime/webook/internal/repository"
 	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"strings"
 	"time"
 )
 
+// 数据库里只保存错误信息的前面一部分
+const maxJobErrorLen = 1024
+
+// ErrNoJobNode 广播任务分发的时候没有存活的节点
+var ErrNoJobNode = errors.New("没有存活的调度节点")
+
 type CronJobService interface {
-	Preempt(ctx context.Context) (domain.Job, error)
+	// Preempt 优先级高的先抢 跳过 filter 里已经满了的执行器
+	Preempt(ctx context.Context, filter domain.JobPreemptFilter) (domain.Job, error)
+	// PreemptTask 抢一个广播或者分片任务分发出来的子任务
+	// 返回的 Job 带着子任务 执行和记录结果的方式和普通任务一样
+	// 跳过 filter 里已经满了的任务
+	PreemptTask(ctx context.Context, node string, filter domain.JobPreemptFilter) (domain.Job, error)
+	// CountDue 到了执行时间还在等待的任务 按照优先级计数
+	CountDue(ctx context.Context) (map[int]int64, error)
+	// Dispatch 广播和分片任务抢到之后不直接执行 而是分发这一轮的子任务
+	// 调用方还需要调用 Complete 计算下一次分发的时间
+	Dispatch(ctx context.Context, job domain.Job) error
 	ResetNextTime(ctx context.Context, job domain.Job) error
+	// Start 记录开始执行 失败只记录日志
+	Start(ctx context.Context, job domain.Job, node string) domain.JobRun
+	// Complete 记录执行结果
+	// 到了预定的执行时间才会计算下一次执行时间 手动触发的执行不影响原来的调度
+	// 失败时按照任务配置的重试策略计算下一次重试的时间 重试次数用完了就等下一次调度
+	// 子任务失败时按照同样的策略单独重试
+	Complete(ctx context.Context, job domain.Job, run domain.JobRun) error
+	// Yield 节点负载太高 执行到一半让给其他节点
+	// 不计算下一次执行时间 普通任务在 CancelFun 里释放 子任务在这里放回去
+	Yield(ctx context.Context, job domain.Job, run domain.JobRun) error
 }
 
 type cronJobService struct {
 	repo            repository.CronJobRepository
+	execRepo        repository.JobExecutionRepository
+	taskRepo        repository.JobTaskRepository
+	nodes           JobNodeService
 	refreshInterval time.Duration
-	l               logger.LoggerV1
+	// 续约失败之后隔多久重试
+	refreshRetryInterval time.Duration
+	// 多久没有续约成功会被其他节点抢走 和 dao 里的判断一致
+	leaseTimeout time.Duration
+	l            logger.LoggerV1
 }
 
-func newCronJobService(
+func NewCronJobService(
 	repo repository.CronJobRepository,
+	execRepo repository.JobExecutionRepository,
+	taskRepo repository.JobTaskRepository,
+	nodes JobNodeService,
 	l logger.LoggerV1,
 ) CronJobService {
 	return &cronJobService{
-		repo: repo,
-		l:    l,
+		repo:     repo,
+		execRepo: execRepo,
+		taskRepo: taskRepo,
+		nodes:    nodes,
+		l:        l,
 
-		refreshInterval: time.Minute,
+		refreshInterval:      time.Minute,
+		refreshRetryInterval: time.Second * 5,
+		leaseTimeout:         time.Minute * 2,
 	}
 }
 
-func (c cronJobService) Preempt(ctx context.Context) (domain.Job, error) {
-	job, err := c.repo.Preempt(ctx)
+func (c cronJobService) Preempt(ctx context.Context, filter domain.JobPreemptFilter) (domain.Job, error) {
+	job, err := c.preempt(ctx, filter.Executors)
 	if err != nil {
 		return domain.Job{}, err
 	}
-	ticker := time.NewTicker(c.refreshInterval)
-	go func() {
-		for range ticker.C {
-			c.refresh(job.Id)
-		}
-	}()
+	lost, stop := c.keepAlive(func(ctx context.Context) error {
+		return c.repo.UpdateTime(ctx, job.Id, job.Version)
+	}, logger.Int64("jid", job.Id))
+	job.LeaseLost = lost
 
 	job.CancelFun = func() {
-		ticker.Stop()
+		stop()
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 		err := c.repo.Release(ctx, job.Id, job.Version)
@@ -61,21 +103,290 @@ func (c cronJobService) Preempt(ctx context.Context) (domain.Job, error) {
 	return job, err
 }
 
+// preempt 错过了执行时间并且策略是跳过的任务 直接计算下一次执行时间 再抢下一个
+func (c cronJobService) preempt(ctx context.Context, excludeExecutors []string) (domain.Job, error) {
+	for {
+		job, err := c.repo.Preempt(ctx, excludeExecutors)
+		if err != nil {
+			return domain.Job{}, err
+		}
+		now := time.Now()
+		if job.Misfire != domain.JobMisfireSkip || !job.Misfired(now) {
+			return job, nil
+		}
+		c.l.Warn("任务错过了执行时间 跳过",
+			logger.Int64("jid", job.Id),
+			logger.String("scheduled", job.ScheduledTime.String()))
+		err = c.repo.UpdateNextTime(ctx, job.Id, c.scheduleAfter(job, now))
+		if err != nil {
+			return domain.Job{}, err
+		}
+		err = c.repo.Release(ctx, job.Id, job.Version)
+		if err != nil {
+			return domain.Job{}, err
+		}
+	}
+}
+
+func (c cronJobService) CountDue(ctx context.Context) (map[int]int64, error) {
+	return c.repo.CountDue(ctx)
+}
+
+func (c cronJobService) PreemptTask(ctx context.Context, node string, filter domain.JobPreemptFilter) (domain.Job, error) {
+	for {
+		task, err := c.taskRepo.Preempt(ctx, node, filter.JobIds)
+		if err != nil {
+			return domain.Job{}, err
+		}
+		// 查不到任务的其他错误 子任务等续约超时之后再被抢
+		job, err := c.repo.FindById(ctx, task.JobId)
+		if err != nil && !errors.Is(err, repository.ErrJobNotFound) {
+			return domain.Job{}, err
+		}
+		if err != nil || job.Status.Paused() {
+			// 任务被删除或者暂停了 剩下的子任务不再执行
+			err = c.taskRepo.Complete(ctx, task, domain.JobTaskStatusCanceled, task.Attempt, time.Time{})
+			if err != nil {
+				return domain.Job{}, err
+			}
+			continue
+		}
+
+		job.Task = &task
+		job.Attempt = task.Attempt
+		lost, stop := c.keepAlive(func(ctx context.Context) error {
+			return c.taskRepo.UpdateTime(ctx, task.Id, task.Version)
+		}, logger.Int64("jid", job.Id), logger.Int64("tid", task.Id))
+		job.LeaseLost = lost
+		// 子任务在 Complete 的时候已经修改了状态 只需要停止续约
+		job.CancelFun = stop
+		return job, nil
+	}
+}
+
+func (c cronJobService) Dispatch(ctx context.Context, job domain.Job) error {
+	now := time.Now()
+	// 同一轮的子任务 tick 相同 节点崩溃之后重新分发也不会重复
+	// 手动触发的时候还没到预定的执行时间 用触发时间区分
+	tick := job.ScheduledTime
+	if tick.After(now) && !job.TriggerTime.IsZero() {
+		tick = job.TriggerTime
+	}
+
+	var tasks []domain.JobTask
+	switch job.Mode {
+	case domain.JobModeBroadcast:
+		nodes, err := c.nodes.Live(ctx)
+		if err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return ErrNoJobNode
+		}
+		for i, node := range nodes {
+			tasks = append(tasks, domain.JobTask{
+				JobId:    job.Id,
+				Tick:     tick,
+				Shard:    i,
+				Shards:   len(nodes),
+				Node:     node.Name,
+				NextTime: now,
+			})
+		}
+	case domain.JobModeSharding:
+		for i := 0; i < job.Shards; i++ {
+			tasks = append(tasks, domain.JobTask{
+				JobId:    job.Id,
+				Tick:     tick,
+				Shard:    i,
+				Shards:   job.Shards,
+				NextTime: now,
+			})
+		}
+	default:
+		return fmt.Errorf("任务不需要分发 %s", job.Mode)
+	}
+
+	err := c.taskRepo.Create(ctx, tasks)
+	if err != nil {
+		return err
+	}
+	if job.Mode == domain.JobModeBroadcast {
+		err = c.taskRepo.CancelBefore(ctx, job.Id, tick)
+		if err != nil {
+			c.l.Warn("取消过期的广播子任务失败", logger.Error(err), logger.Int64("jid", job.Id))
+		}
+	}
+	return nil
+}
+
 func (c cronJobService) ResetNextTime(ctx context.Context, job domain.Job) error {
-	nextTime := job.NextTime()
+	nextTime, err := job.NextTime()
+	if err != nil {
+		return err
+	}
 	return c.repo.UpdateNextTime(ctx, job.Id, nextTime)
 }
 
-func (c *cronJobService) refresh(id int64) {
+func (c cronJobService) Start(ctx context.Context, job domain.Job, node string) domain.JobRun {
+	run := domain.JobRun{
+		JobId:     job.Id,
+		JobName:   job.Name,
+		Node:      node,
+		Attempt:   job.Attempt + 1,
+		StartTime: time.Now(),
+		Status:    domain.JobRunStatusRunning,
+	}
+	if job.Task != nil {
+		run.TaskId = job.Task.Id
+		run.Shard = job.Task.Shard
+	}
+	id, err := c.execRepo.Create(ctx, run)
+	if err != nil {
+		c.l.Error("记录任务执行失败", logger.Error(err), logger.Int64("jid", job.Id))
+	}
+	run.Id = id
+	return run
+}
+
+func (c cronJobService) Complete(ctx context.Context, job domain.Job, run domain.JobRun) error {
+	if len(run.Error) > maxJobErrorLen {
+		// 截断的时候不要留下半个字符
+		run.Error = strings.ToValidUTF8(run.Error[:maxJobErrorLen], "")
+	}
+	if run.Id > 0 {
+		err := c.execRepo.Finish(ctx, run)
+		if err != nil {
+			c.l.Error("记录任务执行结果失败", logger.Error(err), logger.Int64("jid", job.Id))
+		}
+	}
+
+	if job.Task != nil {
+		return c.completeTask(ctx, job, run)
+	}
+	attempt, nextTime := c.next(job, run)
+	return c.repo.Complete(ctx, job, run, attempt, nextTime)
+}
+
+func (c cronJobService) Yield(ctx context.Context, job domain.Job, run domain.JobRun) error {
+	if run.Id > 0 {
+		run.Status = domain.JobRunStatusYielded
+		err := c.execRepo.Finish(ctx, run)
+		if err != nil {
+			c.l.Error("记录任务执行结果失败", logger.Error(err), logger.Int64("jid", job.Id))
+		}
+	}
+	if job.Task != nil {
+		return c.taskRepo.Release(ctx, *job.Task)
+	}
+	return nil
+}
+
+// completeTask 子任务只在重试的时候需要计算下一次执行时间
+func (c cronJobService) completeTask(ctx context.Context, job domain.Job, run domain.JobRun) error {
+	if run.Status == domain.JobRunStatusSuccess {
+		return c.taskRepo.Complete(ctx, *job.Task, domain.JobTaskStatusSuccess, 0, time.Time{})
+	}
+	policy, err := job.RetryPolicy()
+	if err != nil {
+		c.l.Error("任务的重试策略错误", logger.Error(err), logger.Int64("jid", job.Id))
+	}
+	if run.Attempt >= policy.MaxAttempts {
+		return c.taskRepo.Complete(ctx, *job.Task, domain.JobTaskStatusFailed, run.Attempt, time.Time{})
+	}
+	return c.taskRepo.Complete(ctx, *job.Task, domain.JobTaskStatusWaiting,
+		run.Attempt, run.EndTime.Add(policy.Backoff(run.Attempt)))
+}
+
+// next 计算连续失败的次数和下一次执行的时间
+func (c cronJobService) next(job domain.Job, run domain.JobRun) (int, time.Time) {
+	// 预定的执行时间还没到 说明这次是手动触发的
+	scheduledAhead := job.ScheduledTime.After(run.StartTime)
+	if run.Status == domain.JobRunStatusSuccess {
+		if scheduledAhead {
+			return 0, time.Time{}
+		}
+		return 0, c.scheduleAfter(job, run.EndTime)
+	}
+
+	policy, err := job.RetryPolicy()
+	if err != nil {
+		c.l.Error("任务的重试策略错误", logger.Error(err), logger.Int64("jid", job.Id))
+	}
+	if run.Attempt >= policy.MaxAttempts {
+		// 不重试了 等下一次调度
+		return 0, c.scheduleAfter(job, run.EndTime)
+	}
+	nextTime := run.EndTime.Add(policy.Backoff(run.Attempt))
+	// 重试不能错过原来的调度
+	if scheduledAhead && job.ScheduledTime.Before(nextTime) {
+		nextTime = job.ScheduledTime
+	}
+	return run.Attempt, nextTime
+}
+
+// scheduleAfter 按照 misfire 策略计算下一次调度的时间
+func (c cronJobService) scheduleAfter(job domain.Job, now time.Time) time.Time {
+	next, err := job.NextAfter(job.ScheduledTime, now)
+	if err != nil {
+		// 创建的时候校验过 一般是运行环境缺少时区数据
+		// 过一会儿再试 避免一直被抢
+		c.l.Error("计算下一次执行时间失败", logger.Error(err), logger.Int64("jid", job.Id))
+		return now.Add(time.Minute)
+	}
+	return next
+}
+
+// keepAlive 定期续约 发现已经被别人抢走或者删除了就关闭返回的 channel
+// 续约失败时会很快重试 一直失败到租约快过期的时候也会关闭 避免两个节点同时执行
+// 调用返回的函数停止续约
+func (c cronJobService) keepAlive(
+	refresh func(ctx context.Context) error,
+	fields ...logger.Field,
+) (<-chan struct{}, func()) {
+	timer := time.NewTimer(c.refreshInterval)
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	go func() {
+		defer timer.Stop()
+		lastRefresh := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+			err := c.refresh(refresh, fields...)
+			switch {
+			case err == nil:
+				lastRefresh = time.Now()
+				timer.Reset(c.refreshInterval)
+			case errors.Is(err, repository.ErrJobLeaseLost):
+				// 任务已经不归自己了 通知执行中的任务停下来
+				close(lost)
+				return
+			case time.Since(lastRefresh)+c.refreshRetryInterval >= c.leaseTimeout:
+				// 下一次重试之前租约就过期了
+				c.l.Error("续约一直失败 取消执行", fields...)
+				close(lost)
+				return
+			default:
+				timer.Reset(c.refreshRetryInterval)
+			}
+		}
+	}()
+	return lost, func() {
+		close(done)
+	}
+}
+
+func (c cronJobService) refresh(refresh func(ctx context.Context) error, fields ...logger.Field) error {
 	// 续约本质上就是更新一下更新时间
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	err := c.repo.UpdateTime(ctx, id)
+	err := refresh(ctx)
 	if err != nil {
-		c.l.Error(
-			"续约失败",
-			logger.Error(err),
-			logger.Int64("jid", id),
-		)
+		c.l.Error("续约失败", append(fields, logger.Error(err))...)
 	}
+	return err
 }
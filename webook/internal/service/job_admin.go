@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"time"
+)
+
+var (
+	ErrJobNotFound      = repository.ErrJobNotFound
+	ErrDuplicateJobName = repository.ErrDuplicateJobName
+	ErrInvalidJob       = errors.New("任务定义不合法")
+	ErrJobPaused        = errors.New("任务已经暂停")
+)
+
+const (
+	// 预览最多返回多少个执行时间
+	maxJobPreview = 100
+	// 分片任务最多拆成多少个分片
+	maxJobShards = 1024
+)
+
+// JobAdminService 管理定时任务
+type JobAdminService interface {
+	// Create 新建的任务按照 cron 表达式等待调度
+	Create(ctx context.Context, job domain.Job) (int64, error)
+	// Update 修改任务的定义 会重新计算下一次执行时间
+	Update(ctx context.Context, job domain.Job) error
+	Delete(ctx context.Context, id int64) error
+	Get(ctx context.Context, id int64) (domain.Job, error)
+	List(ctx context.Context, offset, limit int) ([]domain.Job, error)
+	// Pause 暂停调度 正在执行的不会被打断
+	Pause(ctx context.Context, id int64) error
+	// Resume 恢复调度 从现在开始计算下一次执行时间
+	// 执行期间暂停又恢复的任务还是由原来的节点执行 不会被其他节点抢占
+	Resume(ctx context.Context, id int64) error
+	// Trigger 立刻执行一次 不影响原来的调度
+	Trigger(ctx context.Context, id int64) error
+	// Preview 从现在开始的 n 次执行时间 tz 为空时使用本地时区
+	Preview(expression string, tz string, n int) ([]time.Time, error)
+	// Executions 执行记录 按开始时间倒序
+	// jobId 为0时查询所有任务 status 为 JobRunStatusUnknown 时查询所有状态
+	Executions(ctx context.Context, jobId int64, status domain.JobRunStatus, offset, limit int) ([]domain.JobRun, error)
+	// Nodes 存活的调度器节点 广播任务会分发给这些节点
+	Nodes(ctx context.Context) ([]domain.JobNode, error)
+	// Sync 按照代码里的定义创建任务 已经存在的只同步表达式 执行器 执行方式 分片数量和优先级
+	// 配置 状态这些可以在后台修改的字段保持不变
+	Sync(ctx context.Context, jobs []domain.Job) error
+}
+
+type jobAdminService struct {
+	repo     repository.CronJobRepository
+	execRepo repository.JobExecutionRepository
+	nodes    JobNodeService
+}
+
+func NewJobAdminService(
+	repo repository.CronJobRepository,
+	execRepo repository.JobExecutionRepository,
+	nodes JobNodeService,
+) JobAdminService {
+	return &jobAdminService{
+		repo:     repo,
+		execRepo: execRepo,
+		nodes:    nodes,
+	}
+}
+
+func (j *jobAdminService) Create(ctx context.Context, job domain.Job) (int64, error) {
+	err := j.validate(job)
+	if err != nil {
+		return 0, err
+	}
+	job.ScheduledTime, err = job.NextTime()
+	if err != nil {
+		return 0, err
+	}
+	return j.repo.Create(ctx, job)
+}
+
+func (j *jobAdminService) Update(ctx context.Context, job domain.Job) error {
+	err := j.validate(job)
+	if err != nil {
+		return err
+	}
+	job.ScheduledTime, err = job.NextTime()
+	if err != nil {
+		return err
+	}
+	return j.repo.Update(ctx, job)
+}
+
+func (j *jobAdminService) Delete(ctx context.Context, id int64) error {
+	return j.repo.Delete(ctx, id)
+}
+
+func (j *jobAdminService) Get(ctx context.Context, id int64) (domain.Job, error) {
+	return j.repo.FindById(ctx, id)
+}
+
+func (j *jobAdminService) List(ctx context.Context, offset, limit int) ([]domain.Job, error) {
+	return j.repo.List(ctx, offset, limit)
+}
+
+func (j *jobAdminService) Pause(ctx context.Context, id int64) error {
+	return j.repo.Pause(ctx, id)
+}
+
+func (j *jobAdminService) Resume(ctx context.Context, id int64) error {
+	job, err := j.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !job.Status.Paused() {
+		return nil
+	}
+	// 暂停期间错过的都不补
+	nextTime, err := job.NextTime()
+	if err != nil {
+		return err
+	}
+	return j.repo.Resume(ctx, id, nextTime)
+}
+
+func (j *jobAdminService) Trigger(ctx context.Context, id int64) error {
+	job, err := j.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Status.Paused() {
+		return ErrJobPaused
+	}
+	return j.repo.Trigger(ctx, id, time.Now())
+}
+
+func (j *jobAdminService) Preview(expression string, tz string, n int) ([]time.Time, error) {
+	s, err := domain.ParseJobSchedule(expression, tz)
+	if err != nil {
+		return nil, fmt.Errorf("%w cron 表达式错误 %s", ErrInvalidJob, err.Error())
+	}
+	n = min(max(n, 1), maxJobPreview)
+	res := make([]time.Time, 0, n)
+	t := time.Now()
+	for i := 0; i < n; i++ {
+		t = s.Next(t)
+		// 不会再执行了
+		if t.IsZero() {
+			break
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (j *jobAdminService) Executions(
+	ctx context.Context,
+	jobId int64,
+	status domain.JobRunStatus,
+	offset, limit int,
+) ([]domain.JobRun, error) {
+	return j.execRepo.List(ctx, jobId, status, offset, limit)
+}
+
+func (j *jobAdminService) Nodes(ctx context.Context) ([]domain.JobNode, error) {
+	return j.nodes.Live(ctx)
+}
+
+func (j *jobAdminService) Sync(ctx context.Context, jobs []domain.Job) error {
+	names := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		names = append(names, job.Name)
+	}
+	existing, err := j.repo.FindByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]domain.Job, len(existing))
+	for _, job := range existing {
+		byName[job.Name] = job
+	}
+	for _, job := range jobs {
+		old, ok := byName[job.Name]
+		if !ok {
+			_, err = j.Create(ctx, job)
+			// 其他节点同时启动 已经创建了
+			if err != nil && !errors.Is(err, ErrDuplicateJobName) {
+				return fmt.Errorf("创建任务 %s 失败 %w", job.Name, err)
+			}
+			continue
+		}
+		updated, changed := syncDefinition(old, job)
+		if !changed {
+			continue
+		}
+		err = j.Update(ctx, updated)
+		if err != nil {
+			return fmt.Errorf("更新任务 %s 失败 %w", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// syncDefinition 把代码里定义的字段同步到已有的任务上 没有变化时返回 false
+// 比较和复制的字段放在一起 加字段的时候不会漏掉
+func syncDefinition(old domain.Job, job domain.Job) (domain.Job, bool) {
+	changed := old.Expression != job.Expression ||
+		old.Executor != job.Executor ||
+		old.Mode != job.Mode ||
+		old.Shards != job.Shards ||
+		old.Priority != job.Priority
+	old.Expression = job.Expression
+	old.Executor = job.Executor
+	old.Mode = job.Mode
+	old.Shards = job.Shards
+	old.Priority = job.Priority
+	return old, changed
+}
+
+func (j *jobAdminService) validate(job domain.Job) error {
+	if job.Name == "" || job.Executor == "" {
+		return fmt.Errorf("%w 名字和执行器不能为空", ErrInvalidJob)
+	}
+	_, err := job.Schedule()
+	if err != nil {
+		return fmt.Errorf("%w cron 表达式错误 %s", ErrInvalidJob, err.Error())
+	}
+	if job.MaxDuration < 0 {
+		return fmt.Errorf("%w 最长执行时间不能小于0", ErrInvalidJob)
+	}
+	_, err = job.RetryPolicy()
+	if err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidJob, err.Error())
+	}
+	if job.Mode == domain.JobModeSharding {
+		if job.Shards <= 0 || job.Shards > maxJobShards {
+			return fmt.Errorf("%w 分片数量必须在 1 到 %d 之间", ErrInvalidJob, maxJobShards)
+		}
+	} else if job.Shards != 0 {
+		return fmt.Errorf("%w 只有分片任务可以设置分片数量", ErrInvalidJob)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// memoryJobRepo 把任务放在内存里 记录更新的次数
+type memoryJobRepo struct {
+	repository.CronJobRepository
+	jobs    map[int64]domain.Job
+	updates int
+}
+
+func (m *memoryJobRepo) Create(ctx context.Context, job domain.Job) (int64, error) {
+	for _, old := range m.jobs {
+		if old.Name == job.Name {
+			return 0, ErrDuplicateJobName
+		}
+	}
+	job.Id = int64(len(m.jobs) + 1)
+	m.jobs[job.Id] = job
+	return job.Id, nil
+}
+
+func (m *memoryJobRepo) Update(ctx context.Context, job domain.Job) error {
+	if _, ok := m.jobs[job.Id]; !ok {
+		return ErrJobNotFound
+	}
+	m.updates++
+	m.jobs[job.Id] = job
+	return nil
+}
+
+func (m *memoryJobRepo) FindById(ctx context.Context, id int64) (domain.Job, error) {
+	job, ok := m.jobs[id]
+	if !ok {
+		return domain.Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (m *memoryJobRepo) FindByNames(ctx context.Context, names []string) ([]domain.Job, error) {
+	res := make([]domain.Job, 0, len(names))
+	for _, name := range names {
+		for _, job := range m.jobs {
+			if job.Name == name {
+				res = append(res, job)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *memoryJobRepo) Resume(ctx context.Context, id int64, nextTime time.Time) error {
+	job := m.jobs[id]
+	if job.Status == domain.JobStatusPausing {
+		job.Status = domain.JobStatusRunning
+	} else {
+		job.Status = domain.JobStatusWaiting
+		job.ScheduledTime = nextTime
+	}
+	m.jobs[id] = job
+	return nil
+}
+
+func (m *memoryJobRepo) Trigger(ctx context.Context, id int64, t time.Time) error {
+	job := m.jobs[id]
+	job.TriggerTime = t
+	m.jobs[id] = job
+	return nil
+}
+
+func TestJobAdminService_Create(t *testing.T) {
+	testCases := []struct {
+		name string
+		job  domain.Job
+
+		wantErr error
+	}{
+		{
+			name: "成功",
+			job:  domain.Job{Name: "a", Executor: "local", Expression: "@every 1m"},
+		},
+		{
+			name:    "没有执行器",
+			job:     domain.Job{Name: "a", Expression: "@every 1m"},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name:    "表达式错误",
+			job:     domain.Job{Name: "a", Executor: "local", Expression: "* *"},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name:    "最长执行时间小于0",
+			job:     domain.Job{Name: "a", Executor: "local", Expression: "@every 1m", MaxDuration: -time.Second},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name:    "分片任务没有分片数量",
+			job:     domain.Job{Name: "a", Executor: "local", Expression: "@every 1m", Mode: domain.JobModeSharding},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name: "分片数量太多",
+			job: domain.Job{Name: "a", Executor: "local", Expression: "@every 1m",
+				Mode: domain.JobModeSharding, Shards: maxJobShards + 1},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name:    "不是分片任务但是设置了分片数量",
+			job:     domain.Job{Name: "a", Executor: "local", Expression: "@every 1m", Shards: 2},
+			wantErr: ErrInvalidJob,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &memoryJobRepo{jobs: map[int64]domain.Job{}}
+			svc := NewJobAdminService(repo, nil, nil)
+			id, err := svc.Create(context.Background(), tc.job)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				assert.Empty(t, repo.jobs)
+				return
+			}
+			// 按照表达式算好了第一次执行的时间
+			assert.WithinDuration(t, time.Now().Add(time.Minute), repo.jobs[id].ScheduledTime, time.Second)
+		})
+	}
+}
+
+func TestJobAdminService_Preview(t *testing.T) {
+	svc := NewJobAdminService(nil, nil, nil)
+	times, err := svc.Preview("0 0 8 * * *", "Asia/Shanghai", 3)
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	for i, tm := range times {
+		local := tm.In(loc)
+		assert.Equal(t, 8, local.Hour())
+		if i > 0 {
+			assert.Equal(t, 24*time.Hour, tm.Sub(times[i-1]))
+		}
+	}
+
+	// 数量限制在 1 到 maxJobPreview 之间
+	times, err = svc.Preview("@every 1m", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, times, 1)
+	times, err = svc.Preview("@every 1m", "", maxJobPreview+1)
+	require.NoError(t, err)
+	assert.Len(t, times, maxJobPreview)
+
+	_, err = svc.Preview("* *", "", 1)
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	_, err = svc.Preview("@every 1m", "Mars/Olympus", 1)
+	assert.ErrorIs(t, err, ErrInvalidJob)
+}
+
+func TestJobAdminService_TriggerAndResume(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status domain.JobStatus
+
+		wantTriggerErr error
+		// 恢复之后的状态
+		wantStatus domain.JobStatus
+	}{
+		{
+			name:       "等待中",
+			status:     domain.JobStatusWaiting,
+			wantStatus: domain.JobStatusWaiting,
+		},
+		{
+			name:       "执行中",
+			status:     domain.JobStatusRunning,
+			wantStatus: domain.JobStatusRunning,
+		},
+		{
+			name:           "暂停",
+			status:         domain.JobStatusPaused,
+			wantTriggerErr: ErrJobPaused,
+			wantStatus:     domain.JobStatusWaiting,
+		},
+		{
+			name:           "执行期间暂停",
+			status:         domain.JobStatusPausing,
+			wantTriggerErr: ErrJobPaused,
+			// 原来的节点接着执行 不会被其他节点抢占
+			wantStatus: domain.JobStatusRunning,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &memoryJobRepo{jobs: map[int64]domain.Job{
+				1: {Id: 1, Name: "a", Executor: "local", Expression: "@every 1m", Status: tc.status},
+			}}
+			svc := NewJobAdminService(repo, nil, nil)
+			ctx := context.Background()
+
+			err := svc.Trigger(ctx, 1)
+			assert.ErrorIs(t, err, tc.wantTriggerErr)
+			assert.Equal(t, err == nil, !repo.jobs[1].TriggerTime.IsZero())
+			assert.ErrorIs(t, svc.Trigger(ctx, 2), ErrJobNotFound)
+
+			require.NoError(t, svc.Resume(ctx, 1))
+			assert.Equal(t, tc.wantStatus, repo.jobs[1].Status)
+		})
+	}
+}
+
+func TestJobAdminService_Sync(t *testing.T) {
+	defined := domain.Job{
+		Name:       "ranking",
+		Executor:   "local",
+		Expression: "@every 30m",
+		Mode:       domain.JobModeSharding,
+		Shards:     4,
+		Priority:   5,
+	}
+	testCases := []struct {
+		name   string
+		change func(job *domain.Job)
+
+		wantUpdates int
+	}{
+		{
+			name:   "没有变化",
+			change: func(job *domain.Job) {},
+		},
+		{
+			name: "表达式变了",
+			change: func(job *domain.Job) {
+				job.Expression = "@every 1h"
+			},
+			wantUpdates: 1,
+		},
+		{
+			name: "分片数量变了",
+			change: func(job *domain.Job) {
+				job.Shards = 8
+			},
+			wantUpdates: 1,
+		},
+		{
+			name: "优先级变了",
+			change: func(job *domain.Job) {
+				job.Priority = 10
+			},
+			wantUpdates: 1,
+		},
+		{
+			name: "后台修改的字段不同步",
+			change: func(job *domain.Job) {
+				job.Config = `{"k":"v"}`
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &memoryJobRepo{jobs: map[int64]domain.Job{}}
+			svc := NewJobAdminService(repo, nil, nil)
+			ctx := context.Background()
+			require.NoError(t, svc.Sync(ctx, []domain.Job{defined}))
+			assert.Equal(t, 0, repo.updates)
+
+			job := defined
+			tc.change(&job)
+			require.NoError(t, svc.Sync(ctx, []domain.Job{job}))
+			assert.Equal(t, tc.wantUpdates, repo.updates)
+			synced, err := repo.FindById(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, job.Expression, synced.Expression)
+			assert.Equal(t, job.Shards, synced.Shards)
+			assert.Equal(t, job.Priority, synced.Priority)
+			assert.Equal(t, defined.Config, synced.Config)
+			assert.True(t, synced.ScheduledTime.After(time.Now()))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"time"
+)
+
+// JobNodeService 存活的调度器节点
+// 广播任务按照存活的节点分发
+type JobNodeService interface {
+	// Heartbeat 注册节点并且续约 调度器需要定期调用
+	Heartbeat(ctx context.Context, node string) error
+	// Leave 节点正常退出时调用
+	Leave(ctx context.Context, node string) error
+	// Live 最近还有心跳的节点 按名字排序
+	Live(ctx context.Context) ([]domain.JobNode, error)
+}
+
+type jobNodeService struct {
+	repo repository.JobNodeRepository
+	// 超过这个时间没有心跳就认为节点下线了
+	liveTimeout time.Duration
+}
+
+func NewJobNodeService(repo repository.JobNodeRepository) JobNodeService {
+	return &jobNodeService{
+		repo:        repo,
+		liveTimeout: time.Second * 30,
+	}
+}
+
+func (j *jobNodeService) Heartbeat(ctx context.Context, node string) error {
+	return j.repo.Heartbeat(ctx, node)
+}
+
+func (j *jobNodeService) Leave(ctx context.Context, node string) error {
+	return j.repo.Delete(ctx, node)
+}
+
+func (j *jobNodeService) Live(ctx context.Context) ([]domain.JobNode, error) {
+	return j.repo.FindAlive(ctx, time.Now().Add(-j.liveTimeout))
+}
@@ -5,93 +5,240 @@ import (
 	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
 	"github.com/Anwenya/GeekTime/webook/internal/domain"
 	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
 	"github.com/ecodeclub/ekit/queue"
 	"github.com/ecodeclub/ekit/slice"
-	"math"
 	"time"
 )
 
 type RankingService interface {
 	TopN(ctx context.Context) error
+	// TopNWithStrategy 使用指定的计分规则计算一次排行榜
+	TopNWithStrategy(ctx context.Context, strategy score.Strategy) error
 	GetTopN(ctx context.Context) ([]domain.Article, error)
 }
 
-type BatchRankingService struct {
-	// 查询文章的点赞数
-	intrSvc interactivev1.InteractiveServiceClient
-	// 查询时间段内的文章
-	artSvc ArticleService
+// ReadMetric 参与排名计算的阅读指标
+type ReadMetric string
 
-	batchSize int
-	scoreFunc func(likeCnt int64, updateTime time.Time) float64
+const (
+	// ReadMetricPV 阅读数 每次阅读都会计数
+	ReadMetricPV ReadMetric = "read_cnt"
+	// ReadMetricUV 独立访客数 同一个用户只计一次 不受刷新影响
+	ReadMetricUV ReadMetric = "uv_cnt"
+)
+
+// ValidReadMetric 作者可以为自己的文章选择阅读指标 空字符串表示使用榜单的配置
+func ValidReadMetric(metric string) bool {
+	switch ReadMetric(metric) {
+	case "", ReadMetricPV, ReadMetricUV:
+		return true
+	default:
+		return false
+	}
+}
+
+type RankingConfig struct {
+	// 默认的阅读指标 作者为文章选择了指标时以作者的选择为准
+	ReadMetric ReadMetric `yaml:"readMetric"`
+	// 一次阅读相当于多少个赞 默认为0 只看点赞数 阅读指标也就不起作用
+	// 计分规则没有配置 readWeight 时使用
+	ReadWeight float64 `yaml:"readWeight"`
+	// 默认的计分规则 任务配置中指定了规则时以任务配置为准
+	Score score.Config `yaml:"score"`
+	// 命名榜单 例如日榜 周榜 作者自己的热门文章
+	Lists []RankingListConfig `yaml:"lists"`
+	// 命名榜单的计算周期
+	ListSpec string `yaml:"listSpec"`
+	// 多个节点分片并行计算全站榜单
+	Sharded ShardedRankingConfig `yaml:"sharded"`
+	// 榜单的历史快照
+	Snapshot RankingSnapshotConfig `yaml:"snapshot"`
+}
+
+type BatchRankingService struct {
+	// 遍历最近的文章
+	scanner recentArticleScanner
+	// 默认的计分规则
+	strategy score.Strategy
+	// 阅读指标
+	readMetric ReadMetric
 	// topN
 	n int
 
 	repo repository.RankingRepository
+	// 每次发布都记录快照
+	snapshots RankingSnapshotService
 }
 
 func NewBatchRankingService(
 	intrSvc interactivev1.InteractiveServiceClient,
 	artSvc ArticleService,
 	repo repository.RankingRepository,
+	snapshots RankingSnapshotService,
+	cfg RankingConfig,
 ) RankingService {
+	strategy, readMetric, err := rankingStrategy(cfg)
+	if err != nil {
+		// InitRankingConfig 已经提前校验过 走到这里说明配置没有经过校验
+		panic(any(err))
+	}
 	return &BatchRankingService{
-		intrSvc:   intrSvc,
-		artSvc:    artSvc,
-		repo:      repo,
-		batchSize: 100,
-		n:         100,
-		// 积分计算规则
-		scoreFunc: func(likeCnt int64, updateTime time.Time) float64 {
-			// 如果频繁更新 该时间就会比较小
-			// 这在该计算规则下不平衡
-			duration := time.Since(updateTime).Seconds()
-			return float64(likeCnt-1) / math.Pow(duration+2, 1.5)
-		},
+		scanner:    newRecentArticleScanner(artSvc, intrSvc),
+		repo:       repo,
+		n:          100,
+		readMetric: readMetric,
+		strategy:   strategy,
+		snapshots:  snapshots,
 	}
 }
 
+// rankingStrategy 根据配置确定默认的计分规则和阅读指标
+// 计分规则配置错误时返回错误 不再悄悄退回默认规则
+func rankingStrategy(cfg RankingConfig) (score.Strategy, ReadMetric, error) {
+	readMetric := cfg.ReadMetric
+	if readMetric != ReadMetricUV {
+		readMetric = ReadMetricPV
+	}
+	scoreCfg := cfg.Score
+	// 计分规则明确配置了 readWeight 时以它为准 包括0
+	if scoreCfg.ReadWeight == nil {
+		scoreCfg.ReadWeight = &cfg.ReadWeight
+	}
+	strategy, err := score.New(scoreCfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return strategy, readMetric, nil
+}
+
 func (b *BatchRankingService) TopN(ctx context.Context) error {
-	arts, err := b.topN(ctx)
+	return b.TopNWithStrategy(ctx, b.strategy)
+}
+
+func (b *BatchRankingService) TopNWithStrategy(ctx context.Context, strategy score.Strategy) error {
+	scored, err := b.topN(ctx, strategy)
 	if err != nil {
 		return err
 	}
-	return b.repo.ReplaceTopN(ctx, arts)
+	err = b.repo.ReplaceTopN(ctx, articlesOf(scored))
+	if err != nil {
+		return err
+	}
+	b.snapshots.Record(ctx, RankingGlobal, scored)
+	return nil
 }
 
-func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error) {
-	offset := 0
+func (b *BatchRankingService) topN(ctx context.Context, strategy score.Strategy) ([]domain.ScoredArticle, error) {
 	start := time.Now()
-	// 只统计前七天的文章
-	ddl := start.Add(-7 * 24 * time.Hour)
-
-	type Score struct {
-		score float64
-		art   domain.Article
-	}
-	topNQueue := queue.NewConcurrentPriorityQueue[Score](
-		b.n,
-		func(src Score, dst Score) int {
-			if src.score > dst.score {
-				return 1
-			} else if src.score == dst.score {
-				return 0
-			} else {
-				return -1
-			}
+
+	top := newArticleTopN(b.n)
+	err := b.scanner.scan(ctx, start, recentPeriod, func(art domain.Article, intr *interactivev1.Interactive) {
+		val := strategy.Score(score.Input{
+			LikeCnt:    intr.GetLikeCnt(),
+			ReadCnt:    readCnt(b.readMetric, art, intr),
+			CollectCnt: intr.GetCollectCnt(),
+			UpdateTime: art.UpdateTime,
+			Now:        start,
+		})
+		top.add(val, art)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return top.scored(), nil
+}
+
+// readCnt 作者为文章选择了阅读指标时用作者的 否则用榜单配置的
+func readCnt(metric ReadMetric, art domain.Article, intr *interactivev1.Interactive) int64 {
+	if art.ReadMetric != "" && ValidReadMetric(art.ReadMetric) {
+		metric = ReadMetric(art.ReadMetric)
+	}
+	if metric == ReadMetricUV {
+		return intr.GetUvCnt()
+	}
+	return intr.GetReadCnt()
+}
+
+func (b *BatchRankingService) GetTopN(ctx context.Context) ([]domain.Article, error) {
+	return b.repo.GetTopN(ctx)
+}
+
+// recentPeriod 默认只统计前七天的文章
+const recentPeriod = 7 * 24 * time.Hour
+
+// recentArticleScanner 分批遍历最近一段时间的文章以及文章的互动数据
+// 批量计算和实时榜单的全量重建共用
+type recentArticleScanner struct {
+	// 查询时间段内的文章
+	artSvc ArticleService
+	// 查询文章的点赞数
+	intrSvc interactivev1.InteractiveServiceClient
+
+	batchSize int
+}
+
+func newRecentArticleScanner(
+	artSvc ArticleService,
+	intrSvc interactivev1.InteractiveServiceClient,
+) recentArticleScanner {
+	return recentArticleScanner{
+		artSvc:    artSvc,
+		intrSvc:   intrSvc,
+		batchSize: 100,
+	}
+}
+
+func (s recentArticleScanner) scan(
+	ctx context.Context,
+	start time.Time,
+	period time.Duration,
+	fn func(art domain.Article, intr *interactivev1.Interactive),
+) error {
+	return s.scanWith(ctx, start, period, s.artSvc.ListPub, fn)
+}
+
+// scanShard 只遍历 id 对 shards 取模等于 shard 的文章
+func (s recentArticleScanner) scanShard(
+	ctx context.Context,
+	start time.Time,
+	period time.Duration,
+	shard int,
+	shards int,
+	fn func(art domain.Article, intr *interactivev1.Interactive),
+) error {
+	return s.scanWith(
+		ctx,
+		start,
+		period,
+		func(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error) {
+			return s.artSvc.ListPubByShard(ctx, start, shard, shards, offset, limit)
 		},
+		fn,
 	)
+}
 
+func (s recentArticleScanner) scanWith(
+	ctx context.Context,
+	start time.Time,
+	period time.Duration,
+	list func(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error),
+	fn func(art domain.Article, intr *interactivev1.Interactive),
+) error {
+	offset := 0
+	// 只统计这段时间内的文章
+	ddl := start.Add(-period)
 	for {
 		// 取数据
-		arts, err := b.artSvc.ListPub(ctx, start, offset, b.batchSize)
+		arts, err := list(ctx, start, offset, s.batchSize)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// 提前退出
 		if len(arts) == 0 {
-			break
+			return nil
 		}
 
 		ids := slice.Map[domain.Article, int64](
@@ -102,55 +249,88 @@ func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error
 		)
 
 		// 取点赞数
-		intrResp, err := b.intrSvc.GetByIds(ctx, &interactivev1.GetByIdsRequest{
-			Biz: "article",
+		intrResp, err := s.intrSvc.GetByIds(ctx, &interactivev1.GetByIdsRequest{
+			Biz: domain.BizArticle,
 			Ids: ids,
 		})
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		intrMap := intrResp.GetInteractives()
 		for _, art := range arts {
-			intr := intrMap[art.Id]
-
-			score := b.scoreFunc(intr.LikeCnt, art.UpdateTime)
-			ele := Score{
-				score: score,
-				art:   art,
-			}
-
-			// 满
-			if topNQueue.Len() >= b.n {
-				minEle, _ := topNQueue.Dequeue()
-				if minEle.score < score {
-					_ = topNQueue.Enqueue(ele)
-				} else {
-					_ = topNQueue.Enqueue(minEle)
-				}
-			} else {
-				_ = topNQueue.Enqueue(ele)
-			}
+			fn(art, intrMap[art.Id])
 		}
 
 		offset += len(arts)
 		// 最后一页 或者 有文章超过的更新时间超过了时间范围
-		if len(arts) < b.batchSize || arts[len(arts)-1].UpdateTime.Before(ddl) {
-			break
+		if len(arts) < s.batchSize || arts[len(arts)-1].UpdateTime.Before(ddl) {
+			return nil
+		}
+	}
+}
+
+// articleTopN 用小顶堆保留分数最高的 n 篇文章
+type articleTopN struct {
+	n     int
+	queue *queue.ConcurrentPriorityQueue[domain.ScoredArticle]
+}
+
+func newArticleTopN(n int) *articleTopN {
+	return &articleTopN{
+		n: n,
+		queue: queue.NewConcurrentPriorityQueue[domain.ScoredArticle](
+			n,
+			func(src domain.ScoredArticle, dst domain.ScoredArticle) int {
+				if src.Score > dst.Score {
+					return 1
+				} else if src.Score == dst.Score {
+					return 0
+				} else {
+					return -1
+				}
+			},
+		),
+	}
+}
+
+func (t *articleTopN) add(score float64, art domain.Article) {
+	ele := domain.ScoredArticle{
+		Score:   score,
+		Article: art,
+	}
+	// 满
+	if t.queue.Len() >= t.n {
+		minEle, _ := t.queue.Dequeue()
+		if minEle.Score < score {
+			_ = t.queue.Enqueue(ele)
+		} else {
+			_ = t.queue.Enqueue(minEle)
 		}
+		return
 	}
+	_ = t.queue.Enqueue(ele)
+}
 
-	// 计算结果
-	res := make([]domain.Article, topNQueue.Len())
+// scored 按分数从高到低排列
+func (t *articleTopN) scored() []domain.ScoredArticle {
+	res := make([]domain.ScoredArticle, t.queue.Len())
 	// 小顶堆 要倒序
-	for i := topNQueue.Len() - 1; i >= 0; i-- {
-		ele, _ := topNQueue.Dequeue()
-		res[i] = ele.art
+	for i := t.queue.Len() - 1; i >= 0; i-- {
+		res[i], _ = t.queue.Dequeue()
 	}
-	return res, nil
+	return res
+}
 
+func (t *articleTopN) result() []domain.Article {
+	return articlesOf(t.scored())
 }
 
-func (b *BatchRankingService) GetTopN(ctx context.Context) ([]domain.Article, error) {
-	return b.repo.GetTopN(ctx)
+func articlesOf(scored []domain.ScoredArticle) []domain.Article {
+	return slice.Map[domain.ScoredArticle, domain.Article](
+		scored,
+		func(idx int, src domain.ScoredArticle) domain.Article {
+			return src.Article
+		},
+	)
 }
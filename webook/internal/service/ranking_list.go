@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RankingGlobal 原来的全站榜单 由 RankingService 计算
+const RankingGlobal = "global"
+
+var ErrUnknownRankingList = errors.New("榜单不存在")
+
+// RankingGroupBy 榜单的分组方式
+type RankingGroupBy string
+
+const (
+	// RankingGroupByNone 不分组 整个榜单只有一份
+	RankingGroupByNone RankingGroupBy = ""
+	// RankingGroupByAuthor 每个作者一份 只包含作者自己的文章
+	RankingGroupByAuthor RankingGroupBy = "author"
+	// RankingGroupByCategory 每个分类一份 没有分类的文章不参与
+	RankingGroupByCategory RankingGroupBy = "category"
+	// RankingGroupByTag 每个标签一份 一篇文章会出现在它每个标签的榜单里
+	RankingGroupByTag RankingGroupBy = "tag"
+)
+
+const (
+	maxCategoryLen = 32
+	maxTags        = 5
+	maxTagLen      = 16
+)
+
+// ValidArticleLabels 分类和标签用作分组榜单的 key
+// 标签用逗号分隔存储 所以不能包含逗号
+func ValidArticleLabels(category string, tags []string) bool {
+	if utf8.RuneCountInString(category) > maxCategoryLen || strings.TrimSpace(category) != category {
+		return false
+	}
+	if len(tags) > maxTags {
+		return false
+	}
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLen ||
+			strings.TrimSpace(tag) != tag || strings.Contains(tag, ",") {
+			return false
+		}
+		if _, ok := seen[tag]; ok {
+			return false
+		}
+		seen[tag] = struct{}{}
+	}
+	return true
+}
+
+// RankingGroup 查询分组榜单时指定分组 只用到和榜单分组方式对应的字段
+type RankingGroup struct {
+	AuthorId int64
+	Category string
+	Tag      string
+}
+
+// RankingListConfig 命名榜单的配置
+type RankingListConfig struct {
+	Name string `yaml:"name"`
+	// 只统计这段时间内的文章 默认七天
+	Period  time.Duration  `yaml:"period"`
+	GroupBy RankingGroupBy `yaml:"groupBy"`
+	// topN
+	N int `yaml:"n"`
+	// 使用的阅读指标
+	ReadMetric ReadMetric `yaml:"readMetric"`
+	// 计分规则
+	Score score.Config `yaml:"score"`
+	// redis 的过期时间
+	Expiration time.Duration `yaml:"expiration"`
+	// 本地缓存的过期时间 为0时不使用本地缓存
+	LocalExpiration time.Duration `yaml:"localExpiration"`
+}
+
+// RankingListService 命名榜单 例如日榜 周榜 作者自己的热门文章
+type RankingListService interface {
+	// Refresh 重新计算所有命名榜单
+	Refresh(ctx context.Context) error
+	// GetTopN 分组的榜单需要在 group 中指定作者 分类或者标签
+	GetTopN(ctx context.Context, name string, group RankingGroup) ([]domain.Article, error)
+}
+
+type rankingList struct {
+	cfg      RankingListConfig
+	strategy score.Strategy
+}
+
+type BatchRankingListService struct {
+	scanner recentArticleScanner
+	lists   []rankingList
+	repo    repository.RankingListRepository
+	// 全站榜单
+	global RankingService
+	// 不分组的榜单发布时记录快照
+	snapshots RankingSnapshotService
+}
+
+// NewBatchRankingListService 配置错误时直接返回 error
+func NewBatchRankingListService(
+	artSvc ArticleService,
+	intrSvc interactivev1.InteractiveServiceClient,
+	repo repository.RankingListRepository,
+	global RankingService,
+	snapshots RankingSnapshotService,
+	cfgs []RankingListConfig,
+) (RankingListService, error) {
+	lists := make([]rankingList, 0, len(cfgs))
+	names := make(map[string]struct{}, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || cfg.Name == RankingGlobal {
+			return nil, fmt.Errorf("榜单名字不合法 %q", cfg.Name)
+		}
+		if _, ok := names[cfg.Name]; ok {
+			return nil, fmt.Errorf("榜单名字重复 %s", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+		switch cfg.GroupBy {
+		case RankingGroupByNone, RankingGroupByAuthor, RankingGroupByCategory, RankingGroupByTag:
+		default:
+			return nil, fmt.Errorf("榜单 %s 不支持的分组方式 %s", cfg.Name, cfg.GroupBy)
+		}
+		if cfg.Period <= 0 {
+			cfg.Period = recentPeriod
+		}
+		if cfg.N <= 0 {
+			cfg.N = 100
+		}
+		if cfg.ReadMetric != ReadMetricUV {
+			cfg.ReadMetric = ReadMetricPV
+		}
+		strategy, err := score.New(cfg.Score)
+		if err != nil {
+			return nil, fmt.Errorf("榜单 %s 的计分规则错误 %w", cfg.Name, err)
+		}
+		lists = append(lists, rankingList{cfg: cfg, strategy: strategy})
+	}
+	return &BatchRankingListService{
+		scanner:   newRecentArticleScanner(artSvc, intrSvc),
+		lists:     lists,
+		repo:      repo,
+		global:    global,
+		snapshots: snapshots,
+	}, nil
+}
+
+func (b *BatchRankingListService) Refresh(ctx context.Context) error {
+	if len(b.lists) == 0 {
+		return nil
+	}
+	now := time.Now()
+	// 只遍历一次 按最长的统计周期取数据
+	var period time.Duration
+	// 每个榜单每个分组一个 topN
+	tops := make([]map[string]*articleTopN, len(b.lists))
+	for i, list := range b.lists {
+		period = max(period, list.cfg.Period)
+		tops[i] = make(map[string]*articleTopN)
+	}
+
+	err := b.scanner.scan(ctx, now, period, func(art domain.Article, intr *interactivev1.Interactive) {
+		for i, list := range b.lists {
+			if art.UpdateTime.Before(now.Add(-list.cfg.Period)) {
+				continue
+			}
+			groups := b.groupsOf(list.cfg, art)
+			if len(groups) == 0 {
+				continue
+			}
+			val := list.strategy.Score(score.Input{
+				LikeCnt:    intr.GetLikeCnt(),
+				ReadCnt:    readCnt(list.cfg.ReadMetric, art, intr),
+				CollectCnt: intr.GetCollectCnt(),
+				UpdateTime: art.UpdateTime,
+				Now:        now,
+			})
+			for _, group := range groups {
+				top, ok := tops[i][group]
+				if !ok {
+					top = newArticleTopN(list.cfg.N)
+					tops[i][group] = top
+				}
+				top.add(val, art)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, list := range b.lists {
+		for group, top := range tops[i] {
+			scored := top.scored()
+			err = b.repo.ReplaceTopN(ctx, list.cfg.Name, group, articlesOf(scored))
+			if err != nil {
+				return err
+			}
+			// 分组的榜单太多了 不记录快照
+			if group == "" {
+				b.snapshots.Record(ctx, list.cfg.Name, scored)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BatchRankingListService) GetTopN(ctx context.Context, name string, group RankingGroup) ([]domain.Article, error) {
+	if name == RankingGlobal {
+		return b.global.GetTopN(ctx)
+	}
+	for _, list := range b.lists {
+		if list.cfg.Name == name {
+			return b.repo.GetTopN(ctx, name, b.group(list.cfg, group))
+		}
+	}
+	return nil, ErrUnknownRankingList
+}
+
+// groupsOf 文章属于的分组 不分组的榜单只有一个空字符串的分组
+func (b *BatchRankingListService) groupsOf(cfg RankingListConfig, art domain.Article) []string {
+	switch cfg.GroupBy {
+	case RankingGroupByAuthor:
+		return []string{strconv.FormatInt(art.Author.Id, 10)}
+	case RankingGroupByCategory:
+		if art.Category == "" {
+			return nil
+		}
+		return []string{art.Category}
+	case RankingGroupByTag:
+		return art.Tags
+	default:
+		return []string{""}
+	}
+}
+
+func (b *BatchRankingListService) group(cfg RankingListConfig, group RankingGroup) string {
+	switch cfg.GroupBy {
+	case RankingGroupByAuthor:
+		return strconv.FormatInt(group.AuthorId, 10)
+	case RankingGroupByCategory:
+		return group.Category
+	case RankingGroupByTag:
+		return group.Tag
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recentArticles 按更新时间倒序分页 和 ListPub 一致
+type recentArticles struct {
+	ArticleService
+	arts []domain.Article
+}
+
+func (r *recentArticles) ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error) {
+	if offset >= len(r.arts) {
+		return nil, nil
+	}
+	return r.arts[offset:min(offset+limit, len(r.arts))], nil
+}
+
+// likeCounts 只返回点赞数
+type likeCounts struct {
+	interactivev1.InteractiveServiceClient
+	likes map[int64]int64
+}
+
+func (l *likeCounts) GetByIds(ctx context.Context, in *interactivev1.GetByIdsRequest, opts ...grpc.CallOption) (*interactivev1.GetByIdsResponse, error) {
+	res := make(map[int64]*interactivev1.Interactive, len(in.GetIds()))
+	for _, id := range in.GetIds() {
+		res[id] = &interactivev1.Interactive{Biz: in.GetBiz(), BizId: id, LikeCnt: l.likes[id]}
+	}
+	return &interactivev1.GetByIdsResponse{Interactives: res}, nil
+}
+
+// memoryRankingLists 记录每个榜单每个分组最后一次发布的文章
+type memoryRankingLists struct {
+	repository.RankingListRepository
+	lists map[string][]int64
+}
+
+func (m *memoryRankingLists) ReplaceTopN(ctx context.Context, name string, group string, arts []domain.Article) error {
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.Id)
+	}
+	m.lists[name+"/"+group] = ids
+	return nil
+}
+
+type recordedSnapshots struct {
+	RankingSnapshotService
+	names []string
+}
+
+func (r *recordedSnapshots) Record(ctx context.Context, name string, arts []domain.ScoredArticle) {
+	r.names = append(r.names, name)
+}
+
+func TestBatchRankingListService_Refresh(t *testing.T) {
+	now := time.Now()
+	article := func(id int64, author int64, age time.Duration) domain.Article {
+		return domain.Article{Id: id, Author: domain.Author{Id: author}, UpdateTime: now.Add(-age)}
+	}
+	artSvc := &recentArticles{arts: []domain.Article{
+		article(1, 1, time.Hour),
+		article(2, 2, time.Hour),
+		article(3, 1, 48*time.Hour),
+		article(4, 2, 10*24*time.Hour),
+	}}
+	intrSvc := &likeCounts{likes: map[int64]int64{1: 10, 2: 20, 3: 100, 4: 1000}}
+	repo := &memoryRankingLists{lists: map[string][]int64{}}
+	snapshots := &recordedSnapshots{}
+	svc, err := NewBatchRankingListService(artSvc, intrSvc, repo, nil, snapshots, []RankingListConfig{
+		{Name: "daily", Period: 24 * time.Hour},
+		{Name: "author", Period: 7 * 24 * time.Hour, GroupBy: RankingGroupByAuthor},
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.Refresh(context.Background()))
+
+	// 日榜只有一天内的文章 点赞多的在前面
+	assert.Equal(t, []int64{2, 1}, repo.lists["daily/"])
+	// 按作者分组 超过统计周期的文章不算
+	assert.Len(t, repo.lists, 3)
+	assert.ElementsMatch(t, []int64{1, 3}, repo.lists["author/1"])
+	assert.Equal(t, []int64{2}, repo.lists["author/2"])
+	// 只有不分组的榜单记录快照
+	assert.Equal(t, []string{"daily"}, snapshots.names)
+}
+
+func TestBatchRankingListService_RefreshLabels(t *testing.T) {
+	now := time.Now()
+	article := func(id int64, category string, tags ...string) domain.Article {
+		return domain.Article{Id: id, Category: category, Tags: tags, UpdateTime: now.Add(-time.Hour)}
+	}
+	artSvc := &recentArticles{arts: []domain.Article{
+		article(1, "go", "redis", "mysql"),
+		article(2, "go", "redis"),
+		article(3, "java"),
+		article(4, ""),
+	}}
+	intrSvc := &likeCounts{likes: map[int64]int64{1: 10, 2: 20, 3: 30, 4: 40}}
+	repo := &memoryRankingLists{lists: map[string][]int64{}}
+	svc, err := NewBatchRankingListService(artSvc, intrSvc, repo, nil, &recordedSnapshots{}, []RankingListConfig{
+		{Name: "category", GroupBy: RankingGroupByCategory},
+		{Name: "tag", GroupBy: RankingGroupByTag},
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.Refresh(context.Background()))
+
+	// 没有分类和标签的文章不参与 一篇文章出现在它每个标签的榜单里
+	assert.Equal(t, map[string][]int64{
+		"category/go":   {2, 1},
+		"category/java": {3},
+		"tag/redis":     {2, 1},
+		"tag/mysql":     {1},
+	}, repo.lists)
+}
+
+func TestValidArticleLabels(t *testing.T) {
+	testCases := []struct {
+		name     string
+		category string
+		tags     []string
+		want     bool
+	}{
+		{name: "都没有", want: true},
+		{name: "正常", category: "后端", tags: []string{"go", "redis"}, want: true},
+		{name: "分类太长", category: strings.Repeat("分", maxCategoryLen+1)},
+		{name: "标签太多", tags: []string{"a", "b", "c", "d", "e", "f"}},
+		{name: "空标签", tags: []string{""}},
+		{name: "标签带逗号", tags: []string{"a,b"}},
+		{name: "标签重复", tags: []string{"go", "go"}},
+		{name: "首尾空白", tags: []string{" go"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ValidArticleLabels(tc.category, tc.tags))
+		})
+	}
+}
+
+func TestNewBatchRankingListService(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfgs []RankingListConfig
+	}{
+		{name: "名字为空", cfgs: []RankingListConfig{{}}},
+		{name: "和全站榜单重名", cfgs: []RankingListConfig{{Name: RankingGlobal}}},
+		{name: "名字重复", cfgs: []RankingListConfig{{Name: "a"}, {Name: "a"}}},
+		{name: "不支持的分组", cfgs: []RankingListConfig{{Name: "a", GroupBy: "series"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewBatchRankingListService(nil, nil, nil, nil, nil, tc.cfgs)
+			assert.Error(t, err)
+		})
+	}
+}
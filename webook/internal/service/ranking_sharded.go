@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"time"
+)
+
+var ErrRankingShardMissing = errors.New("分片的中间结果不完整")
+
+type ShardedRankingConfig struct {
+	// 开启后所有节点一起计算全站榜单 代替单个节点计算
+	Enabled bool `yaml:"enabled"`
+	// 按文章 id 取模分成多少片
+	Shards int `yaml:"shards"`
+	// 计算周期 分片的中间结果保留两个周期 调度的间隔不要超过它
+	// 轮次取广播任务的执行时间 不需要和 cron 表达式对齐
+	Interval time.Duration `yaml:"interval"`
+	Spec     string        `yaml:"spec"`
+	// 一轮计算的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ShardedRankingService 分片计算全站榜单
+// round 是一轮计算的开始时间 同一轮的所有节点相同
+// 分片的认领由调用方通过分布式锁完成
+type ShardedRankingService interface {
+	// ComputeShard 计算一个分片的前N名 保存为中间结果
+	ComputeShard(ctx context.Context, round int64, shard int) error
+	// PendingShards 还没有中间结果的分片
+	PendingShards(ctx context.Context, round int64) ([]int, error)
+	// Merge 合并所有分片的中间结果 写入排行榜
+	// 已经合并过的轮次直接返回
+	Merge(ctx context.Context, round int64) error
+	Shards() int
+}
+
+type BatchShardedRankingService struct {
+	scanner    recentArticleScanner
+	strategy   score.Strategy
+	readMetric ReadMetric
+	n          int
+	shards     int
+
+	repo      repository.RankingRepository
+	shardRepo repository.RankingShardRepository
+	snapshots RankingSnapshotService
+	l         logger.LoggerV1
+}
+
+func NewBatchShardedRankingService(
+	intrSvc interactivev1.InteractiveServiceClient,
+	artSvc ArticleService,
+	repo repository.RankingRepository,
+	shardRepo repository.RankingShardRepository,
+	snapshots RankingSnapshotService,
+	cfg RankingConfig,
+	l logger.LoggerV1,
+) ShardedRankingService {
+	strategy, readMetric, err := rankingStrategy(cfg)
+	if err != nil {
+		panic(any(err))
+	}
+	shards := cfg.Sharded.Shards
+	if shards <= 0 {
+		shards = 1
+	}
+	return &BatchShardedRankingService{
+		scanner:    newRecentArticleScanner(artSvc, intrSvc),
+		strategy:   strategy,
+		readMetric: readMetric,
+		n:          100,
+		shards:     shards,
+		repo:       repo,
+		shardRepo:  shardRepo,
+		snapshots:  snapshots,
+		l:          l,
+	}
+}
+
+func (b *BatchShardedRankingService) Shards() int {
+	return b.shards
+}
+
+func (b *BatchShardedRankingService) ComputeShard(ctx context.Context, round int64, shard int) error {
+	// 所有分片都以轮次开始的时间计算分数 接手别人的分片时结果也一致
+	start := time.Unix(round, 0)
+	top := newArticleTopN(b.n)
+	err := b.scanner.scanShard(ctx, start, recentPeriod, shard, b.shards,
+		func(art domain.Article, intr *interactivev1.Interactive) {
+			top.add(b.strategy.Score(score.Input{
+				LikeCnt:    intr.GetLikeCnt(),
+				ReadCnt:    readCnt(b.readMetric, art, intr),
+				CollectCnt: intr.GetCollectCnt(),
+				UpdateTime: art.UpdateTime,
+				Now:        start,
+			}), art)
+		})
+	if err != nil {
+		return err
+	}
+	return b.shardRepo.SavePartial(ctx, round, shard, top.scored())
+}
+
+func (b *BatchShardedRankingService) PendingShards(ctx context.Context, round int64) ([]int, error) {
+	partials, err := b.shardRepo.GetPartials(ctx, round, b.shards)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int, 0, b.shards-len(partials))
+	for i := 0; i < b.shards; i++ {
+		if _, ok := partials[i]; !ok {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+func (b *BatchShardedRankingService) Merge(ctx context.Context, round int64) error {
+	merged, err := b.shardRepo.IsMerged(ctx, round)
+	if err != nil {
+		return err
+	}
+	if merged {
+		return nil
+	}
+	partials, err := b.shardRepo.GetPartials(ctx, round, b.shards)
+	if err != nil {
+		return err
+	}
+	if len(partials) < b.shards {
+		return fmt.Errorf("%w 轮次 %d 只有 %d/%d 个分片", ErrRankingShardMissing, round, len(partials), b.shards)
+	}
+	top := newArticleTopN(b.n)
+	for _, partial := range partials {
+		for _, ele := range partial {
+			top.add(ele.Score, ele.Article)
+		}
+	}
+	scored := top.scored()
+	err = b.repo.ReplaceTopN(ctx, articlesOf(scored))
+	if err != nil {
+		return err
+	}
+	b.snapshots.Record(ctx, RankingGlobal, scored)
+	return b.shardRepo.MarkMerged(ctx, round)
+}
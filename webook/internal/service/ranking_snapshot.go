@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"sort"
+	"time"
+)
+
+var ErrRankingSnapshotNotFound = repository.ErrRankingSnapshotNotFound
+
+// 一次最多查询多少个快照
+const maxRankingSnapshots = 1000
+
+type RankingSnapshotConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 快照保留多久
+	Retention time.Duration `yaml:"retention"`
+	// 同一个榜单两次快照的最小间隔 实时榜单每分钟发布一次 不需要每次都保存
+	MinInterval time.Duration `yaml:"minInterval"`
+	// 清理过期快照的周期
+	CleanupSpec string `yaml:"cleanupSpec"`
+}
+
+// RankingSnapshotService 榜单的历史快照
+type RankingSnapshotService interface {
+	// Record 记录一次发布的榜单
+	// 失败只记录日志 不影响榜单的发布
+	Record(ctx context.Context, name string, arts []domain.ScoredArticle)
+	// AsOf t 时刻正在展示的榜单
+	AsOf(ctx context.Context, name string, t time.Time) (domain.RankingSnapshot, error)
+	// Trajectory 文章在一段时间内每个快照中的名次
+	Trajectory(ctx context.Context, name string, aid int64, start, end time.Time) ([]domain.RankPoint, error)
+	// Moves from 和 to 两个时刻之间名次的变化
+	// 按照 to 时刻的名次排序 掉出榜单的排在最后
+	Moves(ctx context.Context, name string, from, to time.Time) ([]domain.RankMove, error)
+	// Cleanup 删除超过保留时间的快照
+	Cleanup(ctx context.Context) (int64, error)
+}
+
+type rankingSnapshotService struct {
+	repo repository.RankingSnapshotRepository
+	cfg  RankingSnapshotConfig
+	l    logger.LoggerV1
+}
+
+func NewRankingSnapshotService(
+	repo repository.RankingSnapshotRepository,
+	cfg RankingSnapshotConfig,
+	l logger.LoggerV1,
+) RankingSnapshotService {
+	return &rankingSnapshotService{
+		repo: repo,
+		cfg:  cfg,
+		l:    l,
+	}
+}
+
+func (r *rankingSnapshotService) Record(ctx context.Context, name string, arts []domain.ScoredArticle) {
+	if !r.cfg.Enabled {
+		return
+	}
+	now := time.Now()
+	latest, err := r.repo.LatestTime(ctx, name)
+	switch {
+	case err == nil:
+		if now.Sub(latest) < r.cfg.MinInterval {
+			return
+		}
+	case errors.Is(err, ErrRankingSnapshotNotFound):
+	default:
+		r.l.Error("查询最近的榜单快照失败", logger.Error(err), logger.String("name", name))
+		return
+	}
+
+	items := make([]domain.RankingSnapshotItem, 0, len(arts))
+	for i, art := range arts {
+		items = append(items, domain.RankingSnapshotItem{
+			ArticleId: art.Article.Id,
+			Position:  i + 1,
+			Score:     art.Score,
+		})
+	}
+	_, err = r.repo.Save(ctx, domain.RankingSnapshot{
+		Name:   name,
+		Ctime:  now,
+		Bucket: r.bucket(now),
+		Items:  items,
+	})
+	// 其他节点刚刚保存过这个时间段的快照
+	if err != nil && !errors.Is(err, repository.ErrDuplicateRankingSnapshot) {
+		r.l.Error("保存榜单快照失败", logger.Error(err), logger.String("name", name))
+	}
+}
+
+// bucket 按照最小间隔划分时间段 上面的检查在多个节点之间有并发问题
+// 由数据库的唯一索引保证每个时间段只有一个快照
+func (r *rankingSnapshotService) bucket(t time.Time) int64 {
+	interval := r.cfg.MinInterval.Milliseconds()
+	if interval <= 0 {
+		return t.UnixMilli()
+	}
+	return t.UnixMilli() / interval
+}
+
+func (r *rankingSnapshotService) AsOf(ctx context.Context, name string, t time.Time) (domain.RankingSnapshot, error) {
+	return r.repo.AsOf(ctx, name, t)
+}
+
+func (r *rankingSnapshotService) Trajectory(
+	ctx context.Context,
+	name string,
+	aid int64,
+	start, end time.Time,
+) ([]domain.RankPoint, error) {
+	snapshots, err := r.repo.ListByRange(ctx, name, start, end, maxRankingSnapshots)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		ids = append(ids, snapshot.Id)
+	}
+	items, err := r.repo.ArticleItems(ctx, ids, aid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.RankPoint, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		item := items[snapshot.Id]
+		res = append(res, domain.RankPoint{
+			SnapshotId: snapshot.Id,
+			Time:       snapshot.Ctime,
+			Position:   item.Position,
+			Score:      item.Score,
+		})
+	}
+	return res, nil
+}
+
+func (r *rankingSnapshotService) Moves(
+	ctx context.Context,
+	name string,
+	from, to time.Time,
+) ([]domain.RankMove, error) {
+	fromSnapshot, err := r.repo.AsOf(ctx, name, from)
+	if err != nil {
+		return nil, err
+	}
+	toSnapshot, err := r.repo.AsOf(ctx, name, to)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make(map[int64]*domain.RankMove, len(toSnapshot.Items))
+	for _, item := range fromSnapshot.Items {
+		moves[item.ArticleId] = &domain.RankMove{ArticleId: item.ArticleId, From: item.Position}
+	}
+	for _, item := range toSnapshot.Items {
+		move, ok := moves[item.ArticleId]
+		if !ok {
+			move = &domain.RankMove{ArticleId: item.ArticleId}
+			moves[item.ArticleId] = move
+		}
+		move.To = item.Position
+	}
+
+	res := make([]domain.RankMove, 0, len(moves))
+	for _, move := range moves {
+		res = append(res, *move)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		// 掉出榜单的排在最后 按原来的名次排
+		if (res[i].To == 0) != (res[j].To == 0) {
+			return res[j].To == 0
+		}
+		if res[i].To == 0 {
+			return res[i].From < res[j].From
+		}
+		return res[i].To < res[j].To
+	})
+	return res, nil
+}
+
+func (r *rankingSnapshotService) Cleanup(ctx context.Context) (int64, error) {
+	if r.cfg.Retention <= 0 {
+		return 0, nil
+	}
+	ddl := time.Now().Add(-r.cfg.Retention)
+	var total int64
+	for {
+		// 分批删除 避免大事务
+		cnt, err := r.repo.DeleteBefore(ctx, ddl, 100)
+		total += cnt
+		if err != nil || cnt == 0 {
+			return total, err
+		}
+	}
+}
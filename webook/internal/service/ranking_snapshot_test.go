@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+func initRankingSnapshotRepo(t *testing.T) repository.RankingSnapshotRepository {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		TranslateError: true,
+		Logger:         glogger.Default.LogMode(glogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	require.NoError(t, db.AutoMigrate(&dao.RankingSnapshot{}, &dao.RankingSnapshotItem{}))
+	return repository.NewDBRankingSnapshotRepository(dao.NewGORMRankingSnapshotDAO(db))
+}
+
+func saveRankingSnapshot(t *testing.T, repo repository.RankingSnapshotRepository, ctime time.Time, aids ...int64) int64 {
+	items := make([]domain.RankingSnapshotItem, 0, len(aids))
+	for i, aid := range aids {
+		items = append(items, domain.RankingSnapshotItem{ArticleId: aid, Position: i + 1, Score: float64(100 - i)})
+	}
+	id, err := repo.Save(context.Background(), domain.RankingSnapshot{
+		Name:   "global",
+		Ctime:  ctime,
+		Bucket: ctime.UnixMilli(),
+		Items:  items,
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func TestRankingSnapshotService_Record(t *testing.T) {
+	repo := initRankingSnapshotRepo(t)
+	cfg := RankingSnapshotConfig{Enabled: true, MinInterval: time.Hour}
+	arts := []domain.ScoredArticle{
+		{Score: 2, Article: domain.Article{Id: 1}},
+		{Score: 1, Article: domain.Article{Id: 2}},
+	}
+	ctx := context.Background()
+	NewRankingSnapshotService(repo, cfg, logger.NewNopLogger()).Record(ctx, "global", arts)
+	latest, err := repo.LatestTime(ctx, "global")
+	require.NoError(t, err)
+
+	// 模拟另一个节点同时通过了最小间隔的检查
+	_, err = repo.Save(ctx, domain.RankingSnapshot{
+		Name:   "global",
+		Ctime:  latest.Add(time.Second),
+		Bucket: latest.UnixMilli() / time.Hour.Milliseconds(),
+	})
+	assert.ErrorIs(t, err, repository.ErrDuplicateRankingSnapshot)
+
+	// 间隔内再次发布不保存
+	NewRankingSnapshotService(repo, cfg, logger.NewNopLogger()).Record(ctx, "global", arts)
+	snapshots, err := repo.ListByRange(ctx, "global", latest.Add(-time.Hour), latest.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	snapshot, err := repo.AsOf(ctx, "global", latest)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.RankingSnapshotItem{
+		{ArticleId: 1, Position: 1, Score: 2},
+		{ArticleId: 2, Position: 2, Score: 1},
+	}, snapshot.Items)
+}
+
+func TestRankingSnapshotService_Trajectory(t *testing.T) {
+	repo := initRankingSnapshotRepo(t)
+	svc := NewRankingSnapshotService(repo, RankingSnapshotConfig{Enabled: true}, logger.NewNopLogger())
+	start := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+	first := saveRankingSnapshot(t, repo, start, 1, 2)
+	second := saveRankingSnapshot(t, repo, start.Add(time.Minute), 3, 4)
+	third := saveRankingSnapshot(t, repo, start.Add(2*time.Minute), 2, 1)
+
+	res, err := svc.Trajectory(context.Background(), "global", 1, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	// 不在榜上的快照名次和分数都是零值 不会跳过
+	assert.Equal(t, []domain.RankPoint{
+		{SnapshotId: first, Time: start, Position: 1, Score: 100},
+		{SnapshotId: second, Time: start.Add(time.Minute)},
+		{SnapshotId: third, Time: start.Add(2 * time.Minute), Position: 2, Score: 99},
+	}, res)
+}
+
+func TestRankingSnapshotService_Moves(t *testing.T) {
+	repo := initRankingSnapshotRepo(t)
+	svc := NewRankingSnapshotService(repo, RankingSnapshotConfig{Enabled: true}, logger.NewNopLogger())
+	from := time.Now().Add(-time.Hour)
+	to := from.Add(time.Minute)
+	saveRankingSnapshot(t, repo, from, 1, 2, 3, 4)
+	saveRankingSnapshot(t, repo, to, 3, 5, 1)
+
+	res, err := svc.Moves(context.Background(), "global", from, to)
+	require.NoError(t, err)
+	// 按照新的名次排序 新上榜的 From 是 0 掉出榜单的按照原来的名次排在最后
+	assert.Equal(t, []domain.RankMove{
+		{ArticleId: 3, From: 3, To: 1},
+		{ArticleId: 5, From: 0, To: 2},
+		{ArticleId: 1, From: 1, To: 3},
+		{ArticleId: 2, From: 2, To: 0},
+		{ArticleId: 4, From: 4, To: 0},
+	}, res)
+
+	_, err = svc.Moves(context.Background(), "global", from.Add(-time.Hour), to)
+	assert.ErrorIs(t, err, ErrRankingSnapshotNotFound)
+}
+
+// countedDeletes 记录每一批删除的数量
+type countedDeletes struct {
+	repository.RankingSnapshotRepository
+	batches []int64
+}
+
+func (c *countedDeletes) DeleteBefore(ctx context.Context, t time.Time, limit int) (int64, error) {
+	cnt, err := c.RankingSnapshotRepository.DeleteBefore(ctx, t, limit)
+	c.batches = append(c.batches, cnt)
+	return cnt, err
+}
+
+func TestRankingSnapshotService_Cleanup(t *testing.T) {
+	repo := &countedDeletes{RankingSnapshotRepository: initRankingSnapshotRepo(t)}
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 250; i++ {
+		saveRankingSnapshot(t, repo, old.Add(time.Duration(i)*time.Minute), int64(i))
+	}
+	latest := saveRankingSnapshot(t, repo, time.Now(), 1)
+
+	svc := NewRankingSnapshotService(repo, RankingSnapshotConfig{Enabled: true, Retention: 24 * time.Hour}, logger.NewNopLogger())
+	cnt, err := svc.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(250), cnt)
+	// 每批最多一百个 删完之后再查一次
+	assert.Equal(t, []int64{100, 100, 50, 0}, repo.batches)
+
+	snapshot, err := repo.AsOf(context.Background(), "global", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, latest, snapshot.Id)
+
+	// 没有配置保留时间的不清理
+	svc = NewRankingSnapshotService(repo, RankingSnapshotConfig{Enabled: true}, logger.NewNopLogger())
+	cnt, err = svc.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, cnt)
+	assert.Len(t, repo.batches, 4)
+}
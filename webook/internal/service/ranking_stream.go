@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"math"
+	"time"
+)
+
+// IncrementalRankingService 实时榜单
+// 消费阅读和点赞事件增量更新分数 定时把前N名写入 RankingRepository
+type IncrementalRankingService interface {
+	OnRead(ctx context.Context, aid int64, t time.Time) error
+	OnLike(ctx context.Context, aid int64, t time.Time) error
+	OnCancelLike(ctx context.Context, aid int64, t time.Time) error
+	OnCollect(ctx context.Context, aid int64, t time.Time) error
+	// Materialize 把当前的前N名写入 RankingRepository
+	Materialize(ctx context.Context) error
+	// Rebuild 用最近七天的全量数据重建实时榜单
+	// 用来修正丢失或者重复的事件
+	Rebuild(ctx context.Context) error
+}
+
+type StreamRankingConfig struct {
+	// 开启后由实时榜单负责更新排行榜 批量计算只用来定期全量重建
+	Enabled bool `yaml:"enabled"`
+	// 分数的半衰期
+	HalfLife time.Duration `yaml:"halfLife"`
+	// 各种事件的分数
+	ReadWeight    float64 `yaml:"readWeight"`
+	LikeWeight    float64 `yaml:"likeWeight"`
+	CollectWeight float64 `yaml:"collectWeight"`
+	// topN
+	N int `yaml:"n"`
+	// 有序集合最多保留多少篇文章
+	MaxSize int `yaml:"maxSize"`
+	// 写入排行榜的周期
+	Materialize string `yaml:"materialize"`
+	// 全量重建的周期
+	Rebuild string `yaml:"rebuild"`
+}
+
+type StreamRankingService struct {
+	repo repository.StreamRankingRepository
+	// 前N名写到这里 和批量计算共用
+	rankingRepo repository.RankingRepository
+	// 直接查仓库 避免产生阅读事件
+	artRepo repository.ArticleRepository
+	// 全量重建时遍历最近的文章
+	scanner recentArticleScanner
+	// 发布时记录快照
+	snapshots RankingSnapshotService
+
+	cfg StreamRankingConfig
+	l   logger.LoggerV1
+}
+
+func NewStreamRankingService(
+	repo repository.StreamRankingRepository,
+	rankingRepo repository.RankingRepository,
+	artRepo repository.ArticleRepository,
+	artSvc ArticleService,
+	intrSvc interactivev1.InteractiveServiceClient,
+	snapshots RankingSnapshotService,
+	cfg StreamRankingConfig,
+	l logger.LoggerV1,
+) IncrementalRankingService {
+	return &StreamRankingService{
+		repo:        repo,
+		rankingRepo: rankingRepo,
+		artRepo:     artRepo,
+		scanner:     newRecentArticleScanner(artSvc, intrSvc),
+		snapshots:   snapshots,
+		cfg:         cfg,
+		l:           l,
+	}
+}
+
+func (s *StreamRankingService) OnRead(ctx context.Context, aid int64, t time.Time) error {
+	return s.incr(ctx, aid, s.cfg.ReadWeight, t)
+}
+
+func (s *StreamRankingService) OnLike(ctx context.Context, aid int64, t time.Time) error {
+	return s.incr(ctx, aid, s.cfg.LikeWeight, t)
+}
+
+// OnCancelLike 减掉的是取消时刻的分数 和点赞时加上的并不完全相等
+// 误差由定期的全量重建修正
+func (s *StreamRankingService) OnCancelLike(ctx context.Context, aid int64, t time.Time) error {
+	return s.incr(ctx, aid, -s.cfg.LikeWeight, t)
+}
+
+func (s *StreamRankingService) OnCollect(ctx context.Context, aid int64, t time.Time) error {
+	return s.incr(ctx, aid, s.cfg.CollectWeight, t)
+}
+
+func (s *StreamRankingService) incr(ctx context.Context, aid int64, weight float64, t time.Time) error {
+	if weight == 0 {
+		return nil
+	}
+	return s.repo.IncrScore(ctx, aid, weight, t)
+}
+
+func (s *StreamRankingService) Materialize(ctx context.Context) error {
+	err := s.repo.Rebase(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	// 多取一些 文章可能已经被撤回了
+	top, err := s.repo.TopN(ctx, s.cfg.N*2)
+	if err != nil {
+		return err
+	}
+	scored := make([]domain.ScoredArticle, 0, s.cfg.N)
+	for _, ele := range top {
+		if len(scored) >= s.cfg.N {
+			break
+		}
+		art, err := s.artRepo.GetPubById(ctx, ele.Article.Id)
+		if err != nil {
+			s.l.Warn("实时榜单查询文章失败", logger.Error(err), logger.Int64("aid", ele.Article.Id))
+			continue
+		}
+		scored = append(scored, domain.ScoredArticle{Score: ele.Score, Article: art})
+	}
+	err = s.rankingRepo.ReplaceTopN(ctx, articlesOf(scored))
+	if err != nil {
+		return err
+	}
+	s.snapshots.Record(ctx, RankingGlobal, scored)
+	return nil
+}
+
+func (s *StreamRankingService) Rebuild(ctx context.Context) error {
+	now := time.Now()
+	halfLife := s.cfg.HalfLife.Seconds()
+	scores := make(map[int64]float64)
+	err := s.scanner.scan(ctx, now, recentPeriod, func(art domain.Article, intr *interactivev1.Interactive) {
+		base := float64(intr.GetReadCnt())*s.cfg.ReadWeight +
+			float64(intr.GetLikeCnt())*s.cfg.LikeWeight +
+			float64(intr.GetCollectCnt())*s.cfg.CollectWeight
+		// 拿不到每次互动的时间 近似认为都发生在文章最后更新的时候
+		scores[art.Id] = base * math.Pow(2, art.UpdateTime.Sub(now).Seconds()/halfLife)
+	})
+	if err != nil {
+		return err
+	}
+	err = s.repo.Reset(ctx, scores, now)
+	if err != nil {
+		return err
+	}
+	return s.Materialize(ctx)
+}
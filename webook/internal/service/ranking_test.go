@@ -0,0 +1,90 @@
+package service
+
+import (
+	interactivev1 "github.com/Anwenya/GeekTime/webook/api/proto/gen/interactive/v1"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service/score"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReadCnt(t *testing.T) {
+	intr := &interactivev1.Interactive{ReadCnt: 100, UvCnt: 10}
+	testCases := []struct {
+		name   string
+		metric ReadMetric
+		art    domain.Article
+		want   int64
+	}{
+		{
+			name:   "使用榜单配置的阅读数",
+			metric: ReadMetricPV,
+			want:   100,
+		},
+		{
+			name:   "使用榜单配置的独立访客数",
+			metric: ReadMetricUV,
+			want:   10,
+		},
+		{
+			name:   "作者选择了独立访客数",
+			metric: ReadMetricPV,
+			art:    domain.Article{ReadMetric: "uv_cnt"},
+			want:   10,
+		},
+		{
+			name:   "作者选择了阅读数",
+			metric: ReadMetricUV,
+			art:    domain.Article{ReadMetric: "read_cnt"},
+			want:   100,
+		},
+		{
+			name:   "不认识的指标使用榜单配置",
+			metric: ReadMetricUV,
+			art:    domain.Article{ReadMetric: "like_cnt"},
+			want:   10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, readCnt(tc.metric, tc.art, intr))
+		})
+	}
+}
+
+func TestRankingStrategy(t *testing.T) {
+	now := time.Now()
+	in := score.Input{LikeCnt: 10, UpdateTime: now.Add(-time.Hour), Now: now}
+	read := in
+	read.ReadCnt = 100
+
+	// 指定了计分规则 没有配置 readWeight 时也要使用外层的 否则阅读指标不起作用
+	strategy, metric, err := rankingStrategy(RankingConfig{
+		ReadMetric: "uv_cnt",
+		ReadWeight: 0.1,
+		Score:      score.Config{Strategy: score.StrategyHN},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ReadMetricUV, metric)
+	assert.Greater(t, strategy.Score(read), strategy.Score(in))
+
+	// 计分规则明确配置了0 不使用外层的
+	zero := 0.0
+	strategy, _, err = rankingStrategy(RankingConfig{
+		ReadWeight: 0.1,
+		Score:      score.Config{Strategy: score.StrategyHN, ReadWeight: &zero},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, strategy.Score(in), strategy.Score(read))
+
+	strategy, metric, err = rankingStrategy(RankingConfig{ReadMetric: "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, ReadMetricPV, metric)
+	assert.Equal(t, strategy.Score(in), strategy.Score(read))
+
+	// 未知的计分规则直接报错
+	_, _, err = rankingStrategy(RankingConfig{Score: score.Config{Strategy: "unknown"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package score
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Input 计算分数需要的数据
+type Input struct {
+	LikeCnt    int64
+	ReadCnt    int64
+	CollectCnt int64
+	UpdateTime time.Time
+	// Now 计算时的时间 同一批文章使用同一个时间
+	Now time.Time
+}
+
+// Strategy 排行榜的计分规则 分数越高排名越靠前
+type Strategy interface {
+	Name() string
+	Score(in Input) float64
+}
+
+const (
+	StrategyHN     = "hn"
+	StrategyReddit = "reddit"
+	StrategyWilson = "wilson"
+	StrategyMix    = "mix"
+)
+
+// Config 计分规则及其参数 没有用到的参数会被忽略 为0时使用默认值
+type Config struct {
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// hn 时间衰减的指数
+	Gravity float64 `json:"gravity" yaml:"gravity"`
+	// reddit 多少秒抵得上票数增加一个数量级
+	Decay float64 `json:"decay" yaml:"decay"`
+	// wilson 置信度对应的 z 值
+	Z float64 `json:"z" yaml:"z"`
+	// 各项指标折算成票数的权重 hn reddit 中点赞固定为1
+	// 阅读的权重没有配置时由榜单的默认值补上 明确配置为0表示不考虑阅读
+	ReadWeight    *float64 `json:"readWeight" yaml:"readWeight"`
+	LikeWeight    float64  `json:"likeWeight" yaml:"likeWeight"`
+	CollectWeight float64  `json:"collectWeight" yaml:"collectWeight"`
+	// mix 分数减半需要的小时数
+	HalfLife float64 `json:"halfLife" yaml:"halfLife"`
+}
+
+// readWeight 没有配置时不考虑阅读
+func (c Config) readWeight() float64 {
+	if c.ReadWeight == nil {
+		return 0
+	}
+	return *c.ReadWeight
+}
+
+var factories = map[string]func(cfg Config) Strategy{
+	StrategyHN: func(cfg Config) Strategy {
+		return &HNStrategy{gravity: orDefault(cfg.Gravity, 1.5), weights: cfg}
+	},
+	StrategyReddit: func(cfg Config) Strategy {
+		return &RedditStrategy{decay: orDefault(cfg.Decay, 45000), weights: cfg}
+	},
+	StrategyWilson: func(cfg Config) Strategy {
+		return &WilsonStrategy{z: orDefault(cfg.Z, 1.96)}
+	},
+	StrategyMix: func(cfg Config) Strategy {
+		if cfg.readWeight() == 0 && cfg.LikeWeight == 0 && cfg.CollectWeight == 0 {
+			cfg.LikeWeight = 1
+		}
+		return &MixStrategy{halfLife: orDefault(cfg.HalfLife, 24), weights: cfg}
+	},
+}
+
+// New 根据配置创建计分规则 没有指定时使用 hn
+func New(cfg Config) (Strategy, error) {
+	name := cfg.Strategy
+	if name == "" {
+		name = StrategyHN
+	}
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的计分规则:%s", name)
+	}
+	return factory(cfg), nil
+}
+
+// HNStrategy 类似 Hacker News 的算法 票数随时间按幂函数衰减
+type HNStrategy struct {
+	gravity float64
+	weights Config
+}
+
+func (h *HNStrategy) Name() string {
+	return StrategyHN
+}
+
+func (h *HNStrategy) Score(in Input) float64 {
+	// 如果频繁更新 该时间就会比较小
+	// 这在该计算规则下不平衡
+	duration := in.Now.Sub(in.UpdateTime).Seconds()
+	return (votes(in, h.weights) - 1) / math.Pow(duration+2, h.gravity)
+}
+
+// RedditStrategy 票数取对数 越新的内容基础分越高
+// 新内容需要的票数随时间指数增长
+type RedditStrategy struct {
+	decay   float64
+	weights Config
+}
+
+// redditEpoch reddit 算法使用的起始时间
+const redditEpoch = 1134028003
+
+func (r *RedditStrategy) Name() string {
+	return StrategyReddit
+}
+
+func (r *RedditStrategy) Score(in Input) float64 {
+	order := math.Log10(math.Max(votes(in, r.weights), 1))
+	seconds := float64(in.UpdateTime.Unix() - redditEpoch)
+	return order + seconds/r.decay
+}
+
+// WilsonStrategy 点赞率的威尔逊置信区间下界
+// 阅读少的内容点赞率不可信 下界会比较低 与时间无关
+type WilsonStrategy struct {
+	z float64
+}
+
+func (w *WilsonStrategy) Name() string {
+	return StrategyWilson
+}
+
+func (w *WilsonStrategy) Score(in Input) float64 {
+	if in.ReadCnt <= 0 {
+		return 0
+	}
+	n := float64(in.ReadCnt)
+	p := math.Min(float64(in.LikeCnt)/n, 1)
+	z2 := w.z * w.z
+	return (p + z2/(2*n) - w.z*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// MixStrategy 阅读 点赞 收藏加权求和 按半衰期衰减
+type MixStrategy struct {
+	halfLife float64
+	weights  Config
+}
+
+func (m *MixStrategy) Name() string {
+	return StrategyMix
+}
+
+func (m *MixStrategy) Score(in Input) float64 {
+	sum := float64(in.ReadCnt)*m.weights.readWeight() +
+		float64(in.LikeCnt)*m.weights.LikeWeight +
+		float64(in.CollectCnt)*m.weights.CollectWeight
+	hours := in.Now.Sub(in.UpdateTime).Hours()
+	return sum * math.Pow(0.5, hours/m.halfLife)
+}
+
+// votes 点赞数加上阅读和收藏折算的票数
+func votes(in Input, weights Config) float64 {
+	return float64(in.LikeCnt) +
+		float64(in.ReadCnt)*weights.readWeight() +
+		float64(in.CollectCnt)*weights.CollectWeight
+}
+
+func orDefault(val float64, def float64) float64 {
+	if val == 0 {
+		return def
+	}
+	return val
+}
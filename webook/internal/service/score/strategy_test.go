@@ -0,0 +1,64 @@
+package score
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      Config
+		wantName string
+		wantErr  bool
+	}{
+		{name: "默认使用 hn", cfg: Config{}, wantName: StrategyHN},
+		{name: "reddit", cfg: Config{Strategy: StrategyReddit}, wantName: StrategyReddit},
+		{name: "wilson", cfg: Config{Strategy: StrategyWilson}, wantName: StrategyWilson},
+		{name: "mix", cfg: Config{Strategy: StrategyMix}, wantName: StrategyMix},
+		{name: "未知规则", cfg: Config{Strategy: "unknown"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(tc.cfg)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantName, s.Name())
+		})
+	}
+}
+
+func TestStrategyOrder(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.Local)
+	fresh := Input{LikeCnt: 10, ReadCnt: 100, CollectCnt: 2, UpdateTime: now.Add(-time.Hour), Now: now}
+	stale := Input{LikeCnt: 10, ReadCnt: 100, CollectCnt: 2, UpdateTime: now.Add(-48 * time.Hour), Now: now}
+	popular := Input{LikeCnt: 100, ReadCnt: 1000, CollectCnt: 20, UpdateTime: now.Add(-time.Hour), Now: now}
+
+	for _, name := range []string{StrategyHN, StrategyReddit, StrategyMix} {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(Config{Strategy: name})
+			require.NoError(t, err)
+			// 同样的数据 越新分数越高
+			assert.Greater(t, s.Score(fresh), s.Score(stale))
+			// 同样的时间 数据越好分数越高
+			assert.Greater(t, s.Score(popular), s.Score(fresh))
+		})
+	}
+}
+
+func TestWilsonStrategy(t *testing.T) {
+	s, err := New(Config{Strategy: StrategyWilson})
+	require.NoError(t, err)
+	// 点赞率相同时 样本越多越可信
+	assert.Greater(t,
+		s.Score(Input{LikeCnt: 50, ReadCnt: 100}),
+		s.Score(Input{LikeCnt: 5, ReadCnt: 10}),
+	)
+	assert.Equal(t, float64(0), s.Score(Input{}))
+}
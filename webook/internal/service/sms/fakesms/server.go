@@ -0,0 +1,258 @@
+package fakesms
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/httpsms"
+)
+
+// Config 模拟真实服务商的各种情况 零值表示不模拟
+type Config struct {
+	AppKey string `yaml:"appKey"`
+	Secret string `yaml:"secret"`
+	// 每个请求的延迟
+	Latency time.Duration `yaml:"latency"`
+	// 随机失败的比例 0 到 1
+	ErrorRate float64 `yaml:"errorRate"`
+	// 每个号码在 Interval 内最多发几条 超过返回 429
+	RateLimit int           `yaml:"rateLimit"`
+	Interval  time.Duration `yaml:"interval"`
+	// 请求里的时间戳和服务器的时间最多差多少 默认5分钟
+	MaxSkew time.Duration `yaml:"maxSkew"`
+}
+
+// Message 收到的一条短信 一个请求发给多个号码的时候每个号码一条
+type Message struct {
+	Number     string    `json:"number"`
+	SignName   string    `json:"signName"`
+	TemplateId string    `json:"templateId"`
+	Args       []string  `json:"args"`
+	Time       time.Time `json:"time"`
+}
+
+// Server 实现了 httpsms 的接口 不会真的发短信 只把短信记录下来
+// POST /sms/send 发短信 GET /sms/messages?number= 查看收到的短信
+// 本地开发的时候可以在这里看验证码 测试里可以直接调用 Messages
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+
+	mutex    sync.Mutex
+	messages []Message
+	// 每个号码最近发送的时间 用来限流
+	sent map[string][]time.Time
+	// 用过的 nonce 超过 MaxSkew 之后清理
+	nonces map[string]time.Time
+	// 接下来这么多个请求一定失败
+	failures int
+	rand     *rand.Rand
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = time.Minute * 5
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	s := &Server{
+		cfg:    cfg,
+		mux:    http.NewServeMux(),
+		sent:   map[string][]time.Time{},
+		nonces: map[string]time.Time{},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.mux.HandleFunc("/sms/send", s.send)
+	s.mux.HandleFunc("/sms/messages", s.list)
+	return s
+}
+
+// Start 在 addr 上监听 返回发短信的地址 addr 的端口为0时随机选一个
+func (s *Server) Start(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		_ = http.Serve(l, s)
+	}()
+	return "http://" + l.Addr().String() + "/sms/send", nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Messages 按照收到的顺序
+func (s *Server) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := make([]Message, len(s.messages))
+	copy(res, s.messages)
+	return res
+}
+
+// Last 发给这个号码的最后一条短信
+func (s *Server) Last(number string) (Message, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Number == number {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// FailNext 接下来的 n 个请求返回错误 测试里用来模拟服务商故障
+func (s *Server) FailNext(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = n
+}
+
+// Reset 清空记录
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages = nil
+	s.sent = map[string][]time.Time{}
+	s.failures = 0
+}
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.write(w, http.StatusMethodNotAllowed, http.StatusMethodNotAllowed, "只支持 POST")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		s.write(w, http.StatusBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg, ok := s.verify(r, body); !ok {
+		s.write(w, http.StatusUnauthorized, http.StatusUnauthorized, msg)
+		return
+	}
+	var req httpsms.SendReq
+	err = json.Unmarshal(body, &req)
+	if err != nil || req.TemplateId == "" || len(req.Numbers) == 0 {
+		s.write(w, http.StatusBadRequest, http.StatusBadRequest, "请求参数错误")
+		return
+	}
+
+	if s.cfg.Latency > 0 {
+		select {
+		case <-time.After(s.cfg.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 || (s.cfg.ErrorRate > 0 && s.rand.Float64() < s.cfg.ErrorRate) {
+		if s.failures > 0 {
+			s.failures--
+		}
+		s.write(w, http.StatusOK, 500, "模拟的服务商故障")
+		return
+	}
+	if !s.allow(req.Numbers, now) {
+		s.write(w, http.StatusTooManyRequests, http.StatusTooManyRequests, "发送太频繁")
+		return
+	}
+	for _, number := range req.Numbers {
+		s.sent[number] = append(s.sent[number], now)
+		s.messages = append(s.messages, Message{
+			Number:     number,
+			SignName:   req.SignName,
+			TemplateId: req.TemplateId,
+			Args:       req.Args,
+			Time:       now,
+		})
+	}
+	s.write(w, http.StatusOK, 0, "")
+}
+
+// verify 校验签名 时间戳和 nonce
+func (s *Server) verify(r *http.Request, body []byte) (string, bool) {
+	if r.Header.Get(httpsms.HeaderKey) != s.cfg.AppKey {
+		return "appKey 错误", false
+	}
+	timestamp := r.Header.Get(httpsms.HeaderTimestamp)
+	nonce := r.Header.Get(httpsms.HeaderNonce)
+	sign := httpsms.Sign(s.cfg.Secret, timestamp, nonce, body)
+	if !hmac.Equal([]byte(sign), []byte(r.Header.Get(httpsms.HeaderSignature))) {
+		return "签名错误", false
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	now := time.Now()
+	if err != nil || now.Sub(time.Unix(sec, 0)).Abs() > s.cfg.MaxSkew {
+		return "时间戳过期", false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, t := range s.nonces {
+		if now.Sub(t) > s.cfg.MaxSkew {
+			delete(s.nonces, key)
+		}
+	}
+	if _, ok := s.nonces[nonce]; ok || nonce == "" {
+		return "重复的请求", false
+	}
+	s.nonces[nonce] = now
+	return "", true
+}
+
+// allow 有一个号码超过限制就整个请求都不发
+func (s *Server) allow(numbers []string, now time.Time) bool {
+	if s.cfg.RateLimit <= 0 {
+		return true
+	}
+	for _, number := range numbers {
+		times := s.sent[number]
+		// 只保留窗口内的
+		i := 0
+		for i < len(times) && now.Sub(times[i]) >= s.cfg.Interval {
+			i++
+		}
+		s.sent[number] = times[i:]
+		if len(times)-i >= s.cfg.RateLimit {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	number := r.URL.Query().Get("number")
+	res := make([]Message, 0)
+	for _, msg := range s.Messages() {
+		if number == "" || msg.Number == number {
+			res = append(res, msg)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(httpsms.SendResp{
+		Code:      code,
+		Msg:       msg,
+		RequestId: strconv.FormatInt(time.Now().UnixNano(), 36),
+	})
+}
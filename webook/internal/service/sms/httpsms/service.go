@@ -0,0 +1,145 @@
+package httpsms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRateLimited 服务商限流 换一个服务商或者稍后再试
+var ErrRateLimited = errors.New("短信服务商限流")
+
+// 签名用到的请求头
+const (
+	HeaderKey       = "X-SMS-Key"
+	HeaderTimestamp = "X-SMS-Timestamp"
+	HeaderNonce     = "X-SMS-Nonce"
+	HeaderSignature = "X-SMS-Signature"
+)
+
+// SendReq 发给服务商的请求体
+type SendReq struct {
+	SignName   string   `json:"signName"`
+	TemplateId string   `json:"templateId"`
+	Args       []string `json:"args"`
+	Numbers    []string `json:"numbers"`
+}
+
+// SendResp code 为0表示成功
+type SendResp struct {
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	RequestId string `json:"requestId"`
+}
+
+type Config struct {
+	// 发送短信的地址 例如 http://127.0.0.1:8090/sms/send
+	Endpoint string `yaml:"endpoint"`
+	AppKey   string `yaml:"appKey"`
+	Secret   string `yaml:"secret"`
+	SignName string `yaml:"signName"`
+	// 一次请求最长多久 默认5秒
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Service 对接通用的 HTTP 短信接口
+// 请求体是 JSON 用 HMAC-SHA256 签名 签名的算法见 Sign
+type Service struct {
+	client *http.Client
+	cfg    Config
+}
+
+func NewService(client *http.Client, cfg Config) *Service {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 5
+	}
+	return &Service{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+func (s *Service) Send(ctx context.Context, tplId string, args []string, numbers ...string) error {
+	body, err := json.Marshal(SendReq{
+		SignName:   s.cfg.SignName,
+		TemplateId: tplId,
+		Args:       args,
+		Numbers:    numbers,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderKey, s.cfg.AppKey)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(s.cfg.Secret, timestamp, nonce, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	// 带上一部分响应 方便排查问题
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("短信服务返回 %d %s", resp.StatusCode, string(data))
+	}
+	var res SendResp
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return fmt.Errorf("短信服务的响应无法解析 %w", err)
+	}
+	if res.Code != 0 {
+		return fmt.Errorf("发送短信失败 code: %d, msg: %s, requestId: %s", res.Code, res.Msg, res.RequestId)
+	}
+	return nil
+}
+
+// Sign hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + body))
+// timestamp 是秒级时间戳 服务端同时校验时间和 nonce 防止重放
+func Sign(secret string, timestamp string, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,99 @@
+package httpsms_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/fakesms"
+	"github.com/Anwenya/GeekTime/webook/internal/service/sms/httpsms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Send(t *testing.T) {
+	testCases := []struct {
+		name   string
+		server fakesms.Config
+		// 客户端用的密钥
+		secret string
+		before func(s *fakesms.Server)
+		// 发送的次数 只检查最后一次的结果
+		times int
+
+		wantErr     error
+		wantAnyErr  bool
+		wantMessage int
+	}{
+		{
+			name:        "发送成功",
+			server:      fakesms.Config{AppKey: "key", Secret: "secret"},
+			secret:      "secret",
+			times:       1,
+			wantMessage: 2,
+		},
+		{
+			name:       "签名错误",
+			server:     fakesms.Config{AppKey: "key", Secret: "secret"},
+			secret:     "wrong",
+			times:      1,
+			wantAnyErr: true,
+		},
+		{
+			name:   "服务商故障",
+			server: fakesms.Config{AppKey: "key", Secret: "secret"},
+			secret: "secret",
+			before: func(s *fakesms.Server) {
+				s.FailNext(1)
+			},
+			times:      1,
+			wantAnyErr: true,
+		},
+		{
+			name:        "限流",
+			server:      fakesms.Config{AppKey: "key", Secret: "secret", RateLimit: 2},
+			secret:      "secret",
+			times:       3,
+			wantErr:     httpsms.ErrRateLimited,
+			wantMessage: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := fakesms.NewServer(tc.server)
+			if tc.before != nil {
+				tc.before(server)
+			}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			svc := httpsms.NewService(http.DefaultClient, httpsms.Config{
+				Endpoint: ts.URL + "/sms/send",
+				AppKey:   "key",
+				Secret:   tc.secret,
+				SignName: "webook",
+			})
+			var err error
+			for i := 0; i < tc.times; i++ {
+				err = svc.Send(context.Background(), "tpl", []string{"123456"}, "13800000000", "13900000000")
+			}
+			switch {
+			case tc.wantErr != nil:
+				assert.ErrorIs(t, err, tc.wantErr)
+			case tc.wantAnyErr:
+				assert.Error(t, err)
+			default:
+				require.NoError(t, err)
+			}
+			assert.Len(t, server.Messages(), tc.wantMessage)
+			if tc.wantMessage > 0 {
+				msg, ok := server.Last("13800000000")
+				require.True(t, ok)
+				assert.Equal(t, "tpl", msg.TemplateId)
+				assert.Equal(t, "webook", msg.SignName)
+				assert.Equal(t, []string{"123456"}, msg.Args)
+			}
+		})
+	}
+}
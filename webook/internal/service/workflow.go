@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/repository"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWorkflowNotFound      = repository.ErrWorkflowNotFound
+	ErrDuplicateWorkflowName = repository.ErrDuplicateWorkflowName
+	ErrWorkflowLeaseLost     = repository.ErrWorkflowLeaseLost
+	ErrInvalidWorkflow       = errors.New("工作流定义不合法")
+	// ErrNoWorkflowRun 现在没有需要执行的工作流
+	ErrNoWorkflowRun = errors.New("没有需要执行的工作流")
+)
+
+// WorkflowService 管理工作流
+type WorkflowService interface {
+	// Create 节点引用的任务必须已经存在
+	Create(ctx context.Context, w domain.Workflow) (int64, error)
+	Update(ctx context.Context, w domain.Workflow) error
+	Delete(ctx context.Context, id int64) error
+	Get(ctx context.Context, id int64) (domain.Workflow, error)
+	List(ctx context.Context, offset, limit int) ([]domain.Workflow, error)
+	// Runs 执行记录 按时间倒序
+	Runs(ctx context.Context, workflowId int64, offset, limit int) ([]domain.WorkflowRun, error)
+	// Run 一次执行的详情 包括每个节点的状态
+	Run(ctx context.Context, id int64) (domain.WorkflowRun, error)
+}
+
+type workflowService struct {
+	repo    repository.WorkflowRepository
+	jobRepo repository.CronJobRepository
+}
+
+func NewWorkflowService(
+	repo repository.WorkflowRepository,
+	jobRepo repository.CronJobRepository,
+) WorkflowService {
+	return &workflowService{
+		repo:    repo,
+		jobRepo: jobRepo,
+	}
+}
+
+func (w *workflowService) Create(ctx context.Context, wf domain.Workflow) (int64, error) {
+	err := w.validate(ctx, wf)
+	if err != nil {
+		return 0, err
+	}
+	wf.ScheduledTime = wf.NextTime()
+	return w.repo.Create(ctx, wf)
+}
+
+func (w *workflowService) Update(ctx context.Context, wf domain.Workflow) error {
+	err := w.validate(ctx, wf)
+	if err != nil {
+		return err
+	}
+	wf.ScheduledTime = wf.NextTime()
+	return w.repo.Update(ctx, wf)
+}
+
+func (w *workflowService) Delete(ctx context.Context, id int64) error {
+	return w.repo.Delete(ctx, id)
+}
+
+func (w *workflowService) Get(ctx context.Context, id int64) (domain.Workflow, error) {
+	return w.repo.FindById(ctx, id)
+}
+
+func (w *workflowService) List(ctx context.Context, offset, limit int) ([]domain.Workflow, error) {
+	return w.repo.List(ctx, offset, limit)
+}
+
+func (w *workflowService) Runs(ctx context.Context, workflowId int64, offset, limit int) ([]domain.WorkflowRun, error) {
+	return w.repo.ListRuns(ctx, workflowId, offset, limit)
+}
+
+func (w *workflowService) Run(ctx context.Context, id int64) (domain.WorkflowRun, error) {
+	return w.repo.FindRunById(ctx, id)
+}
+
+func (w *workflowService) validate(ctx context.Context, wf domain.Workflow) error {
+	err := wf.Validate()
+	if err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidWorkflow, err.Error())
+	}
+	names := make([]string, 0, len(wf.Steps))
+	for _, step := range wf.Steps {
+		names = append(names, step.Job)
+	}
+	jobs, err := w.jobRepo.FindByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	if len(jobs) != len(names) {
+		exists := make(map[string]struct{}, len(jobs))
+		for _, job := range jobs {
+			exists[job.Name] = struct{}{}
+		}
+		var missing []string
+		for _, name := range names {
+			if _, ok := exists[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		return fmt.Errorf("%w 任务不存在 %s", ErrInvalidWorkflow, strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// WorkflowRunService 调度器执行工作流时使用
+type WorkflowRunService interface {
+	// Preempt 优先接手崩溃节点留下的执行 然后触发到了时间的工作流
+	// 没有需要执行的返回 ErrNoWorkflowRun
+	// 返回的执行会自动续约 执行完之后要调用 CancelFun
+	Preempt(ctx context.Context, node string) (domain.Workflow, domain.WorkflowRun, error)
+	// Jobs 节点对应的任务 按名字索引
+	Jobs(ctx context.Context, names []string) (map[string]domain.Job, error)
+	// StartStep 记录节点开始执行 同时记录到任务的执行记录里
+	StartStep(ctx context.Context, run domain.WorkflowRun, step domain.WorkflowStepRun, job domain.Job) (domain.JobRun, error)
+	// FinishStep 记录节点的执行结果
+	// 节点还要重试时状态还是执行中
+	FinishStep(ctx context.Context, run domain.WorkflowRun, step domain.WorkflowStepRun, exec domain.JobRun) error
+	FinishRun(ctx context.Context, run domain.WorkflowRun) error
+}
+
+type workflowRunService struct {
+	repo     repository.WorkflowRepository
+	jobRepo  repository.CronJobRepository
+	execRepo repository.JobExecutionRepository
+	l        logger.LoggerV1
+
+	refreshInterval time.Duration
+	// 超过这么久没有续约 认为执行的节点已经崩溃了
+	leaseTimeout time.Duration
+}
+
+func NewWorkflowRunService(
+	repo repository.WorkflowRepository,
+	jobRepo repository.CronJobRepository,
+	execRepo repository.JobExecutionRepository,
+	l logger.LoggerV1,
+) WorkflowRunService {
+	return &workflowRunService{
+		repo:            repo,
+		jobRepo:         jobRepo,
+		execRepo:        execRepo,
+		l:               l,
+		refreshInterval: time.Minute,
+		leaseTimeout:    time.Minute * 2,
+	}
+}
+
+func (w *workflowRunService) Preempt(ctx context.Context, node string) (domain.Workflow, domain.WorkflowRun, error) {
+	wf, run, err := w.resume(ctx, node)
+	if errors.Is(err, ErrNoWorkflowRun) {
+		wf, run, err = w.trigger(ctx, node)
+	}
+	if err != nil {
+		return domain.Workflow{}, domain.WorkflowRun{}, err
+	}
+	w.keepAlive(&run)
+	return wf, run, nil
+}
+
+// resume 接手续约超时的执行
+func (w *workflowRunService) resume(ctx context.Context, node string) (domain.Workflow, domain.WorkflowRun, error) {
+	for {
+		run, err := w.repo.PreemptRun(ctx, node, time.Now().Add(-w.leaseTimeout))
+		if errors.Is(err, repository.ErrWorkflowNotFound) {
+			return domain.Workflow{}, domain.WorkflowRun{}, ErrNoWorkflowRun
+		}
+		if err != nil {
+			return domain.Workflow{}, domain.WorkflowRun{}, err
+		}
+		wf, err := w.repo.FindById(ctx, run.WorkflowId)
+		if err == nil {
+			w.l.Info("接手工作流的执行", logger.Int64("runId", run.Id), logger.String("workflow", run.WorkflowName))
+			return wf, run, nil
+		}
+		if !errors.Is(err, repository.ErrWorkflowNotFound) {
+			return domain.Workflow{}, domain.WorkflowRun{}, err
+		}
+		// 工作流已经被删除了 直接结束
+		run.Status = domain.WorkflowRunFailed
+		run.EndTime = time.Now()
+		err = w.repo.FinishRun(ctx, run)
+		if err != nil {
+			return domain.Workflow{}, domain.WorkflowRun{}, err
+		}
+	}
+}
+
+// trigger 触发到了时间的工作流
+func (w *workflowRunService) trigger(ctx context.Context, node string) (domain.Workflow, domain.WorkflowRun, error) {
+	now := time.Now()
+	wf, err := w.repo.FindDue(ctx, now)
+	if errors.Is(err, repository.ErrWorkflowNotFound) {
+		return domain.Workflow{}, domain.WorkflowRun{}, ErrNoWorkflowRun
+	}
+	if err != nil {
+		return domain.Workflow{}, domain.WorkflowRun{}, err
+	}
+	run := domain.WorkflowRun{
+		WorkflowId:   wf.Id,
+		WorkflowName: wf.Name,
+		Node:         node,
+		StartTime:    now,
+		Steps:        make([]domain.WorkflowStepRun, 0, len(wf.Steps)),
+	}
+	for _, step := range wf.Steps {
+		run.Steps = append(run.Steps, domain.WorkflowStepRun{Job: step.Job})
+	}
+	id, err := w.repo.CreateRun(ctx, wf, wf.NextTime(), run)
+	if errors.Is(err, repository.ErrWorkflowPreempted) {
+		return domain.Workflow{}, domain.WorkflowRun{}, ErrNoWorkflowRun
+	}
+	if err != nil {
+		return domain.Workflow{}, domain.WorkflowRun{}, err
+	}
+	if id == 0 {
+		w.l.Warn("上一次执行还没有结束 跳过这一次", logger.String("workflow", wf.Name))
+		return domain.Workflow{}, domain.WorkflowRun{}, ErrNoWorkflowRun
+	}
+	// 拿到节点的 id
+	run, err = w.repo.FindRunById(ctx, id)
+	return wf, run, err
+}
+
+// keepAlive 定时续约 续约时发现被别人接手了就通知执行的节点停下来
+func (w *workflowRunService) keepAlive(run *domain.WorkflowRun) {
+	ticker := time.NewTicker(w.refreshInterval)
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	id, version := run.Id, run.Version
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				err := w.repo.RefreshRun(ctx, id, version)
+				cancel()
+				if err == nil {
+					continue
+				}
+				w.l.Error("工作流续约失败", logger.Error(err), logger.Int64("runId", id))
+				if errors.Is(err, repository.ErrWorkflowLeaseLost) {
+					close(lost)
+					return
+				}
+			}
+		}
+	}()
+	run.LeaseLost = lost
+	run.CancelFun = func() {
+		close(done)
+	}
+}
+
+func (w *workflowRunService) Jobs(ctx context.Context, names []string) (map[string]domain.Job, error) {
+	jobs, err := w.jobRepo.FindByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]domain.Job, len(jobs))
+	for _, job := range jobs {
+		res[job.Name] = job
+	}
+	return res, nil
+}
+
+func (w *workflowRunService) StartStep(
+	ctx context.Context,
+	run domain.WorkflowRun,
+	step domain.WorkflowStepRun,
+	job domain.Job,
+) (domain.JobRun, error) {
+	err := w.repo.UpdateStep(ctx, run, step)
+	if err != nil {
+		return domain.JobRun{}, err
+	}
+	exec := domain.JobRun{
+		JobId:     job.Id,
+		JobName:   job.Name,
+		Node:      run.Node,
+		Attempt:   step.Attempt,
+		StartTime: step.StartTime,
+		Status:    domain.JobRunStatusRunning,
+	}
+	exec.Id, err = w.execRepo.Create(ctx, exec)
+	if err != nil {
+		// 执行记录不影响工作流
+		w.l.Error("记录任务执行失败", logger.Error(err), logger.Int64("jid", job.Id))
+	}
+	return exec, nil
+}
+
+func (w *workflowRunService) FinishStep(
+	ctx context.Context,
+	run domain.WorkflowRun,
+	step domain.WorkflowStepRun,
+	exec domain.JobRun,
+) error {
+	if len(step.Error) > maxJobErrorLen {
+		step.Error = strings.ToValidUTF8(step.Error[:maxJobErrorLen], "")
+	}
+	if exec.Id > 0 {
+		exec.EndTime = step.EndTime
+		exec.Error = step.Error
+		exec.Status = domain.JobRunStatusFailed
+		if step.Status == domain.WorkflowStepSuccess {
+			exec.Status = domain.JobRunStatusSuccess
+		}
+		err := w.execRepo.Finish(ctx, exec)
+		if err != nil {
+			w.l.Error("记录任务执行结果失败", logger.Error(err), logger.Int64("jid", exec.JobId))
+		}
+	}
+	return w.repo.UpdateStep(ctx, run, step)
+}
+
+func (w *workflowRunService) FinishRun(ctx context.Context, run domain.WorkflowRun) error {
+	return w.repo.FinishRun(ctx, run)
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/web/token"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx/decorator"
+	"github.com/Anwenya/GeekTime/webook/pkg/logger"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// 一次最多查询的天数
+	maxAnalyticsDays     = 90
+	defaultAnalyticsTopN = 10
+)
+
+var errInvalidDateRange = errors.New("日期范围错误")
+
+type AnalyticsHandler struct {
+	svc service.AnalyticsService
+	l   logger.LoggerV1
+}
+
+func NewAnalyticsHandler(svc service.AnalyticsService, l logger.LoggerV1) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		svc: svc,
+		l:   l,
+	}
+}
+
+func (h *AnalyticsHandler) RegisterRoutes(server *gin.Engine) {
+	group := server.Group("/analytics")
+	group.GET("/articles", decorator.WrapBodyAndClaims[AnalyticsReq, token.UserClaims](h.Articles))
+	group.GET("/articles/export", h.Export)
+}
+
+func (h *AnalyticsHandler) Articles(
+	ctx *gin.Context,
+	req AnalyticsReq,
+	uc token.UserClaims,
+) (ginx.Result, error) {
+	start, end, err := h.parseRange(req)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	res, err := h.svc.AuthorTrend(ctx, uc.Uid, start, end, h.topN(req))
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: h.toVo(res)}, nil
+}
+
+// Export 导出 CSV 每篇文章每天一行 最后是所有文章的汇总
+func (h *AnalyticsHandler) Export(ctx *gin.Context) {
+	var req AnalyticsReq
+	if err := ctx.BindQuery(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(token.UserClaims)
+	start, end, err := h.parseRange(req)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginx.Result{Code: 4, Msg: err.Error()})
+		return
+	}
+	res, err := h.svc.AuthorTrend(ctx, uc.Uid, start, end, h.topN(req))
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginx.Result{Code: 5, Msg: "系统错误"})
+		h.l.Error(
+			"导出文章数据失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err),
+		)
+		return
+	}
+
+	filename := fmt.Sprintf("analytics_%s_%s.csv", start.Format("20060102"), end.Format("20060102"))
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	ctx.Status(http.StatusOK)
+
+	w := csv.NewWriter(ctx.Writer)
+	_ = w.Write([]string{
+		"day", "article_id", "title",
+		"read_cnt", "read_delta",
+		"like_cnt", "like_delta",
+		"collect_cnt", "collect_delta",
+	})
+	for _, trend := range res.Articles {
+		for _, stat := range trend.Stats {
+			_ = w.Write(h.csvRow(strconv.FormatInt(trend.Article.Id, 10), trend.Article.Title, stat))
+		}
+	}
+	for _, stat := range res.Total {
+		_ = w.Write(h.csvRow("total", "", stat))
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		h.l.Error(
+			"写入 CSV 失败",
+			logger.Int64("uid", uc.Uid),
+			logger.Error(err),
+		)
+	}
+}
+
+func (h *AnalyticsHandler) csvRow(id string, title string, stat domain.DailyStat) []string {
+	return []string{
+		stat.Day.Format(time.DateOnly), id, title,
+		strconv.FormatInt(stat.ReadCnt, 10), strconv.FormatInt(stat.ReadDelta, 10),
+		strconv.FormatInt(stat.LikeCnt, 10), strconv.FormatInt(stat.LikeDelta, 10),
+		strconv.FormatInt(stat.CollectCnt, 10), strconv.FormatInt(stat.CollectDelta, 10),
+	}
+}
+
+func (h *AnalyticsHandler) parseRange(req AnalyticsReq) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(time.DateOnly, req.Start, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errInvalidDateRange
+	}
+	end, err := time.ParseInLocation(time.DateOnly, req.End, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errInvalidDateRange
+	}
+	if end.Before(start) || end.Sub(start) >= maxAnalyticsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errInvalidDateRange
+	}
+	return start, end, nil
+}
+
+func (h *AnalyticsHandler) topN(req AnalyticsReq) int {
+	if req.TopN <= 0 {
+		return defaultAnalyticsTopN
+	}
+	return req.TopN
+}
+
+func (h *AnalyticsHandler) toVo(res domain.AuthorAnalytics) AuthorAnalyticsVo {
+	toTrendVos := func(trends []domain.ArticleTrend) []ArticleTrendVo {
+		return slice.Map[domain.ArticleTrend, ArticleTrendVo](
+			trends,
+			func(idx int, src domain.ArticleTrend) ArticleTrendVo {
+				return ArticleTrendVo{
+					Id:          src.Article.Id,
+					Title:       src.Article.Title,
+					ReadGain:    src.ReadGain,
+					LikeGain:    src.LikeGain,
+					CollectGain: src.CollectGain,
+					Stats:       h.toStatVos(src.Stats),
+				}
+			},
+		)
+	}
+	return AuthorAnalyticsVo{
+		Start:       res.Start.Format(time.DateOnly),
+		End:         res.End.Format(time.DateOnly),
+		Total:       h.toStatVos(res.Total),
+		Articles:    toTrendVos(res.Articles),
+		TopArticles: toTrendVos(res.TopArticles),
+	}
+}
+
+func (h *AnalyticsHandler) toStatVos(stats []domain.DailyStat) []DailyStatVo {
+	return slice.Map[domain.DailyStat, DailyStatVo](
+		stats,
+		func(idx int, src domain.DailyStat) DailyStatVo {
+			return DailyStatVo{
+				Day:          src.Day.Format(time.DateOnly),
+				ReadCnt:      src.ReadCnt,
+				LikeCnt:      src.LikeCnt,
+				CollectCnt:   src.CollectCnt,
+				ReadDelta:    src.ReadDelta,
+				LikeDelta:    src.LikeDelta,
+				CollectDelta: src.CollectDelta,
+			}
+		},
+	)
+}
@@ -0,0 +1,35 @@
+package web
+
+type AnalyticsReq struct {
+	// 格式 2006-01-02 包含首尾两天
+	Start string `form:"start" json:"start"`
+	End   string `form:"end" json:"end"`
+	TopN  int    `form:"topN" json:"topN"`
+}
+
+type DailyStatVo struct {
+	Day          string `json:"day"`
+	ReadCnt      int64  `json:"readCnt"`
+	LikeCnt      int64  `json:"likeCnt"`
+	CollectCnt   int64  `json:"collectCnt"`
+	ReadDelta    int64  `json:"readDelta"`
+	LikeDelta    int64  `json:"likeDelta"`
+	CollectDelta int64  `json:"collectDelta"`
+}
+
+type ArticleTrendVo struct {
+	Id          int64         `json:"id"`
+	Title       string        `json:"title"`
+	ReadGain    int64         `json:"readGain"`
+	LikeGain    int64         `json:"likeGain"`
+	CollectGain int64         `json:"collectGain"`
+	Stats       []DailyStatVo `json:"stats"`
+}
+
+type AuthorAnalyticsVo struct {
+	Start       string           `json:"start"`
+	End         string           `json:"end"`
+	Total       []DailyStatVo    `json:"total"`
+	Articles    []ArticleTrendVo `json:"articles"`
+	TopArticles []ArticleTrendVo `json:"topArticles"`
+}
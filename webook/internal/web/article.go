@@ -32,7 +32,7 @@ func NewArticleHandler(
 		l:                  l,
 		articleService:     articleService,
 		interactiveService: interactiveService,
-		biz:                "article",
+		biz:                domain.BizArticle,
 	}
 }
 
@@ -57,6 +57,12 @@ func (h *ArticleHandler) Edit(
 	req ArticleEditReq,
 	uc token.UserClaims,
 ) (ginx.Result, error) {
+	if !service.ValidReadMetric(req.ReadMetric) {
+		return ginx.Result{Code: 4, Msg: "阅读指标错误"}, nil
+	}
+	if !service.ValidArticleLabels(req.Category, req.Tags) {
+		return ginx.Result{Code: 4, Msg: "分类或标签错误"}, nil
+	}
 	id, err := h.articleService.Save(
 		ctx,
 		domain.Article{
@@ -66,6 +72,9 @@ func (h *ArticleHandler) Edit(
 			Author: domain.Author{
 				Id: uc.Uid,
 			},
+			ReadMetric: req.ReadMetric,
+			Category:   req.Category,
+			Tags:       req.Tags,
 		},
 	)
 	if err != nil {
@@ -79,7 +88,12 @@ func (h *ArticleHandler) Publish(
 	req PublishReq,
 	uc token.UserClaims,
 ) (ginx.Result, error) {
-
+	if !service.ValidReadMetric(req.ReadMetric) {
+		return ginx.Result{Code: 4, Msg: "阅读指标错误"}, nil
+	}
+	if !service.ValidArticleLabels(req.Category, req.Tags) {
+		return ginx.Result{Code: 4, Msg: "分类或标签错误"}, nil
+	}
 	id, err := h.articleService.Publish(
 		ctx,
 		domain.Article{
@@ -89,6 +103,9 @@ func (h *ArticleHandler) Publish(
 			Author: domain.Author{
 				Id: uc.Uid,
 			},
+			ReadMetric: req.ReadMetric,
+			Category:   req.Category,
+			Tags:       req.Tags,
 		},
 	)
 	if err != nil {
@@ -176,6 +193,9 @@ func (h *ArticleHandler) Detail(ctx *gin.Context) {
 		Content:    art.Content,
 		AuthorId:   art.Author.Id,
 		Status:     art.Status.ToUint8(),
+		ReadMetric: art.ReadMetric,
+		Category:   art.Category,
+		Tags:       art.Tags,
 		CreateTime: art.CreateTime.Format(time.DateTime),
 		UpdateTime: art.UpdateTime.Format(time.DateTime),
 	}
@@ -315,8 +335,11 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 				Content:    art.Content,
 				AuthorId:   art.Author.Id,
 				AuthorName: art.Author.Name,
+				Category:   art.Category,
+				Tags:       art.Tags,
 
 				ReadCnt:    interactive.Interactive.ReadCnt,
+				UvCnt:      interactive.Interactive.UvCnt,
 				CollectCnt: interactive.Interactive.CollectCnt,
 				LikeCnt:    interactive.Interactive.LikeCnt,
 				Liked:      interactive.Interactive.Liked,
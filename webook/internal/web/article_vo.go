@@ -1,15 +1,19 @@
 package web
 
 type ArticleVo struct {
-	Id         int64  `json:"id,omitempty"`
-	Title      string `json:"title,omitempty"`
-	Abstract   string `json:"abstract,omitempty"`
-	Content    string `json:"content,omitempty"`
-	AuthorId   int64  `json:"authorId,omitempty"`
-	AuthorName string `json:"authorName,omitempty"`
-	Status     uint8  `json:"status,omitempty"`
+	Id         int64    `json:"id,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Abstract   string   `json:"abstract,omitempty"`
+	Content    string   `json:"content,omitempty"`
+	AuthorId   int64    `json:"authorId,omitempty"`
+	AuthorName string   `json:"authorName,omitempty"`
+	Status     uint8    `json:"status,omitempty"`
+	ReadMetric string   `json:"readMetric,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
 
 	ReadCnt    int64 `json:"readCnt"`
+	UvCnt      int64 `json:"uvCnt"`
 	LikeCnt    int64 `json:"likeCnt"`
 	CollectCnt int64 `json:"collectCnt"`
 	Liked      bool  `json:"liked"`
@@ -23,12 +27,20 @@ type PublishReq struct {
 	Id      int64
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// 参与排名的阅读指标 read_cnt 或者 uv_cnt 不传时使用榜单的配置
+	ReadMetric string `json:"readMetric"`
+	// 分类和标签 用于按分类和按标签分组的榜单
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
 }
 
 type ArticleEditReq struct {
-	Id      int64
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Id         int64
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	ReadMetric string   `json:"readMetric"`
+	Category   string   `json:"category"`
+	Tags       []string `json:"tags"`
 }
 
 type ArticleWithdrawReq struct {
@@ -0,0 +1,323 @@
+package web
+
+import (
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/job"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/web/middleware"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx/decorator"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// JobHandler 定时任务的管理接口 只有管理员可以访问
+type JobHandler struct {
+	svc      service.JobAdminService
+	registry *job.Registry
+	admins   []int64
+}
+
+func NewJobHandler(svc service.JobAdminService, registry *job.Registry, admins []int64) *JobHandler {
+	return &JobHandler{
+		svc:      svc,
+		registry: registry,
+		admins:   admins,
+	}
+}
+
+func (h *JobHandler) RegisterRoutes(server *gin.Engine) {
+	group := server.Group("/jobs")
+	group.Use(middleware.NewAdminMiddlewareBuilder(h.admins).Build())
+	group.POST("/create", decorator.WrapBody[JobReq](h.Create))
+	group.POST("/update", decorator.WrapBody[JobReq](h.Update))
+	group.POST("/delete", decorator.WrapBody[JobIdReq](h.Delete))
+	group.POST("/pause", decorator.WrapBody[JobIdReq](h.Pause))
+	group.POST("/resume", decorator.WrapBody[JobIdReq](h.Resume))
+	group.POST("/run", decorator.WrapBody[JobIdReq](h.Run))
+	group.GET("/list", decorator.WrapBody[JobListReq](h.List))
+	group.GET("/detail/:id", decorator.Wrap(h.Detail))
+	group.GET("/preview", decorator.WrapBody[JobPreviewReq](h.Preview))
+	group.GET("/executions", decorator.WrapBody[JobExecutionListReq](h.Executions))
+	// 只看失败的执行记录
+	group.GET("/failures", decorator.WrapBody[JobExecutionListReq](h.Failures))
+	group.GET("/nodes", decorator.Wrap(h.Nodes))
+	// 代码里注册的任务 包括只在本地执行的
+	group.GET("/registry", decorator.Wrap(h.Registry))
+}
+
+func (h *JobHandler) Create(ctx *gin.Context, req JobReq) (ginx.Result, error) {
+	job, err := h.toDomain(req)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	id, err := h.svc.Create(ctx, job)
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: id}, nil
+}
+
+func (h *JobHandler) Update(ctx *gin.Context, req JobReq) (ginx.Result, error) {
+	job, err := h.toDomain(req)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	return h.result(h.svc.Update(ctx, job))
+}
+
+func (h *JobHandler) Delete(ctx *gin.Context, req JobIdReq) (ginx.Result, error) {
+	return h.result(h.svc.Delete(ctx, req.Id))
+}
+
+func (h *JobHandler) Pause(ctx *gin.Context, req JobIdReq) (ginx.Result, error) {
+	return h.result(h.svc.Pause(ctx, req.Id))
+}
+
+func (h *JobHandler) Resume(ctx *gin.Context, req JobIdReq) (ginx.Result, error) {
+	return h.result(h.svc.Resume(ctx, req.Id))
+}
+
+// Run 立刻执行一次 由抢到任务的节点执行
+func (h *JobHandler) Run(ctx *gin.Context, req JobIdReq) (ginx.Result, error) {
+	return h.result(h.svc.Trigger(ctx, req.Id))
+}
+
+func (h *JobHandler) List(ctx *gin.Context, req JobListReq) (ginx.Result, error) {
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	jobs, err := h.svc.List(ctx, req.Offset, req.Limit)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.Job, JobVo](jobs, func(idx int, src domain.Job) JobVo {
+			return h.toVo(src)
+		}),
+	}, nil
+}
+
+func (h *JobHandler) Detail(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: "参数错误"}, nil
+	}
+	job, err := h.svc.Get(ctx, id)
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: h.toVo(job)}, nil
+}
+
+func (h *JobHandler) Executions(ctx *gin.Context, req JobExecutionListReq) (ginx.Result, error) {
+	var status domain.JobRunStatus
+	switch req.Status {
+	case "":
+	case domain.JobRunStatusSuccess.String():
+		status = domain.JobRunStatusSuccess
+	case domain.JobRunStatusFailed.String():
+		status = domain.JobRunStatusFailed
+	case domain.JobRunStatusRunning.String():
+		status = domain.JobRunStatusRunning
+	case domain.JobRunStatusYielded.String():
+		status = domain.JobRunStatusYielded
+	default:
+		return ginx.Result{Code: 4, Msg: "status 参数错误"}, nil
+	}
+	return h.executions(ctx, req, status)
+}
+
+func (h *JobHandler) Failures(ctx *gin.Context, req JobExecutionListReq) (ginx.Result, error) {
+	return h.executions(ctx, req, domain.JobRunStatusFailed)
+}
+
+func (h *JobHandler) executions(
+	ctx *gin.Context,
+	req JobExecutionListReq,
+	status domain.JobRunStatus,
+) (ginx.Result, error) {
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	runs, err := h.svc.Executions(ctx, req.JobId, status, req.Offset, req.Limit)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.JobRun, JobRunVo](runs, func(idx int, src domain.JobRun) JobRunVo {
+			return h.toRunVo(src)
+		}),
+	}, nil
+}
+
+// Nodes 存活的调度器节点
+func (h *JobHandler) Nodes(ctx *gin.Context) (ginx.Result, error) {
+	nodes, err := h.svc.Nodes(ctx)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.JobNode, JobNodeVo](nodes, func(idx int, src domain.JobNode) JobNodeVo {
+			return JobNodeVo{
+				Name:          src.Name,
+				StartTime:     src.StartTime.UnixMilli(),
+				HeartbeatTime: src.HeartbeatTime.UnixMilli(),
+			}
+		}),
+	}, nil
+}
+
+func (h *JobHandler) Registry(ctx *gin.Context) (ginx.Result, error) {
+	return ginx.Result{
+		Data: slice.Map[job.Definition, JobDefinitionVo](h.registry.Definitions(),
+			func(idx int, src job.Definition) JobDefinitionVo {
+				return JobDefinitionVo{
+					Name:     src.Name,
+					Spec:     src.Spec,
+					Mode:     src.Mode.String(),
+					Executor: src.Executor,
+				}
+			}),
+	}, nil
+}
+
+// Preview 保存之前先看一下表达式对不对
+func (h *JobHandler) Preview(ctx *gin.Context, req JobPreviewReq) (ginx.Result, error) {
+	if req.N <= 0 {
+		req.N = 5
+	}
+	times, err := h.svc.Preview(req.Expression, req.Timezone, req.N)
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[time.Time, string](times, func(idx int, src time.Time) string {
+			return src.Format(time.DateTime)
+		}),
+	}, nil
+}
+
+func (h *JobHandler) result(err error) (ginx.Result, error) {
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+// bizErr 调用方可以处理的错误
+func (h *JobHandler) bizErr(err error) (ginx.Result, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidJob):
+		return ginx.Result{Code: 4, Msg: err.Error()}, true
+	case errors.Is(err, service.ErrJobNotFound):
+		return ginx.Result{Code: 4, Msg: "任务不存在"}, true
+	case errors.Is(err, service.ErrDuplicateJobName):
+		return ginx.Result{Code: 4, Msg: err.Error()}, true
+	case errors.Is(err, service.ErrJobPaused):
+		return ginx.Result{Code: 4, Msg: err.Error()}, true
+	}
+	return ginx.Result{}, false
+}
+
+// toDomain 返回的错误可以直接展示给调用方
+func (h *JobHandler) toDomain(req JobReq) (domain.Job, error) {
+	mode, ok := domain.ParseJobMode(req.Mode)
+	if !ok {
+		return domain.Job{}, errors.New("mode 参数错误")
+	}
+	misfire, ok := domain.ParseJobMisfirePolicy(req.Misfire)
+	if !ok {
+		return domain.Job{}, errors.New("misfire 参数错误")
+	}
+	var maxDuration time.Duration
+	if req.MaxDuration != "" {
+		var err error
+		maxDuration, err = time.ParseDuration(req.MaxDuration)
+		if err != nil {
+			return domain.Job{}, errors.New("maxDuration 参数错误")
+		}
+	}
+	return domain.Job{
+		Id:          req.Id,
+		Name:        req.Name,
+		Executor:    req.Executor,
+		Expression:  req.Expression,
+		Config:      req.Config,
+		Mode:        mode,
+		Shards:      req.Shards,
+		Timezone:    req.Timezone,
+		Misfire:     misfire,
+		MaxDuration: maxDuration,
+		Priority:    req.Priority,
+	}, nil
+}
+
+func (h *JobHandler) toVo(job domain.Job) JobVo {
+	return JobVo{
+		Id:          job.Id,
+		Name:        job.Name,
+		Executor:    job.Executor,
+		Expression:  job.Expression,
+		Config:      job.Config,
+		Mode:        job.Mode.String(),
+		Shards:      job.Shards,
+		Timezone:    job.Timezone,
+		Misfire:     job.Misfire.String(),
+		MaxDuration: h.duration(job.MaxDuration),
+		Priority:    job.Priority,
+		Status:      job.Status.String(),
+		NextTime:    h.millis(job.ScheduledTime),
+		TriggerTime: h.millis(job.TriggerTime),
+		Attempt:     job.Attempt,
+		LastRun:     h.toRunVo(job.LastRun),
+		CreateTime:  job.CreateTime.UnixMilli(),
+		UpdateTime:  job.UpdateTime.UnixMilli(),
+	}
+}
+
+func (h *JobHandler) toRunVo(run domain.JobRun) JobRunVo {
+	return JobRunVo{
+		Id:        run.Id,
+		JobId:     run.JobId,
+		JobName:   run.JobName,
+		Node:      run.Node,
+		Attempt:   run.Attempt,
+		TaskId:    run.TaskId,
+		Shard:     run.Shard,
+		StartTime: h.millis(run.StartTime),
+		EndTime:   h.millis(run.EndTime),
+		Status:    run.Status.String(),
+		Error:     run.Error,
+	}
+}
+
+func (h *JobHandler) millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// duration 0 表示不限制 返回空字符串
+func (h *JobHandler) duration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/web/token"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx/decorator"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeJobAdminService 记录收到的任务 返回预设的错误
+type fakeJobAdminService struct {
+	service.JobAdminService
+	job     domain.Job
+	err     error
+	preview []time.Time
+}
+
+func (f *fakeJobAdminService) Create(ctx context.Context, job domain.Job) (int64, error) {
+	f.job = job
+	return 1, f.err
+}
+
+func (f *fakeJobAdminService) Trigger(ctx context.Context, id int64) error {
+	f.job.Id = id
+	return f.err
+}
+
+func (f *fakeJobAdminService) Preview(expression string, tz string, n int) ([]time.Time, error) {
+	f.job.Expression = expression
+	f.job.Timezone = tz
+	return f.preview[:min(n, len(f.preview))], f.err
+}
+
+func TestJobHandler(t *testing.T) {
+	decorator.InitCounter(prometheus.CounterOpts{Name: "job_handler_test"})
+	first := time.Date(2026, 1, 1, 8, 0, 0, 0, time.Local)
+	testCases := []struct {
+		name   string
+		uid    int64
+		method string
+		path   string
+		body   any
+		err    error
+
+		wantCode int
+		wantRes  ginx.Result
+		wantJob  domain.Job
+	}{
+		{
+			name:   "创建成功",
+			uid:    1,
+			method: http.MethodPost,
+			path:   "/jobs/create",
+			body: JobReq{
+				Name:        "ranking",
+				Executor:    "local",
+				Expression:  "@every 30m",
+				Mode:        "sharding",
+				Shards:      4,
+				MaxDuration: "10m",
+				Priority:    5,
+			},
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Data: float64(1)},
+			wantJob: domain.Job{
+				Name:        "ranking",
+				Executor:    "local",
+				Expression:  "@every 30m",
+				Mode:        domain.JobModeSharding,
+				Shards:      4,
+				MaxDuration: 10 * time.Minute,
+				Priority:    5,
+			},
+		},
+		{
+			name:     "执行方式错误",
+			uid:      1,
+			method:   http.MethodPost,
+			path:     "/jobs/create",
+			body:     JobReq{Name: "ranking", Mode: "unknown"},
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Code: 4, Msg: "mode 参数错误"},
+		},
+		{
+			name:     "任务定义不合法",
+			uid:      1,
+			method:   http.MethodPost,
+			path:     "/jobs/create",
+			body:     JobReq{Name: "ranking"},
+			err:      service.ErrInvalidJob,
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Code: 4, Msg: service.ErrInvalidJob.Error()},
+			wantJob:  domain.Job{Name: "ranking"},
+		},
+		{
+			name:     "系统错误",
+			uid:      1,
+			method:   http.MethodPost,
+			path:     "/jobs/create",
+			body:     JobReq{Name: "ranking"},
+			err:      errors.New("模拟的数据库错误"),
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Code: 5, Msg: "系统错误"},
+			wantJob:  domain.Job{Name: "ranking"},
+		},
+		{
+			name:     "暂停的任务不能执行",
+			uid:      1,
+			method:   http.MethodPost,
+			path:     "/jobs/run",
+			body:     JobIdReq{Id: 3},
+			err:      service.ErrJobPaused,
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Code: 4, Msg: service.ErrJobPaused.Error()},
+			wantJob:  domain.Job{Id: 3},
+		},
+		{
+			name:     "任务不存在",
+			uid:      1,
+			method:   http.MethodPost,
+			path:     "/jobs/run",
+			body:     JobIdReq{Id: 3},
+			err:      service.ErrJobNotFound,
+			wantCode: http.StatusOK,
+			wantRes:  ginx.Result{Code: 4, Msg: "任务不存在"},
+			wantJob:  domain.Job{Id: 3},
+		},
+		{
+			name:     "预览",
+			uid:      1,
+			method:   http.MethodGet,
+			path:     "/jobs/preview?expression=0+0+8+*+*+*&timezone=Asia/Shanghai&n=2",
+			wantCode: http.StatusOK,
+			wantRes: ginx.Result{Data: []any{
+				first.Format(time.DateTime),
+				first.Add(24 * time.Hour).Format(time.DateTime),
+			}},
+			wantJob: domain.Job{Expression: "0 0 8 * * *", Timezone: "Asia/Shanghai"},
+		},
+		{
+			name:     "不是管理员",
+			uid:      2,
+			method:   http.MethodPost,
+			path:     "/jobs/run",
+			body:     JobIdReq{Id: 3},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &fakeJobAdminService{
+				err:     tc.err,
+				preview: []time.Time{first, first.Add(24 * time.Hour), first.Add(48 * time.Hour)},
+			}
+			hdl := NewJobHandler(svc, nil, []int64{1})
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				ctx.Set("user", token.UserClaims{Uid: tc.uid})
+			})
+			hdl.RegisterRoutes(server)
+
+			var body []byte
+			if tc.body != nil {
+				var err error
+				body, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+			req, err := http.NewRequest(tc.method, tc.path, bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if recorder.Code != http.StatusOK {
+				assert.Equal(t, domain.Job{}, svc.job)
+				return
+			}
+			var res ginx.Result
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&res))
+			assert.Equal(t, tc.wantRes, res)
+			assert.Equal(t, tc.wantJob, svc.job)
+		})
+	}
+}
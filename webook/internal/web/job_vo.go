@@ -0,0 +1,101 @@
+package web
+
+type JobReq struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+	// 执行器的名字 例如 local
+	Executor   string `json:"executor"`
+	Expression string `json:"expression"`
+	Config     string `json:"config"`
+	// single broadcast sharding 默认 single
+	Mode string `json:"mode"`
+	// 分片任务拆成几个分片
+	Shards int `json:"shards"`
+	// 例如 Asia/Shanghai 为空时使用服务器的时区
+	Timezone string `json:"timezone"`
+	// fire_once fire_all skip 默认 fire_once
+	Misfire string `json:"misfire"`
+	// 一次执行最长多久 例如 30m 为空时不限制
+	MaxDuration string `json:"maxDuration"`
+	// 越大越先执行 默认0
+	Priority int `json:"priority"`
+}
+
+type JobIdReq struct {
+	Id int64 `json:"id"`
+}
+
+type JobListReq struct {
+	Offset int `form:"offset"`
+	Limit  int `form:"limit"`
+}
+
+// JobExecutionListReq jobId 为0时查询所有任务
+type JobExecutionListReq struct {
+	JobId int64 `form:"jobId"`
+	// success failed running yielded 不传时查询所有状态
+	Status string `form:"status"`
+	Offset int    `form:"offset"`
+	Limit  int    `form:"limit"`
+}
+
+type JobPreviewReq struct {
+	Expression string `form:"expression"`
+	Timezone   string `form:"timezone"`
+	// 预览多少次 默认五次
+	N int `form:"n"`
+}
+
+// JobVo 时间都是毫秒时间戳 0 表示没有
+type JobVo struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Executor    string `json:"executor"`
+	Expression  string `json:"expression"`
+	Config      string `json:"config"`
+	Mode        string `json:"mode"`
+	Shards      int    `json:"shards"`
+	Timezone    string `json:"timezone"`
+	Misfire     string `json:"misfire"`
+	MaxDuration string `json:"maxDuration"`
+	Priority    int    `json:"priority"`
+	Status      string `json:"status"`
+	NextTime    int64  `json:"nextTime"`
+	// 手动触发了还没有执行
+	TriggerTime int64 `json:"triggerTime"`
+	// 连续失败的次数
+	Attempt    int      `json:"attempt"`
+	LastRun    JobRunVo `json:"lastRun"`
+	CreateTime int64    `json:"createTime"`
+	UpdateTime int64    `json:"updateTime"`
+}
+
+type JobRunVo struct {
+	Id      int64  `json:"id,omitempty"`
+	JobId   int64  `json:"jobId,omitempty"`
+	JobName string `json:"jobName,omitempty"`
+	Node    string `json:"node,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	// 广播和分片任务的子任务
+	TaskId    int64  `json:"taskId,omitempty"`
+	Shard     int    `json:"shard"`
+	StartTime int64  `json:"startTime"`
+	EndTime   int64  `json:"endTime"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+}
+
+type JobNodeVo struct {
+	Name          string `json:"name"`
+	StartTime     int64  `json:"startTime"`
+	HeartbeatTime int64  `json:"heartbeatTime"`
+}
+
+type JobDefinitionVo struct {
+	Name string `json:"name"`
+	Spec string `json:"spec"`
+	// local singleton broadcast
+	Mode string `json:"mode"`
+	// 为空表示在本节点执行
+	Executor string `json:"executor"`
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"errors"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx/decorator"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// 轨迹一次最多查询的时间范围
+const maxRankingTrajectoryRange = 31 * 24 * time.Hour
+
+type RankingHandler struct {
+	svc       service.RankingListService
+	snapshots service.RankingSnapshotService
+}
+
+func NewRankingHandler(
+	svc service.RankingListService,
+	snapshots service.RankingSnapshotService,
+) *RankingHandler {
+	return &RankingHandler{
+		svc:       svc,
+		snapshots: snapshots,
+	}
+}
+
+func (h *RankingHandler) RegisterRoutes(server *gin.Engine) {
+	group := server.Group("/ranking/:name")
+	group.GET("", decorator.Wrap(h.TopN))
+	group.GET("/history", decorator.WrapBody[RankingHistoryReq](h.History))
+	group.GET("/trajectory", decorator.WrapBody[RankingTrajectoryReq](h.Trajectory))
+	group.GET("/moves", decorator.WrapBody[RankingMovesReq](h.Moves))
+}
+
+// TopN 分组的榜单通过 authorId category 或者 tag 参数指定分组
+func (h *RankingHandler) TopN(ctx *gin.Context) (ginx.Result, error) {
+	group := service.RankingGroup{
+		Category: ctx.Query("category"),
+		Tag:      ctx.Query("tag"),
+	}
+	if idStr := ctx.Query("authorId"); idStr != "" {
+		var err error
+		group.AuthorId, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return ginx.Result{Code: 4, Msg: "authorId 参数错误"}, nil
+		}
+	}
+	arts, err := h.svc.GetTopN(ctx, ctx.Param("name"), group)
+	if errors.Is(err, service.ErrUnknownRankingList) {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.Article, ArticleVo](
+			arts,
+			func(idx int, src domain.Article) ArticleVo {
+				return ArticleVo{
+					Id:         src.Id,
+					Title:      src.Title,
+					Abstract:   src.Abstract(),
+					AuthorId:   src.Author.Id,
+					AuthorName: src.Author.Name,
+					Category:   src.Category,
+					Tags:       src.Tags,
+					CreateTime: src.CreateTime.Format(time.DateTime),
+					UpdateTime: src.UpdateTime.Format(time.DateTime),
+				}
+			},
+		),
+	}, nil
+}
+
+// History 某个时刻正在展示的榜单
+func (h *RankingHandler) History(ctx *gin.Context, req RankingHistoryReq) (ginx.Result, error) {
+	at := time.Now()
+	if req.At > 0 {
+		at = time.UnixMilli(req.At)
+	}
+	snapshot, err := h.snapshots.AsOf(ctx, ctx.Param("name"), at)
+	if errors.Is(err, service.ErrRankingSnapshotNotFound) {
+		return ginx.Result{Code: 4, Msg: "没有这个时刻的榜单"}, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: RankingSnapshotVo{
+			Id:    snapshot.Id,
+			Name:  snapshot.Name,
+			Ctime: snapshot.Ctime.UnixMilli(),
+			Items: slice.Map[domain.RankingSnapshotItem, RankingSnapshotItemVo](
+				snapshot.Items,
+				func(idx int, src domain.RankingSnapshotItem) RankingSnapshotItemVo {
+					return RankingSnapshotItemVo{
+						ArticleId: src.ArticleId,
+						Position:  src.Position,
+						Score:     src.Score,
+					}
+				},
+			),
+		},
+	}, nil
+}
+
+// Trajectory 文章在一段时间内的名次变化
+func (h *RankingHandler) Trajectory(ctx *gin.Context, req RankingTrajectoryReq) (ginx.Result, error) {
+	start, end := time.UnixMilli(req.Start), time.UnixMilli(req.End)
+	if req.Aid <= 0 || end.Before(start) || end.Sub(start) > maxRankingTrajectoryRange {
+		return ginx.Result{Code: 4, Msg: "参数错误"}, nil
+	}
+	points, err := h.snapshots.Trajectory(ctx, ctx.Param("name"), req.Aid, start, end)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.RankPoint, RankPointVo](
+			points,
+			func(idx int, src domain.RankPoint) RankPointVo {
+				return RankPointVo{
+					SnapshotId: src.SnapshotId,
+					Time:       src.Time.UnixMilli(),
+					Position:   src.Position,
+					Score:      src.Score,
+				}
+			},
+		),
+	}, nil
+}
+
+// Moves 两个时刻之间名次的变化
+func (h *RankingHandler) Moves(ctx *gin.Context, req RankingMovesReq) (ginx.Result, error) {
+	if req.From <= 0 || req.To <= 0 {
+		return ginx.Result{Code: 4, Msg: "参数错误"}, nil
+	}
+	moves, err := h.snapshots.Moves(ctx, ctx.Param("name"), time.UnixMilli(req.From), time.UnixMilli(req.To))
+	if errors.Is(err, service.ErrRankingSnapshotNotFound) {
+		return ginx.Result{Code: 4, Msg: "没有这个时刻的榜单"}, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.RankMove, RankMoveVo](
+			moves,
+			func(idx int, src domain.RankMove) RankMoveVo {
+				return RankMoveVo{
+					ArticleId: src.ArticleId,
+					From:      src.From,
+					To:        src.To,
+					Delta:     src.Delta(),
+				}
+			},
+		),
+	}, nil
+}
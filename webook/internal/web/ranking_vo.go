@@ -0,0 +1,47 @@
+package web
+
+// RankingHistoryReq 时间都是毫秒时间戳
+type RankingHistoryReq struct {
+	// 查询这个时刻的榜单 为0时查询当前的
+	At int64 `form:"at"`
+}
+
+type RankingTrajectoryReq struct {
+	Aid   int64 `form:"aid"`
+	Start int64 `form:"start"`
+	End   int64 `form:"end"`
+}
+
+type RankingMovesReq struct {
+	From int64 `form:"from"`
+	To   int64 `form:"to"`
+}
+
+type RankingSnapshotVo struct {
+	Id    int64                   `json:"id"`
+	Name  string                  `json:"name"`
+	Ctime int64                   `json:"ctime"`
+	Items []RankingSnapshotItemVo `json:"items"`
+}
+
+type RankingSnapshotItemVo struct {
+	ArticleId int64   `json:"articleId"`
+	Position  int     `json:"position"`
+	Score     float64 `json:"score"`
+}
+
+type RankPointVo struct {
+	SnapshotId int64 `json:"snapshotId"`
+	Time       int64 `json:"time"`
+	// 0 表示不在榜上
+	Position int     `json:"position"`
+	Score    float64 `json:"score"`
+}
+
+type RankMoveVo struct {
+	ArticleId int64 `json:"articleId"`
+	From      int   `json:"from"`
+	To        int   `json:"to"`
+	// 正数表示名次上升
+	Delta int `json:"delta"`
+}
@@ -0,0 +1,265 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Anwenya/GeekTime/webook/internal/domain"
+	"github.com/Anwenya/GeekTime/webook/internal/service"
+	"github.com/Anwenya/GeekTime/webook/internal/web/middleware"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx"
+	"github.com/Anwenya/GeekTime/webook/pkg/ginx/decorator"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
+)
+
+// WorkflowHandler 工作流的管理接口 只有管理员可以访问
+type WorkflowHandler struct {
+	svc    service.WorkflowService
+	admins []int64
+}
+
+func NewWorkflowHandler(svc service.WorkflowService, admins []int64) *WorkflowHandler {
+	return &WorkflowHandler{
+		svc:    svc,
+		admins: admins,
+	}
+}
+
+func (h *WorkflowHandler) RegisterRoutes(server *gin.Engine) {
+	group := server.Group("/jobs/workflows")
+	group.Use(middleware.NewAdminMiddlewareBuilder(h.admins).Build())
+	group.POST("/create", decorator.WrapBody[WorkflowReq](h.Create))
+	group.POST("/update", decorator.WrapBody[WorkflowReq](h.Update))
+	group.POST("/delete", decorator.WrapBody[WorkflowIdReq](h.Delete))
+	group.GET("/list", decorator.WrapBody[JobListReq](h.List))
+	group.GET("/detail/:id", decorator.Wrap(h.Detail))
+	group.GET("/runs", decorator.WrapBody[WorkflowRunListReq](h.Runs))
+	group.GET("/runs/:id", decorator.Wrap(h.Run))
+}
+
+func (h *WorkflowHandler) Create(ctx *gin.Context, req WorkflowReq) (ginx.Result, error) {
+	wf, err := h.toDomain(req)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	id, err := h.svc.Create(ctx, wf)
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: id}, nil
+}
+
+func (h *WorkflowHandler) Update(ctx *gin.Context, req WorkflowReq) (ginx.Result, error) {
+	wf, err := h.toDomain(req)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: err.Error()}, nil
+	}
+	return h.result(h.svc.Update(ctx, wf))
+}
+
+func (h *WorkflowHandler) Delete(ctx *gin.Context, req WorkflowIdReq) (ginx.Result, error) {
+	return h.result(h.svc.Delete(ctx, req.Id))
+}
+
+func (h *WorkflowHandler) List(ctx *gin.Context, req JobListReq) (ginx.Result, error) {
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	wfs, err := h.svc.List(ctx, req.Offset, req.Limit)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.Workflow, WorkflowVo](wfs, func(idx int, src domain.Workflow) WorkflowVo {
+			return h.toVo(src)
+		}),
+	}, nil
+}
+
+func (h *WorkflowHandler) Detail(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: "参数错误"}, nil
+	}
+	wf, err := h.svc.Get(ctx, id)
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: h.toVo(wf)}, nil
+}
+
+func (h *WorkflowHandler) Runs(ctx *gin.Context, req WorkflowRunListReq) (ginx.Result, error) {
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	runs, err := h.svc.Runs(ctx, req.WorkflowId, req.Offset, req.Limit)
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{
+		Data: slice.Map[domain.WorkflowRun, WorkflowRunVo](runs, func(idx int, src domain.WorkflowRun) WorkflowRunVo {
+			return h.toRunVo(src)
+		}),
+	}, nil
+}
+
+// Run 一次执行的详情 包括每个节点的状态
+func (h *WorkflowHandler) Run(ctx *gin.Context) (ginx.Result, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return ginx.Result{Code: 4, Msg: "参数错误"}, nil
+	}
+	run, err := h.svc.Run(ctx, id)
+	if errors.Is(err, service.ErrWorkflowNotFound) {
+		return ginx.Result{Code: 4, Msg: "执行记录不存在"}, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Data: h.toRunVo(run)}, nil
+}
+
+func (h *WorkflowHandler) result(err error) (ginx.Result, error) {
+	if res, ok := h.bizErr(err); ok {
+		return res, nil
+	}
+	if err != nil {
+		return ginx.Result{Code: 5, Msg: "系统错误"}, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *WorkflowHandler) bizErr(err error) (ginx.Result, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWorkflow):
+		return ginx.Result{Code: 4, Msg: err.Error()}, true
+	case errors.Is(err, service.ErrWorkflowNotFound):
+		return ginx.Result{Code: 4, Msg: "工作流不存在"}, true
+	case errors.Is(err, service.ErrDuplicateWorkflowName):
+		return ginx.Result{Code: 4, Msg: err.Error()}, true
+	}
+	return ginx.Result{}, false
+}
+
+func (h *WorkflowHandler) toDomain(req WorkflowReq) (domain.Workflow, error) {
+	wf := domain.Workflow{
+		Id:         req.Id,
+		Name:       req.Name,
+		Expression: req.Expression,
+		Steps:      make([]domain.WorkflowStep, 0, len(req.Steps)),
+	}
+	for _, step := range req.Steps {
+		s := domain.WorkflowStep{
+			Job:       step.Job,
+			Depends:   step.Depends,
+			OnFailure: domain.WorkflowFailurePolicy(step.OnFailure),
+		}
+		if step.Retry != nil {
+			retry, err := h.toRetry(*step.Retry)
+			if err != nil {
+				return domain.Workflow{}, fmt.Errorf("节点 %s 的重试间隔错误", step.Job)
+			}
+			s.Retry = retry
+		}
+		wf.Steps = append(wf.Steps, s)
+	}
+	return wf, nil
+}
+
+// toRetry 没有配置的部分和任务的重试策略默认值一样
+func (h *WorkflowHandler) toRetry(req WorkflowRetryReq) (domain.JobRetryPolicy, error) {
+	res := domain.JobRetryPolicy{
+		MaxAttempts:     req.MaxAttempts,
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute * 10,
+		Multiplier:      2,
+	}
+	var err error
+	if req.InitialInterval != "" {
+		res.InitialInterval, err = time.ParseDuration(req.InitialInterval)
+		if err != nil {
+			return res, err
+		}
+	}
+	if req.MaxInterval != "" {
+		res.MaxInterval, err = time.ParseDuration(req.MaxInterval)
+		if err != nil {
+			return res, err
+		}
+	}
+	if req.Multiplier > 0 {
+		res.Multiplier = req.Multiplier
+	}
+	return res, nil
+}
+
+func (h *WorkflowHandler) toVo(wf domain.Workflow) WorkflowVo {
+	return WorkflowVo{
+		Id:         wf.Id,
+		Name:       wf.Name,
+		Expression: wf.Expression,
+		Steps: slice.Map[domain.WorkflowStep, WorkflowStepReq](
+			wf.Steps,
+			func(idx int, src domain.WorkflowStep) WorkflowStepReq {
+				step := WorkflowStepReq{
+					Job:       src.Job,
+					Depends:   src.Depends,
+					OnFailure: string(src.OnFailure),
+				}
+				if src.OnFailure == domain.WorkflowFailureRetry {
+					step.Retry = &WorkflowRetryReq{
+						MaxAttempts:     src.Retry.MaxAttempts,
+						InitialInterval: src.Retry.InitialInterval.String(),
+						MaxInterval:     src.Retry.MaxInterval.String(),
+						Multiplier:      src.Retry.Multiplier,
+					}
+				}
+				return step
+			},
+		),
+		Status:     wf.Status.String(),
+		NextTime:   h.millis(wf.ScheduledTime),
+		CreateTime: wf.CreateTime.UnixMilli(),
+		UpdateTime: wf.UpdateTime.UnixMilli(),
+	}
+}
+
+func (h *WorkflowHandler) toRunVo(run domain.WorkflowRun) WorkflowRunVo {
+	return WorkflowRunVo{
+		Id:           run.Id,
+		WorkflowId:   run.WorkflowId,
+		WorkflowName: run.WorkflowName,
+		Node:         run.Node,
+		Status:       run.Status.String(),
+		StartTime:    h.millis(run.StartTime),
+		EndTime:      h.millis(run.EndTime),
+		Steps: slice.Map[domain.WorkflowStepRun, WorkflowStepRunVo](
+			run.Steps,
+			func(idx int, src domain.WorkflowStepRun) WorkflowStepRunVo {
+				return WorkflowStepRunVo{
+					Job:       src.Job,
+					Status:    src.Status.String(),
+					Attempt:   src.Attempt,
+					StartTime: h.millis(src.StartTime),
+					EndTime:   h.millis(src.EndTime),
+					Error:     src.Error,
+				}
+			},
+		),
+	}
+}
+
+func (h *WorkflowHandler) millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
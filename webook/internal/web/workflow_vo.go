@@ -0,0 +1,67 @@
+package web
+
+type WorkflowReq struct {
+	Id         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Expression string            `json:"expression"`
+	Steps      []WorkflowStepReq `json:"steps"`
+}
+
+type WorkflowStepReq struct {
+	// 任务的名字
+	Job     string   `json:"job"`
+	Depends []string `json:"depends"`
+	// stop skip retry 默认 stop
+	OnFailure string            `json:"onFailure"`
+	Retry     *WorkflowRetryReq `json:"retry"`
+}
+
+// WorkflowRetryReq 时间间隔的格式是 10s 1m 这种
+type WorkflowRetryReq struct {
+	MaxAttempts     int     `json:"maxAttempts"`
+	InitialInterval string  `json:"initialInterval"`
+	MaxInterval     string  `json:"maxInterval"`
+	Multiplier      float64 `json:"multiplier"`
+}
+
+type WorkflowIdReq struct {
+	Id int64 `json:"id"`
+}
+
+type WorkflowRunListReq struct {
+	WorkflowId int64 `form:"workflowId"`
+	Offset     int   `form:"offset"`
+	Limit      int   `form:"limit"`
+}
+
+// WorkflowVo 时间都是毫秒时间戳
+type WorkflowVo struct {
+	Id         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Expression string            `json:"expression"`
+	Steps      []WorkflowStepReq `json:"steps"`
+	Status     string            `json:"status"`
+	NextTime   int64             `json:"nextTime"`
+	CreateTime int64             `json:"createTime"`
+	UpdateTime int64             `json:"updateTime"`
+}
+
+type WorkflowRunVo struct {
+	Id           int64               `json:"id"`
+	WorkflowId   int64               `json:"workflowId"`
+	WorkflowName string              `json:"workflowName"`
+	Node         string              `json:"node"`
+	Status       string              `json:"status"`
+	StartTime    int64               `json:"startTime"`
+	EndTime      int64               `json:"endTime"`
+	Steps        []WorkflowStepRunVo `json:"steps,omitempty"`
+}
+
+type WorkflowStepRunVo struct {
+	Job       string `json:"job"`
+	Status    string `json:"status"`
+	Attempt   int    `json:"attempt"`
+	StartTime int64  `json:"startTime"`
+	EndTime   int64  `json:"endTime"`
+	Error     string `json:"error"`
+}
@@ -33,15 +33,19 @@ func main() {
 		}
 	}
 
-	app.cron.Start()
+	// 分布式任务先同步到数据库再开始调度
+	err := app.jobs.Start()
+	if err != nil {
+		zap.L().Panic("启动失败", zap.Error(err))
+	}
 	defer func() {
-		// 等待定时任务退出
-		<-app.cron.Stop().Done()
+		// 等待本地任务退出
+		<-app.jobs.Stop().Done()
 	}()
 
 	server := app.server
 
-	err := server.Run(config.Config.App.HttpServerAddress)
+	err = server.Run(config.Config.App.HttpServerAddress)
 	if err != nil {
 		zap.L().Panic("启动失败", zap.Error(err))
 	}
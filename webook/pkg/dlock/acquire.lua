@@ -0,0 +1,11 @@
+-- 抢到锁之后从全局的计数器拿一个 fencing token
+-- 所有的锁共用一个计数器 对同一个锁来说也是单调递增的
+local key = KEYS[1]
+local tokenKey = KEYS[2]
+local owner = ARGV[1]
+local ttl = ARGV[2]
+
+if redis.call("SET", key, owner, "NX", "PX", ttl) then
+    return redis.call("INCR", tokenKey)
+end
+return 0
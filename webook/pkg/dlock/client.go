@@ -0,0 +1,135 @@
+package dlock
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// Client 基于 Store 的锁 抢到之后在后台自动续约
+type Client struct {
+	store Store
+	// 锁的过期时间
+	ttl time.Duration
+	// 续约的间隔
+	refreshInterval time.Duration
+	// 抢锁失败之后重试的间隔
+	retryInterval time.Duration
+}
+
+// NewClient ttl 是锁的过期时间 每隔 ttl/3 续约一次
+func NewClient(store Store, ttl time.Duration) *Client {
+	return &Client{
+		store:           store,
+		ttl:             ttl,
+		refreshInterval: ttl / 3,
+		retryInterval:   time.Millisecond * 100,
+	}
+}
+
+func (c *Client) TryLock(ctx context.Context, key string) (Lock, error) {
+	owner := uuid.NewString()
+	token, err := c.store.Acquire(ctx, key, owner, c.ttl)
+	if err != nil {
+		return nil, err
+	}
+	lockCtx, cancel := context.WithCancelCause(context.Background())
+	l := &storeLock{
+		client: c,
+		key:    key,
+		owner:  owner,
+		token:  token,
+		ctx:    WithToken(lockCtx, c.store.Name(), token),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go l.autoRefresh()
+	return l, nil
+}
+
+func (c *Client) Lock(ctx context.Context, key string) (Lock, error) {
+	for {
+		l, err := c.TryLock(ctx, key)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(c.retryInterval):
+		}
+	}
+}
+
+type storeLock struct {
+	client *Client
+	key    string
+	// 区分不同的持有者 续约和释放的时候校验
+	owner string
+	token int64
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// 续约的 goroutine 已经退出
+	done chan struct{}
+	once sync.Once
+}
+
+func (l *storeLock) Key() string {
+	return l.key
+}
+
+func (l *storeLock) Token() int64 {
+	return l.token
+}
+
+func (l *storeLock) Context() context.Context {
+	return l.ctx
+}
+
+func (l *storeLock) Held() bool {
+	return l.ctx.Err() == nil
+}
+
+// Unlock 停止续约并释放锁
+func (l *storeLock) Unlock(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		l.cancel(ErrUnlocked)
+		<-l.done
+		err = l.client.store.Release(ctx, l.key, l.owner)
+	})
+	return err
+}
+
+// autoRefresh 续约失败时重试 一直失败到锁过期就认为锁已经丢了
+func (l *storeLock) autoRefresh() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.client.refreshInterval)
+	defer ticker.Stop()
+	// 最后一次续约成功的时间
+	last := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(l.ctx, l.client.refreshInterval)
+		err := l.client.store.Refresh(ctx, l.key, l.owner, l.client.ttl)
+		cancel()
+		switch {
+		case err == nil:
+			last = time.Now()
+		case errors.Is(err, ErrLockLost):
+			l.cancel(ErrLockLost)
+			return
+		case time.Since(last)+l.client.refreshInterval >= l.client.ttl:
+			// 下次续约之前锁就过期了
+			l.cancel(ErrLockLost)
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package dlock
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+// StoreSuite Redis 和 MySQL 的实现要有一样的表现
+type StoreSuite struct {
+	suite.Suite
+	newStore func(t *testing.T) (Store, func(key string))
+	store    Store
+	// 让锁立刻过期
+	expire func(key string)
+}
+
+func TestRedisStore(t *testing.T) {
+	suite.Run(t, &StoreSuite{newStore: func(t *testing.T) (Store, func(key string)) {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		return NewRedisStore(client), func(key string) {
+			mr.Del(key)
+		}
+	}})
+}
+
+func TestMySQLStore(t *testing.T) {
+	suite.Run(t, &StoreSuite{newStore: func(t *testing.T) (Store, func(key string)) {
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+			Logger: glogger.Default.LogMode(glogger.Silent),
+		})
+		require.NoError(t, err)
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+		require.NoError(t, db.AutoMigrate(&DistributedLock{}))
+		return NewMySQLStore(db), func(key string) {
+			err := db.Model(&DistributedLock{}).Where("name = ?", key).
+				Update("expire_time", 0).Error
+			require.NoError(t, err)
+		}
+	}})
+}
+
+func (s *StoreSuite) SetupTest() {
+	s.store, s.expire = s.newStore(s.T())
+}
+
+func (s *StoreSuite) TestAcquire() {
+	t := s.T()
+	ctx := context.Background()
+	token, err := s.store.Acquire(ctx, "a", "owner1", time.Minute)
+	require.NoError(t, err)
+
+	_, err = s.store.Acquire(ctx, "a", "owner2", time.Minute)
+	assert.Equal(t, ErrLocked, err)
+	// 不同的锁互不影响
+	_, err = s.store.Acquire(ctx, "b", "owner2", time.Minute)
+	assert.NoError(t, err)
+
+	// 释放之后别人可以抢到 token 更大
+	require.NoError(t, s.store.Release(ctx, "a", "owner1"))
+	next, err := s.store.Acquire(ctx, "a", "owner2", time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, next, token)
+
+	// 过期之后也可以
+	s.expire("a")
+	last, err := s.store.Acquire(ctx, "a", "owner3", time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, last, next)
+}
+
+func (s *StoreSuite) TestRefreshAndRelease() {
+	t := s.T()
+	ctx := context.Background()
+	_, err := s.store.Acquire(ctx, "a", "owner1", time.Minute)
+	require.NoError(t, err)
+	assert.NoError(t, s.store.Refresh(ctx, "a", "owner1", time.Minute))
+	assert.Equal(t, ErrLockLost, s.store.Refresh(ctx, "a", "owner2", time.Minute))
+
+	// 只能释放自己的锁
+	require.NoError(t, s.store.Release(ctx, "a", "owner2"))
+	_, err = s.store.Acquire(ctx, "a", "owner2", time.Minute)
+	assert.Equal(t, ErrLocked, err)
+
+	s.expire("a")
+	_, err = s.store.Acquire(ctx, "a", "owner2", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, ErrLockLost, s.store.Refresh(ctx, "a", "owner1", time.Minute))
+}
+
+func TestClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := NewClient(NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})), time.Millisecond*300)
+	ctx := context.Background()
+
+	lock, err := client.TryLock(ctx, "a")
+	require.NoError(t, err)
+	token, ok := TokenFromContext(lock.Context())
+	assert.True(t, ok)
+	assert.Equal(t, lock.Token(), token)
+	fence, ok := FenceFromContext(lock.Context())
+	assert.True(t, ok)
+	assert.Equal(t, Fence{Source: "redis", Token: token}, fence)
+
+	// 续约之后一直持有
+	mr.FastForward(time.Millisecond * 200)
+	time.Sleep(time.Millisecond * 250)
+	mr.FastForward(time.Millisecond * 200)
+	assert.True(t, lock.Held())
+	_, err = client.TryLock(ctx, "a")
+	assert.Equal(t, ErrLocked, err)
+
+	// 锁被别人抢走之后通过 ctx 通知
+	mr.Del("a")
+	other, err := client.TryLock(ctx, "a")
+	require.NoError(t, err)
+	assert.Greater(t, other.Token(), lock.Token())
+	select {
+	case <-lock.Context().Done():
+		assert.Equal(t, ErrLockLost, context.Cause(lock.Context()))
+	case <-time.After(time.Second):
+		t.Fatal("没有收到丢锁的通知")
+	}
+
+	require.NoError(t, other.Unlock(ctx))
+	assert.Equal(t, ErrUnlocked, context.Cause(other.Context()))
+	// 可以重复释放
+	assert.NoError(t, other.Unlock(ctx))
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	lock, err = client.Lock(waitCtx, "a")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+}
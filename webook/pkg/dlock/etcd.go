@@ -0,0 +1,218 @@
+package dlock
+
+import (
+	"context"
+	"errors"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcdv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"sync"
+	"time"
+)
+
+// EtcdLocker 基于 etcd 的选举 适合排行榜这种单例任务
+// 每次竞选一个 session session 的租约由客户端自动续约
+// 节点崩溃或者和 etcd 断开太久 租约过期 leader 的 key 被删除 下一个竞选者自动当选
+// token 是 etcd 的版本号 只能和同样来自 etcd 的 token 比较
+type EtcdLocker struct {
+	client *etcdv3.Client
+	// 竞选时写入的值 用来观察谁是 leader
+	node string
+	// session 租约的过期时间 秒
+	ttl    int
+	prefix string
+}
+
+func NewEtcdLocker(client *etcdv3.Client, node string, ttl time.Duration) *EtcdLocker {
+	return &EtcdLocker{
+		client: client,
+		node:   node,
+		ttl:    max(int(ttl.Seconds()), 1),
+		prefix: "/dlock/",
+	}
+}
+
+// TryLock 已经有 leader 时返回 ErrLocked
+func (e *EtcdLocker) TryLock(ctx context.Context, key string) (Lock, error) {
+	return e.campaign(ctx, key, true)
+}
+
+// Lock 一直竞选到当选或者 ctx 过期
+func (e *EtcdLocker) Lock(ctx context.Context, key string) (Lock, error) {
+	return e.campaign(ctx, key, false)
+}
+
+// Observe leader 变化的时候通知新 leader 的节点名字 ctx 取消之后关闭
+// 开始观察时已经有 leader 的话会先通知一次
+// 只是读 不需要创建 session 和租约
+func (e *EtcdLocker) Observe(ctx context.Context, key string) (<-chan string, error) {
+	res := make(chan string)
+	go func() {
+		defer close(res)
+		e.observe(ctx, e.prefix+key+"/", res)
+	}()
+	return res, nil
+}
+
+// observe 和 concurrency.Election 的 Observe 一样 竞选者的 key 都在 prefix 下面
+// 创建版本最小的就是 leader
+func (e *EtcdLocker) observe(ctx context.Context, prefix string, res chan<- string) {
+	for ctx.Err() == nil {
+		resp, err := e.client.Get(ctx, prefix, etcdv3.WithFirstCreate()...)
+		if err != nil {
+			return
+		}
+		var leader *mvccpb.KeyValue
+		if len(resp.Kvs) > 0 {
+			leader = resp.Kvs[0]
+		} else {
+			// 没有 leader 第一个写入的竞选者就是 leader
+			leader = e.waitPut(ctx, prefix, resp.Header.Revision+1)
+			if leader == nil {
+				return
+			}
+		}
+		if !send(ctx, res, string(leader.Value)) {
+			return
+		}
+		// 等 leader 退位 期间 leader 更新了值也要通知
+		if !e.waitDelete(ctx, leader, res) {
+			return
+		}
+	}
+}
+
+func (e *EtcdLocker) waitPut(ctx context.Context, prefix string, rev int64) *mvccpb.KeyValue {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for resp := range e.client.Watch(ctx, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(rev)) {
+		if resp.Err() != nil {
+			return nil
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == etcdv3.EventTypePut {
+				return ev.Kv
+			}
+		}
+	}
+	return nil
+}
+
+// waitDelete leader 的 key 被删除之后返回 true
+func (e *EtcdLocker) waitDelete(ctx context.Context, leader *mvccpb.KeyValue, res chan<- string) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for resp := range e.client.Watch(ctx, string(leader.Key), etcdv3.WithRev(leader.ModRevision+1)) {
+		if resp.Err() != nil {
+			return false
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == etcdv3.EventTypeDelete {
+				return true
+			}
+			if !send(ctx, res, string(ev.Kv.Value)) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+func send(ctx context.Context, res chan<- string, leader string) bool {
+	select {
+	case res <- leader:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (e *EtcdLocker) campaign(ctx context.Context, key string, try bool) (Lock, error) {
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(e.ttl))
+	if err != nil {
+		return nil, err
+	}
+	election := concurrency.NewElection(session, e.prefix+key)
+	if try {
+		_, err = election.Leader(ctx)
+		if err == nil {
+			_ = session.Close()
+			return nil, ErrLocked
+		}
+		if !errors.Is(err, concurrency.ErrElectionNoLeader) {
+			_ = session.Close()
+			return nil, err
+		}
+	}
+	// 查询之后有人先当选了 会一直等到 ctx 过期
+	err = election.Campaign(ctx, e.node)
+	if err != nil {
+		_ = session.Close()
+		if try && ctx.Err() != nil {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+
+	lockCtx, cancel := context.WithCancelCause(context.Background())
+	// leader 的 key 的创建版本 etcd 的版本号全局递增 可以直接当 fencing token
+	// 和 redis mysql 的 token 没有可比性 所以 Fence 的 Source 是 etcd
+	token := election.Rev()
+	l := &etcdLock{
+		key:      key,
+		token:    token,
+		session:  session,
+		election: election,
+		ctx:      WithToken(lockCtx, "etcd", token),
+		cancel:   cancel,
+	}
+	go func() {
+		select {
+		case <-session.Done():
+			// 租约过期 已经不是 leader 了
+			cancel(ErrLockLost)
+		case <-lockCtx.Done():
+		}
+	}()
+	return l, nil
+}
+
+type etcdLock struct {
+	key      string
+	token    int64
+	session  *concurrency.Session
+	election *concurrency.Election
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	once   sync.Once
+}
+
+func (l *etcdLock) Key() string {
+	return l.key
+}
+
+func (l *etcdLock) Token() int64 {
+	return l.token
+}
+
+func (l *etcdLock) Context() context.Context {
+	return l.ctx
+}
+
+func (l *etcdLock) Held() bool {
+	return l.ctx.Err() == nil
+}
+
+// Unlock 放弃 leader 并关闭 session
+func (l *etcdLock) Unlock(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		l.cancel(ErrUnlocked)
+		err = l.election.Resign(ctx)
+		if er := l.session.Close(); err == nil {
+			err = er
+		}
+	})
+	return err
+}
@@ -0,0 +1,114 @@
+package dlock
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	etcdv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEtcdLocker(t *testing.T) {
+	client := startEtcd(t)
+	node1 := NewEtcdLocker(client, "node1", time.Second*5)
+	node2 := NewEtcdLocker(client, "node2", time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	leaders, err := node1.Observe(ctx, "ranking")
+	require.NoError(t, err)
+	// 观察不需要租约
+	leases, err := client.Leases(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, leases.Leases)
+
+	lock, err := node1.TryLock(ctx, "ranking")
+	require.NoError(t, err)
+	assert.Equal(t, "node1", <-leaders)
+	token, ok := TokenFromContext(lock.Context())
+	assert.True(t, ok)
+	assert.Equal(t, lock.Token(), token)
+
+	_, err = node2.TryLock(ctx, "ranking")
+	assert.Equal(t, ErrLocked, err)
+	// 不同的任务互不影响
+	other, err := node2.TryLock(ctx, "other")
+	require.NoError(t, err)
+	require.NoError(t, other.Unlock(ctx))
+
+	// leader 放弃之后 等待中的节点当选
+	acquired := make(chan Lock)
+	go func() {
+		l, er := node2.Lock(ctx, "ranking")
+		assert.NoError(t, er)
+		acquired <- l
+	}()
+	time.Sleep(time.Millisecond * 200)
+	require.NoError(t, lock.Unlock(ctx))
+	assert.Equal(t, ErrUnlocked, context.Cause(lock.Context()))
+	next := <-acquired
+	assert.Equal(t, "node2", <-leaders)
+	assert.Greater(t, next.Token(), lock.Token())
+
+	// 租约没了就不再是 leader
+	_, err = client.Revoke(ctx, next.(*etcdLock).session.Lease())
+	require.NoError(t, err)
+	select {
+	case <-next.Context().Done():
+		assert.Equal(t, ErrLockLost, context.Cause(next.Context()))
+	case <-ctx.Done():
+		t.Fatal("没有收到失去 leader 的通知")
+	}
+	lock, err = node1.TryLock(ctx, "ranking")
+	require.NoError(t, err)
+	assert.Equal(t, "node1", <-leaders)
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func startEtcd(t *testing.T) *etcdv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL := localURL(t)
+	peerURL := localURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(time.Second * 10):
+		t.Fatal("etcd 启动超时")
+	}
+
+	client, err := etcdv3.New(etcdv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// localURL 找一个空闲的端口
+func localURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	u, err := url.Parse(fmt.Sprintf("http://%s", addr))
+	require.NoError(t, err)
+	return *u
+}
@@ -0,0 +1,12 @@
+package dlock
+
+import _ "embed"
+
+//go:embed acquire.lua
+var luaAcquire string
+
+//go:embed refresh.lua
+var luaRefresh string
+
+//go:embed release.lua
+var luaRelease string
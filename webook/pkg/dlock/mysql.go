@@ -0,0 +1,106 @@
+package dlock
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// MySQLStore 每个锁一行 过期时间是应用的时间 节点之间的时钟偏差要远小于 ttl
+// 释放锁的时候不删除这一行 fencing token 才能一直递增
+type MySQLStore struct {
+	db *gorm.DB
+}
+
+func NewMySQLStore(db *gorm.DB) Store {
+	return &MySQLStore{db: db}
+}
+
+func (m *MySQLStore) Name() string {
+	return "mysql"
+}
+
+func (m *MySQLStore) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error) {
+	now := time.Now().UnixMilli()
+	db := m.db.WithContext(ctx)
+	// 第一次有人用这个锁
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&DistributedLock{
+		Name:       key,
+		Owner:      owner,
+		Token:      1,
+		ExpireTime: now + ttl.Milliseconds(),
+		Utime:      now,
+		Ctime:      now,
+	})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return 1, nil
+	}
+
+	// 锁已经过期或者被释放了
+	res = db.Model(&DistributedLock{}).
+		Where("name = ? AND expire_time < ?", key, now).
+		Updates(map[string]any{
+			"owner":       owner,
+			"token":       gorm.Expr("token + 1"),
+			"expire_time": now + ttl.Milliseconds(),
+			"utime":       now,
+		})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, ErrLocked
+	}
+	var l DistributedLock
+	err := db.Where("name = ? AND owner = ?", key, owner).First(&l).Error
+	if err == gorm.ErrRecordNotFound {
+		// 刚抢到就因为时钟偏差被别人抢走了
+		return 0, ErrLocked
+	}
+	return l.Token, err
+}
+
+func (m *MySQLStore) Refresh(ctx context.Context, key string, owner string, ttl time.Duration) error {
+	now := time.Now().UnixMilli()
+	res := m.db.WithContext(ctx).
+		Model(&DistributedLock{}).
+		Where("name = ? AND owner = ?", key, owner).
+		Updates(map[string]any{
+			"expire_time": now + ttl.Milliseconds(),
+			"utime":       now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (m *MySQLStore) Release(ctx context.Context, key string, owner string) error {
+	return m.db.WithContext(ctx).
+		Model(&DistributedLock{}).
+		Where("name = ? AND owner = ?", key, owner).
+		Updates(map[string]any{
+			"owner":       "",
+			"expire_time": 0,
+			"utime":       time.Now().UnixMilli(),
+		}).Error
+}
+
+type DistributedLock struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Name  string `gorm:"type:varchar(255);unique"`
+	Owner string `gorm:"type:varchar(64)"`
+	// fencing token 每次被抢到加一
+	Token int64
+	// 毫秒
+	ExpireTime int64
+	Utime      int64
+	Ctime      int64
+}
@@ -0,0 +1,51 @@
+package dlock
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RedisStore 锁的值是持有者 过期时间就是锁的租约
+type RedisStore struct {
+	client redis.Cmdable
+	// fencing token 的计数器
+	tokenKey string
+}
+
+func NewRedisStore(client redis.Cmdable) Store {
+	return &RedisStore{
+		client:   client,
+		tokenKey: "dlock:fencing",
+	}
+}
+
+func (r *RedisStore) Name() string {
+	return "redis"
+}
+
+func (r *RedisStore) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error) {
+	token, err := r.client.Eval(ctx, luaAcquire, []string{key, r.tokenKey}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, ErrLocked
+	}
+	return token, nil
+}
+
+func (r *RedisStore) Refresh(ctx context.Context, key string, owner string, ttl time.Duration) error {
+	res, err := r.client.Eval(ctx, luaRefresh, []string{key}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *RedisStore) Release(ctx context.Context, key string, owner string) error {
+	return r.client.Eval(ctx, luaRelease, []string{key}, owner).Err()
+}
@@ -0,0 +1,82 @@
+package dlock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrLocked 锁被别人持有
+	ErrLocked = errors.New("锁被其他人持有")
+	// ErrLockLost 续约失败 锁可能已经被别人抢走了
+	ErrLockLost = errors.New("锁已经丢失")
+	// ErrUnlocked 锁已经主动释放
+	ErrUnlocked = errors.New("锁已经释放")
+)
+
+// Locker 单例任务只依赖这个接口
+// Client 基于 Store 实现 EtcdLocker 基于 etcd 的选举实现
+type Locker interface {
+	// TryLock 只抢一次 被别人持有时返回 ErrLocked
+	// ctx 只控制抢锁的过程 抢到之后锁会一直保持 直到 Unlock 或者丢失
+	TryLock(ctx context.Context, key string) (Lock, error)
+	// Lock 抢不到锁时一直等 直到 ctx 过期
+	Lock(ctx context.Context, key string) (Lock, error)
+}
+
+type Lock interface {
+	Key() string
+	// Token fencing token 同一个 key 后抢到锁的人的 token 一定更大
+	// 下游的写操作可以用它拒绝过期的持有者
+	// 不同存储的 token 没有可比性 切换存储之后要按照 Fence 的 Source 区分
+	Token() int64
+	// Context 锁丢失或者释放之后被取消 context.Cause 是 ErrLockLost 或者 ErrUnlocked
+	// 里面带着 fencing token 可以用 TokenFromContext 取出来
+	Context() context.Context
+	// Held 锁还在不在
+	Held() bool
+	// Unlock 释放锁 可以多次调用
+	Unlock(ctx context.Context) error
+}
+
+// Store 锁的存储
+// 续约 丢锁通知这些由 Client 统一处理 Store 只需要实现最基本的操作
+type Store interface {
+	// Name 存储的名字 例如 redis mysql 用来区分 fencing token 的来源
+	Name() string
+	// Acquire 抢锁 被别人持有时返回 ErrLocked
+	// 成功时返回 fencing token 同一个 key 后抢到锁的人拿到的 token 一定更大
+	Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error)
+	// Refresh 续约 锁已经不属于 owner 时返回 ErrLockLost
+	Refresh(ctx context.Context, key string, owner string, ttl time.Duration) error
+	// Release 释放锁 锁已经不属于 owner 时什么也不做
+	Release(ctx context.Context, key string, owner string) error
+}
+
+// Fence fencing token 和生成它的存储
+// 只有 Source 相同的 token 才能比较大小
+// 例如 redis 是全局的计数器 mysql 是每个锁一个计数器 etcd 是全局的版本号
+type Fence struct {
+	Source string
+	Token  int64
+}
+
+type fenceKey struct{}
+
+// WithToken 把 fencing token 放到 ctx 里 下游的写操作可以用它拒绝过期的持有者
+func WithToken(ctx context.Context, source string, token int64) context.Context {
+	return context.WithValue(ctx, fenceKey{}, Fence{Source: source, Token: token})
+}
+
+// TokenFromContext 没有持有锁时返回 false
+func TokenFromContext(ctx context.Context) (int64, bool) {
+	fence, ok := FenceFromContext(ctx)
+	return fence.Token, ok
+}
+
+// FenceFromContext 没有持有锁时返回 false
+func FenceFromContext(ctx context.Context) (Fence, bool) {
+	fence, ok := ctx.Value(fenceKey{}).(Fence)
+	return fence, ok
+}
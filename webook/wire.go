@@ -5,7 +5,9 @@ package main
 import (
 	"github.com/Anwenya/GeekTime/webook/internal/events"
 	"github.com/Anwenya/GeekTime/webook/internal/events/article"
+	"github.com/Anwenya/GeekTime/webook/internal/events/ranking"
 	"github.com/Anwenya/GeekTime/webook/internal/ioc"
+	"github.com/Anwenya/GeekTime/webook/internal/job"
 	"github.com/Anwenya/GeekTime/webook/internal/repository"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
@@ -14,19 +16,33 @@ import (
 	itoken "github.com/Anwenya/GeekTime/webook/internal/web/token"
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
-	"github.com/robfig/cron/v3"
 )
 
 type App struct {
 	server    *gin.Engine
 	consumers []events.Consumer
-	cron      *cron.Cron
+	jobs      *job.Registry
 }
 
 var rankingServiceSet = wire.NewSet(
 	cache.NewRedisRankingCache,
 	repository.NewCachedRankingRepository,
 	service.NewBatchRankingService,
+	ioc.InitRankingListRepository,
+	ioc.InitRankingListService,
+	ioc.InitShardedRankingService,
+	dao.NewGORMRankingSnapshotDAO,
+	repository.NewDBRankingSnapshotRepository,
+	ioc.InitRankingSnapshotService,
+	ioc.InitShardedRankingJob,
+)
+
+var streamRankingSet = wire.NewSet(
+	ioc.InitStreamRankingConfig,
+	ioc.InitStreamRankingCache,
+	repository.NewCachedStreamRankingRepository,
+	service.NewStreamRankingService,
+	ranking.NewConsumer,
 )
 
 func InitWebServer() *App {
@@ -40,15 +56,40 @@ func InitWebServer() *App {
 		ioc.InitEtcd,
 		ioc.InitSaramaClient,
 		ioc.InitSyncProducer,
-		ioc.InitRlockClient,
+		ioc.InitLocker,
 
 		// dao
 		dao.NewGORMUserDAO,
 		dao.NewGORMArticleDAO,
 
 		rankingServiceSet,
-		ioc.InitRankingJob,
-		ioc.InitJobs,
+		streamRankingSet,
+		ioc.InitRankingConfig,
+		ioc.InitJobMetrics,
+
+		// 定时任务管理
+		ioc.InitJobDAO,
+		repository.NewPreemptJobRepository,
+		dao.NewGORMJobExecutionDAO,
+		repository.NewDBJobExecutionRepository,
+		dao.NewGORMJobNodeDAO,
+		repository.NewDBJobNodeRepository,
+		dao.NewGORMJobTaskDAO,
+		repository.NewDBJobTaskRepository,
+		service.NewJobNodeService,
+		service.NewJobAdminService,
+		service.NewCronJobService,
+		ioc.InitJobLoadBalancer,
+		ioc.InitJobSchedulerConfig,
+		job.NewScheduler,
+		ioc.InitJobRegistry,
+		ioc.InitJobHandler,
+		dao.NewGORMWorkflowDAO,
+		repository.NewDBWorkflowRepository,
+		service.NewWorkflowService,
+		service.NewWorkflowRunService,
+		job.NewWorkflowScheduler,
+		ioc.InitWorkflowHandler,
 
 		ioc.InitInteractiveClientV1,
 
@@ -72,10 +113,13 @@ func InitWebServer() *App {
 		service.NewCodeService,
 		service.NewUserService,
 		service.NewArticleService,
+		service.NewAnalyticsService,
 
 		// handler
 		web.NewUserHandler,
 		web.NewArticleHandler,
+		web.NewAnalyticsHandler,
+		web.NewRankingHandler,
 		web.NewOAuth2WechatHandler,
 		itoken.NewRedisTokenHandler,
 		ioc.InitGinMiddlewares,
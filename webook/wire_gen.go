@@ -9,7 +9,9 @@ package main
 import (
 	"github.com/Anwenya/GeekTime/webook/internal/events"
 	"github.com/Anwenya/GeekTime/webook/internal/events/article"
+	"github.com/Anwenya/GeekTime/webook/internal/events/ranking"
 	"github.com/Anwenya/GeekTime/webook/internal/ioc"
+	"github.com/Anwenya/GeekTime/webook/internal/job"
 	"github.com/Anwenya/GeekTime/webook/internal/repository"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/cache"
 	"github.com/Anwenya/GeekTime/webook/internal/repository/dao"
@@ -18,7 +20,6 @@ import (
 	"github.com/Anwenya/GeekTime/webook/internal/web/token"
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
-	"github.com/robfig/cron/v3"
 )
 
 import (
@@ -41,7 +42,7 @@ func InitWebServer() *App {
 	userService := service.NewUserService(userRepository)
 	codeCache := cache.NewRedisCodeCache(cmdable)
 	codeRepository := repository.NewCachedCodeRepository(codeCache)
-	smService := ioc.InitSMSService()
+	smService := ioc.InitSMSService(loggerV1)
 	codeService := service.NewCodeService(codeRepository, smService)
 	userHandler := web.NewUserHandler(userService, codeService, tokenHandler)
 	wechatService := ioc.InitWechatService(loggerV1)
@@ -56,18 +57,55 @@ func InitWebServer() *App {
 	clientv3Client := ioc.InitEtcd()
 	interactiveServiceClient := ioc.InitInteractiveClientV1(clientv3Client)
 	articleHandler := web.NewArticleHandler(loggerV1, articleService, interactiveServiceClient)
-	engine := ioc.InitWebServer(v, userHandler, oAuth2WechatHandler, articleHandler)
-	v2 := ioc.InitConsumers()
+	analyticsService := service.NewAnalyticsService(articleService, interactiveServiceClient)
+	analyticsHandler := web.NewAnalyticsHandler(analyticsService, loggerV1)
 	rankingCache := cache.NewRedisRankingCache(cmdable)
 	rankingRepository := repository.NewCachedRankingRepository(rankingCache)
-	rankingService := service.NewBatchRankingService(interactiveServiceClient, articleService, rankingRepository)
-	rlockClient := ioc.InitRlockClient(cmdable)
-	job := ioc.InitRankingJob(rankingService, rlockClient, loggerV1)
-	cron := ioc.InitJobs(loggerV1, job)
+	rankingConfig := ioc.InitRankingConfig()
+	rankingSnapshotDAO := dao.NewGORMRankingSnapshotDAO(db)
+	rankingSnapshotRepository := repository.NewDBRankingSnapshotRepository(rankingSnapshotDAO)
+	rankingSnapshotService := ioc.InitRankingSnapshotService(rankingSnapshotRepository, rankingConfig, loggerV1)
+	rankingService := service.NewBatchRankingService(interactiveServiceClient, articleService, rankingRepository, rankingSnapshotService, rankingConfig)
+	rankingListRepository := ioc.InitRankingListRepository(cmdable, rankingConfig)
+	rankingListService := ioc.InitRankingListService(articleService, interactiveServiceClient, rankingListRepository, rankingService, rankingSnapshotService, rankingConfig)
+	rankingHandler := web.NewRankingHandler(rankingListService, rankingSnapshotService)
+	jobDAO := ioc.InitJobDAO(db, cmdable)
+	cronJobRepository := repository.NewPreemptJobRepository(jobDAO)
+	jobExecutionDAO := dao.NewGORMJobExecutionDAO(db)
+	jobExecutionRepository := repository.NewDBJobExecutionRepository(jobExecutionDAO)
+	jobNodeDAO := dao.NewGORMJobNodeDAO(db)
+	jobNodeRepository := repository.NewDBJobNodeRepository(jobNodeDAO)
+	jobNodeService := service.NewJobNodeService(jobNodeRepository)
+	jobAdminService := service.NewJobAdminService(cronJobRepository, jobExecutionRepository, jobNodeService)
+	jobTaskDAO := dao.NewGORMJobTaskDAO(db)
+	jobTaskRepository := repository.NewDBJobTaskRepository(jobTaskDAO)
+	cronJobService := service.NewCronJobService(cronJobRepository, jobExecutionRepository, jobTaskRepository, jobNodeService, loggerV1)
+	metrics := ioc.InitJobMetrics()
+	loadBalancer := ioc.InitJobLoadBalancer(cmdable, metrics, loggerV1)
+	schedulerConfig := ioc.InitJobSchedulerConfig()
+	scheduler := job.NewScheduler(cronJobService, jobNodeService, loadBalancer, schedulerConfig, metrics, loggerV1)
+	workflowDAO := dao.NewGORMWorkflowDAO(db)
+	workflowRepository := repository.NewDBWorkflowRepository(workflowDAO)
+	workflowRunService := service.NewWorkflowRunService(workflowRepository, cronJobRepository, jobExecutionRepository, loggerV1)
+	workflowScheduler := job.NewWorkflowScheduler(workflowRunService, loggerV1)
+	locker := ioc.InitLocker(cmdable, db, clientv3Client)
+	streamRankingConfig := ioc.InitStreamRankingConfig()
+	streamRankingCache := ioc.InitStreamRankingCache(cmdable, streamRankingConfig)
+	streamRankingRepository := repository.NewCachedStreamRankingRepository(streamRankingCache)
+	incrementalRankingService := service.NewStreamRankingService(streamRankingRepository, rankingRepository, articleRepository, articleService, interactiveServiceClient, rankingSnapshotService, streamRankingConfig, loggerV1)
+	shardedRankingService := ioc.InitShardedRankingService(interactiveServiceClient, articleService, rankingRepository, cmdable, rankingSnapshotService, rankingConfig, loggerV1)
+	shardedRankingJob := ioc.InitShardedRankingJob(shardedRankingService, locker, rankingConfig, loggerV1)
+	registry := ioc.InitJobRegistry(loggerV1, jobAdminService, scheduler, workflowScheduler, clientv3Client, metrics, rankingService, streamRankingConfig, incrementalRankingService, rankingConfig, rankingListService, shardedRankingJob, rankingSnapshotService)
+	jobHandler := ioc.InitJobHandler(jobAdminService, registry)
+	workflowService := service.NewWorkflowService(workflowRepository, cronJobRepository)
+	workflowHandler := ioc.InitWorkflowHandler(workflowService)
+	engine := ioc.InitWebServer(v, userHandler, oAuth2WechatHandler, articleHandler, analyticsHandler, rankingHandler, jobHandler, workflowHandler)
+	consumer := ranking.NewConsumer(client, incrementalRankingService, loggerV1)
+	v2 := ioc.InitConsumers(streamRankingConfig, consumer)
 	app := &App{
 		server:    engine,
 		consumers: v2,
-		cron:      cron,
+		jobs:      registry,
 	}
 	return app
 }
@@ -77,7 +115,9 @@ func InitWebServer() *App {
 type App struct {
 	server    *gin.Engine
 	consumers []events.Consumer
-	cron      *cron.Cron
+	jobs      *job.Registry
 }
 
-var rankingServiceSet = wire.NewSet(cache.NewRedisRankingCache, repository.NewCachedRankingRepository, service.NewBatchRankingService)
+var rankingServiceSet = wire.NewSet(cache.NewRedisRankingCache, repository.NewCachedRankingRepository, service.NewBatchRankingService, ioc.InitRankingListRepository, ioc.InitRankingListService, ioc.InitShardedRankingService, dao.NewGORMRankingSnapshotDAO, repository.NewDBRankingSnapshotRepository, ioc.InitRankingSnapshotService, ioc.InitShardedRankingJob)
+
+var streamRankingSet = wire.NewSet(ioc.InitStreamRankingConfig, ioc.InitStreamRankingCache, repository.NewCachedStreamRankingRepository, service.NewStreamRankingService, ranking.NewConsumer)